@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Actioner is implemented by backends that support custom ASCOM actions
+// (invoked through the Action and CommandString methods).
+type Actioner interface {
+	// Actions returns the names of the supported actions.
+	Actions() []string
+
+	// Action runs the named action. id is the backend-local switch the
+	// action targets, or -1 when no switch was specified. params holds any
+	// remaining parameters.
+	Action(name string, id int, params string) (string, error)
+}
+
+// ActionWriter is implemented by Actioners some of whose actions change
+// device state. Such actions are refused in maintenance mode like switch
+// writes; actions of backends without it are taken to be read-only.
+type ActionWriter interface {
+	// ActionWrites reports whether the named action changes device state
+	// when run on backend-local switch id (-1 when none was specified).
+	ActionWrites(name string, id int) bool
+}
+
+// Actions returns the names of all custom actions supported by any backend,
+// plus the built-in testswitch, sorted and de-duplicated.
+func (r *Router) Actions() []string {
+	seen := map[string]bool{ActionTestSwitch: true}
+	names := []string{ActionTestSwitch}
+	for _, b := range r.backends {
+		a, ok := b.(Actioner)
+		if !ok {
+			continue
+		}
+		for _, name := range a.Actions() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Action runs a custom action. If params starts with a global switch ID the
+// action is sent to that switch's backend; otherwise it goes to the single
+// backend supporting it.
+func (r *Router) Action(name, params string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == ActionTestSwitch {
+		return r.testSwitch(params)
+	}
+	a, id, localID, rest, err := r.actionTarget(name, params)
+	if err != nil {
+		return "", err
+	}
+	result, err := a.Action(name, localID, rest)
+	if id >= 0 {
+		ref, _ := r.ref(id)
+		err = r.wrapErr(id, ref, err)
+	}
+	return result, err
+}
+
+// ActionWrites reports whether running action name with params changes
+// device state: testswitch always does, a backend action when its backend
+// says so (ActionWriter). An action that cannot be resolved reports false;
+// Action then fails it.
+func (r *Router) ActionWrites(name, params string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == ActionTestSwitch {
+		return true
+	}
+	a, _, localID, _, err := r.actionTarget(name, params)
+	if err != nil {
+		return false
+	}
+	w, ok := a.(ActionWriter)
+	return ok && w.ActionWrites(name, localID)
+}
+
+// actionTarget resolves the backend that runs action name: the backend of
+// the switch whose global ID starts params, else the single backend
+// supporting it. id is that global ID (-1 if none) and localID its
+// backend-local ID; rest is params without the ID.
+func (r *Router) actionTarget(name, params string) (a Actioner, id, localID int, rest string, err error) {
+	fields := strings.Fields(params)
+	if len(fields) > 0 {
+		if id, err := strconv.Atoi(fields[0]); err == nil {
+			ref, ok := r.ref(id)
+			if !ok {
+				return nil, 0, 0, "", errInvalidID(id)
+			}
+			a, ok := ref.backend.(Actioner)
+			if !ok || !supportsAction(a, name) {
+				return nil, 0, 0, "", fmt.Errorf("%w: action %q is not supported by switch %d", ErrActionNotImplemented, name, id)
+			}
+			rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(params), fields[0]))
+			return a, id, ref.localID, rest, nil
+		}
+	}
+
+	var target Actioner
+	for _, b := range r.backends {
+		if a, ok := b.(Actioner); ok && supportsAction(a, name) {
+			if target != nil {
+				return nil, 0, 0, "", fmt.Errorf("action %q is supported by several backends; pass a switch ID as the first parameter", name)
+			}
+			target = a
+		}
+	}
+	if target == nil {
+		return nil, 0, 0, "", fmt.Errorf("%w: %q", ErrActionNotImplemented, name)
+	}
+	return target, -1, -1, strings.TrimSpace(params), nil
+}
+
+func supportsAction(a Actioner, name string) bool {
+	for _, n := range a.Actions() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,254 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Aggregation modes selectable with AggregateConfig.Mode.
+const (
+	// AggregateAny is on while at least one member is on (the default).
+	AggregateAny = "any"
+	// AggregateAll is on while every member is on.
+	AggregateAll = "all"
+	// AggregateCount reports how many members are on, from 0 to the
+	// number of members.
+	AggregateCount = "count"
+	// AggregateSum reports the total of the members' values, e.g. the
+	// combined wattage of several Mi plugs, from 0 to Max.
+	AggregateSum = "sum"
+)
+
+// AggregateConfig defines a virtual read-only switch whose value is derived
+// from a group of member switches, e.g. "anything powered?" over every
+// power outlet.
+type AggregateConfig struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Members are the names of the switches the aggregate is computed over.
+	Members []string `json:"members"`
+	// Mode is AggregateAny, AggregateAll, AggregateCount or AggregateSum.
+	Mode string `json:"mode,omitempty"`
+	// Max is the top of an AggregateSum switch's range; totals above it
+	// read as Max. Zero means the sum of the members' maximums.
+	Max float64 `json:"max,omitempty"`
+}
+
+// aggregates serves the configured aggregate switches. Values are computed
+// from the members' cached values on every read; nothing is ever written
+// to hardware.
+type aggregates struct {
+	router *Router
+
+	mu   sync.RWMutex
+	cfgs []AggregateConfig
+}
+
+func newAggregates(r *Router, cfgs []AggregateConfig) *aggregates {
+	a := &aggregates{router: r, cfgs: make([]AggregateConfig, len(cfgs))}
+	for i, cfg := range cfgs {
+		switch cfg.Mode {
+		case "":
+			cfg.Mode = AggregateAny
+		case AggregateAny, AggregateAll, AggregateCount, AggregateSum:
+		default:
+			log.Printf("Warning: aggregate switch %q: mode must be %q, %q, %q or %q, got %q; using %q",
+				cfg.Name, AggregateAny, AggregateAll, AggregateCount, AggregateSum, cfg.Mode, AggregateAny)
+			cfg.Mode = AggregateAny
+		}
+		if cfg.Max != 0 && (cfg.Mode != AggregateSum || cfg.Max < 0) {
+			log.Printf("Warning: aggregate switch %q: max must be positive and only applies to mode %q; ignoring it",
+				cfg.Name, AggregateSum)
+			cfg.Max = 0
+		}
+		a.cfgs[i] = cfg
+	}
+	return a
+}
+
+func (a *aggregates) get(id int) (AggregateConfig, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if id < 0 || id >= len(a.cfgs) {
+		return AggregateConfig{}, false
+	}
+	return a.cfgs[id], true
+}
+
+// Configs returns the aggregate definitions, including runtime renames.
+func (a *aggregates) Configs() []AggregateConfig {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]AggregateConfig(nil), a.cfgs...)
+}
+
+// members resolves member names to switches, matching names
+// case-insensitively across visible and hidden switches. Aggregates cannot
+// be members of other aggregates.
+func (a *aggregates) members(cfg AggregateConfig) []switchRef {
+	t := a.router.tbl()
+	var out []switchRef
+	for _, refs := range [][]switchRef{t.index, t.hidden} {
+		for _, ref := range refs {
+			if ref.backend == SwitchBackend(a) {
+				continue
+			}
+			if _, ok := ref.backend.(unassigned); ok {
+				continue
+			}
+			name := ref.backend.GetName(ref.localID)
+			for _, m := range cfg.Members {
+				if strings.EqualFold(name, m) {
+					out = append(out, ref)
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+// checkMembers warns about aggregate members that match no switch.
+func (a *aggregates) checkMembers() {
+	for _, cfg := range a.Configs() {
+		found := make(map[string]bool)
+		for _, ref := range a.members(cfg) {
+			found[strings.ToLower(ref.backend.GetName(ref.localID))] = true
+		}
+		for _, m := range cfg.Members {
+			if !found[strings.ToLower(m)] {
+				log.Printf("Warning: aggregate switch %q: member %q matches no switch", cfg.Name, m)
+			}
+		}
+	}
+}
+
+func (a *aggregates) NumSwitches() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.cfgs)
+}
+
+func (a *aggregates) GetName(id int) string {
+	cfg, _ := a.get(id)
+	return cfg.Name
+}
+
+func (a *aggregates) SetName(id int, name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if id < 0 || id >= len(a.cfgs) {
+		return fmt.Errorf("invalid aggregate switch id %d", id)
+	}
+	a.cfgs[id].Name = name
+	return nil
+}
+
+func (a *aggregates) GetDescription(id int) string {
+	cfg, _ := a.get(id)
+	if cfg.Description != "" {
+		return cfg.Description
+	}
+	members := strings.Join(cfg.Members, ", ")
+	switch cfg.Mode {
+	case AggregateAll:
+		return "On when all of " + members + " are on"
+	case AggregateCount:
+		return "Number of " + members + " that are on"
+	case AggregateSum:
+		return "Total of " + members
+	}
+	return "On when any of " + members + " is on"
+}
+
+func (a *aggregates) GetCanWrite(int) bool { return false }
+func (a *aggregates) GetMin(int) float64   { return 0 }
+func (a *aggregates) GetStep(int) float64  { return 1 }
+
+func (a *aggregates) GetMax(id int) float64 {
+	cfg, _ := a.get(id)
+	switch cfg.Mode {
+	case AggregateCount:
+		return float64(len(cfg.Members))
+	case AggregateSum:
+		return a.sumMax(cfg)
+	}
+	return 1
+}
+
+// sumMax is the top of an AggregateSum switch's range: the configured Max,
+// or else the sum of the members' maximums.
+func (a *aggregates) sumMax(cfg AggregateConfig) float64 {
+	if cfg.Max > 0 {
+		return cfg.Max
+	}
+	total := 0.0
+	for _, ref := range a.members(cfg) {
+		total += ref.backend.GetMax(ref.localID)
+	}
+	return total
+}
+
+func (a *aggregates) GetSwitch(id int) (bool, error) {
+	value, err := a.GetSwitchValue(id)
+	return value > 0, err
+}
+
+// GetSwitchValue computes the aggregate from the members' cached values.
+// A member whose value cannot be read counts as off, or as 0 in a sum.
+func (a *aggregates) GetSwitchValue(id int) (float64, error) {
+	cfg, ok := a.get(id)
+	if !ok {
+		return 0, fmt.Errorf("invalid aggregate switch id %d", id)
+	}
+	refs := a.members(cfg)
+	if cfg.Mode == AggregateSum {
+		total := 0.0
+		for _, ref := range refs {
+			if value, err := ref.backend.GetSwitchValue(ref.localID); err == nil {
+				total += value
+			}
+		}
+		return min(total, a.sumMax(cfg)), nil
+	}
+	on := 0
+	for _, ref := range refs {
+		value, err := ref.backend.GetSwitchValue(ref.localID)
+		if err == nil && value > ref.backend.GetMin(ref.localID) {
+			on++
+		}
+	}
+	switch cfg.Mode {
+	case AggregateCount:
+		return float64(on), nil
+	case AggregateAll:
+		if len(refs) > 0 && on == len(refs) {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	if on > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (a *aggregates) SetSwitch(int, bool) error         { return errAggregateReadOnly }
+func (a *aggregates) SetSwitchValue(int, float64) error { return errAggregateReadOnly }
+func (a *aggregates) Connect() error                    { return nil }
+func (a *aggregates) Disconnect()                       {}
+func (a *aggregates) IsConnected() bool                 { return true }
+func (a *aggregates) BackendType() string               { return "aggregate" }
+
+var errAggregateReadOnly = fmt.Errorf("%w: aggregate switches are read-only", ErrInvalidOperation)
+
+// Aggregates returns the aggregate switch definitions, including runtime
+// renames.
+func (r *Router) Aggregates() []AggregateConfig {
+	if r.aggregates == nil {
+		return nil
+	}
+	return r.aggregates.Configs()
+}
@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAggregateModes(t *testing.T) {
+	fake := newFakeSwitches(1, 0, 1)
+	fake.max = 5
+	members := []string{"fake 0", "FAKE 1", "fake 2"}
+	r := NewRouter([]SwitchBackend{fake}, Options{Aggregates: []AggregateConfig{
+		{Name: "any", Members: members},
+		{Name: "all", Members: members, Mode: AggregateAll},
+		{Name: "count", Members: members, Mode: AggregateCount},
+		{Name: "sum", Members: members, Mode: AggregateSum, Max: 4},
+	}})
+	if n := r.NumSwitches(); n != 7 {
+		t.Fatalf("NumSwitches = %d, want 3 members and 4 aggregates", n)
+	}
+
+	check := func(state string, want []float64) {
+		t.Helper()
+		for i, w := range want {
+			if v, err := r.GetSwitchValue(3 + i); err != nil || v != w {
+				t.Errorf("%s: %s = %v, %v; want %v", state, r.GetName(3+i), v, err, w)
+			}
+		}
+	}
+	// any, all, count, sum (capped at Max 4)
+	check("two on", []float64{1, 0, 2, 2})
+	fake.values[1] = 5
+	check("all on", []float64{1, 1, 3, 4})
+	fake.values = []float64{0, 0, 0}
+	check("all off", []float64{0, 0, 0, 0})
+
+	if max := r.GetMax(5); max != 3 {
+		t.Errorf("count GetMax = %v, want the number of members", max)
+	}
+	if r.GetCanWrite(3) {
+		t.Error("aggregate switch reports CanWrite")
+	}
+	if err := r.SetSwitch(3, true); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("SetSwitch on an aggregate = %v, want ErrInvalidOperation", err)
+	}
+	if fake.writes != 0 {
+		t.Errorf("%d writes reached members, want none", fake.writes)
+	}
+}
+
+func TestAggregateUnknownMode(t *testing.T) {
+	buf := captureLog(t)
+	r := NewRouter([]SwitchBackend{newFakeSwitches(1, 0)}, Options{Aggregates: []AggregateConfig{
+		{Name: "agg", Members: []string{"fake 0", "nosuch"}, Mode: "most"},
+	}})
+	if v, _ := r.GetSwitchValue(2); v != 1 {
+		t.Errorf("aggregate with unknown mode = %v, want any-on 1", v)
+	}
+	for _, want := range []string{`mode must be`, `member "nosuch" matches no switch`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log lacks %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+// A sum aggregate totals its members' wattage readings; without a
+// configured max its range is the sum of the members' maximums.
+func TestAggregateSum(t *testing.T) {
+	plugs := newNamedSwitches("mi", "Mount W", "Heater W", "PC W")
+	plugs.max = 1000
+	plugs.values = []float64{12.5, 230, 65}
+	r := NewRouter([]SwitchBackend{plugs}, Options{Aggregates: []AggregateConfig{
+		{Name: "Total W", Members: []string{"mount w", "heater w", "pc w"}, Mode: AggregateSum},
+		{Name: "Heater+PC W", Members: []string{"Heater W", "PC W"}, Mode: AggregateSum, Max: 250},
+	}})
+	if v, err := r.GetSwitchValue(3); err != nil || v != 307.5 {
+		t.Errorf("total = %v, %v; want 307.5", v, err)
+	}
+	if min, max := r.GetMin(3), r.GetMax(3); min != 0 || max != 3000 {
+		t.Errorf("total range = %v-%v, want 0-3000", min, max)
+	}
+	if v, _ := r.GetSwitchValue(4); v != 250 {
+		t.Errorf("capped total = %v, want the configured max 250", v)
+	}
+
+	plugs.mu.Lock()
+	plugs.values[1] = 0
+	plugs.mu.Unlock()
+	if v, _ := r.GetSwitchValue(3); v != 77.5 {
+		t.Errorf("total after the heater turned off = %v, want 77.5", v)
+	}
+}
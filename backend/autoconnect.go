@@ -0,0 +1,30 @@
+package backend
+
+import (
+	"log"
+	"sync"
+)
+
+// autoConnect connects ref's backend before its first switch operation when
+// Options.AutoConnect is set and the backend is not connected yet. Each
+// backend is auto-connected at most once, so a client that disconnects
+// explicitly stays disconnected; concurrent first operations wait for the
+// same Connect.
+func (r *Router) autoConnect(ref switchRef) {
+	if !r.opts.AutoConnect || ref.backend.IsConnected() {
+		return
+	}
+	r.autoMu.Lock()
+	once, ok := r.autoOnce[ref.backend]
+	if !ok {
+		once = new(sync.Once)
+		r.autoOnce[ref.backend] = once
+	}
+	r.autoMu.Unlock()
+	once.Do(func() {
+		log.Printf("Auto-connecting %s backend on first use", typeName(ref.backend))
+		if err := ref.backend.Connect(); err != nil {
+			log.Printf("Warning: auto-connecting %s backend: %v", typeName(ref.backend), err)
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package backend
+
+import "testing"
+
+func TestAutoConnect(t *testing.T) {
+	fake := newFakeSwitches(0)
+	fake.connected = false
+	r := NewRouter([]SwitchBackend{fake}, Options{AutoConnect: true})
+	if err := r.SetSwitch(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if !fake.IsConnected() {
+		t.Error("backend not connected by the first operation with auto_connect")
+	}
+
+	// Only the first use connects; an explicit disconnect is respected.
+	fake.Disconnect()
+	r.GetSwitch(0)
+	if fake.IsConnected() {
+		t.Error("backend reconnected after an explicit disconnect")
+	}
+}
+
+func TestNoAutoConnectByDefault(t *testing.T) {
+	fake := newFakeSwitches(0)
+	fake.connected = false
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+	r.SetSwitch(0, true)
+	r.GetSwitch(0)
+	if fake.IsConnected() {
+		t.Error("backend connected by an operation without auto_connect")
+	}
+}
@@ -1,6 +1,12 @@
 package backend
 
-import "fmt"
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // SwitchBackend is the interface all hardware backends must implement.
 // Each backend manages one or more named switches (0-based local IDs).
@@ -41,7 +47,8 @@ type SwitchBackend interface {
 	// SetSwitchValue sets the numeric value of switch id.
 	SetSwitchValue(id int, value float64) error
 
-	// Connect initialises the backend and connects to hardware.
+	// Connect initialises the backend and connects to hardware. It blocks
+	// until the initial state query has finished.
 	Connect() error
 
 	// Disconnect tears down the hardware connection.
@@ -51,52 +58,530 @@ type SwitchBackend interface {
 	IsConnected() bool
 }
 
+// Poller is implemented by backends whose switches can be refreshed from
+// hardware in the background. The Router's refresh scheduler reads each
+// switch at its PollInterval and commits the result with SetCachedValue.
+type Poller interface {
+	// PollInterval returns how often switch id should be refreshed.
+	// Zero means the switch is never polled automatically.
+	PollInterval(id int) time.Duration
+
+	// PollSwitchValue reads the live value of switch id from hardware
+	// without touching the cached state.
+	PollSwitchValue(id int) (float64, error)
+
+	// SetCachedValue stores a freshly polled value for switch id.
+	SetCachedValue(id int, value float64)
+}
+
+// LiveReader is implemented by backends whose GetSwitch queries hardware
+// rather than returning cached state. Only live reads count as hardware
+// contact for the circuit breaker and last-contact tracking.
+type LiveReader interface {
+	ReadsLive() bool
+}
+
+// CacheFallback is implemented by live-reading backends that can be
+// configured to answer GetSwitch from their cached value, with a logged
+// warning, when the live query fails. The failure still counts against the
+// circuit breaker.
+type CacheFallback interface {
+	FallsBackToCache() bool
+}
+
+// CountNotifier is implemented by backends whose number of switches can
+// change at runtime, e.g. a hub that gains or loses entities. The Router
+// registers fn and re-indexes its switches whenever it is called.
+type CountNotifier interface {
+	OnSwitchCountChange(fn func())
+}
+
+// HealthReporter is implemented by backends that can be degraded without
+// being disconnected, e.g. when state can no longer be persisted.
+type HealthReporter interface {
+	// Health returns nil when healthy, or an error describing the problem.
+	Health() error
+}
+
+// Stamped is implemented by backends that record when each switch's value
+// was last confirmed by hardware, including reads made while connecting.
+// A zero time means the value is still the one restored from config.
+type Stamped interface {
+	LastUpdated(id int) time.Time
+}
+
+// Invalidator is implemented by Stamped backends so Router.Invalidate can
+// clear the hardware stamp of a switch whose cached value was invalidated.
+type Invalidator interface {
+	InvalidateCache(id int)
+}
+
+// Typed is implemented by backends that report a short type name
+// (e.g. "mi", "hikvision") for use in logs and error messages.
+type Typed interface {
+	BackendType() string
+}
+
+// OptionsProvider is implemented by backends that carry per-switch
+// SwitchOptions in their device configs.
+type OptionsProvider interface {
+	// SwitchOptions returns the options configured for switch id.
+	SwitchOptions(id int) SwitchOptions
+}
+
+// SwitchOptions holds per-switch settings shared by all backends. Backend
+// device configs embed it so the fields sit alongside the device's own.
+type SwitchOptions struct {
+	// PollSeconds overrides the backend's default refresh interval.
+	// Nil uses the backend default; 0 disables polling for this switch.
+	PollSeconds *int `json:"poll_seconds,omitempty"`
+
+	// Debounce commits a polled change only once the same value has been
+	// read on two consecutive polls, suppressing transient flaps.
+	Debounce bool `json:"debounce,omitempty"`
+
+	// StateNames labels the switch's discrete values, e.g. ["off", "low",
+	// "high"] for Min 0, Max 2, Step 1. StateNames[i] names Min + i*Step.
+	StateNames []string `json:"state_names,omitempty"`
+
+	// OffOnShutdown turns the switch off when the driver shuts down
+	// gracefully (SIGINT/SIGTERM), e.g. so mount power is not left on.
+	OffOnShutdown bool `json:"off_on_shutdown,omitempty"`
+
+	// InitialState is the value the switch is set to the first time the
+	// driver connects, e.g. to power up a dew heater. Nil leaves it as is.
+	InitialState *float64 `json:"initial_state,omitempty"`
+
+	// OnlineSwitch adds a read-only "<name> online" switch reporting whether
+	// the driver's last hardware operation on this switch succeeded.
+	OnlineSwitch bool `json:"online_switch,omitempty"`
+
+	// PresentAs "percent" exposes the switch to clients as 0-100, step 1 or
+	// coarser, translating to and from the native Min-Max range.
+	PresentAs string `json:"present_as,omitempty"`
+
+	// RequireConfirm rejects writes that move the switch into ConfirmState
+	// unless the client passes Confirm=true, guarding critical equipment
+	// such as a mount or PC against accidental power-off.
+	RequireConfirm bool `json:"require_confirm,omitempty"`
+
+	// ConfirmState is the state that needs confirmation: ConfirmOff
+	// (default), ConfirmOn or ConfirmAny.
+	ConfirmState string `json:"confirm_state,omitempty"`
+
+	// KeepaliveSeconds makes the switch a dead-man's switch: turning it on
+	// starts a timer that turns it off again after this many seconds unless
+	// the client calls KeepAlive (or writes on again) first. Zero disables.
+	KeepaliveSeconds int `json:"keepalive_seconds,omitempty"`
+
+	// SettleMs is how long the device takes to physically switch after a
+	// write is acknowledged, e.g. a slow relay. Writes return only once it
+	// has passed; reads meanwhile report the state being left. Zero
+	// disables.
+	SettleMs int `json:"settle_ms,omitempty"`
+
+	// Deadband, in the switch's native units, suppresses chatter on value
+	// switches: SetSwitchValue skips writes and polling ignores readings
+	// that differ from the current value by less than this. Zero disables.
+	Deadband float64 `json:"deadband,omitempty"`
+
+	// ConfirmWrite reads the switch back after every write and re-sends the
+	// write while the device does not report the commanded value, up to
+	// ConfirmWriteRetries times (nil: 2), waiting ConfirmWriteDelayMs (nil:
+	// 500) before each read. A write that never confirms fails.
+	ConfirmWrite        bool `json:"confirm_write,omitempty"`
+	ConfirmWriteRetries *int `json:"confirm_write_retries,omitempty"`
+	ConfirmWriteDelayMs *int `json:"confirm_write_delay_ms,omitempty"`
+}
+
+// PollInterval resolves the refresh interval for a switch, falling back to
+// defaultSeconds when no per-switch override is configured.
+func (o SwitchOptions) PollInterval(defaultSeconds int) time.Duration {
+	seconds := defaultSeconds
+	if o.PollSeconds != nil {
+		seconds = *o.PollSeconds
+	}
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// ChangeFunc is called with the global switch ID and old/new values (as
+// presented to clients) whenever the Router observes a switch value change.
+type ChangeFunc func(id int, oldValue, newValue float64)
+
+// Options holds Router-wide settings.
+type Options struct {
+	// BreakerFailures is the number of consecutive hardware failures after
+	// which a switch's circuit breaker opens. Zero disables the breaker.
+	BreakerFailures int
+
+	// BreakerCooldown is how long an open breaker short-circuits operations
+	// before letting a probe through.
+	BreakerCooldown time.Duration
+
+	// BooleanValueMode selects how SetSwitchValue handles values other than
+	// Min/Max on on/off switches: BooleanRound (default) or BooleanReject.
+	BooleanValueMode string
+
+	// HideReadOnly leaves read-only switches out of the switch index, so
+	// ASCOM clients only see actuators. Hidden switches are still listed by
+	// HiddenSwitches for diagnostics.
+	HideReadOnly bool
+
+	// IDMapFile, if set, persists which global ID each switch has so that
+	// editing the config does not renumber existing switches.
+	IDMapFile string
+
+	// AutoConnect connects a backend on the first switch operation that
+	// needs it, so clients need not PUT connected first.
+	AutoConnect bool
+
+	// Aggregates defines virtual read-only switches derived from groups of
+	// other switches. They follow every backend's switches and are never
+	// hidden by HideReadOnly.
+	Aggregates []AggregateConfig
+
+	// Order lists switches, by name or "<type>:<name>", that take the
+	// first global IDs in the given order; unlisted switches follow in
+	// backend-then-local order. With IDMapFile, IDs already saved win.
+	Order []string
+
+	// Faults, if set, injects latency and errors into switch reads and
+	// writes for client testing (see FaultInjection).
+	Faults *FaultInjection
+}
+
 // Router maps flat global switch IDs to the correct backend and local ID.
 type Router struct {
 	backends []SwitchBackend
-	// index[globalID] = {backendIdx, localID}
+	opts     Options
+	// table holds the switch index; it is replaced atomically when a
+	// CountNotifier backend gains or loses switches.
+	table     atomic.Pointer[switchTable]
+	reindexMu sync.Mutex
+
+	pollMu   sync.Mutex
+	pollStop chan struct{}
+
+	listenersMu sync.RWMutex
+	listeners   []ChangeFunc
+
+	// idMapMu guards idMap, the persisted key→global ID assignments
+	// (Options.IDMapFile).
+	idMapMu sync.Mutex
+	idMap   map[string]int
+
+	// clampMu guards clampLogged, the last out-of-range reading logged per
+	// switch, so a persistent anomaly is reported once.
+	clampMu     sync.Mutex
+	clampLogged map[int]float64
+
+	// aggregates serves Options.Aggregates; nil if none are configured.
+	aggregates *aggregates
+
+	// autoMu guards autoOnce, which runs each backend's Options.AutoConnect
+	// Connect at most once.
+	autoMu   sync.Mutex
+	autoOnce map[SwitchBackend]*sync.Once
+
+	// renamedMu guards renamed, the switches renamed through SetName, whose
+	// names are shown without their backend's name prefix.
+	renamedMu sync.Mutex
+	renamed   map[switchRef]bool
+
+	// keepaliveMu guards keepalives, the armed dead-man timers of switches
+	// with keepalive_seconds, and keepalivesStopped, set once they are
+	// stopped for good (StopKeepalives).
+	keepaliveMu       sync.Mutex
+	keepalives        map[switchRef]*keepalive
+	keepalivesStopped bool
+
+	// writeGuard, if set, vetoes writes the Router makes on its own, such
+	// as keep-alive expiry (SetWriteGuard).
+	writeGuard atomic.Pointer[func() error]
+
+	// settleMu guards settling, the switches inside the settle window of
+	// their last write (settle_ms).
+	settleMu sync.Mutex
+	settling map[switchRef]*settle
+}
+
+// switchTable is an immutable snapshot of the switch index together with
+// the per-switch state that follows each switch across a re-index.
+type switchTable struct {
+	// index[globalID] = {backend, localID}
 	index []switchRef
+	// hidden lists read-only switches left out of index (Options.HideReadOnly)
+	hidden []switchRef
+	// breakers[globalID] guards hardware access for each switch
+	breakers []*breaker
+	// lastContact[globalID] is the UnixNano time of the last successful
+	// hardware operation on each switch (0 = never)
+	lastContact []*atomic.Int64
+	// failing[globalID] is set while the last hardware operation on each
+	// switch failed
+	failing []*atomic.Bool
+	// invalid[globalID] is set while each switch's cached value has been
+	// invalidated and must be read live on the next access
+	invalid []*atomic.Bool
 }
 
 type switchRef struct {
-	backend  SwitchBackend
-	localID  int
+	backend SwitchBackend
+	localID int
 }
 
 // NewRouter builds a Router from an ordered list of backends.
-func NewRouter(backends []SwitchBackend) *Router {
-	r := &Router{backends: backends}
+func NewRouter(backends []SwitchBackend, opts Options) *Router {
+	r := &Router{backends: backends, opts: opts, clampLogged: make(map[int]float64), autoOnce: make(map[SwitchBackend]*sync.Once)}
+	if len(opts.Aggregates) > 0 {
+		r.aggregates = newAggregates(r, opts.Aggregates)
+	}
+	r.table.Store(r.buildTable(nil))
 	for _, b := range backends {
-		for localID := 0; localID < b.NumSwitches(); localID++ {
-			r.index = append(r.index, switchRef{backend: b, localID: localID})
+		if n, ok := b.(CountNotifier); ok {
+			n.OnSwitchCountChange(r.reindex)
 		}
 	}
+	r.checkStateNames()
+	r.checkPresentAs()
+	r.checkOrder()
+	r.checkConfirmStates()
+	r.checkSettleTimes()
+	r.checkDeadbands()
+	r.checkConfirmWrites()
+	if r.aggregates != nil {
+		r.aggregates.checkMembers()
+	}
 	return r
 }
 
+// tbl returns the current switch table.
+func (r *Router) tbl() *switchTable { return r.table.Load() }
+
+// buildTable enumerates every backend's switches, then the aggregate and
+// online switches, into a new table, reordered by Options.Order. Switches already in old keep their
+// breaker, last-contact and failure state.
+func (r *Router) buildTable(old *switchTable) *switchTable {
+	t := &switchTable{}
+	for _, b := range r.backends {
+		for localID := 0; localID < b.NumSwitches(); localID++ {
+			if r.opts.HideReadOnly && !b.GetCanWrite(localID) {
+				t.hidden = append(t.hidden, switchRef{backend: b, localID: localID})
+				continue
+			}
+			t.index = append(t.index, switchRef{backend: b, localID: localID})
+		}
+	}
+	if r.aggregates != nil {
+		for localID := 0; localID < r.aggregates.NumSwitches(); localID++ {
+			t.index = append(t.index, switchRef{backend: r.aggregates, localID: localID})
+		}
+	}
+	online := &onlineSwitches{router: r}
+	for _, ref := range t.index {
+		if r.options(ref).OnlineSwitch {
+			online.targets = append(online.targets, ref)
+		}
+	}
+	for localID := range online.targets {
+		t.index = append(t.index, switchRef{backend: online, localID: localID})
+	}
+	if len(r.opts.Order) > 0 {
+		t.index = r.orderIndex(t.index)
+	}
+	if r.opts.IDMapFile != "" {
+		t.index = r.stableIndex(t.index)
+	}
+	prev := make(map[switchRef]int)
+	if old != nil {
+		for id, ref := range old.index {
+			prev[ref] = id
+		}
+	}
+	for _, ref := range t.index {
+		if id, ok := prev[ref]; ok {
+			t.breakers = append(t.breakers, old.breakers[id])
+			t.lastContact = append(t.lastContact, old.lastContact[id])
+			t.failing = append(t.failing, old.failing[id])
+			t.invalid = append(t.invalid, old.invalid[id])
+			continue
+		}
+		t.breakers = append(t.breakers, &breaker{})
+		t.lastContact = append(t.lastContact, new(atomic.Int64))
+		t.failing = append(t.failing, new(atomic.Bool))
+		t.invalid = append(t.invalid, new(atomic.Bool))
+	}
+	return t
+}
+
+// reindex rebuilds the switch table after a backend's switch count changed,
+// restarting polling if it was running. Operations already in flight finish
+// against the switch they resolved; later calls see the new IDs.
+func (r *Router) reindex() {
+	r.reindexMu.Lock()
+	defer r.reindexMu.Unlock()
+	old := r.tbl()
+	t := r.buildTable(old)
+	r.table.Store(t)
+	log.Printf("Switch count changed: %d -> %d", len(old.index), len(t.index))
+	// Switches may have moved to other IDs.
+	r.clampMu.Lock()
+	r.clampLogged = make(map[int]float64)
+	r.clampMu.Unlock()
+
+	r.pollMu.Lock()
+	polling := r.pollStop != nil
+	r.pollMu.Unlock()
+	if polling {
+		r.StopPolling()
+		r.StartPolling()
+	}
+}
+
+// LastContact returns when switch id last completed a hardware operation
+// successfully, or the zero time if it never has.
+func (r *Router) LastContact(id int) time.Time {
+	t := r.tbl()
+	if id < 0 || id >= len(t.lastContact) {
+		return time.Time{}
+	}
+	if ns := t.lastContact[id].Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// LastUpdated returns when the value of switch id was last confirmed by
+// hardware: the later of the backend's own stamp (if it is Stamped) and the
+// Router's last successful operation. The zero time means the value has
+// only been restored from config and is unverified (stale).
+func (r *Router) LastUpdated(id int) time.Time {
+	t := r.LastContact(id)
+	if ref, ok := r.ref(id); ok {
+		if st, ok := ref.backend.(Stamped); ok {
+			if u := st.LastUpdated(ref.localID); u.After(t) {
+				t = u
+			}
+		}
+	}
+	return t
+}
+
 // NumSwitches returns the total number of switches across all backends.
-func (r *Router) NumSwitches() int { return len(r.index) }
+func (r *Router) NumSwitches() int { return len(r.tbl().index) }
 
 // Backends returns all registered backends.
 func (r *Router) Backends() []SwitchBackend { return r.backends }
 
+// ActiveBackends returns the backends that contribute at least one switch.
+func (r *Router) ActiveBackends() []SwitchBackend {
+	var out []SwitchBackend
+	for _, b := range r.backends {
+		if b.NumSwitches() > 0 {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Warnings returns a description of every degraded condition reported by
+// the backends, e.g. "mi: state file not writable: ...". Empty means healthy.
+func (r *Router) Warnings() []string {
+	var out []string
+	for _, b := range r.backends {
+		if h, ok := b.(HealthReporter); ok {
+			if err := h.Health(); err != nil {
+				out = append(out, fmt.Sprintf("%s: %v", typeName(b), err))
+			}
+		}
+	}
+	return out
+}
+
+// OnChange registers fn to be called on every observed switch value change.
+func (r *Router) OnChange(fn ChangeFunc) {
+	r.listenersMu.Lock()
+	r.listeners = append(r.listeners, fn)
+	r.listenersMu.Unlock()
+}
+
+func (r *Router) notifyChange(id int, oldValue, newValue float64) {
+	if oldValue == newValue {
+		return
+	}
+	if ref, ok := r.ref(id); ok && r.percent(ref) {
+		oldValue, newValue = toPercent(ref, oldValue), toPercent(ref, newValue)
+	}
+	r.listenersMu.RLock()
+	defer r.listenersMu.RUnlock()
+	for _, fn := range r.listeners {
+		fn(id, oldValue, newValue)
+	}
+}
+
+// options returns the SwitchOptions for ref, or the zero value if its
+// backend does not provide any.
+func (r *Router) options(ref switchRef) SwitchOptions {
+	if p, ok := ref.backend.(OptionsProvider); ok {
+		return p.SwitchOptions(ref.localID)
+	}
+	return SwitchOptions{}
+}
+
+// wrapErr prefixes err with the switch's global ID, backend type and name
+// so client-facing errors identify the failing device, e.g.
+// "switch 4 [hikvision 'Garage']: connection refused".
+func (r *Router) wrapErr(id int, ref switchRef, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("switch %d [%s '%s']: %w", id, typeName(ref.backend), ref.backend.GetName(ref.localID), err)
+}
+
+// typeName returns b's BackendType, or "backend" if it does not report one.
+func typeName(b SwitchBackend) string {
+	if t, ok := b.(Typed); ok {
+		return t.BackendType()
+	}
+	return "backend"
+}
+
+// BackendType returns the type name of the backend owning switch id.
+func (r *Router) BackendType(id int) string {
+	if ref, ok := r.ref(id); ok {
+		return typeName(ref.backend)
+	}
+	return ""
+}
+
 func (r *Router) ref(globalID int) (switchRef, bool) {
-	if globalID < 0 || globalID >= len(r.index) {
+	t := r.tbl()
+	if globalID < 0 || globalID >= len(t.index) {
 		return switchRef{}, false
 	}
-	return r.index[globalID], true
+	return t.index[globalID], true
 }
 
+// GetName returns the name of switch id as shown to clients, including its
+// backend's name prefix; see displayName.
 func (r *Router) GetName(id int) string {
 	if ref, ok := r.ref(id); ok {
-		return ref.backend.GetName(ref.localID)
+		return r.displayName(ref)
 	}
 	return ""
 }
 
 func (r *Router) SetName(id int, name string) error {
 	if ref, ok := r.ref(id); ok {
-		return ref.backend.SetName(ref.localID, name)
+		if err := ref.backend.SetName(ref.localID, name); err != nil {
+			return r.wrapErr(id, ref, err)
+		}
+		r.markRenamed(ref)
+		r.renameStableID(id)
+		return nil
 	}
 	return errInvalidID(id)
 }
@@ -117,6 +602,9 @@ func (r *Router) GetCanWrite(id int) bool {
 
 func (r *Router) GetMin(id int) float64 {
 	if ref, ok := r.ref(id); ok {
+		if r.percent(ref) {
+			return 0
+		}
 		return ref.backend.GetMin(ref.localID)
 	}
 	return 0
@@ -124,6 +612,9 @@ func (r *Router) GetMin(id int) float64 {
 
 func (r *Router) GetMax(id int) float64 {
 	if ref, ok := r.ref(id); ok {
+		if r.percent(ref) {
+			return 100
+		}
 		return ref.backend.GetMax(ref.localID)
 	}
 	return 1
@@ -131,39 +622,191 @@ func (r *Router) GetMax(id int) float64 {
 
 func (r *Router) GetStep(id int) float64 {
 	if ref, ok := r.ref(id); ok {
+		if r.percent(ref) {
+			return percentStep(ref)
+		}
 		return ref.backend.GetStep(ref.localID)
 	}
 	return 1
 }
 
+// GetSwitch returns the state of switch id. While the switch's breaker is
+// open the cached value is reported instead of querying hardware, and while
+// it is settling after a write, the state it is leaving.
 func (r *Router) GetSwitch(id int) (bool, error) {
 	if ref, ok := r.ref(id); ok {
-		return ref.backend.GetSwitch(ref.localID)
+		if err := r.injectFault(id, FaultRead); err != nil {
+			return false, r.wrapErr(id, ref, err)
+		}
+		r.autoConnect(ref)
+		if from, ok := r.settlingFrom(ref); ok {
+			return from > ref.backend.GetMin(ref.localID), nil
+		}
+		if r.breakerOpen(id) {
+			value, err := ref.backend.GetSwitchValue(ref.localID)
+			return value > ref.backend.GetMin(ref.localID), r.wrapErr(id, ref, err)
+		}
+		live := false
+		if lr, ok := ref.backend.(LiveReader); ok && lr.ReadsLive() {
+			live = true
+		} else if err := r.refreshInvalid(id, ref); err != nil {
+			return false, r.wrapErr(id, ref, err)
+		}
+		state, err := ref.backend.GetSwitch(ref.localID)
+		if live {
+			r.recordResult(id, err)
+			if err == nil {
+				r.validated(id)
+			}
+		}
+		if err != nil {
+			if cf, ok := ref.backend.(CacheFallback); ok && cf.FallsBackToCache() {
+				if value, cerr := ref.backend.GetSwitchValue(ref.localID); cerr == nil {
+					log.Printf("Warning: %v; reporting cached value %v", r.wrapErr(id, ref, err), value)
+					return value > ref.backend.GetMin(ref.localID), nil
+				}
+			}
+		}
+		return state, r.wrapErr(id, ref, err)
 	}
 	return false, errInvalidID(id)
 }
 
 func (r *Router) GetSwitchValue(id int) (float64, error) {
 	if ref, ok := r.ref(id); ok {
-		return ref.backend.GetSwitchValue(ref.localID)
+		if err := r.injectFault(id, FaultRead); err != nil {
+			return 0, r.wrapErr(id, ref, err)
+		}
+		r.autoConnect(ref)
+		if err := r.refreshInvalid(id, ref); err != nil {
+			return 0, r.wrapErr(id, ref, err)
+		}
+		value, err := ref.backend.GetSwitchValue(ref.localID)
+		if from, ok := r.settlingFrom(ref); ok {
+			value, err = from, nil
+		}
+		if err == nil {
+			value = r.clamp(id, ref, value)
+			if r.percent(ref) {
+				value = toPercent(ref, value)
+			}
+		}
+		return value, r.wrapErr(id, ref, err)
 	}
 	return 0, errInvalidID(id)
 }
 
+// CachedSwitchValue returns switch id's value as GetSwitchValue presents
+// it, from the backend's cache alone: it never connects a backend,
+// refreshes an invalidated value or injects faults, so a bulk read of every
+// switch makes no hardware round trips.
+func (r *Router) CachedSwitchValue(id int) (float64, error) {
+	ref, ok := r.ref(id)
+	if !ok {
+		return 0, errInvalidID(id)
+	}
+	value, err := ref.backend.GetSwitchValue(ref.localID)
+	if from, ok := r.settlingFrom(ref); ok {
+		value, err = from, nil
+	}
+	if err != nil {
+		return 0, r.wrapErr(id, ref, err)
+	}
+	value = r.clamp(id, ref, value)
+	if r.percent(ref) {
+		value = toPercent(ref, value)
+	}
+	return value, nil
+}
+
 func (r *Router) SetSwitch(id int, state bool) error {
 	if ref, ok := r.ref(id); ok {
-		return ref.backend.SetSwitch(ref.localID, state)
+		if err := r.injectFault(id, FaultWrite); err != nil {
+			return r.wrapErr(id, ref, err)
+		}
+		r.autoConnect(ref)
+		if err := r.breakerErr(id); err != nil {
+			return r.wrapErr(id, ref, err)
+		}
+		old, _ := ref.backend.GetSwitchValue(ref.localID)
+		target := ref.backend.GetMin(ref.localID)
+		if state {
+			target = ref.backend.GetMax(ref.localID)
+		}
+		if r.redundantWrite(id, ref, old, target) {
+			r.keepaliveWritten(id, ref, target)
+			return nil
+		}
+		err := ref.backend.SetSwitch(ref.localID, state)
+		r.recordResult(id, err)
+		if err != nil {
+			return r.wrapErr(id, ref, err)
+		}
+		r.settleWrite(id, ref, old, target)
+		if err := r.confirmWrite(id, ref, target, func() error { return ref.backend.SetSwitch(ref.localID, state) }); err != nil {
+			return r.wrapErr(id, ref, err)
+		}
+		r.keepaliveWritten(id, ref, target)
+		if v, err := ref.backend.GetSwitchValue(ref.localID); err == nil {
+			r.notifyChange(id, old, v)
+		}
+		return nil
 	}
 	return errInvalidID(id)
 }
 
 func (r *Router) SetSwitchValue(id int, value float64) error {
 	if ref, ok := r.ref(id); ok {
-		return ref.backend.SetSwitchValue(ref.localID, value)
+		if err := r.injectFault(id, FaultWrite); err != nil {
+			return r.wrapErr(id, ref, err)
+		}
+		if r.percent(ref) {
+			native, err := fromPercent(ref, value)
+			if err != nil {
+				return r.wrapErr(id, ref, err)
+			}
+			value = native
+		}
+		return r.setNativeValue(id, ref, value)
 	}
 	return errInvalidID(id)
 }
 
+// setNativeValue writes value, in the switch's native units whatever its
+// present_as, to switch id.
+func (r *Router) setNativeValue(id int, ref switchRef, value float64) error {
+	r.autoConnect(ref)
+	value, err := r.normalizeValue(ref, value)
+	if err != nil {
+		return r.wrapErr(id, ref, err)
+	}
+	if err := r.breakerErr(id); err != nil {
+		return r.wrapErr(id, ref, err)
+	}
+	old, _ := ref.backend.GetSwitchValue(ref.localID)
+	if r.redundantWrite(id, ref, old, value) {
+		r.keepaliveWritten(id, ref, value)
+		return nil
+	}
+	if r.deadbandWrite(id, ref, old, value) {
+		return nil
+	}
+	err = ref.backend.SetSwitchValue(ref.localID, value)
+	r.recordResult(id, err)
+	if err != nil {
+		return r.wrapErr(id, ref, err)
+	}
+	r.settleWrite(id, ref, old, value)
+	if err := r.confirmWrite(id, ref, value, func() error { return ref.backend.SetSwitchValue(ref.localID, value) }); err != nil {
+		return r.wrapErr(id, ref, err)
+	}
+	r.keepaliveWritten(id, ref, value)
+	if v, err := ref.backend.GetSwitchValue(ref.localID); err == nil {
+		r.notifyChange(id, old, v)
+	}
+	return nil
+}
+
 func errInvalidID(id int) error {
 	return fmt.Errorf("switch ID %d is out of range", id)
 }
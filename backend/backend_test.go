@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+)
+
+// Backend errors name the global switch, its backend and its name, and
+// still match the underlying error.
+func TestErrorsNameTheSwitch(t *testing.T) {
+	boom := errors.New("device unreachable")
+	failing := newFakeSwitches(0)
+	failing.err = boom
+	r := NewRouter([]SwitchBackend{newFakeSwitches(0), failing}, Options{})
+
+	err := r.SetSwitch(1, true)
+	if err == nil {
+		t.Fatal("SetSwitch succeeded on a failing backend")
+	}
+	if want := "switch 1 [backend 'fake 0']: device unreachable"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+	if !errors.Is(err, boom) {
+		t.Errorf("error %v does not wrap the backend's error", err)
+	}
+	if _, err := r.GetSwitchValue(1); err == nil || !errors.Is(err, boom) {
+		t.Errorf("GetSwitchValue error = %v", err)
+	}
+	if err := r.SetSwitch(0, true); err != nil {
+		t.Errorf("SetSwitch on the healthy backend: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// breaker is a per-switch circuit breaker. After Options.BreakerFailures
+// consecutive hardware failures it opens for Options.BreakerCooldown, during
+// which reads are served from cache and writes fail fast. Once the cooldown
+// expires the next operation is let through as a probe: success closes the
+// breaker, failure re-opens it.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	// failingSince is when failures first reached the threshold; it is
+	// cleared by the next success.
+	failingSince time.Time
+}
+
+// BreakerStatus describes a switch's circuit breaker for diagnostics.
+type BreakerStatus struct {
+	State     string    `json:"state"` // closed | open | half-open
+	Failures  int       `json:"failures"`
+	OpenUntil time.Time `json:"open_until,omitempty"`
+}
+
+func (r *Router) breakerEnabled() bool { return r.opts.BreakerFailures > 0 }
+
+// breakerOpen reports whether operations on switch id should be short-circuited.
+func (r *Router) breakerOpen(id int) bool {
+	t := r.tbl()
+	if !r.breakerEnabled() || id < 0 || id >= len(t.breakers) {
+		return false
+	}
+	b := t.breakers[id]
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Now().Before(b.openUntil)
+}
+
+// breakerErr returns a fast-fail error while switch id's breaker is open.
+func (r *Router) breakerErr(id int) error {
+	if !r.breakerOpen(id) {
+		return nil
+	}
+	t := r.tbl()
+	if id >= len(t.breakers) {
+		return nil
+	}
+	b := t.breakers[id]
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return fmt.Errorf("device unavailable after %d consecutive failures, retrying in %s",
+		b.failures, time.Until(b.openUntil).Round(time.Second))
+}
+
+// recordResult records the outcome of a hardware operation on switch id:
+// successes update its last-contact time, and both set its failing flag
+// and feed its breaker.
+// Validation errors do not count as hardware failures.
+func (r *Router) recordResult(id int, err error) {
+	t := r.tbl()
+	if err == nil && id >= 0 && id < len(t.lastContact) {
+		t.lastContact[id].Store(time.Now().UnixNano())
+	}
+	if errors.Is(err, ErrInvalidValue) || errors.Is(err, ErrInvalidOperation) {
+		return
+	}
+	if id >= 0 && id < len(t.failing) {
+		t.failing[id].Store(err != nil)
+	}
+	if !r.breakerEnabled() || id < 0 || id >= len(t.breakers) {
+		return
+	}
+	b := t.breakers[id]
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if b.failures >= r.opts.BreakerFailures {
+			log.Printf("[breaker] switch %d recovered", id)
+		}
+		b.failures = 0
+		b.openUntil = time.Time{}
+		b.failingSince = time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= r.opts.BreakerFailures {
+		if b.failingSince.IsZero() {
+			b.failingSince = time.Now()
+		}
+		b.openUntil = time.Now().Add(r.opts.BreakerCooldown)
+		log.Printf("[breaker] switch %d open for %v after %d consecutive failures", id, r.opts.BreakerCooldown, b.failures)
+	}
+}
+
+// BreakerStatus reports the circuit breaker state of switch id.
+func (r *Router) BreakerStatus(id int) BreakerStatus {
+	t := r.tbl()
+	if !r.breakerEnabled() || id < 0 || id >= len(t.breakers) {
+		return BreakerStatus{State: "closed"}
+	}
+	b := t.breakers[id]
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := BreakerStatus{State: "closed", Failures: b.failures}
+	switch {
+	case time.Now().Before(b.openUntil):
+		st.State = "open"
+		st.OpenUntil = b.openUntil
+	case b.failures >= r.opts.BreakerFailures:
+		st.State = "half-open"
+	}
+	return st
+}
+
+// UnreachableSince reports since when every switch of backend b has had its
+// breaker tripped (open or half-open), i.e. the backend as a whole appears
+// unreachable. It returns the zero time if any switch is healthy, the
+// breaker is disabled, or b has no switches.
+func (r *Router) UnreachableSince(b SwitchBackend) time.Time {
+	if !r.breakerEnabled() {
+		return time.Time{}
+	}
+	var since time.Time
+	found := false
+	t := r.tbl()
+	for id, ref := range t.index {
+		if ref.backend != b {
+			continue
+		}
+		found = true
+		br := t.breakers[id]
+		br.mu.Lock()
+		t := br.failingSince
+		br.mu.Unlock()
+		if t.IsZero() {
+			return time.Time{}
+		}
+		if t.After(since) {
+			since = t
+		}
+	}
+	if !found {
+		return time.Time{}
+	}
+	return since
+}
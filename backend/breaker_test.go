@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Consecutive failures open the breaker, which then fails fast without
+// touching the device until the cooldown lets a probe through.
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	fake := newFakeSwitches(0)
+	fake.err = errors.New("timeout")
+	r := NewRouter([]SwitchBackend{fake}, Options{BreakerFailures: 2, BreakerCooldown: 100 * time.Millisecond})
+
+	for i := 0; i < 2; i++ {
+		if err := r.SetSwitch(0, true); err == nil {
+			t.Fatal("SetSwitch succeeded on a failing device")
+		}
+	}
+	if st := r.BreakerStatus(0); st.State != "open" || st.Failures != 2 {
+		t.Fatalf("breaker %+v after 2 failures, want open", st)
+	}
+
+	err := r.SetSwitch(0, true)
+	if err == nil || !strings.Contains(err.Error(), "consecutive failures") {
+		t.Errorf("SetSwitch with the breaker open = %v, want a fast failure", err)
+	}
+	if fake.writes != 2 {
+		t.Errorf("%d writes reached the device, want 2 (none while open)", fake.writes)
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	if st := r.BreakerStatus(0); st.State != "half-open" {
+		t.Errorf("breaker %+v after the cooldown, want half-open", st)
+	}
+	fake.mu.Lock()
+	fake.err = nil
+	fake.mu.Unlock()
+	if err := r.SetSwitch(0, true); err != nil {
+		t.Fatalf("probe after the cooldown: %v", err)
+	}
+	if st := r.BreakerStatus(0); st.State != "closed" || st.Failures != 0 {
+		t.Errorf("breaker %+v after a successful probe, want closed", st)
+	}
+}
+
+// Invalid values are the client's fault and do not count as failures.
+func TestBreakerIgnoresValidationErrors(t *testing.T) {
+	fake := newFakeSwitches(0)
+	fake.err = fmt.Errorf("%w: 5 is out of range", ErrInvalidValue)
+	r := NewRouter([]SwitchBackend{fake}, Options{BreakerFailures: 1, BreakerCooldown: time.Minute})
+	for i := 0; i < 3; i++ {
+		if err := r.SetSwitchValue(0, 5); !errors.Is(err, ErrInvalidValue) {
+			t.Fatalf("SetSwitchValue(5) = %v, want ErrInvalidValue", err)
+		}
+	}
+	if st := r.BreakerStatus(0); st.State != "closed" {
+		t.Errorf("breaker %+v after invalid values, want closed", st)
+	}
+}
@@ -0,0 +1,37 @@
+package backend
+
+import "log"
+
+// Clamping is implemented by backends that can be configured to pin values
+// read from hardware to the switch's [Min, Max] range.
+type Clamping interface {
+	ClampsValues() bool
+}
+
+// clamp pins value to switch id's range when its backend has clamping
+// enabled, logging each new out-of-range reading once.
+func (r *Router) clamp(id int, ref switchRef, value float64) float64 {
+	c, ok := ref.backend.(Clamping)
+	if !ok || !c.ClampsValues() {
+		return value
+	}
+	lo, hi := ref.backend.GetMin(ref.localID), ref.backend.GetMax(ref.localID)
+	clamped := value
+	switch {
+	case value < lo:
+		clamped = lo
+	case value > hi:
+		clamped = hi
+	default:
+		return value
+	}
+	r.clampMu.Lock()
+	last, seen := r.clampLogged[id]
+	r.clampLogged[id] = value
+	r.clampMu.Unlock()
+	if !seen || last != value {
+		log.Printf("Warning: switch %d (%s) read %v, outside its range %v-%v; reporting %v",
+			id, ref.backend.GetName(ref.localID), value, lo, hi, clamped)
+	}
+	return clamped
+}
@@ -0,0 +1,44 @@
+package backend
+
+import (
+	"strings"
+	"testing"
+)
+
+// clampingFake is a fake backend with clamp_values set.
+type clampingFake struct{ *fakeSwitches }
+
+func (clampingFake) ClampsValues() bool { return true }
+
+func TestClampOutOfRangeReads(t *testing.T) {
+	buf := captureLog(t)
+	fake := newFakeSwitches(5, -2, 1)
+	r := NewRouter([]SwitchBackend{clampingFake{fake}}, Options{})
+
+	for id, want := range []float64{1, 0, 1} {
+		if v, err := r.GetSwitchValue(id); err != nil || v != want {
+			t.Errorf("GetSwitchValue(%d) = %v, %v; want %v", id, v, err, want)
+		}
+	}
+	r.GetSwitchValue(0)
+	if n := strings.Count(buf.String(), "switch 0 (fake 0) read 5, outside its range 0-1; reporting 1"); n != 1 {
+		t.Errorf("out-of-range read logged %d times, want once:\n%s", n, buf.String())
+	}
+	if strings.Contains(buf.String(), "switch 2") {
+		t.Errorf("in-range read logged:\n%s", buf.String())
+	}
+
+	// A different out-of-range reading is logged again.
+	fake.mu.Lock()
+	fake.values[0] = 7
+	fake.mu.Unlock()
+	r.GetSwitchValue(0)
+	if !strings.Contains(buf.String(), "read 7") {
+		t.Errorf("new out-of-range reading not logged:\n%s", buf.String())
+	}
+
+	// Without clamp_values the raw reading passes through.
+	if v, _ := NewRouter([]SwitchBackend{fake}, Options{}).GetSwitchValue(0); v != 7 {
+		t.Errorf("GetSwitchValue without clamping = %v, want 7", v)
+	}
+}
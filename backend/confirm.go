@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+)
+
+// Dangerous states selectable with SwitchOptions.ConfirmState.
+const (
+	// ConfirmOff guards writes that turn the switch off (the default).
+	ConfirmOff = "off"
+	// ConfirmOn guards writes that turn the switch on or above Min.
+	ConfirmOn = "on"
+	// ConfirmAny guards every write.
+	ConfirmAny = "any"
+)
+
+// CheckConfirm returns an InvalidOperation error if writing value (as
+// presented to clients) to switch id moves it into the dangerous state of
+// a require_confirm switch and the client did not pass confirmed.
+func (r *Router) CheckConfirm(id int, value float64, confirmed bool) error {
+	ref, ok := r.ref(id)
+	if !ok || confirmed {
+		return nil
+	}
+	opts := r.options(ref)
+	if !opts.RequireConfirm {
+		return nil
+	}
+	// A value within half a step of Min is rounded to Min, i.e. off.
+	off := value < r.GetMin(id)+r.GetStep(id)/2
+	dangerous := false
+	switch opts.ConfirmState {
+	case ConfirmOn:
+		dangerous = !off
+	case ConfirmAny:
+		dangerous = true
+	default:
+		dangerous = off
+	}
+	if !dangerous {
+		return nil
+	}
+	return r.wrapErr(id, ref, fmt.Errorf("%w: writing %v requires confirmation; repeat the request with Confirm=true", ErrInvalidOperation, value))
+}
+
+// checkConfirmStates warns about unknown confirm_state values, which guard
+// the off state.
+func (r *Router) checkConfirmStates() {
+	for id, ref := range r.tbl().index {
+		switch state := r.options(ref).ConfirmState; state {
+		case "", ConfirmOff, ConfirmOn, ConfirmAny:
+		default:
+			log.Printf("Warning: switch %d (%s) has unknown confirm_state %q; confirming %q",
+				id, ref.backend.GetName(ref.localID), state, ConfirmOff)
+		}
+	}
+}
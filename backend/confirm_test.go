@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckConfirm(t *testing.T) {
+	for _, tc := range []struct {
+		state     string
+		value     float64
+		confirmed bool
+		rejected  bool
+	}{
+		{"", 0, false, true}, // off is guarded by default
+		{"", 1, false, false},
+		{"", 0, true, false},
+		{ConfirmOff, 0.4, false, true}, // rounds to off
+		{ConfirmOn, 1, false, true},
+		{ConfirmOn, 0, false, false},
+		{ConfirmOn, 1, true, false},
+		{ConfirmAny, 0, false, true},
+		{ConfirmAny, 1, false, true},
+		{ConfirmAny, 1, true, false},
+	} {
+		fake := newFakeSwitches(1)
+		fake.opts[0] = SwitchOptions{RequireConfirm: true, ConfirmState: tc.state}
+		r := NewRouter([]SwitchBackend{fake}, Options{})
+		err := r.CheckConfirm(0, tc.value, tc.confirmed)
+		if tc.rejected != errors.Is(err, ErrInvalidOperation) || (!tc.rejected && err != nil) {
+			t.Errorf("confirm_state %q, value %v, confirmed %v: %v; want rejected %v",
+				tc.state, tc.value, tc.confirmed, err, tc.rejected)
+		}
+	}
+
+	// Switches without require_confirm are never guarded.
+	r := NewRouter([]SwitchBackend{newFakeSwitches(1)}, Options{})
+	if err := r.CheckConfirm(0, 0, false); err != nil {
+		t.Errorf("CheckConfirm without require_confirm = %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// Defaults for SwitchOptions.ConfirmWrite.
+const (
+	defaultConfirmRetries = 2
+	defaultConfirmDelay   = 500 * time.Millisecond
+)
+
+// liveValue returns a function reading switch ref's value from hardware, or
+// nil if its backend only has a cache: Pollers are polled, LiveReaders'
+// GetSwitch is mapped to Min or Max.
+func liveValue(ref switchRef) func() (float64, error) {
+	if p, ok := ref.backend.(Poller); ok {
+		return func() (float64, error) { return p.PollSwitchValue(ref.localID) }
+	}
+	if lr, ok := ref.backend.(LiveReader); ok && lr.ReadsLive() {
+		return func() (float64, error) {
+			on, err := ref.backend.GetSwitch(ref.localID)
+			if on {
+				return ref.backend.GetMax(ref.localID), err
+			}
+			return ref.backend.GetMin(ref.localID), err
+		}
+	}
+	return nil
+}
+
+// confirmWrite, for switches with confirm_write, reads switch id back after
+// value (native) was written and, while the device does not report it,
+// re-sends the write with write, up to confirm_write_retries times. If the
+// switch never reaches value, the value it does report is cached and an
+// error returned, so a missed command on critical equipment is not mistaken
+// for success.
+func (r *Router) confirmWrite(id int, ref switchRef, value float64, write func() error) error {
+	opts := r.options(ref)
+	if !opts.ConfirmWrite {
+		return nil
+	}
+	read := liveValue(ref)
+	if read == nil {
+		return nil // warned about by checkConfirmWrites
+	}
+	retries := defaultConfirmRetries
+	if opts.ConfirmWriteRetries != nil {
+		retries = max(*opts.ConfirmWriteRetries, 0)
+	}
+	delay := defaultConfirmDelay
+	if opts.ConfirmWriteDelayMs != nil {
+		delay = time.Duration(max(*opts.ConfirmWriteDelayMs, 0)) * time.Millisecond
+	}
+	tolerance := ref.backend.GetStep(ref.localID) / 2
+	name := ref.backend.GetName(ref.localID)
+
+	for attempt := 0; ; attempt++ {
+		time.Sleep(delay)
+		got, err := read()
+		r.recordResult(id, err)
+		if err == nil && math.Abs(got-value) <= tolerance {
+			if attempt > 0 {
+				log.Printf("Switch %d (%s) confirmed at %v after %d re-sent write(s)", id, name, value, attempt)
+			}
+			return nil
+		}
+		if attempt == retries {
+			if err != nil {
+				return fmt.Errorf("write of %v not confirmed: reading it back failed: %w", value, err)
+			}
+			if p, ok := ref.backend.(Poller); ok {
+				p.SetCachedValue(ref.localID, got)
+			}
+			return fmt.Errorf("write of %v not confirmed: the device still reports %v after %d attempt(s)", value, got, attempt+1)
+		}
+		if err != nil {
+			log.Printf("Warning: switch %d (%s): reading back %v failed: %v; re-sending (retry %d of %d)", id, name, value, err, attempt+1, retries)
+		} else {
+			log.Printf("Warning: switch %d (%s) reports %v after writing %v; re-sending (retry %d of %d)", id, name, got, value, attempt+1, retries)
+		}
+		if err := write(); err != nil {
+			r.recordResult(id, err)
+			return err
+		}
+	}
+}
+
+// checkConfirmWrites warns about confirm_write on switches whose backend
+// cannot read them back, for which it has no effect.
+func (r *Router) checkConfirmWrites() {
+	for id, ref := range r.tbl().index {
+		if r.options(ref).ConfirmWrite && liveValue(ref) == nil {
+			log.Printf("Warning: switch %d (%s) has confirm_write, but its backend cannot read it back; writes are not confirmed",
+				id, ref.backend.GetName(ref.localID))
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package backend
+
+import "testing"
+
+// confirmFake returns a router over one confirm_write switch whose device
+// ignores the first ignore writes.
+func confirmFake(ignore, retries int) (*Router, *fakeSwitches) {
+	fake := newFakeSwitches(0)
+	fake.live = []float64{0}
+	fake.ignore = ignore
+	delay := 0
+	fake.opts[0].ConfirmWrite = true
+	fake.opts[0].ConfirmWriteRetries = &retries
+	fake.opts[0].ConfirmWriteDelayMs = &delay
+	return NewRouter([]SwitchBackend{fake}, Options{}), fake
+}
+
+// A write the device missed is re-sent until it reads back as written.
+func TestConfirmWriteRetries(t *testing.T) {
+	r, fake := confirmFake(1, 2)
+	if err := r.SetSwitch(0, true); err != nil {
+		t.Fatalf("SetSwitch: %v", err)
+	}
+	fake.mu.Lock()
+	writes, live := fake.writes, fake.live[0]
+	fake.mu.Unlock()
+	if writes != 2 || live != 1 {
+		t.Errorf("%d writes, device at %v; want 2 writes, device at 1", writes, live)
+	}
+}
+
+// A write that never reads back fails and caches what the device reports.
+func TestConfirmWriteGivesUp(t *testing.T) {
+	r, fake := confirmFake(5, 2)
+	if err := r.SetSwitch(0, true); err == nil {
+		t.Fatal("SetSwitch succeeded although the device never switched")
+	}
+	fake.mu.Lock()
+	writes := fake.writes
+	fake.mu.Unlock()
+	if writes != 3 {
+		t.Errorf("%d writes, want 3 (the write and 2 retries)", writes)
+	}
+	if v := fake.value(0); v != 0 {
+		t.Errorf("cached value = %v, want the device's 0", v)
+	}
+}
+
+// Without confirm_write a missed write is not noticed or re-sent.
+func TestConfirmWriteOff(t *testing.T) {
+	r, fake := confirmFake(1, 2)
+	fake.opts[0].ConfirmWrite = false
+	if err := r.SetSwitch(0, true); err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	writes := fake.writes
+	fake.mu.Unlock()
+	if writes != 1 {
+		t.Errorf("%d writes, want 1", writes)
+	}
+}
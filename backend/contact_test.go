@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// LastContact advances on every successful write and stays put on failures.
+func TestLastContact(t *testing.T) {
+	fake := newFakeSwitches(0)
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+	if c := r.LastContact(0); !c.IsZero() {
+		t.Fatalf("LastContact before any operation = %v, want zero", c)
+	}
+
+	if err := r.SetSwitch(0, true); err != nil {
+		t.Fatal(err)
+	}
+	first := r.LastContact(0)
+	if first.IsZero() {
+		t.Fatal("LastContact still zero after a successful write")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	fake.mu.Lock()
+	fake.err = errors.New("timeout")
+	fake.mu.Unlock()
+	if err := r.SetSwitch(0, false); err == nil {
+		t.Fatal("SetSwitch succeeded on a failing device")
+	}
+	if c := r.LastContact(0); !c.Equal(first) {
+		t.Errorf("LastContact = %v after a failure, want it left at %v", c, first)
+	}
+
+	fake.mu.Lock()
+	fake.err = nil
+	fake.mu.Unlock()
+	if err := r.SetSwitch(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if c := r.LastContact(0); !c.After(first) {
+		t.Errorf("LastContact = %v after another success, want later than %v", c, first)
+	}
+	if c := r.LastContact(5); !c.IsZero() {
+		t.Errorf("LastContact(5) = %v for an unknown switch, want zero", c)
+	}
+}
@@ -0,0 +1,39 @@
+package backend
+
+import (
+	"log"
+	"math"
+)
+
+// inDeadband reports whether value is within switch ref's deadband of
+// current, i.e. too small a change to act on. Min and Max never are, so the
+// switch can always be turned fully off or on, and is seen to be.
+func (r *Router) inDeadband(ref switchRef, current, value float64) bool {
+	deadband := r.options(ref).Deadband
+	if deadband <= 0 || math.Abs(value-current) >= deadband {
+		return false
+	}
+	return value != ref.backend.GetMin(ref.localID) && value != ref.backend.GetMax(ref.localID)
+}
+
+// deadbandWrite reports whether writing value to switch id can be skipped
+// because it is within the switch's deadband of the current value. As with
+// redundant writes, a value only restored from config is never trusted.
+func (r *Router) deadbandWrite(id int, ref switchRef, current, value float64) bool {
+	if current == value || !r.inDeadband(ref, current, value) || r.LastUpdated(id).IsZero() {
+		return false
+	}
+	log.Printf("Switch %d (%s): %v is within deadband %v of %v; skipping write",
+		id, ref.backend.GetName(ref.localID), value, r.options(ref).Deadband, current)
+	return true
+}
+
+// checkDeadbands warns about negative deadband values, which are ignored.
+func (r *Router) checkDeadbands() {
+	for id, ref := range r.tbl().index {
+		if d := r.options(ref).Deadband; d < 0 {
+			log.Printf("Warning: switch %d (%s) has negative deadband %v; ignoring it",
+				id, ref.backend.GetName(ref.localID), d)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Writes within the deadband of the current value are skipped; larger ones,
+// and writes of Min or Max, go through.
+func TestDeadbandWrites(t *testing.T) {
+	fake := newFakeSwitches(50)
+	fake.max = 100
+	fake.opts[0].Deadband = 5
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+
+	for _, tc := range []struct {
+		value  float64
+		writes int
+		cached float64
+	}{
+		{60, 1, 60}, // first write: the restored value isn't trusted
+		{62, 1, 60},
+		{57, 1, 60},
+		{70, 2, 70},
+		{98, 3, 98},
+		{100, 4, 100}, // Max is always written
+	} {
+		if err := r.SetSwitchValue(0, tc.value); err != nil {
+			t.Fatal(err)
+		}
+		fake.mu.Lock()
+		writes := fake.writes
+		fake.mu.Unlock()
+		if writes != tc.writes || fake.value(0) != tc.cached {
+			t.Errorf("after writing %v: %d writes, value %v; want %d, %v", tc.value, writes, fake.value(0), tc.writes, tc.cached)
+		}
+	}
+}
+
+// Polled readings within the deadband neither update the cache nor fire a
+// change event.
+func TestDeadbandPolling(t *testing.T) {
+	fake := newFakeSwitches(50)
+	fake.max = 100
+	fake.opts[0].Deadband = 5
+	fake.live = []float64{52}
+	fake.interval = []time.Duration{10 * time.Millisecond}
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+	var mu sync.Mutex
+	var changes []string
+	r.OnChange(func(id int, old, value float64) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, fmt.Sprintf("%v->%v", old, value))
+	})
+	r.StartPolling()
+	defer r.StopPolling()
+
+	time.Sleep(50 * time.Millisecond)
+	if v := fake.value(0); v != 50 {
+		t.Errorf("cached value %v after a reading within the deadband, want 50", v)
+	}
+	fake.mu.Lock()
+	fake.live[0] = 58
+	fake.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"50->58"}; !slices.Equal(changes, want) {
+		t.Errorf("changes = %q, want %q", changes, want)
+	}
+}
@@ -0,0 +1,14 @@
+package backend
+
+import "strings"
+
+// ExpandDescription fills a description_template such as "{name} on {host}"
+// from fields, keyed by placeholder name without braces. Unknown
+// placeholders are left as they are.
+func ExpandDescription(template string, fields map[string]string) string {
+	pairs := make([]string, 0, 2*len(fields))
+	for k, v := range fields {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
@@ -0,0 +1,18 @@
+package backend
+
+import "testing"
+
+func TestExpandDescription(t *testing.T) {
+	fields := map[string]string{"name": "Dew heater", "host": "10.0.0.5"}
+	for template, want := range map[string]string{
+		"{name} on {host}":   "Dew heater on 10.0.0.5",
+		"{name} ({name})":    "Dew heater (Dew heater)",
+		"{name} at {rack}":   "Dew heater at {rack}",
+		"no placeholders":    "no placeholders",
+		"{host}{name}{host}": "10.0.0.5Dew heater10.0.0.5",
+	} {
+		if got := ExpandDescription(template, fields); got != want {
+			t.Errorf("ExpandDescription(%q) = %q, want %q", template, got, want)
+		}
+	}
+}
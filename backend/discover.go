@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// DiscoveredDevice is a device found on the network that is not yet in the
+// config, with what is still needed to add it.
+type DiscoveredDevice struct {
+	Type    string `json:"type"`    // backend type, e.g. "mi"
+	Address string `json:"address"` // IP, or host:port
+	Model   string `json:"model,omitempty"`
+	ID      string `json:"id,omitempty"` // device ID or serial number
+	// Needs lists the config fields that must still be supplied, e.g.
+	// ["token"] or ["username", "password"].
+	Needs []string `json:"needs,omitempty"`
+}
+
+// Discoverer is implemented by backends that can find their devices on the
+// local network. Discover returns only devices not already configured.
+type Discoverer interface {
+	Discover(timeout time.Duration) ([]DiscoveredDevice, error)
+}
+
+// Discover runs every backend's network discovery in parallel for up to
+// timeout and returns the unconfigured devices found. A failing backend is
+// logged and skipped.
+func (r *Router) Discover(timeout time.Duration) []DiscoveredDevice {
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		out = []DiscoveredDevice{}
+	)
+	for _, b := range r.backends {
+		d, ok := b.(Discoverer)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(b SwitchBackend, d Discoverer) {
+			defer wg.Done()
+			found, err := d.Discover(timeout)
+			if err != nil {
+				log.Printf("[discover] %s: %v", typeName(b), err)
+			}
+			mu.Lock()
+			out = append(out, found...)
+			mu.Unlock()
+		}(b, d)
+	}
+	wg.Wait()
+	return out
+}
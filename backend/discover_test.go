@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+// discoveringFake is a fake backend with a canned discovery result.
+type discoveringFake struct {
+	*fakeSwitches
+	found []DiscoveredDevice
+	err   error
+}
+
+func (d *discoveringFake) Discover(time.Duration) ([]DiscoveredDevice, error) {
+	return d.found, d.err
+}
+
+// Discover merges every backend's candidates; a failing backend still
+// contributes what it found and backends without discovery are skipped.
+func TestDiscover(t *testing.T) {
+	mi := &discoveringFake{fakeSwitches: newFakeSwitches(0), found: []DiscoveredDevice{
+		{Type: "mi", Address: "10.0.0.5", Model: "chuangmi.plug.v3", Needs: []string{"token"}},
+	}}
+	cam := &discoveringFake{fakeSwitches: newFakeSwitches(0), err: errors.New("probe failed"), found: []DiscoveredDevice{
+		{Type: "hikvision", Address: "10.0.0.9", Needs: []string{"username", "password"}},
+	}}
+	r := NewRouter([]SwitchBackend{mi, newFakeSwitches(0), cam}, Options{})
+
+	got := r.Discover(time.Second)
+	sort.Slice(got, func(i, j int) bool { return got[i].Address < got[j].Address })
+	if len(got) != 2 || got[0].Type != "mi" || got[0].Needs[0] != "token" || got[1].Type != "hikvision" {
+		t.Errorf("Discover = %+v, want the mi plug and the camera", got)
+	}
+
+	if got := NewRouter([]SwitchBackend{newFakeSwitches(0)}, Options{}).Discover(time.Second); got == nil || len(got) != 0 {
+		t.Errorf("Discover without discovering backends = %#v, want an empty list", got)
+	}
+}
@@ -0,0 +1,30 @@
+package backend
+
+import "errors"
+
+// Sentinel errors that map to specific ASCOM error numbers, or classify
+// device failures for RetryPolicy. Backends and the Router wrap them with
+// fmt.Errorf("%w: ...") so the server can report the right ErrorNumber to
+// clients.
+var (
+	// ErrInvalidValue reports a value outside the switch's valid range.
+	ErrInvalidValue = errors.New("invalid value")
+
+	// ErrInvalidOperation reports an operation that is not allowed in the
+	// switch's current state or configuration.
+	ErrInvalidOperation = errors.New("invalid operation")
+
+	// ErrNotConnected reports an operation attempted while disconnected.
+	ErrNotConnected = errors.New("not connected")
+
+	// ErrActionNotImplemented reports an unknown custom action.
+	ErrActionNotImplemented = errors.New("action not implemented")
+
+	// ErrMalformedResponse reports a device reply that could not be
+	// decoded, e.g. a truncated packet or one encrypted with another token.
+	ErrMalformedResponse = errors.New("malformed response")
+
+	// ErrRejected reports a device that understood the request and refused
+	// it, e.g. a miIO error code or a SOAP fault.
+	ErrRejected = errors.New("rejected by device")
+)
@@ -0,0 +1,135 @@
+package backend
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// fakeSwitches is an in-memory SwitchBackend and Poller of 0-1 switches
+// with per-switch options, counting the writes it receives (failed ones
+// included).
+type fakeSwitches struct {
+	mu        sync.Mutex
+	values    []float64
+	live      []float64       // what PollSwitchValue reports; nil means values
+	ignore    int             // writes still to be acknowledged without reaching live
+	interval  []time.Duration // per-switch PollInterval; nil means none
+	polls     []int           // PollSwitchValue calls, per switch
+	err       error           // returned by every read and write when set
+	opts      []SwitchOptions
+	readOnly  map[int]bool // switches reporting CanWrite false
+	max       float64
+	connected bool
+	writes    int
+}
+
+func newFakeSwitches(values ...float64) *fakeSwitches {
+	return &fakeSwitches{values: values, opts: make([]SwitchOptions, len(values)), polls: make([]int, len(values)), max: 1, connected: true}
+}
+
+func (f *fakeSwitches) NumSwitches() int                   { return len(f.values) }
+func (f *fakeSwitches) GetName(id int) string              { return fmt.Sprintf("fake %d", id) }
+func (f *fakeSwitches) SetName(int, string) error          { return nil }
+func (f *fakeSwitches) GetDescription(int) string          { return "" }
+func (f *fakeSwitches) GetCanWrite(id int) bool            { return !f.readOnly[id] }
+func (f *fakeSwitches) GetMin(int) float64                 { return 0 }
+func (f *fakeSwitches) GetMax(int) float64                 { return f.max }
+func (f *fakeSwitches) GetStep(int) float64                { return 1 }
+func (f *fakeSwitches) SwitchOptions(id int) SwitchOptions { return f.opts[id] }
+
+func (f *fakeSwitches) Connect() error {
+	f.setConnected(true)
+	return nil
+}
+
+func (f *fakeSwitches) Disconnect() { f.setConnected(false) }
+
+func (f *fakeSwitches) IsConnected() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connected
+}
+
+func (f *fakeSwitches) setConnected(on bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connected = on
+}
+
+func (f *fakeSwitches) GetSwitch(id int) (bool, error) {
+	v, err := f.GetSwitchValue(id)
+	return v > 0, err
+}
+
+func (f *fakeSwitches) GetSwitchValue(id int) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.values[id], f.err
+}
+
+func (f *fakeSwitches) SetSwitch(id int, state bool) error {
+	v := 0.0
+	if state {
+		v = f.max
+	}
+	return f.SetSwitchValue(id, v)
+}
+
+func (f *fakeSwitches) SetSwitchValue(id int, value float64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes++
+	if f.err != nil {
+		return f.err
+	}
+	f.values[id] = value
+	if f.live != nil {
+		if f.ignore > 0 {
+			f.ignore--
+		} else {
+			f.live[id] = value
+		}
+	}
+	return nil
+}
+
+func (f *fakeSwitches) PollInterval(id int) time.Duration {
+	if f.interval == nil {
+		return 0
+	}
+	return f.interval[id]
+}
+
+func (f *fakeSwitches) PollSwitchValue(id int) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.polls[id]++
+	if f.err != nil {
+		return 0, f.err
+	}
+	if f.live != nil {
+		return f.live[id], nil
+	}
+	return f.values[id], nil
+}
+
+func (f *fakeSwitches) SetCachedValue(id int, value float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[id] = value
+}
+
+// pollCount returns how often switch id has been polled.
+func (f *fakeSwitches) pollCount(id int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.polls[id]
+}
+
+// value returns the cached value of switch id.
+func (f *fakeSwitches) value(id int) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.values[id]
+}
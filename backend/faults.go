@@ -0,0 +1,84 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// Operations FaultInjection can target.
+const (
+	FaultRead  = "read"
+	FaultWrite = "write"
+)
+
+// ErrInjectedFault is the error returned by an operation failed on purpose
+// by FaultInjection.
+var ErrInjectedFault = errors.New("injected fault (debug_faults)")
+
+// FaultInjection makes the Router's switch reads and writes slow or flaky on
+// purpose, so client timeout and error handling can be exercised against a
+// real config. It is a debugging aid: main only applies it when started
+// with --debug-faults. Faults happen before the backend is called, so they
+// never reach hardware, trip a breaker or count as device contact.
+type FaultInjection struct {
+	// LatencyMs delays every affected operation by this many milliseconds.
+	LatencyMs int `json:"latency_ms,omitempty"`
+	// JitterMs adds a random extra delay of up to this many milliseconds.
+	JitterMs int `json:"jitter_ms,omitempty"`
+	// ErrorRate is the fraction of affected operations, 0 to 1, that fail
+	// with ErrInjectedFault after the delay.
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	// Operations limits the faults to FaultRead (getswitch, getswitchvalue)
+	// or FaultWrite (setswitch, setswitchvalue). Empty means both.
+	Operations []string `json:"operations,omitempty"`
+	// Switches limits the faults to these global switch IDs. Empty means
+	// every switch.
+	Switches []int `json:"switches,omitempty"`
+}
+
+// Check reports the first invalid setting of f.
+func (f *FaultInjection) Check() error {
+	if f.LatencyMs < 0 || f.JitterMs < 0 {
+		return errors.New("latency_ms and jitter_ms must not be negative")
+	}
+	if f.ErrorRate < 0 || f.ErrorRate > 1 {
+		return fmt.Errorf("error_rate must be between 0 and 1, got %v", f.ErrorRate)
+	}
+	for i, op := range f.Operations {
+		if op != FaultRead && op != FaultWrite {
+			return fmt.Errorf("operations.%d must be %q or %q, got %q", i, FaultRead, FaultWrite, op)
+		}
+	}
+	return nil
+}
+
+// injectFault applies Options.Faults to operation op on switch id: it
+// sleeps for the configured latency and then, at the configured rate,
+// returns ErrInjectedFault.
+func (r *Router) injectFault(id int, op string) error {
+	f := r.opts.Faults
+	if f == nil {
+		return nil
+	}
+	if len(f.Operations) > 0 && !slices.Contains(f.Operations, op) {
+		return nil
+	}
+	if len(f.Switches) > 0 && !slices.Contains(f.Switches, id) {
+		return nil
+	}
+	delay := time.Duration(f.LatencyMs) * time.Millisecond
+	if f.JitterMs > 0 {
+		delay += time.Duration(rand.Int63n(int64(f.JitterMs)*int64(time.Millisecond) + 1))
+	}
+	if delay > 0 {
+		Tracef("switch %d: injecting %v of latency into %s", id, delay, op)
+		time.Sleep(delay)
+	}
+	if f.ErrorRate > 0 && rand.Float64() < f.ErrorRate {
+		return ErrInjectedFault
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFaultsInjectErrors(t *testing.T) {
+	fake := newFakeSwitches(0, 0)
+	r := NewRouter([]SwitchBackend{fake}, Options{Faults: &FaultInjection{
+		ErrorRate:  1,
+		Operations: []string{FaultWrite},
+		Switches:   []int{0},
+	}})
+
+	if err := r.SetSwitch(0, true); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("SetSwitch(0) = %v, want ErrInjectedFault", err)
+	}
+	if fake.writes != 0 {
+		t.Errorf("an injected write fault reached the backend (%d writes)", fake.writes)
+	}
+	if _, err := r.GetSwitch(0); err != nil {
+		t.Errorf("GetSwitch(0) = %v, but only writes are faulted", err)
+	}
+	if err := r.SetSwitch(1, true); err != nil {
+		t.Errorf("SetSwitch(1) = %v, but only switch 0 is faulted", err)
+	}
+}
+
+func TestFaultsInjectLatency(t *testing.T) {
+	r := NewRouter([]SwitchBackend{newFakeSwitches(0)}, Options{Faults: &FaultInjection{LatencyMs: 100}})
+	start := time.Now()
+	if _, err := r.GetSwitchValue(0); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("GetSwitchValue took %v, want at least the injected 100ms", d)
+	}
+}
+
+// Without Options.Faults nothing is delayed or failed.
+func TestNoFaultsByDefault(t *testing.T) {
+	r := NewRouter([]SwitchBackend{newFakeSwitches(0)}, Options{})
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		if err := r.SetSwitch(0, i%2 == 0); err != nil {
+			t.Fatalf("SetSwitch: %v", err)
+		}
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("20 writes took %v without faults configured", d)
+	}
+}
+
+func TestFaultInjectionCheck(t *testing.T) {
+	for _, f := range []FaultInjection{
+		{LatencyMs: -1},
+		{ErrorRate: 1.5},
+		{Operations: []string{"delete"}},
+	} {
+		if err := f.Check(); err == nil {
+			t.Errorf("Check(%+v) accepted an invalid setting", f)
+		}
+	}
+	ok := FaultInjection{LatencyMs: 10, ErrorRate: 0.5, Operations: []string{FaultRead}}
+	if err := ok.Check(); err != nil {
+		t.Errorf("Check(%+v) = %v", ok, err)
+	}
+}
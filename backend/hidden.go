@@ -0,0 +1,32 @@
+package backend
+
+// HiddenSwitch is a snapshot of a switch left out of the Router's index by
+// Options.HideReadOnly. It has no global ID.
+type HiddenSwitch struct {
+	Backend string
+	Name    string
+	Min     float64
+	Max     float64
+	Step    float64
+	Value   float64
+	Err     error
+}
+
+// HiddenSwitches returns the cached state of every hidden switch, for the
+// diagnostic views. It never touches hardware.
+func (r *Router) HiddenSwitches() []HiddenSwitch {
+	hidden := r.tbl().hidden
+	out := make([]HiddenSwitch, len(hidden))
+	for i, ref := range hidden {
+		b, id := ref.backend, ref.localID
+		out[i] = HiddenSwitch{
+			Backend: typeName(b),
+			Name:    b.GetName(id),
+			Min:     b.GetMin(id),
+			Max:     b.GetMax(id),
+			Step:    b.GetStep(id),
+		}
+		out[i].Value, out[i].Err = b.GetSwitchValue(id)
+	}
+	return out
+}
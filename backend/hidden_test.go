@@ -0,0 +1,26 @@
+package backend
+
+import "testing"
+
+// With HideReadOnly the read-only switches leave the index, and so the
+// switch count, but stay visible through HiddenSwitches.
+func TestHideReadOnly(t *testing.T) {
+	fake := newFakeSwitches(1, 0, 1)
+	fake.readOnly = map[int]bool{1: true}
+
+	if n := NewRouter([]SwitchBackend{fake}, Options{}).NumSwitches(); n != 3 {
+		t.Errorf("NumSwitches = %d by default, want 3", n)
+	}
+
+	r := NewRouter([]SwitchBackend{fake}, Options{HideReadOnly: true})
+	if n := r.NumSwitches(); n != 2 {
+		t.Fatalf("NumSwitches = %d with read-only switches hidden, want 2", n)
+	}
+	if r.GetName(1) != "fake 2" {
+		t.Errorf("global switch 1 is %q, want the next writable switch \"fake 2\"", r.GetName(1))
+	}
+	hidden := r.HiddenSwitches()
+	if len(hidden) != 1 || hidden[0].Name != "fake 1" || hidden[0].Value != 0 {
+		t.Errorf("HiddenSwitches = %+v, want fake 1", hidden)
+	}
+}
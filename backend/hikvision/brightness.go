@@ -0,0 +1,178 @@
+package hikvision
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Camera functions selectable with CameraConfig.Function.
+const (
+	// FunctionIR switches the IR illuminator on or off (the default).
+	FunctionIR = "ir"
+	// FunctionBrightness sets supplement-light brightness from 0 to 100.
+	FunctionBrightness = "brightness"
+	// FunctionMotion enables or disables motion detection.
+	FunctionMotion = "motion"
+	// FunctionLight sets the supplement light's mode and brightness
+	// together: 0 turns the light off, 1-100 turns it on at that
+	// brightness, in a single request.
+	FunctionLight = "light"
+)
+
+// maxBrightness is the top of the ISAPI supplement-light brightness range.
+const maxBrightness = 100
+
+// brightnessElement returns the SupplementLight element holding the
+// brightness of the configured light ("ir" or "white").
+func (c *camera) brightnessElement() string {
+	if c.cfg.Light == "white" {
+		return "whiteLightBrightness"
+	}
+	return "irLightBrightness"
+}
+
+const supplementLightPath = "/ISAPI/Image/channels/1/supplementLight"
+
+// getSupplementLight fetches the raw SupplementLight XML document.
+func (c *camera) getSupplementLight() ([]byte, error) {
+	return c.getDocument(supplementLightPath)
+}
+
+// getBrightness reads the configured light's brightness (0-100).
+func (c *camera) getBrightness() (float64, error) {
+	doc, err := c.getSupplementLight()
+	if err != nil {
+		return 0, err
+	}
+	m := c.brightnessPattern().FindSubmatch(doc)
+	if m == nil {
+		return 0, fmt.Errorf("camera does not report %s", c.brightnessElement())
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(string(m[2])), 64)
+	if err != nil {
+		return 0, fmt.Errorf("decode %s: %w", c.brightnessElement(), err)
+	}
+	return v, nil
+}
+
+// setBrightness writes the configured light's brightness. The camera expects
+// the whole SupplementLight document, so the current one is read and sent
+// back with only the brightness element changed.
+func (c *camera) setBrightness(value int) error {
+	doc, err := c.getSupplementLight()
+	if err != nil {
+		return err
+	}
+	re := c.brightnessPattern()
+	if !re.Match(doc) {
+		return fmt.Errorf("camera does not report %s", c.brightnessElement())
+	}
+	body := re.ReplaceAll(doc, []byte("${1}"+strconv.Itoa(value)+"${3}"))
+	return c.putDocument(supplementLightPath, body)
+}
+
+// supplementLightMode matches the SupplementLight mode element.
+var supplementLightMode = regexp.MustCompile(`(<supplementLightMode>)([^<]*)(</supplementLightMode>)`)
+
+// lightMode returns the supplementLightMode that turns the configured light on.
+func (c *camera) lightMode() string {
+	if c.cfg.Light == "white" {
+		return "colorVuWhiteLight"
+	}
+	return "irLight"
+}
+
+// getLight reads the combined light value: 0 if the supplement light is
+// off (mode "close"), otherwise the configured light's brightness.
+func (c *camera) getLight() (float64, error) {
+	doc, err := c.getSupplementLight()
+	if err != nil {
+		return 0, err
+	}
+	m := supplementLightMode.FindSubmatch(doc)
+	if m == nil {
+		return 0, fmt.Errorf("camera does not report supplementLightMode")
+	}
+	if strings.TrimSpace(string(m[2])) == "close" {
+		return 0, nil
+	}
+	return c.getBrightness()
+}
+
+// setLight sets the supplement light's mode and brightness in one PUT, so
+// the camera never sees the light on at a stale brightness or the
+// brightness changed while the light is off. Zero switches the light off
+// and leaves the stored brightness alone.
+func (c *camera) setLight(value int) error {
+	doc, err := c.getSupplementLight()
+	if err != nil {
+		return err
+	}
+	if !supplementLightMode.Match(doc) {
+		return fmt.Errorf("camera does not report supplementLightMode")
+	}
+	if value == 0 {
+		doc = supplementLightMode.ReplaceAll(doc, []byte("${1}close${3}"))
+		return c.putDocument(supplementLightPath, doc)
+	}
+	re := c.brightnessPattern()
+	if !re.Match(doc) {
+		return fmt.Errorf("camera does not report %s", c.brightnessElement())
+	}
+	doc = supplementLightMode.ReplaceAll(doc, []byte("${1}"+c.lightMode()+"${3}"))
+	doc = re.ReplaceAll(doc, []byte("${1}"+strconv.Itoa(value)+"${3}"))
+	return c.putDocument(supplementLightPath, doc)
+}
+
+func (c *camera) brightnessPattern() *regexp.Regexp {
+	el := c.brightnessElement()
+	return regexp.MustCompile(`(<` + el + `>)([^<]*)(</` + el + `>)`)
+}
+
+// readValue reads the switch value for the camera's configured function:
+// 0/1 for the IR illuminator or motion detection, 0-2 for the IR mode,
+// 0-100 for brightness and light, or degrees Celsius for temperature.
+func (c *camera) readValue() (float64, error) {
+	var on bool
+	var err error
+	switch c.cfg.Function {
+	case FunctionBrightness:
+		return c.getBrightness()
+	case FunctionLight:
+		return c.getLight()
+	case FunctionTemperature:
+		return c.getTemperature()
+	case FunctionEvent:
+		return c.eventValue(), nil
+	case FunctionIRMode:
+		return c.getIRMode()
+	case FunctionMotion:
+		on, err = c.getMotionDetection()
+	default:
+		on, err = c.getIRLight()
+	}
+	if err != nil {
+		return 0, err
+	}
+	if on {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// writeValue sets the switch value for the camera's configured function.
+func (c *camera) writeValue(value float64) error {
+	switch c.cfg.Function {
+	case FunctionBrightness:
+		return c.setBrightness(int(value))
+	case FunctionLight:
+		return c.setLight(int(value))
+	case FunctionMotion:
+		return c.setMotionDetection(value != 0)
+	case FunctionIRMode:
+		return c.setIRMode(int(value))
+	}
+	return c.setIRLight(value != 0)
+}
@@ -0,0 +1,91 @@
+package hikvision
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// missingService reports whether err is the camera answering that the
+// requested ISAPI service does not exist on its firmware (404 or 400).
+func missingService(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && (se.code == http.StatusNotFound || se.code == http.StatusBadRequest)
+}
+
+// capabilityError builds the persistent error of a switch whose camera
+// lacks the service its function needs (err is the camera's missingService
+// reply), with a hint on how to fix it.
+func (cfg CameraConfig) capabilityError(err error) error {
+	var se *statusError
+	errors.As(err, &se)
+	function := cfg.Function
+	if function == "" {
+		function = FunctionIR
+	}
+	hint := ""
+	if function == FunctionIR {
+		hint = fmt.Sprintf(" (tried ir_paths %s); enable Configuration → System → Maintenance → System Service → Hardware on the camera",
+			strings.Join(cfg.irPaths(), ", "))
+		if !containsPath(cfg.irPaths(), IRPathIrcut) {
+			hint += `, or add "ircut" to ir_paths`
+		}
+	}
+	return fmt.Errorf("camera %s does not support function %q (HTTP %d)%s", cfg.Host, function, se.code, hint)
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCapability records, after a read of camera id made while connecting,
+// whether the camera lacks the service the switch needs, and reports
+// whether it does. An unavailable switch fails every operation with that
+// error, without contacting the camera, until the next Connect probes it
+// again.
+func (b *Backend) checkCapability(id int, err error) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cam := b.cameras[id]
+	cam.unavailable = nil
+	if missingService(err) {
+		cam.unavailable = cam.cfg.capabilityError(err)
+		log.Printf("[hikvision] warning: camera %d (%s) unavailable: %v", id, cam.cfg.Name, cam.unavailable)
+	}
+	return cam.unavailable != nil
+}
+
+// availability returns the persistent error of switch id if its camera
+// lacks the needed service, or nil.
+func (b *Backend) availability(id int) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.cameras) {
+		return nil
+	}
+	return b.cameras[id].unavailable
+}
+
+// Health reports the switches whose camera lacks the service they need,
+// so readiness lists them.
+func (b *Backend) Health() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var problems []string
+	for id, cam := range b.cameras {
+		if cam.unavailable != nil {
+			problems = append(problems, fmt.Sprintf("switch %d (%s): %v", id, cam.cfg.Name, cam.unavailable))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
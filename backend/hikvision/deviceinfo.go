@@ -0,0 +1,98 @@
+package hikvision
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+
+	"alpaca-switch/backend"
+)
+
+// actionGetDeviceInfo returns model, firmware and serial details for one
+// camera (Parameters = switch ID) or all cameras.
+const actionGetDeviceInfo = "getdeviceinfo"
+
+// deviceInfo is the subset of /ISAPI/System/deviceInfo we report.
+type deviceInfo struct {
+	XMLName         xml.Name `xml:"DeviceInfo" json:"-"`
+	Name            string   `xml:"-" json:"name"`
+	Host            string   `xml:"-" json:"host"`
+	DeviceName      string   `xml:"deviceName" json:"deviceName"`
+	DeviceID        string   `xml:"deviceID" json:"deviceID"`
+	Model           string   `xml:"model" json:"model"`
+	SerialNumber    string   `xml:"serialNumber" json:"serialNumber"`
+	MACAddress      string   `xml:"macAddress" json:"macAddress"`
+	FirmwareVersion string   `xml:"firmwareVersion" json:"firmwareVersion"`
+	FirmwareDate    string   `xml:"firmwareReleasedDate" json:"firmwareReleasedDate"`
+	Error           string   `xml:"-" json:"error,omitempty"`
+}
+
+// Actions returns the custom actions supported by the Hikvision backend.
+func (b *Backend) Actions() []string {
+	return []string{actionGetDeviceInfo, actionReauth}
+}
+
+// Action runs a Hikvision custom action for camera id, or for every camera
+// when id is -1.
+func (b *Backend) Action(name string, id int, _ string) (string, error) {
+	if name == actionReauth {
+		return b.reauth(id)
+	}
+	if name != actionGetDeviceInfo {
+		return "", fmt.Errorf("%w: %q", backend.ErrActionNotImplemented, name)
+	}
+	b.mu.RLock()
+	cams := append([]*camera(nil), b.cameras...)
+	b.mu.RUnlock()
+
+	if id >= 0 {
+		if id >= len(cams) {
+			return "", fmt.Errorf("invalid camera id %d", id)
+		}
+		info, err := cams[id].getDeviceInfo()
+		if err != nil {
+			return "", err
+		}
+		return marshalAction(info)
+	}
+	infos := make([]deviceInfo, len(cams))
+	for i, cam := range cams {
+		info, err := cam.getDeviceInfo()
+		if err != nil {
+			info = deviceInfo{Name: cam.cfg.Name, Host: cam.cfg.Host, Error: err.Error()}
+		}
+		infos[i] = info
+	}
+	return marshalAction(infos)
+}
+
+func marshalAction(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (c *camera) getDeviceInfo() (deviceInfo, error) {
+	url := c.isapiURL("/ISAPI/System/deviceInfo")
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return deviceInfo{}, fmt.Errorf("GET %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	backend.Tracef("hikvision GET %s response %d: %s", url, resp.StatusCode, backend.Redact(string(body), c.password()))
+	if resp.StatusCode != http.StatusOK {
+		return deviceInfo{}, fmt.Errorf("camera returned %d: %s", resp.StatusCode, string(body))
+	}
+	var info deviceInfo
+	if err := xml.Unmarshal(body, &info); err != nil {
+		return deviceInfo{}, fmt.Errorf("decode response: %w", err)
+	}
+	info.Name = c.cfg.Name
+	info.Host = c.cfg.Host
+	return info, nil
+}
@@ -0,0 +1,86 @@
+package hikvision
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// sadpGroup is the multicast address Hikvision's SADP discovery protocol
+// uses for both probes and replies.
+var sadpGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 37020}
+
+// sadpProbeMatch is a camera's reply to a SADP inquiry.
+type sadpProbeMatch struct {
+	XMLName     xml.Name `xml:"ProbeMatch"`
+	Uuid        string   `xml:"Uuid"`
+	Types       string   `xml:"Types"`
+	Description string   `xml:"DeviceDescription"`
+	Serial      string   `xml:"DeviceSN"`
+	IPv4        string   `xml:"IPv4Address"`
+	HTTPPort    int      `xml:"HttpPort"`
+}
+
+// Discover sends a SADP inquiry and returns the cameras that answer and are
+// not configured yet. Credentials are always needed to add a camera.
+func (b *Backend) Discover(timeout time.Duration) ([]backend.DiscoveredDevice, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, sadpGroup)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	uuid := make([]byte, 16)
+	rand.Read(uuid)
+	probeID := strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]))
+	probe := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?><Probe><Uuid>%s</Uuid><Types>inquiry</Types></Probe>`, probeID)
+	if _, err := conn.WriteToUDP([]byte(probe), sadpGroup); err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	configured := make(map[string]bool, len(b.cameras))
+	for _, c := range b.cameras {
+		host := c.cfg.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		configured[host] = true
+	}
+	b.mu.RUnlock()
+
+	var found []backend.DiscoveredDevice
+	seen := make(map[string]bool)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 8192)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break // deadline reached
+		}
+		var m sadpProbeMatch
+		if xml.Unmarshal(buf[:n], &m) != nil || m.IPv4 == "" || !strings.EqualFold(m.Types, "inquiry") {
+			continue // our own probe, or another protocol's traffic
+		}
+		if configured[m.IPv4] || seen[m.IPv4] {
+			continue
+		}
+		seen[m.IPv4] = true
+		addr := m.IPv4
+		if m.HTTPPort != 0 && m.HTTPPort != 80 {
+			addr = net.JoinHostPort(m.IPv4, fmt.Sprint(m.HTTPPort))
+		}
+		found = append(found, backend.DiscoveredDevice{
+			Type:    "hikvision",
+			Address: addr,
+			Model:   m.Description,
+			ID:      m.Serial,
+			Needs:   []string{"username", "password"},
+		})
+	}
+	return found, nil
+}
@@ -0,0 +1,362 @@
+package hikvision
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// FunctionEvent is a read-only switch that is on while the camera's alarm
+// stream reports its Event as active. It is added by event_switches.
+const FunctionEvent = "event"
+
+const alertStreamPath = "/ISAPI/Event/notification/alertStream"
+
+// eventTypes maps the event names accepted in event_switches to the ISAPI
+// eventType values that trigger them. Any other name is matched against
+// eventType directly.
+var eventTypes = map[string][]string{
+	"motion":       {"VMD"},
+	"tamper":       {"shelteralarm", "tamperdetection"},
+	"linecrossing": {"linedetection"},
+	"intrusion":    {"fielddetection"},
+	"videoloss":    {"videoloss"},
+}
+
+// defaultEventHold is how long an event switch stays on after the last
+// active notification, when Settings.EventHoldSeconds is unset. Cameras
+// repeat active notifications about once a second while the event lasts.
+const defaultEventHold = 5 * time.Second
+
+// Reconnect backoff for a dropped alarm stream.
+const (
+	eventRetryMin = time.Second
+	eventRetryMax = 30 * time.Second
+)
+
+// maxEventBuffer bounds the unparsed stream data kept while looking for the
+// end of a notification, so parts that are not alerts (e.g. snapshots)
+// cannot grow it without limit.
+const maxEventBuffer = 1 << 20
+
+var (
+	alertEnd        = []byte("</EventNotificationAlert>")
+	alertStart      = []byte("<EventNotificationAlert")
+	eventTypeField  = regexp.MustCompile(`<eventType>\s*([^<\s]+)\s*</eventType>`)
+	eventStateField = regexp.MustCompile(`<eventState>\s*([^<\s]+)\s*</eventState>`)
+)
+
+// expandEventSwitches inserts, after every camera with EventSwitches set, a
+// read-only event switch per listed event, named "<name> <event>".
+func expandEventSwitches(cfgs []CameraConfig) []CameraConfig {
+	var out []CameraConfig
+	for _, cfg := range cfgs {
+		out = append(out, cfg)
+		if cfg.Function == FunctionEvent {
+			continue
+		}
+		for _, event := range cfg.EventSwitches {
+			e := cfg
+			e.EventSwitches = nil
+			e.MotionSwitch, e.MotionName = false, ""
+			e.Function = FunctionEvent
+			e.Event = event
+			e.Light, e.BrightnessStep = "", 0
+			e.TemperatureMin, e.TemperatureMax = 0, 0
+			e.Name = cfg.Name + " " + event
+			e.Description = ""
+			e.Value = 0
+			e.SwitchOptions = backend.SwitchOptions{PollSeconds: cfg.PollSeconds}
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// matchesEvent reports whether an ISAPI eventType triggers event switch cfg.
+func (cfg CameraConfig) matchesEvent(eventType string) bool {
+	types, ok := eventTypes[strings.ToLower(cfg.Event)]
+	if !ok {
+		types = []string{cfg.Event}
+	}
+	for _, t := range types {
+		if strings.EqualFold(t, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// eventStream follows one camera's alarm stream, shared by all of that
+// camera's event switches.
+type eventStream struct {
+	url    string
+	client *http.Client
+	hold   time.Duration
+
+	mu         sync.Mutex
+	lastActive map[string]time.Time // lower-case eventType -> last active notification
+	lastSeen   time.Time            // last data received on the stream
+	live       bool                 // the stream is connected
+	cancel     context.CancelFunc
+	done       chan struct{}
+
+	// irEvents are the eventTypes that signal an IR change, and onIR the
+	// IR switches' refresh functions, called when one arrives and whenever
+	// the stream (re)connects; see Settings.IRSubscription.
+	irEvents []string
+	onIR     []func()
+}
+
+// active reports whether cfg's event was reported active within the hold
+// time.
+func (s *eventStream) active(cfg CameraConfig) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for eventType, t := range s.lastActive {
+		if cfg.matchesEvent(eventType) && time.Since(t) < s.hold {
+			return true
+		}
+	}
+	return false
+}
+
+// seen returns when the stream last delivered data, or the zero time.
+func (s *eventStream) seen() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSeen
+}
+
+// connected reports whether the stream is currently connected.
+func (s *eventStream) connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.live
+}
+
+// setConnected records whether the stream is connected. On connect the IR
+// switches are refreshed, since changes may have been missed while it was
+// down.
+func (s *eventStream) setConnected(live bool) {
+	s.mu.Lock()
+	s.live = live
+	s.mu.Unlock()
+	if live {
+		s.notifyIR()
+	}
+}
+
+// notifyIR runs the IR switches' refresh functions in the background, so
+// the stream keeps being read meanwhile.
+func (s *eventStream) notifyIR() {
+	s.mu.Lock()
+	fns := append([]func(){}, s.onIR...)
+	s.mu.Unlock()
+	for _, fn := range fns {
+		go fn()
+	}
+}
+
+// start follows the stream in the background until stop is called.
+func (s *eventStream) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.run(ctx, s.done)
+}
+
+// stop ends the stream and waits for its goroutine to exit.
+func (s *eventStream) stop() {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel, s.done = nil, nil
+	s.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// run reads the stream, reconnecting with backoff whenever it drops.
+func (s *eventStream) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	retry := eventRetryMin
+	for {
+		received, err := s.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			retry = eventRetryMin
+		}
+		if !backend.Retryable(err) {
+			// e.g. bad credentials: no point hammering the camera
+			retry = eventRetryMax
+		}
+		log.Printf("[hikvision] alarm stream %s: %v; reconnecting in %v", s.url, err, retry)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, eventRetryMax)
+	}
+}
+
+// follow opens the stream and parses notifications until it ends. It
+// reports whether any data arrived, so a stream that worked for a while
+// reconnects quickly.
+func (s *eventStream) follow(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, &statusError{code: resp.StatusCode, body: string(body)}
+	}
+	log.Printf("[hikvision] alarm stream %s connected", s.url)
+	s.setConnected(true)
+	defer s.setConnected(false)
+	received := false
+	var buf []byte
+	chunk := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(chunk)
+		if n > 0 {
+			received = true
+			buf = s.parse(append(buf, chunk[:n]...))
+		}
+		if err == io.EOF {
+			return received, fmt.Errorf("stream closed by camera: %w", io.EOF)
+		}
+		if err != nil {
+			return received, err
+		}
+	}
+}
+
+// parse handles every complete notification in buf and returns the
+// unparsed remainder. Multipart framing between notifications is skipped.
+func (s *eventStream) parse(buf []byte) []byte {
+	now := time.Now()
+	s.mu.Lock()
+	s.lastSeen = now
+	s.mu.Unlock()
+	for {
+		end := bytes.Index(buf, alertEnd)
+		if end < 0 {
+			break
+		}
+		doc := buf[:end]
+		if start := bytes.LastIndex(doc, alertStart); start >= 0 {
+			doc = doc[start:]
+		}
+		s.record(doc, now)
+		buf = buf[end+len(alertEnd):]
+	}
+	// Keep only a notification in progress, or a tail that may hold the
+	// start of its tag.
+	if start := bytes.LastIndex(buf, alertStart); start >= 0 {
+		buf = buf[start:]
+	} else if keep := len(alertStart) - 1; len(buf) > keep {
+		buf = buf[len(buf)-keep:]
+	}
+	if len(buf) > maxEventBuffer {
+		buf = nil
+	}
+	return append([]byte(nil), buf...)
+}
+
+// record applies one notification: active sets the event's time, inactive
+// clears it.
+func (s *eventStream) record(doc []byte, now time.Time) {
+	t, st := eventTypeField.FindSubmatch(doc), eventStateField.FindSubmatch(doc)
+	if t == nil || st == nil {
+		return
+	}
+	eventType := strings.ToLower(string(t[1]))
+	backend.Tracef("hikvision alarm stream %s: %s %s", s.url, t[1], st[1])
+	s.mu.Lock()
+	if strings.EqualFold(string(st[1]), "active") {
+		s.lastActive[eventType] = now
+	} else {
+		delete(s.lastActive, eventType)
+	}
+	irChange := false
+	for _, e := range s.irEvents {
+		if strings.EqualFold(e, eventType) {
+			irChange = true
+		}
+	}
+	s.mu.Unlock()
+	if irChange {
+		s.notifyIR()
+	}
+}
+
+// eventValue returns 1 while the switch's event is active, else 0.
+func (c *camera) eventValue() float64 {
+	if c.events != nil && c.events.active(c.cfg) {
+		return 1
+	}
+	return 0
+}
+
+// attachEventStreams gives every event switch the alarm stream of its
+// camera, one stream per camera URL and user. With irEvents set (see
+// Settings.IRSubscription) IR switches are given their camera's stream too,
+// as irStream.
+func attachEventStreams(cams []*camera, hold time.Duration, irEvents []string) []*eventStream {
+	streams := make(map[string]*eventStream)
+	var out []*eventStream
+	for _, cam := range cams {
+		subscribe := irEvents != nil && cam.cfg.irFunction()
+		if cam.cfg.Function != FunctionEvent && !subscribe {
+			continue
+		}
+		url := cam.isapiURL(alertStreamPath)
+		key := url + "\x00" + cam.cfg.Username
+		s, ok := streams[key]
+		if !ok {
+			s = &eventStream{
+				url: url,
+				// No overall timeout: the response body is read for as long
+				// as the stream stays up.
+				client:     &http.Client{Transport: cam.client.Transport},
+				hold:       hold,
+				lastActive: make(map[string]time.Time),
+				irEvents:   irEvents,
+			}
+			streams[key] = s
+			out = append(out, s)
+		}
+		if subscribe {
+			cam.irStream = s
+		} else {
+			cam.events = s
+		}
+	}
+	return out
+}
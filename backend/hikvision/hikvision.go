@@ -1,5 +1,11 @@
 // Package hikvision implements a SwitchBackend for Hikvision IP camera IR illuminators.
-// Each CameraConfig entry becomes one switch (on = IR enabled, off = IR disabled).
+// Each CameraConfig entry becomes one switch: by default on/off for the IR
+// illuminator, off/on/auto (0–2) with function "ir_mode", 0–100
+// supplement-light brightness with function "brightness",
+// or the read-only internal temperature with function "temperature".
+// List a camera twice to expose several. With motion_switch set, an entry also
+// adds an on/off switch for the camera's motion detection; event_switches
+// adds read-only switches that follow the camera's alarm stream.
 // Hardware communication uses the Hikvision ISAPI over HTTP with Digest authentication.
 //
 // Camera requirements:
@@ -14,12 +20,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/icholy/digest"
+	"alpaca-switch/backend"
 )
 
 // CameraConfig holds connection details and cached state for one Hikvision camera.
@@ -30,75 +38,292 @@ type CameraConfig struct {
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	UniqueID    string  `json:"uniqueid"`
-	Value       float64 `json:"value"` // cached last-known state: 0=off, 1=on
+	Value       float64 `json:"value"` // cached last-known state: 0=off, 1=on (or brightness)
+
+	// Function selects what the switch controls: FunctionIR (default),
+	// FunctionIRMode, FunctionBrightness, FunctionLight, FunctionMotion or
+	// FunctionTemperature.
+	Function string `json:"function,omitempty"`
+	// Light is the supplement light whose brightness is controlled: "ir"
+	// (default) or "white". Only used with FunctionBrightness and
+	// FunctionLight.
+	Light string `json:"light,omitempty"`
+	// BrightnessStep is the brightness switch's step size (default 1).
+	BrightnessStep float64 `json:"brightness_step,omitempty"`
+	// TemperatureMin and TemperatureMax are the temperature switch's range
+	// in degrees Celsius (default -40 to 100). Only used with
+	// FunctionTemperature.
+	TemperatureMin float64 `json:"temperature_min,omitempty"`
+	TemperatureMax float64 `json:"temperature_max,omitempty"`
+
+	// BasePath is a path prefix inserted before /ISAPI, for cameras behind
+	// a reverse proxy (e.g. "/cam1" gives http://host/cam1/ISAPI/...).
+	BasePath string `json:"base_path,omitempty"`
+	// Headers are extra HTTP headers sent with every request to the camera.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// MotionSwitch adds a second switch for this camera that enables or
+	// disables motion detection, named MotionName (default "<name> motion
+	// detection").
+	MotionSwitch bool   `json:"motion_switch,omitempty"`
+	MotionName   string `json:"motion_name,omitempty"`
+
+	// IRPaths lists the IR endpoints to try, in order: IRPathHardware and
+	// IRPathIrcut. Default: hardware, then ircut.
+	IRPaths []string `json:"ir_paths,omitempty"`
+
+	// EventSwitches adds a read-only switch per listed alarm event
+	// ("motion", "tamper", "linecrossing", "intrusion", "videoloss" or a
+	// raw ISAPI eventType), named "<name> <event>", that is on while the
+	// camera's alarm stream reports the event.
+	EventSwitches []string `json:"event_switches,omitempty"`
+	// Event is the alarm event of a FunctionEvent switch.
+	Event string `json:"event,omitempty"`
+
+	backend.SwitchOptions
+}
+
+// Settings holds backend-wide options for the Hikvision backend.
+type Settings struct {
+	// PollSeconds is the default refresh interval for cameras without a
+	// per-camera poll_seconds override. Zero disables background polling.
+	PollSeconds int `json:"poll_seconds"`
+
+	// ConnectMode controls the state query on Connect: ConnectEager
+	// (default) queries cameras one by one, ConnectEagerParallel queries
+	// them all at once, and ConnectLazy skips the query so Connect returns
+	// immediately with the cached config values.
+	ConnectMode string `json:"connect_mode"`
+
+	backend.CommonSettings
+
+	// CachedOnError answers GetSwitch with the cached value, logging a
+	// warning, when the live query fails, instead of returning the error.
+	CachedOnError bool `json:"cached_on_error"`
+
+	// EventHoldSeconds is how long an event switch stays on after the
+	// camera last reported the event active (default 5).
+	EventHoldSeconds int `json:"event_hold_seconds"`
+
+	// IRSubscription keeps IR and IR mode switches current from each
+	// camera's alarm stream instead of querying the camera on every read
+	// and poll: while the stream is connected, reads are answered from the
+	// cache, which is refreshed when one of IREvents arrives and whenever
+	// the stream reconnects.
+	IRSubscription bool `json:"ir_subscription"`
+
+	// IREvents are the eventTypes that signal an IR change (default
+	// "dayNightSwitch" and "IRCutFilter").
+	IREvents []string `json:"ir_events"`
 }
 
+// Connect modes selectable with Settings.ConnectMode.
+const (
+	ConnectEager         = "eager"
+	ConnectEagerParallel = "eager_parallel"
+	ConnectLazy          = "lazy"
+)
+
 // camera is the runtime representation of one camera switch.
 type camera struct {
-	cfg    CameraConfig
-	client *http.Client
+	cfg     CameraConfig
+	client  *http.Client
+	auth    *authTransport // the client's transport, swapped by reauth
+	updated time.Time      // when cfg.Value was last read from or written to the camera
+	// irPath is 1 + the index in cfg.irPaths() of the IR endpoint that
+	// worked, or 0 until one has.
+	irPath atomic.Int32
+	// events is the alarm stream of a FunctionEvent switch.
+	events *eventStream
+	// irStream is the alarm stream of a subscribed IR switch.
+	irStream *eventStream
+	// unavailable is set on Connect when the camera lacks the service the
+	// switch needs; see checkCapability.
+	unavailable error
 }
 
 // Backend implements backend.SwitchBackend for Hikvision IR switches.
 type Backend struct {
 	mu        sync.RWMutex
 	cameras   []*camera
+	settings  Settings
 	connected bool
+	streams   []*eventStream
+
+	// credentials supplies reloaded camera credentials to the reauth
+	// action; see SetCredentialSource.
+	credentials CredentialSource
 }
 
 const cameraRequestTimeout = 3 * time.Second
 
 // New creates a Hikvision backend from a list of camera configs.
-func New(cfgs []CameraConfig) *Backend {
+func New(cfgs []CameraConfig, settings Settings) *Backend {
+	cfgs = expandMotionSwitches(expandEventSwitches(cfgs))
 	cams := make([]*camera, len(cfgs))
 	for i, cfg := range cfgs {
+		if err := cfg.Validate(); err != nil {
+			log.Printf("[hikvision] camera %d (%s): %v; using defaults", i, cfg.Name, err)
+			cfg.Function, cfg.Light, cfg.BrightnessStep, cfg.IRPaths = FunctionIR, "", 0, nil
+			cfg.TemperatureMin, cfg.TemperatureMax = 0, 0
+			cfg.EventSwitches, cfg.Event = nil, ""
+		}
+		auth := newAuthTransport(cfg)
 		cams[i] = &camera{
-			cfg: cfg,
+			cfg:  cfg,
+			auth: auth,
 			client: &http.Client{
-				Timeout: cameraRequestTimeout,
-				Transport: &digest.Transport{
-					Username: cfg.Username,
-					Password: cfg.Password,
-				},
+				Timeout:   cameraRequestTimeout,
+				Transport: auth,
 			},
 		}
 	}
-	return &Backend{cameras: cams}
+	switch settings.ConnectMode {
+	case "", ConnectEager, ConnectEagerParallel, ConnectLazy:
+	default:
+		log.Printf("[hikvision] warning: connect_mode must be %q, %q or %q, got %q; using %q",
+			ConnectEager, ConnectEagerParallel, ConnectLazy, settings.ConnectMode, ConnectEager)
+		settings.ConnectMode = ConnectEager
+	}
+	hold := time.Duration(settings.EventHoldSeconds) * time.Second
+	if hold <= 0 {
+		hold = defaultEventHold
+	}
+	b := &Backend{cameras: cams, settings: settings, streams: attachEventStreams(cams, hold, settings.irEvents())}
+	b.subscribeIR()
+	return b
 }
 
-// Connect queries current IR state from all cameras and marks the backend connected.
+// dimmable reports whether the switch takes a 0-100 brightness value.
+func (cfg CameraConfig) dimmable() bool {
+	return cfg.Function == FunctionBrightness || cfg.Function == FunctionLight
+}
+
+// expandMotionSwitches inserts, after every camera with MotionSwitch set, a
+// motion-detection switch for the same camera.
+func expandMotionSwitches(cfgs []CameraConfig) []CameraConfig {
+	var out []CameraConfig
+	for _, cfg := range cfgs {
+		out = append(out, cfg)
+		if !cfg.MotionSwitch || cfg.Function == FunctionMotion {
+			continue
+		}
+		m := cfg
+		m.MotionSwitch = false
+		m.Function = FunctionMotion
+		m.Light, m.BrightnessStep = "", 0
+		m.TemperatureMin, m.TemperatureMax = 0, 0
+		m.Name = cfg.MotionName
+		if m.Name == "" {
+			m.Name = cfg.Name + " motion detection"
+		}
+		m.Description = ""
+		m.Value = 0
+		m.SwitchOptions = backend.SwitchOptions{PollSeconds: cfg.PollSeconds}
+		out = append(out, m)
+	}
+	return out
+}
+
+// Validate checks the function-specific fields of cfg.
+func (cfg CameraConfig) Validate() error {
+	switch cfg.Function {
+	case "", FunctionIR, FunctionIRMode, FunctionBrightness, FunctionLight, FunctionMotion, FunctionTemperature:
+	case FunctionEvent:
+		if cfg.Event == "" {
+			return fmt.Errorf("function %q needs an event", FunctionEvent)
+		}
+	default:
+		return fmt.Errorf("function must be %q, %q, %q, %q, %q or %q, got %q",
+			FunctionIR, FunctionIRMode, FunctionBrightness, FunctionLight, FunctionMotion, FunctionTemperature, cfg.Function)
+	}
+	for _, event := range cfg.EventSwitches {
+		if strings.TrimSpace(event) == "" {
+			return fmt.Errorf("event_switches entries must not be empty")
+		}
+	}
+	switch cfg.Light {
+	case "", "ir", "white":
+	default:
+		return fmt.Errorf("light must be \"ir\" or \"white\", got %q", cfg.Light)
+	}
+	if cfg.BrightnessStep < 0 || cfg.BrightnessStep > maxBrightness {
+		return fmt.Errorf("brightness_step must be between 0 and %d", maxBrightness)
+	}
+	if min, max := cfg.temperatureRange(); max <= min {
+		return fmt.Errorf("temperature_max (%v) must be above temperature_min (%v)", max, min)
+	}
+	for _, p := range cfg.IRPaths {
+		if p != IRPathHardware && p != IRPathIrcut {
+			return fmt.Errorf("ir_paths entries must be %q or %q, got %q", IRPathHardware, IRPathIrcut, p)
+		}
+	}
+	return nil
+}
+
+// Connect starts the alarm streams, queries the current state of all
+// cameras as configured by connect_mode and marks the backend connected. In
+// the eager modes it blocks until every camera has answered or timed out;
+// in lazy mode cached values are served until the first poll or live read.
 func (b *Backend) Connect() error {
+	for _, s := range b.streams {
+		s.start()
+	}
+	switch b.settings.ConnectMode {
+	case ConnectLazy:
+		log.Print("[hikvision] lazy connect: serving cached state until cameras are polled")
+	case ConnectEagerParallel:
+		b.refreshStates(true)
+	default:
+		b.refreshStates(false)
+	}
 	b.mu.Lock()
 	b.connected = true
 	b.mu.Unlock()
-	go b.refreshStates()
 	return nil
 }
 
-func (b *Backend) refreshStates() {
-	okCount := 0
-	failCount := 0
-	for i, cam := range b.cameras {
-		on, err := cam.getIRLight()
+// refreshStates reads every camera's value, one at a time or all at once.
+func (b *Backend) refreshStates(parallel bool) {
+	var okCount, failCount atomic.Int32
+	refresh := func(i int, cam *camera) {
+		value, err := cam.readValue()
+		if b.checkCapability(i, err) {
+			failCount.Add(1)
+			return
+		}
 		if err != nil {
-			failCount++
+			failCount.Add(1)
 			log.Printf("[hikvision] warning: could not query camera %d (%s): %v", i, cam.cfg.Host, err)
-			continue
+			return
 		}
-		okCount++
+		okCount.Add(1)
 		b.mu.Lock()
-		if on {
-			b.cameras[i].cfg.Value = 1
-		} else {
-			b.cameras[i].cfg.Value = 0
-		}
+		cam.cfg.Value = value
+		cam.updated = time.Now()
 		b.mu.Unlock()
 	}
-	log.Printf("[hikvision] state refresh complete: %d ok, %d failed", okCount, failCount)
+	var wg sync.WaitGroup
+	for i, cam := range b.cameras {
+		if !parallel {
+			refresh(i, cam)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, cam *camera) {
+			defer wg.Done()
+			refresh(i, cam)
+		}(i, cam)
+	}
+	wg.Wait()
+	log.Printf("[hikvision] state refresh complete: %d ok, %d failed", okCount.Load(), failCount.Load())
 }
 
-// Disconnect marks the backend disconnected.
+// Disconnect stops the alarm streams and marks the backend disconnected.
 func (b *Backend) Disconnect() {
+	for _, s := range b.streams {
+		s.stop()
+	}
 	b.mu.Lock()
 	b.connected = false
 	b.mu.Unlock()
@@ -111,6 +336,19 @@ func (b *Backend) IsConnected() bool {
 	return b.connected
 }
 
+// BackendType returns "hikvision".
+func (b *Backend) BackendType() string { return "hikvision" }
+
+// ClampsValues reports whether clamp_values is set.
+func (b *Backend) ClampsValues() bool { return b.settings.ClampsValues() }
+
+// OptimizesWrites reports whether write_mode is optimize, and the
+// write_max_age_seconds freshness limit.
+func (b *Backend) OptimizesWrites() (bool, time.Duration) { return b.settings.OptimizesWrites() }
+
+// NamePrefix returns the name_prefix setting.
+func (b *Backend) NamePrefix() string { return b.settings.NamePrefix }
+
 // NumSwitches returns the number of cameras (one switch per camera).
 func (b *Backend) NumSwitches() int {
 	b.mu.RLock()
@@ -139,34 +377,109 @@ func (b *Backend) SetName(id int, name string) error {
 	return nil
 }
 
-// GetDescription returns the description for switch id.
-// If no description is set in config, falls back to "<name> IR illuminator".
+// GetDescription returns the description for switch id. Without one it
+// expands description_template ({name}, {host}, {function}), falling back
+// to "<name> IR illuminator".
 func (b *Backend) GetDescription(id int) string {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	if id < 0 || id >= len(b.cameras) {
 		return ""
 	}
-	if b.cameras[id].cfg.Description != "" {
-		return b.cameras[id].cfg.Description
+	cfg := b.cameras[id].cfg
+	if cfg.Description != "" {
+		return cfg.Description
+	}
+	if b.settings.DescriptionTemplate != "" {
+		function := cfg.Function
+		if function == "" {
+			function = FunctionIR
+		}
+		return backend.ExpandDescription(b.settings.DescriptionTemplate, map[string]string{
+			"name":     cfg.Name,
+			"host":     cfg.Host,
+			"function": function,
+		})
+	}
+	switch b.cameras[id].cfg.Function {
+	case FunctionBrightness:
+		return fmt.Sprintf("%s illuminator brightness", b.cameras[id].cfg.Name)
+	case FunctionLight:
+		return fmt.Sprintf("%s supplement light", b.cameras[id].cfg.Name)
+	case FunctionMotion:
+		return b.cameras[id].cfg.Name
+	case FunctionTemperature:
+		return fmt.Sprintf("%s temperature (°C)", b.cameras[id].cfg.Name)
+	case FunctionEvent:
+		return fmt.Sprintf("%s (alarm stream)", b.cameras[id].cfg.Name)
+	case FunctionIRMode:
+		return fmt.Sprintf("%s IR mode (0 off, 1 on, 2 auto)", b.cameras[id].cfg.Name)
 	}
 	return fmt.Sprintf("%s IR illuminator", b.cameras[id].cfg.Name)
 }
 
-// GetCanWrite always returns true — IR illuminators are always writable.
-func (b *Backend) GetCanWrite(_ int) bool { return true }
+// GetCanWrite returns true except for temperature and event switches,
+// which are read-only sensors.
+func (b *Backend) GetCanWrite(id int) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return id < 0 || id >= len(b.cameras) || !b.cameras[id].cfg.readOnly()
+}
+
+// readOnly reports whether the switch only reports a reading.
+func (cfg CameraConfig) readOnly() bool {
+	return cfg.Function == FunctionTemperature || cfg.Function == FunctionEvent
+}
 
-// GetMin returns the minimum value (0 = off).
-func (b *Backend) GetMin(_ int) float64 { return 0 }
+// GetMin returns the minimum value: 0 (off), or temperature_min.
+func (b *Backend) GetMin(id int) float64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id >= 0 && id < len(b.cameras) && b.cameras[id].cfg.Function == FunctionTemperature {
+		min, _ := b.cameras[id].cfg.temperatureRange()
+		return min
+	}
+	return 0
+}
 
-// GetMax returns the maximum value (1 = on).
-func (b *Backend) GetMax(_ int) float64 { return 1 }
+// GetMax returns the maximum value: 1 (on) for the IR switch, 2 (auto) for
+// the IR mode, 100 for brightness, or temperature_max.
+func (b *Backend) GetMax(id int) float64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.cameras) {
+		return 1
+	}
+	switch cfg := b.cameras[id].cfg; {
+	case cfg.dimmable():
+		return maxBrightness
+	case cfg.Function == FunctionTemperature:
+		_, max := cfg.temperatureRange()
+		return max
+	case cfg.Function == FunctionIRMode:
+		return float64(len(irModes) - 1)
+	}
+	return 1
+}
 
-// GetStep returns the step size (1).
-func (b *Backend) GetStep(_ int) float64 { return 1 }
+// GetStep returns the step size: 1, brightness_step for brightness, or 0.1
+// for temperature.
+func (b *Backend) GetStep(id int) float64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id >= 0 && id < len(b.cameras) && b.cameras[id].cfg.Function == FunctionTemperature {
+		return temperatureStep
+	}
+	if id >= 0 && id < len(b.cameras) && b.cameras[id].cfg.BrightnessStep > 0 &&
+		b.cameras[id].cfg.dimmable() {
+		return b.cameras[id].cfg.BrightnessStep
+	}
+	return 1
+}
 
-// GetSwitch queries the live IR state from the camera. The result is also
-// cached in cfg.Value so GetSwitchValue stays consistent.
+// GetSwitch queries the live state from the camera (IR on, or brightness
+// above zero). The value is also cached in cfg.Value so GetSwitchValue stays
+// consistent. A subscribed IR switch answers from the cache.
 func (b *Backend) GetSwitch(id int) (bool, error) {
 	b.mu.RLock()
 	if id < 0 || id >= len(b.cameras) {
@@ -176,33 +489,67 @@ func (b *Backend) GetSwitch(id int) (bool, error) {
 	cam := b.cameras[id]
 	b.mu.RUnlock()
 
-	on, err := cam.getIRLight()
+	if err := b.availability(id); err != nil {
+		return false, err
+	}
+	if cam.subscribed() {
+		value, err := b.GetSwitchValue(id)
+		return value > 0, err
+	}
+
+	value, err := cam.readValue()
 	if err != nil {
 		return false, err
 	}
 	// Update cached value
 	b.mu.Lock()
-	if on {
-		b.cameras[id].cfg.Value = 1
-	} else {
-		b.cameras[id].cfg.Value = 0
-	}
+	b.cameras[id].cfg.Value = value
+	b.cameras[id].updated = time.Now()
 	b.mu.Unlock()
-	return on, nil
+	return value > 0, nil
 }
 
-// GetSwitchValue returns the cached numeric value (0.0 or 1.0).
+// ReadsLive reports that GetSwitch queries the camera directly.
+func (b *Backend) ReadsLive() bool { return true }
+
+// FallsBackToCache reports whether cached_on_error is set.
+func (b *Backend) FallsBackToCache() bool { return b.settings.CachedOnError }
+
+// GetSwitchValue returns the cached numeric value (0.0 or 1.0). Before the
+// first successful query this is the value from config. Event switches
+// report the alarm stream's current state.
 func (b *Backend) GetSwitchValue(id int) (float64, error) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	if id < 0 || id >= len(b.cameras) {
 		return 0, fmt.Errorf("invalid camera id %d", id)
 	}
+	if err := b.cameras[id].unavailable; err != nil {
+		return 0, err
+	}
+	if cam := b.cameras[id]; cam.events != nil {
+		return cam.eventValue(), nil
+	}
 	return b.cameras[id].cfg.Value, nil
 }
 
-// SetSwitch turns the IR illuminator for switch id on or off.
+// SetSwitch turns the IR illuminator for switch id on or off. For a
+// brightness switch, on is full brightness and off is zero.
 func (b *Backend) SetSwitch(id int, state bool) error {
+	value := 0.0
+	if state {
+		value = b.GetMax(id)
+		if b.function(id) == FunctionIRMode {
+			value = 1 // on, not auto
+		}
+	}
+	return b.SetSwitchValue(id, value)
+}
+
+// SetSwitchValue sets switch id by numeric value: 0 = off, non-zero = on
+// for the IR illuminator, 0 = off, 1 = on, 2 = auto for the IR mode, or the
+// brightness (rounded to the step) for a brightness switch.
+func (b *Backend) SetSwitchValue(id int, value float64) error {
 	b.mu.RLock()
 	if id < 0 || id >= len(b.cameras) {
 		b.mu.RUnlock()
@@ -211,23 +558,146 @@ func (b *Backend) SetSwitch(id int, state bool) error {
 	cam := b.cameras[id]
 	b.mu.RUnlock()
 
-	if err := cam.setIRLight(state); err != nil {
+	if err := b.availability(id); err != nil {
 		return err
 	}
-	b.mu.Lock()
-	if state {
-		b.cameras[id].cfg.Value = 1
-	} else {
-		b.cameras[id].cfg.Value = 0
+	if cam.cfg.readOnly() {
+		return fmt.Errorf("%w: %s is a read-only %s sensor", backend.ErrInvalidOperation, cam.cfg.Name, cam.cfg.Function)
+	}
+	if cam.cfg.dimmable() {
+		if value < 0 || value > maxBrightness {
+			return fmt.Errorf("%w: brightness %v is outside 0-%d", backend.ErrInvalidValue, value, maxBrightness)
+		}
+		step := b.GetStep(id)
+		value = math.Min(math.Round(value/step)*step, maxBrightness)
+	} else if cam.cfg.Function == FunctionIRMode {
+		value = math.Round(value)
+	} else if value != 0 {
+		value = 1
 	}
+	if err := cam.writeValue(value); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.cameras[id].cfg.Value = value
+	b.cameras[id].updated = time.Now()
 	b.mu.Unlock()
-	log.Printf("[hikvision] camera %d (%s) IR set to %v", id, cam.cfg.Name, state)
+	switch cam.cfg.Function {
+	case FunctionBrightness, FunctionLight:
+		log.Printf("[hikvision] camera %d (%s) brightness set to %v", id, cam.cfg.Name, value)
+	case FunctionMotion:
+		log.Printf("[hikvision] camera %d (%s) motion detection set to %v", id, cam.cfg.Name, value != 0)
+	case FunctionIRMode:
+		log.Printf("[hikvision] camera %d (%s) IR mode set to %s", id, cam.cfg.Name, irModeNames[int(value)])
+	default:
+		log.Printf("[hikvision] camera %d (%s) IR set to %v", id, cam.cfg.Name, value != 0)
+	}
 	return nil
 }
 
-// SetSwitchValue sets the IR illuminator by numeric value (0 = off, non-zero = on).
-func (b *Backend) SetSwitchValue(id int, value float64) error {
-	return b.SetSwitch(id, value != 0)
+// SwitchOptions returns the per-switch options configured for camera id.
+// An IR mode switch without state_names is labelled off, on and auto.
+func (b *Backend) SwitchOptions(id int) backend.SwitchOptions {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.cameras) {
+		return backend.SwitchOptions{}
+	}
+	opts := b.cameras[id].cfg.SwitchOptions
+	if b.cameras[id].cfg.Function == FunctionIRMode && len(opts.StateNames) == 0 {
+		opts.StateNames = append([]string(nil), irModeNames...)
+	}
+	return opts
+}
+
+// function returns the configured function of switch id.
+func (b *Backend) function(id int) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.cameras) {
+		return ""
+	}
+	return b.cameras[id].cfg.Function
+}
+
+// PollInterval returns the background refresh interval for camera id.
+func (b *Backend) PollInterval(id int) time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.cameras) {
+		return 0
+	}
+	return b.cameras[id].cfg.PollInterval(b.settings.PollSeconds)
+}
+
+// PollSwitchValue queries the live value of camera id. A subscribed IR
+// switch returns its cached value without contacting the camera.
+func (b *Backend) PollSwitchValue(id int) (float64, error) {
+	b.mu.RLock()
+	if id < 0 || id >= len(b.cameras) {
+		b.mu.RUnlock()
+		return 0, fmt.Errorf("invalid camera id %d", id)
+	}
+	cam := b.cameras[id]
+	b.mu.RUnlock()
+
+	if err := b.availability(id); err != nil {
+		return 0, err
+	}
+	if cam.subscribed() {
+		return b.GetSwitchValue(id)
+	}
+
+	value, err := cam.readValue()
+	if err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	cam.updated = time.Now()
+	b.mu.Unlock()
+	return value, nil
+}
+
+// SetCachedValue stores a polled IR state for camera id.
+func (b *Backend) SetCachedValue(id int, value float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id < 0 || id >= len(b.cameras) {
+		return
+	}
+	b.cameras[id].cfg.Value = value
+}
+
+// LastUpdated returns when camera id's IR state was last read from or
+// written to the camera, or the zero time if it is still the config value.
+// For an event switch it is when the alarm stream last delivered data, and
+// for a subscribed IR switch the later of the two.
+func (b *Backend) LastUpdated(id int) time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.cameras) {
+		return time.Time{}
+	}
+	cam := b.cameras[id]
+	if cam.events != nil {
+		return cam.events.seen()
+	}
+	if cam.subscribed() && !cam.updated.IsZero() {
+		if seen := cam.irStream.seen(); seen.After(cam.updated) {
+			return seen
+		}
+	}
+	return cam.updated
+}
+
+// InvalidateCache clears camera id's hardware stamp, so its value reads as
+// unverified until it is next read from the camera.
+func (b *Backend) InvalidateCache(id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id >= 0 && id < len(b.cameras) {
+		b.cameras[id].updated = time.Time{}
+	}
 }
 
 // Configs returns a snapshot of all camera configs (for config persistence).
@@ -243,27 +713,50 @@ func (b *Backend) Configs() []CameraConfig {
 
 // ---------- low-level ISAPI calls ----------
 
-// hardwareService is the XML envelope for /ISAPI/System/Hardware.
-type hardwareService struct {
-	XMLName       xml.Name      `xml:"HardwareService"`
-	IrLightSwitch irLightSwitch `xml:"IrLightSwitch"`
+// isapiURL returns the camera URL for an ISAPI path, honouring base_path.
+func (c *camera) isapiURL(path string) string {
+	base := strings.Trim(c.cfg.BasePath, "/")
+	if base != "" {
+		base = "/" + base
+	}
+	return fmt.Sprintf("http://%s%s%s", c.cfg.Host, base, path)
 }
 
-type irLightSwitch struct {
-	Mode string `xml:"mode"`
+// headerTransport adds fixed headers to every request before passing it on.
+type headerTransport struct {
+	headers map[string]string
+	next    http.RoundTripper
 }
 
-func (c *camera) setIRLight(on bool) error {
-	mode := "close"
-	if on {
-		mode = "open"
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
 	}
-	payload, err := xml.Marshal(hardwareService{IrLightSwitch: irLightSwitch{Mode: mode}})
+	return t.next.RoundTrip(req)
+}
+
+// getDocument fetches the raw XML document at an ISAPI path.
+func (c *camera) getDocument(path string) ([]byte, error) {
+	url := c.isapiURL(path)
+	resp, err := c.client.Get(url)
 	if err != nil {
-		return fmt.Errorf("marshal xml: %w", err)
+		return nil, fmt.Errorf("GET %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	backend.Tracef("hikvision GET %s response %d: %s", url, resp.StatusCode, backend.Redact(string(body), c.password()))
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{code: resp.StatusCode, body: string(body)}
 	}
-	url := fmt.Sprintf("http://%s/ISAPI/System/Hardware", c.cfg.Host)
-	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(xml.Header+string(payload)))
+	return body, nil
+}
+
+// putDocument sends an XML document to an ISAPI path.
+func (c *camera) putDocument(path string, body []byte) error {
+	url := c.isapiURL(path)
+	backend.Tracef("hikvision PUT %s request: %s", url, backend.Redact(string(body), c.password()))
+	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(string(body)))
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
@@ -273,26 +766,60 @@ func (c *camera) setIRLight(on bool) error {
 		return fmt.Errorf("PUT %s: %w", url, err)
 	}
 	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
+	respBody, _ := io.ReadAll(resp.Body)
+	backend.Tracef("hikvision PUT %s response %d: %s", url, resp.StatusCode, backend.Redact(string(respBody), c.password()))
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("camera returned %d: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("PUT %s: %w", url, &statusError{code: resp.StatusCode, body: string(respBody)})
 	}
 	return nil
 }
 
-func (c *camera) getIRLight() (bool, error) {
-	url := fmt.Sprintf("http://%s/ISAPI/System/Hardware", c.cfg.Host)
-	resp, err := c.client.Get(url)
+// statusError is a non-200 reply from the camera.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("camera returned %d: %s", e.code, e.body)
+}
+
+// HTTPStatus returns the status code for backend.Retryable.
+func (e *statusError) HTTPStatus() int { return e.code }
+
+const hardwarePath = "/ISAPI/System/Hardware"
+
+// hardwareService is the XML envelope for /ISAPI/System/Hardware.
+type hardwareService struct {
+	XMLName       xml.Name      `xml:"HardwareService"`
+	IrLightSwitch irLightSwitch `xml:"IrLightSwitch"`
+}
+
+type irLightSwitch struct {
+	Mode string `xml:"mode"`
+}
+
+// setHardwareIR switches the IR light through the Hardware service.
+func (c *camera) setHardwareIR(on bool) error {
+	mode := "close"
+	if on {
+		mode = "open"
+	}
+	payload, err := xml.Marshal(hardwareService{IrLightSwitch: irLightSwitch{Mode: mode}})
 	if err != nil {
-		return false, fmt.Errorf("GET %s: %w", url, err)
+		return fmt.Errorf("marshal xml: %w", err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("camera returned %d: %s", resp.StatusCode, string(body))
+	return c.putDocument(hardwarePath, []byte(xml.Header+string(payload)))
+}
+
+// getHardwareIR reads the IR light state from the Hardware service.
+func (c *camera) getHardwareIR() (bool, error) {
+	body, err := c.getDocument(hardwarePath)
+	if err != nil {
+		return false, err
 	}
 	var result hardwareService
-	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := xml.Unmarshal(body, &result); err != nil {
 		return false, fmt.Errorf("decode response: %w", err)
 	}
 	return result.IrLightSwitch.Mode == "open", nil
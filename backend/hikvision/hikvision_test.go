@@ -0,0 +1,713 @@
+package hikvision
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alpaca-switch/backend"
+	"alpaca-switch/internal/testutil"
+)
+
+// newCamera starts a fake camera and a connected backend with one switch
+// configured by cfg, whose Host is filled in.
+func newCamera(t *testing.T, cfg CameraConfig) (*testutil.Hikvision, *Backend) {
+	t.Helper()
+	fake := testutil.NewHikvision()
+	t.Cleanup(fake.Close)
+	cfg.Host = fake.Host()
+	if cfg.Name == "" {
+		cfg.Name = "cam"
+	}
+	b := New([]CameraConfig{cfg}, Settings{})
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(b.Disconnect)
+	return fake, b
+}
+
+func TestIRHardwareService(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{})
+
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatalf("SetSwitch(on): %v", err)
+	}
+	fake.Lock()
+	mode := fake.IRMode
+	fake.Unlock()
+	if mode != "open" {
+		t.Errorf("camera IR mode = %q after switching on, want \"open\"", mode)
+	}
+	if on, err := b.GetSwitch(0); err != nil || !on {
+		t.Errorf("GetSwitch = %v, %v; want true", on, err)
+	}
+
+	fake.Lock()
+	fake.IRMode = "close"
+	fake.Unlock()
+	if on, err := b.GetSwitch(0); err != nil || on {
+		t.Errorf("GetSwitch after the camera switched off = %v, %v; want false", on, err)
+	}
+}
+
+// Without the Hardware service the backend falls back to the IR-cut filter
+// and keeps using it.
+func TestIRFallsBackToIrcut(t *testing.T) {
+	fake := testutil.NewHikvision()
+	defer fake.Close()
+	fake.NoHardware = true
+	b := New([]CameraConfig{{Name: "cam", Host: fake.Host()}}, Settings{})
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatalf("SetSwitch(on): %v", err)
+	}
+	fake.Lock()
+	defer fake.Unlock()
+	if fake.IrcutFilterType != "night" {
+		t.Errorf("IR-cut filter = %q, want \"night\"", fake.IrcutFilterType)
+	}
+}
+
+// ir_paths can put the IR-cut filter first, so the Hardware service is
+// never used even where the camera offers it.
+func TestIRPathsOrder(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{IRPaths: []string{IRPathIrcut, IRPathHardware}})
+
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatalf("SetSwitch(on): %v", err)
+	}
+	fake.Lock()
+	filter, mode := fake.IrcutFilterType, fake.IRMode
+	fake.IrcutFilterType = "day"
+	fake.Unlock()
+	if filter != "night" || mode != "close" {
+		t.Errorf("IR-cut filter %q, Hardware IR mode %q; want night and untouched close", filter, mode)
+	}
+	if on, err := b.GetSwitch(0); err != nil || on {
+		t.Errorf("GetSwitch after the filter went to day = %v, %v; want false", on, err)
+	}
+
+	if err := (CameraConfig{Name: "cam", Host: "h", IRPaths: []string{"isapi"}}).Validate(); err == nil {
+		t.Error("Validate accepted an unknown ir_paths entry")
+	}
+}
+
+func TestDigestAuthentication(t *testing.T) {
+	fake := testutil.NewHikvision()
+	defer fake.Close()
+	fake.Username, fake.Password = "admin", "secret"
+
+	good := New([]CameraConfig{{Name: "cam", Host: fake.Host(), Username: "admin", Password: "secret"}}, Settings{})
+	if err := good.SetSwitch(0, true); err != nil {
+		t.Errorf("SetSwitch with the right password: %v", err)
+	}
+
+	bad := New([]CameraConfig{{Name: "cam", Host: fake.Host(), Username: "admin", Password: "wrong"}}, Settings{})
+	err := bad.SetSwitch(0, false)
+	var status backend.HTTPStatuser
+	if !errors.As(err, &status) || status.HTTPStatus() != http.StatusUnauthorized {
+		t.Errorf("SetSwitch with the wrong password = %v, want HTTP 401", err)
+	}
+}
+
+// A failed write leaves the cached value alone.
+func TestFailedWriteKeepsCache(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{})
+	fake.Lock()
+	fake.FailStatus = http.StatusInternalServerError
+	fake.Unlock()
+
+	if err := b.SetSwitch(0, true); err == nil {
+		t.Fatal("SetSwitch succeeded against a failing camera")
+	}
+	if v, _ := b.GetSwitchValue(0); v != 0 {
+		t.Errorf("cached value = %v after a failed write, want 0", v)
+	}
+}
+
+func TestLightSetsModeAndBrightnessTogether(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{Function: FunctionLight, Light: "white"})
+
+	if err := b.SetSwitchValue(0, 40); err != nil {
+		t.Fatalf("SetSwitchValue(40): %v", err)
+	}
+	fake.Lock()
+	mode, white, puts := fake.LightMode, fake.WhiteBrightness, 0
+	for _, r := range fake.Requests {
+		if r == "PUT /ISAPI/Image/channels/1/supplementLight" {
+			puts++
+		}
+	}
+	fake.Unlock()
+	if mode != "colorVuWhiteLight" || white != 40 {
+		t.Errorf("camera light = %q at %d, want colorVuWhiteLight at 40", mode, white)
+	}
+	if puts != 1 {
+		t.Errorf("%d supplementLight PUTs, want 1", puts)
+	}
+
+	if err := b.SetSwitchValue(0, 0); err != nil {
+		t.Fatalf("SetSwitchValue(0): %v", err)
+	}
+	if v, err := b.PollSwitchValue(0); err != nil || v != 0 {
+		t.Errorf("PollSwitchValue after switching off = %v, %v; want 0", v, err)
+	}
+}
+
+func TestBrightness(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{Function: FunctionBrightness, BrightnessStep: 10})
+
+	if err := b.SetSwitchValue(0, 64); err != nil {
+		t.Fatalf("SetSwitchValue(64): %v", err)
+	}
+	fake.Lock()
+	got := fake.IRBrightness
+	fake.Unlock()
+	if got != 60 {
+		t.Errorf("IR brightness = %d, want 60 (rounded to the step)", got)
+	}
+	if err := b.SetSwitchValue(0, 101); !errors.Is(err, backend.ErrInvalidValue) {
+		t.Errorf("SetSwitchValue(101) = %v, want ErrInvalidValue", err)
+	}
+}
+
+// The motion switch flips only the top-level <enabled> element and sends
+// the rest of the camera's document back unchanged.
+func TestMotionSwitch(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{Name: "Roof cam", MotionSwitch: true})
+	if n := b.NumSwitches(); n != 2 || b.GetName(1) != "Roof cam motion detection" {
+		t.Fatalf("switches = %d, second %q; want the IR switch and \"Roof cam motion detection\"", n, b.GetName(1))
+	}
+
+	if err := b.SetSwitch(1, true); err != nil {
+		t.Fatalf("SetSwitch(motion, on): %v", err)
+	}
+	fake.Lock()
+	enabled, doc, ir := fake.MotionEnabled, fake.MotionDocument, fake.IRMode
+	fake.Unlock()
+	if !enabled {
+		t.Error("motion detection still disabled after switching on")
+	}
+	if ir != "close" {
+		t.Errorf("IR mode = %q, want the IR switch left alone", ir)
+	}
+	if !strings.Contains(doc, "<HumanRecognitionModeSearchCfg>\n<enabled>false</enabled>") || !strings.Contains(doc, "<gridMap>fffffc") {
+		t.Errorf("nested settings not sent back unchanged:\n%s", doc)
+	}
+
+	fake.Lock()
+	fake.MotionEnabled = false
+	fake.Unlock()
+	if on, err := b.GetSwitch(1); err != nil || on {
+		t.Errorf("GetSwitch(motion) after the camera disabled it = %v, %v; want false", on, err)
+	}
+}
+
+func TestDeviceInfoAction(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{Name: "Roof cam"})
+	fake.Lock()
+	fake.Model, fake.Serial, fake.Firmware = "DS-2CD2387G2", "SN123", "V5.7.3"
+	fake.Unlock()
+
+	out, err := b.Action(actionGetDeviceInfo, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info deviceInfo
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatalf("decoding %s: %v", out, err)
+	}
+	if info.Model != "DS-2CD2387G2" || info.SerialNumber != "SN123" || info.FirmwareVersion != "V5.7.3" || info.Name != "Roof cam" {
+		t.Errorf("device info = %+v", info)
+	}
+
+	// For every camera, an unreachable one reports its error in place.
+	fake.Lock()
+	fake.FailStatus = http.StatusServiceUnavailable
+	fake.Unlock()
+	out, err = b.Action(actionGetDeviceInfo, -1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos []deviceInfo
+	if err := json.Unmarshal([]byte(out), &infos); err != nil {
+		t.Fatalf("decoding %s: %v", out, err)
+	}
+	if len(infos) != 1 || infos[0].Error == "" || infos[0].Host != fake.Host() {
+		t.Errorf("device info for all cameras = %+v, want one entry with an error", infos)
+	}
+
+	if _, err := b.Action("nosuchaction", 0, ""); !errors.Is(err, backend.ErrActionNotImplemented) {
+		t.Errorf("unknown action = %v, want ErrActionNotImplemented", err)
+	}
+}
+
+// Before the camera answers, the value from config is served and flagged
+// as unconfirmed; a successful read stamps it.
+func TestConfigValueBeforeConnect(t *testing.T) {
+	fake := testutil.NewHikvision()
+	defer fake.Close()
+	fake.Lock()
+	fake.IRMode = "open"
+	fake.Unlock()
+	b := New([]CameraConfig{{Name: "cam", Host: fake.Host(), Value: 1}}, Settings{})
+
+	if v, err := b.GetSwitchValue(0); err != nil || v != 1 {
+		t.Errorf("GetSwitchValue before Connect = %v, %v; want the config value 1", v, err)
+	}
+	if u := b.LastUpdated(0); !u.IsZero() {
+		t.Errorf("LastUpdated before Connect = %v, want zero (stale)", u)
+	}
+
+	if _, err := b.GetSwitch(0); err != nil {
+		t.Fatal(err)
+	}
+	if u := b.LastUpdated(0); u.IsZero() {
+		t.Error("LastUpdated still zero after reading the camera")
+	}
+}
+
+// slowCamera starts a fake camera behind a proxy that holds every request
+// for delay.
+func slowCamera(t *testing.T, delay time.Duration) (*testutil.Hikvision, string) {
+	t.Helper()
+	fake := testutil.NewHikvision()
+	t.Cleanup(fake.Close)
+	target, _ := url.Parse(fake.URL)
+	forward := httputil.NewSingleHostReverseProxy(target)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		forward.ServeHTTP(w, r)
+	}))
+	t.Cleanup(proxy.Close)
+	return fake, strings.TrimPrefix(proxy.URL, "http://")
+}
+
+func TestConnectModes(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	fake, host := slowCamera(t, delay)
+	fake.Lock()
+	fake.IRMode = "open"
+	fake.Unlock()
+	cams := func() []CameraConfig {
+		return []CameraConfig{{Name: "a", Host: host}, {Name: "b", Host: host}, {Name: "c", Host: host}}
+	}
+
+	b := New(cams(), Settings{ConnectMode: ConnectEagerParallel})
+	start := time.Now()
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d >= 3*delay {
+		t.Errorf("eager_parallel Connect took %v for 3 cameras at %v each; want them queried together", d, delay)
+	}
+	for id := 0; id < 3; id++ {
+		if v, _ := b.GetSwitchValue(id); v != 1 {
+			t.Errorf("camera %d = %v after eager_parallel Connect, want 1", id, v)
+		}
+	}
+	b.Disconnect()
+
+	fake.Lock()
+	fake.Requests = nil
+	fake.Unlock()
+	lazy := cams()
+	lazy[1].Value = 1
+	b = New(lazy, Settings{ConnectMode: ConnectLazy})
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+	fake.Lock()
+	requests := len(fake.Requests)
+	fake.Unlock()
+	if requests != 0 {
+		t.Errorf("lazy Connect sent %d requests, want none", requests)
+	}
+	if v, _ := b.GetSwitchValue(1); v != 1 || !b.IsConnected() {
+		t.Errorf("lazy Connect: camera 1 = %v, connected %v; want the cached 1 and connected", v, b.IsConnected())
+	}
+}
+
+// With base_path and headers the camera is reached through a reverse
+// proxy: every request carries the prefix and the extra headers.
+func TestReverseProxy(t *testing.T) {
+	fake := testutil.NewHikvision()
+	defer fake.Close()
+	target, _ := url.Parse(fake.URL)
+	forward := httputil.NewSingleHostReverseProxy(target)
+
+	var mu sync.Mutex
+	var bad []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := strings.CutPrefix(r.URL.Path, "/cams/roof")
+		if !ok || r.Header.Get("X-Api-Key") != "k1" {
+			mu.Lock()
+			bad = append(bad, r.Method+" "+r.URL.Path+" key="+r.Header.Get("X-Api-Key"))
+			mu.Unlock()
+			http.NotFound(w, r)
+			return
+		}
+		r.URL.Path = path
+		forward.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	b := New([]CameraConfig{{
+		Name:     "cam",
+		Host:     strings.TrimPrefix(proxy.URL, "http://"),
+		BasePath: "/cams/roof/",
+		Headers:  map[string]string{"X-Api-Key": "k1"},
+	}}, Settings{})
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatalf("SetSwitch through the proxy: %v", err)
+	}
+	if on, err := b.GetSwitch(0); err != nil || !on {
+		t.Errorf("GetSwitch through the proxy = %v, %v; want true", on, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bad) > 0 {
+		t.Errorf("requests without the prefix or headers: %v", bad)
+	}
+}
+
+func TestDescriptionTemplate(t *testing.T) {
+	settings := Settings{CommonSettings: backend.CommonSettings{DescriptionTemplate: "{name} {function} on {host}"}}
+	b := New([]CameraConfig{
+		{Name: "Roof cam", Host: "10.0.0.9"},
+		{Name: "Dome cam", Host: "10.0.0.10", Function: FunctionMotion},
+		{Name: "Pier cam", Host: "10.0.0.11", Description: "Pier IR"},
+	}, settings)
+	for id, want := range []string{"Roof cam ir on 10.0.0.9", "Dome cam motion on 10.0.0.10", "Pier IR"} {
+		if got := b.GetDescription(id); got != want {
+			t.Errorf("GetDescription(%d) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+// With cached_on_error a failed live read reports the cached value instead
+// of an error; without it the error reaches the client.
+func TestCachedOnError(t *testing.T) {
+	fake := testutil.NewHikvision()
+	defer fake.Close()
+	fake.FailStatus = http.StatusServiceUnavailable
+	cams := []CameraConfig{{Name: "cam", Host: fake.Host(), Value: 1}}
+
+	lenient := backend.NewRouter([]backend.SwitchBackend{New(cams, Settings{CachedOnError: true})}, backend.Options{})
+	if on, err := lenient.GetSwitch(0); err != nil || !on {
+		t.Errorf("GetSwitch with cached_on_error = %v, %v; want the cached true", on, err)
+	}
+
+	strict := backend.NewRouter([]backend.SwitchBackend{New(cams, Settings{})}, backend.Options{})
+	if _, err := strict.GetSwitch(0); err == nil {
+		t.Error("GetSwitch without cached_on_error succeeded against a failing camera")
+	}
+}
+
+func TestParseTemperature(t *testing.T) {
+	for _, tc := range []struct {
+		name, doc string
+		want      float64
+		ok        bool
+	}{
+		{"deviceTemperature", `<DeviceStatus version="2.0"><deviceTemperature>38.5</deviceTemperature></DeviceStatus>`, 38.5, true},
+		{"TempInfo list", `<DeviceStatus><TempInfoList><TempInfo><id>1</id><temperature> -7 </temperature></TempInfo></TempInfoList></DeviceStatus>`, -7, true},
+		{"CPU element", `<DeviceStatus><CPUList><CPU><cpuUtilization>12</cpuUtilization></CPU></CPUList><Temperature>41</Temperature></DeviceStatus>`, 41, true},
+		{"no temperature", `<DeviceStatus><CPUList><CPU><cpuUtilization>12</cpuUtilization></CPU></CPUList></DeviceStatus>`, 0, false},
+	} {
+		v, err := parseTemperature([]byte(tc.doc))
+		if (err == nil) != tc.ok || v != tc.want {
+			t.Errorf("%s: parseTemperature = %v, %v; want %v (ok %v)", tc.name, v, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestTemperatureSwitch(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{Function: FunctionTemperature, TemperatureMin: -20, TemperatureMax: 60})
+	fake.Lock()
+	fake.Temperature = 42.3
+	fake.Unlock()
+	if v, err := b.PollSwitchValue(0); err != nil || v != 42.3 {
+		t.Errorf("PollSwitchValue = %v, %v; want 42.3", v, err)
+	}
+	if b.GetCanWrite(0) {
+		t.Error("temperature switch reports CanWrite")
+	}
+	if min, max := b.GetMin(0), b.GetMax(0); min != -20 || max != 60 {
+		t.Errorf("range = %v-%v, want the configured -20-60", min, max)
+	}
+}
+
+// waitFor polls cond every 10ms until it holds or timeout passes.
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// Event switches follow the alarm stream: on while their event is active,
+// off once the hold time passes, and the stream reconnects after the
+// camera drops it.
+func TestEventSwitches(t *testing.T) {
+	fake := testutil.NewHikvision()
+	defer fake.Close()
+	b := New([]CameraConfig{{Name: "cam", Host: fake.Host(), EventSwitches: []string{"motion", "tamper"}}},
+		Settings{EventHoldSeconds: 1})
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+	if n := b.NumSwitches(); n != 3 || b.GetName(1) != "cam motion" || b.GetName(2) != "cam tamper" {
+		t.Fatalf("%d switches named %q, %q; want cam, cam motion, cam tamper", n, b.GetName(1), b.GetName(2))
+	}
+	if b.GetCanWrite(1) {
+		t.Error("event switch reports CanWrite")
+	}
+	if !waitFor(2*time.Second, func() bool { return fake.EventStreams() == 1 }) {
+		t.Fatal("alarm stream not opened")
+	}
+
+	value := func(id int) float64 {
+		v, _ := b.PollSwitchValue(id)
+		return v
+	}
+	fake.SendEvent("VMD", "active")
+	if !waitFor(2*time.Second, func() bool { return value(1) == 1 }) {
+		t.Fatal("motion switch not on after a VMD alert")
+	}
+	if value(2) != 0 {
+		t.Error("tamper switch on after a VMD alert")
+	}
+	if !waitFor(3*time.Second, func() bool { return value(1) == 0 }) {
+		t.Error("motion switch still on after the hold time")
+	}
+
+	fake.CloseEventStreams()
+	if !waitFor(5*time.Second, func() bool { return fake.EventStreams() == 1 }) {
+		t.Fatal("alarm stream not reopened after the camera closed it")
+	}
+	fake.SendEvent("shelteralarm", "active")
+	if !waitFor(2*time.Second, func() bool { return value(2) == 1 }) {
+		t.Error("tamper switch not on after a shelteralarm alert on the new stream")
+	}
+}
+
+// An ir_mode switch maps 0, 1 and 2 to the IR-cut filter's day, night and
+// auto modes, both ways.
+func TestIRModeSwitch(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{Function: FunctionIRMode})
+	if max := b.GetMax(0); max != 2 {
+		t.Errorf("GetMax = %v, want 2", max)
+	}
+	for value, mode := range []string{"day", "night", "auto"} {
+		if err := b.SetSwitchValue(0, float64(value)); err != nil {
+			t.Fatalf("SetSwitchValue(%d): %v", value, err)
+		}
+		fake.Lock()
+		got := fake.IrcutFilterType
+		fake.Unlock()
+		if got != mode {
+			t.Errorf("SetSwitchValue(%d) set IrcutFilterType %q, want %q", value, got, mode)
+		}
+	}
+	for value, mode := range []string{"day", "night", "auto"} {
+		fake.Lock()
+		fake.IrcutFilterType = mode
+		fake.Unlock()
+		if v, err := b.PollSwitchValue(0); err != nil || v != float64(value) {
+			t.Errorf("IrcutFilterType %q read as %v, %v; want %d", mode, v, err, value)
+		}
+	}
+	if err := b.SetSwitchValue(0, 3); !errors.Is(err, backend.ErrInvalidValue) {
+		t.Errorf("SetSwitchValue(3) = %v, want ErrInvalidValue", err)
+	}
+	if names := b.SwitchOptions(0).StateNames; !slices.Equal(names, []string{"off", "on", "auto"}) {
+		t.Errorf("state names = %v, want off, on, auto", names)
+	}
+}
+
+// With ir_subscription, a pushed day/night event updates the cached IR
+// state, and reads are answered from the cache while the stream is up.
+func TestIRSubscription(t *testing.T) {
+	fake := testutil.NewHikvision()
+	defer fake.Close()
+	b := New([]CameraConfig{{Name: "cam", Host: fake.Host()}}, Settings{IRSubscription: true})
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+	if !waitFor(2*time.Second, func() bool { return fake.EventStreams() == 1 }) {
+		t.Fatal("alarm stream not opened")
+	}
+	cached := func() float64 {
+		v, _ := b.GetSwitchValue(0)
+		return v
+	}
+
+	fake.Lock()
+	fake.IRMode = "open"
+	fake.Unlock()
+	fake.SendEvent("dayNightSwitch", "active")
+	if !waitFor(2*time.Second, func() bool { return cached() == 1 }) {
+		t.Fatal("cached IR state not updated by the pushed change")
+	}
+
+	fake.Lock()
+	fake.Requests = nil
+	fake.Unlock()
+	for i := 0; i < 3; i++ {
+		if v, err := b.PollSwitchValue(0); err != nil || v != 1 {
+			t.Errorf("PollSwitchValue = %v, %v; want the cached 1", v, err)
+		}
+	}
+	fake.Lock()
+	defer fake.Unlock()
+	if len(fake.Requests) != 0 {
+		t.Errorf("subscribed reads sent %v, want no requests", fake.Requests)
+	}
+}
+
+// A camera lacking the service its switch needs is found on Connect; the
+// switch then fails with a persistent, actionable error without contacting
+// the camera, and Health reports it until a later Connect finds the service.
+func TestMissingCapability(t *testing.T) {
+	fake := testutil.NewHikvision()
+	defer fake.Close()
+	fake.NoHardware = true
+	b := New([]CameraConfig{{Name: "cam", Host: fake.Host(), IRPaths: []string{IRPathHardware}}}, Settings{})
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+
+	fake.Lock()
+	fake.Requests = nil
+	fake.Unlock()
+	err := b.SetSwitch(0, true)
+	if err == nil || !strings.Contains(err.Error(), `does not support function "ir"`) || !strings.Contains(err.Error(), "System Service → Hardware") {
+		t.Errorf("SetSwitch = %v, want the capability error with its hint", err)
+	}
+	if _, err2 := b.PollSwitchValue(0); err2 == nil || err2.Error() != err.Error() {
+		t.Errorf("PollSwitchValue = %v, want the same persistent error", err2)
+	}
+	fake.Lock()
+	requests := fake.Requests
+	fake.Unlock()
+	if len(requests) != 0 {
+		t.Errorf("unavailable switch sent %v", requests)
+	}
+	if err := b.Health(); err == nil || !strings.Contains(err.Error(), "switch 0 (cam)") {
+		t.Errorf("Health = %v, want the unavailable switch listed", err)
+	}
+
+	fake.Lock()
+	fake.NoHardware = false
+	fake.Unlock()
+	b.Disconnect()
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Errorf("SetSwitch after the service appeared: %v", err)
+	}
+	if err := b.Health(); err != nil {
+		t.Errorf("Health after the service appeared = %v", err)
+	}
+}
+
+// After the camera password changes, the reauth action picks up the new
+// credentials from the credential source and the camera works again.
+func TestReauth(t *testing.T) {
+	fake := testutil.NewHikvision()
+	defer fake.Close()
+	fake.Username, fake.Password = "admin", "new-secret"
+	cfg := CameraConfig{Name: "cam", Host: fake.Host(), Username: "admin", Password: "old-secret"}
+	b := New([]CameraConfig{cfg}, Settings{})
+
+	if _, err := b.PollSwitchValue(0); err == nil {
+		t.Fatal("PollSwitchValue with the old password succeeded")
+	}
+	if _, err := b.Action(actionReauth, 0, ""); !errors.Is(err, backend.ErrInvalidOperation) {
+		t.Errorf("reauth without a credential source = %v, want ErrInvalidOperation", err)
+	}
+
+	cfg.Password = "new-secret"
+	b.SetCredentialSource(func() ([]CameraConfig, error) { return []CameraConfig{cfg}, nil })
+	out, err := b.Action(actionReauth, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []reauthResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil || len(results) != 1 || results[0].Error != "" || results[0].Value == nil {
+		t.Errorf("reauth result = %s (%v), want one successful re-read", out, err)
+	}
+	if _, err := b.PollSwitchValue(0); err != nil {
+		t.Errorf("PollSwitchValue after reauth: %v", err)
+	}
+}
+
+// When one of a camera's services rejects a write, the error names it, the
+// switch keeps its last confirmed value, and the camera's other switches
+// carry on unaffected.
+func TestPartialFailure(t *testing.T) {
+	fake := testutil.NewHikvision()
+	defer fake.Close()
+	b := New([]CameraConfig{
+		{Name: "IR", Host: fake.Host()},
+		{Name: "White light", Host: fake.Host(), Function: FunctionLight, Light: "white"},
+		{Name: "Motion", Host: fake.Host(), Function: FunctionMotion},
+	}, Settings{})
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+	for id, v := range []float64{1, 60, 1} {
+		if err := b.SetSwitchValue(id, v); err != nil {
+			t.Fatalf("SetSwitchValue(%d, %v): %v", id, v, err)
+		}
+	}
+
+	fake.Lock()
+	fake.FailPuts = map[string]int{"/ISAPI/Image/channels/1/supplementLight": http.StatusForbidden}
+	fake.Unlock()
+	err := b.SetSwitchValue(1, 20)
+	if err == nil || !strings.Contains(err.Error(), "supplementLight") || !strings.Contains(err.Error(), "403") {
+		t.Errorf("SetSwitchValue on the failing light = %v, want an error naming supplementLight and the status", err)
+	}
+	if v, _ := b.GetSwitchValue(1); v != 60 {
+		t.Errorf("light cached at %v after the failed write, want its last value 60", v)
+	}
+	if v, err := b.PollSwitchValue(1); err != nil || v != 60 {
+		t.Errorf("light on the camera = %v, %v; want 60", v, err)
+	}
+
+	if err := b.SetSwitch(0, false); err != nil {
+		t.Errorf("SetSwitch(IR) while the light fails: %v", err)
+	}
+	for id, want := range []float64{0, 60, 1} {
+		cached, _ := b.GetSwitchValue(id)
+		live, err := b.PollSwitchValue(id)
+		if err != nil || cached != want || live != want {
+			t.Errorf("switch %d: cached %v, camera %v (%v); want %v", id, cached, live, err, want)
+		}
+	}
+}
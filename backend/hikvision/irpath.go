@@ -0,0 +1,164 @@
+package hikvision
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"alpaca-switch/backend"
+)
+
+// IR control endpoints selectable with CameraConfig.IRPaths.
+const (
+	// IRPathHardware uses IrLightSwitch in /ISAPI/System/Hardware.
+	IRPathHardware = "hardware"
+	// IRPathIrcut uses the day/night IR-cut filter in the imaging API, for
+	// firmware without the Hardware service: night is on, day is off.
+	IRPathIrcut = "ircut"
+)
+
+// defaultIRPaths is tried in order when a camera has no ir_paths.
+var defaultIRPaths = []string{IRPathHardware, IRPathIrcut}
+
+const ircutFilterPath = "/ISAPI/Image/channels/1/IrcutFilter"
+
+// ircutFilterType matches the IrcutFilter mode element ("day", "night" or
+// "auto").
+var ircutFilterType = regexp.MustCompile(`(<IrcutFilterType>)([^<]*)(</IrcutFilterType>)`)
+
+// irPaths returns the IR endpoints to try, in order. It takes a pointer so
+// that a read does not copy cfg, whose Value a pushed refresh may be
+// updating at the same time.
+func (cfg *CameraConfig) irPaths() []string {
+	if len(cfg.IRPaths) == 0 {
+		return defaultIRPaths
+	}
+	return cfg.IRPaths
+}
+
+// withIRPath runs fn against the camera's IR endpoint. Until one has worked,
+// each configured path is tried in turn, moving on when the camera answers
+// 404 or 400 (the service does not exist on this firmware); the first path
+// that succeeds is remembered for later calls.
+func (c *camera) withIRPath(fn func(path string) error) error {
+	paths := c.cfg.irPaths()
+	if i := int(c.irPath.Load()); i > 0 && i <= len(paths) {
+		return fn(paths[i-1])
+	}
+	var err error
+	for i, path := range paths {
+		err = fn(path)
+		if missingService(err) {
+			continue
+		}
+		if err == nil {
+			c.irPath.Store(int32(i + 1))
+			if i > 0 {
+				log.Printf("[hikvision] camera %s: using %q for IR control", c.cfg.Name, path)
+			}
+		}
+		return err
+	}
+	return err
+}
+
+func (c *camera) setIRLight(on bool) error {
+	return c.withIRPath(func(path string) error {
+		if path == IRPathIrcut {
+			return c.setIrcutIR(on)
+		}
+		return c.setHardwareIR(on)
+	})
+}
+
+func (c *camera) getIRLight() (bool, error) {
+	var on bool
+	err := c.withIRPath(func(path string) error {
+		var err error
+		if path == IRPathIrcut {
+			on, err = c.getIrcutIR()
+		} else {
+			on, err = c.getHardwareIR()
+		}
+		return err
+	})
+	return on, err
+}
+
+// getIrcutIR reports whether the IR-cut filter is in night mode. "auto"
+// reads as off.
+func (c *camera) getIrcutIR() (bool, error) {
+	mode, err := c.getIrcutMode()
+	return mode == "night", err
+}
+
+// setIrcutIR switches the IR-cut filter to night (on) or day (off).
+func (c *camera) setIrcutIR(on bool) error {
+	mode := "day"
+	if on {
+		mode = "night"
+	}
+	return c.setIrcutMode(mode)
+}
+
+// getIrcutMode reads the IR-cut filter mode: "day", "night" or "auto".
+func (c *camera) getIrcutMode() (string, error) {
+	doc, err := c.getDocument(ircutFilterPath)
+	if err != nil {
+		return "", err
+	}
+	m := ircutFilterType.FindSubmatch(doc)
+	if m == nil {
+		return "", fmt.Errorf("camera does not report IrcutFilterType")
+	}
+	return strings.TrimSpace(string(m[2])), nil
+}
+
+// setIrcutMode sets the IR-cut filter mode, sending back the camera's own
+// document with only the mode changed.
+func (c *camera) setIrcutMode(mode string) error {
+	doc, err := c.getDocument(ircutFilterPath)
+	if err != nil {
+		return err
+	}
+	if !ircutFilterType.Match(doc) {
+		return fmt.Errorf("camera does not report IrcutFilterType")
+	}
+	return c.putDocument(ircutFilterPath, ircutFilterType.ReplaceAll(doc, []byte("${1}"+mode+"${3}")))
+}
+
+// FunctionIRMode exposes the IR illuminator as one three-position switch,
+// 0 off, 1 on and 2 auto, for clients that support multi-value switches.
+// It drives the IR-cut filter, the endpoint that has an auto mode, whatever
+// the camera's ir_paths.
+const FunctionIRMode = "ir_mode"
+
+// irModes are the IR-cut filter modes of a FunctionIRMode switch, indexed
+// by switch value.
+var irModes = []string{"day", "night", "auto"}
+
+// irModeNames label the values of a FunctionIRMode switch for clients.
+var irModeNames = []string{"off", "on", "auto"}
+
+// getIRMode reads the IR-cut filter mode as a FunctionIRMode value.
+func (c *camera) getIRMode() (float64, error) {
+	mode, err := c.getIrcutMode()
+	if err != nil {
+		return 0, err
+	}
+	for value, m := range irModes {
+		if strings.EqualFold(mode, m) {
+			return float64(value), nil
+		}
+	}
+	return 0, fmt.Errorf("camera reports unknown IrcutFilterType %q", mode)
+}
+
+// setIRMode sets the IR-cut filter mode for FunctionIRMode value.
+func (c *camera) setIRMode(value int) error {
+	if value < 0 || value >= len(irModes) {
+		return fmt.Errorf("%w: IR mode %d is not 0 (off), 1 (on) or 2 (auto)", backend.ErrInvalidValue, value)
+	}
+	return c.setIrcutMode(irModes[value])
+}
@@ -0,0 +1,71 @@
+package hikvision
+
+import (
+	"log"
+	"time"
+)
+
+// defaultIREvents are the alarm stream eventTypes taken as an IR or
+// day/night change when Settings.IREvents is unset. Firmware differs; trace
+// logging shows the eventTypes a camera sends.
+var defaultIREvents = []string{"dayNightSwitch", "IRCutFilter"}
+
+// irEvents returns the eventTypes that signal an IR change, or nil if
+// ir_subscription is off.
+func (s Settings) irEvents() []string {
+	if !s.IRSubscription {
+		return nil
+	}
+	if len(s.IREvents) > 0 {
+		return s.IREvents
+	}
+	return defaultIREvents
+}
+
+// irFunction reports whether the switch follows the IR illuminator, and so
+// can be kept up to date by an IR subscription.
+func (cfg CameraConfig) irFunction() bool {
+	return cfg.Function == "" || cfg.Function == FunctionIR || cfg.Function == FunctionIRMode
+}
+
+// subscribed reports whether the camera's IR state is kept current by its
+// alarm stream, so reads can be answered from the cache. While the stream
+// is down or unsupported, reads and polls go to the camera as usual.
+func (c *camera) subscribed() bool {
+	return c.irStream != nil && c.irStream.connected()
+}
+
+// subscribeIR registers every subscribed IR switch's refresh with its
+// camera's alarm stream.
+func (b *Backend) subscribeIR() {
+	for id, cam := range b.cameras {
+		if cam.irStream == nil {
+			continue
+		}
+		id, s := id, cam.irStream
+		s.mu.Lock()
+		s.onIR = append(s.onIR, func() { b.irPushed(id) })
+		s.mu.Unlock()
+	}
+}
+
+// irPushed re-reads switch id after its camera reported an IR change (or
+// its alarm stream reconnected) and caches the result.
+func (b *Backend) irPushed(id int) {
+	b.mu.RLock()
+	cam := b.cameras[id]
+	b.mu.RUnlock()
+	value, err := cam.readValue()
+	if err != nil {
+		log.Printf("[hikvision] warning: camera %d (%s): reading IR state after a pushed change: %v", id, b.GetName(id), err)
+		return
+	}
+	b.mu.Lock()
+	old := cam.cfg.Value
+	cam.cfg.Value = value
+	cam.updated = time.Now()
+	b.mu.Unlock()
+	if old != value {
+		log.Printf("[hikvision] camera %d (%s) IR changed to %v (pushed)", id, b.GetName(id), value)
+	}
+}
@@ -0,0 +1,45 @@
+package hikvision
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const motionDetectionPath = "/ISAPI/System/Video/inputs/channels/1/motionDetection"
+
+// motionEnabled matches the top-level <enabled> element of a MotionDetection
+// document, which precedes the nested layout and region settings.
+var motionEnabled = regexp.MustCompile(`(<enabled>)([^<]*)(</enabled>)`)
+
+// getMotionDetection reports whether motion detection is enabled.
+func (c *camera) getMotionDetection() (bool, error) {
+	doc, err := c.getDocument(motionDetectionPath)
+	if err != nil {
+		return false, err
+	}
+	m := motionEnabled.FindSubmatch(doc)
+	if m == nil {
+		return false, fmt.Errorf("camera does not report motion detection state")
+	}
+	return strings.TrimSpace(string(m[2])) == "true", nil
+}
+
+// setMotionDetection enables or disables motion detection. Like the
+// supplement light, the camera expects the whole document back, so only the
+// first <enabled> element of the current one is changed.
+func (c *camera) setMotionDetection(on bool) error {
+	doc, err := c.getDocument(motionDetectionPath)
+	if err != nil {
+		return err
+	}
+	loc := motionEnabled.FindSubmatchIndex(doc)
+	if loc == nil {
+		return fmt.Errorf("camera does not report motion detection state")
+	}
+	body := make([]byte, 0, len(doc)+1)
+	body = append(body, doc[:loc[4]]...)
+	body = append(body, fmt.Sprint(on)...)
+	body = append(body, doc[loc[5]:]...)
+	return c.putDocument(motionDetectionPath, body)
+}
@@ -0,0 +1,145 @@
+package hikvision
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"alpaca-switch/backend"
+
+	"github.com/icholy/digest"
+)
+
+// actionReauth re-reads the camera credentials from the config and
+// re-probes the camera of one switch (Parameters = switch ID) or of every
+// switch, so a changed camera password needs no restart.
+const actionReauth = "reauth"
+
+// CredentialSource returns the current camera configs, normally by
+// re-reading the config file, for the reauth action.
+type CredentialSource func() ([]CameraConfig, error)
+
+// SetCredentialSource sets where the reauth action reads new credentials
+// from. Without one, reauth fails.
+func (b *Backend) SetCredentialSource(src CredentialSource) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.credentials = src
+}
+
+// authState is one set of camera credentials and the transport that
+// authenticates with them.
+type authState struct {
+	password string
+	rt       http.RoundTripper
+}
+
+// authTransport authenticates camera requests with credentials the reauth
+// action can replace while requests are in flight: each request uses the
+// credentials current when it started. A replacement starts a fresh digest
+// transport, dropping the challenge cached for the old credentials.
+type authTransport struct {
+	state atomic.Pointer[authState]
+}
+
+func newAuthTransport(cfg CameraConfig) *authTransport {
+	t := &authTransport{}
+	t.set(cfg)
+	return t
+}
+
+// set switches to cfg's username, password and headers.
+func (t *authTransport) set(cfg CameraConfig) {
+	var rt http.RoundTripper = &digest.Transport{
+		Username: cfg.Username,
+		Password: cfg.Password,
+	}
+	if len(cfg.Headers) > 0 {
+		rt = &headerTransport{headers: cfg.Headers, next: rt}
+	}
+	t.state.Store(&authState{password: cfg.Password, rt: rt})
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.state.Load().rt.RoundTrip(req)
+}
+
+// password returns the camera's current password, for redacting traces.
+func (c *camera) password() string { return c.auth.state.Load().password }
+
+// reauthResult reports the outcome of reauth for one switch.
+type reauthResult struct {
+	Name  string   `json:"name"`
+	Host  string   `json:"host"`
+	Value *float64 `json:"value,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// reauth loads the credentials for the camera of switch id, or of every
+// switch when id is -1, from the credential source, switches to them and
+// re-reads each affected switch. A switch that was unavailable, or failing
+// with the old password, works again if the read succeeds. Switches whose
+// host is no longer in the config keep their credentials.
+func (b *Backend) reauth(id int) (string, error) {
+	b.mu.RLock()
+	src := b.credentials
+	cams := append([]*camera(nil), b.cameras...)
+	b.mu.RUnlock()
+	if src == nil {
+		return "", fmt.Errorf("%w: no config to read camera credentials from", backend.ErrInvalidOperation)
+	}
+	if id >= len(cams) {
+		return "", fmt.Errorf("invalid camera id %d", id)
+	}
+	cfgs, err := src()
+	if err != nil {
+		return "", fmt.Errorf("reading camera credentials: %w", err)
+	}
+	byHost := make(map[string]CameraConfig)
+	for _, cfg := range cfgs {
+		if _, ok := byHost[cfg.Host]; !ok {
+			byHost[cfg.Host] = cfg
+		}
+	}
+
+	var results []reauthResult
+	for i, cam := range cams {
+		if id >= 0 && cam.cfg.Host != cams[id].cfg.Host {
+			continue
+		}
+		res := reauthResult{Name: b.GetName(i), Host: cam.cfg.Host}
+		cfg, ok := byHost[cam.cfg.Host]
+		if !ok {
+			res.Error = "host is no longer in the config; credentials kept"
+			results = append(results, res)
+			continue
+		}
+		b.mu.Lock()
+		cam.cfg.Username, cam.cfg.Password, cam.cfg.Headers = cfg.Username, cfg.Password, cfg.Headers
+		cam.auth.set(cfg)
+		b.mu.Unlock()
+		log.Printf("[hikvision] camera %d (%s): credentials reloaded", i, res.Name)
+
+		value, err := cam.readValue()
+		if b.checkCapability(i, err) {
+			res.Error = b.availability(i).Error()
+			results = append(results, res)
+			continue
+		}
+		if err != nil {
+			log.Printf("[hikvision] warning: camera %d (%s): re-probe after reauth failed: %v", i, res.Name, err)
+			res.Error = err.Error()
+			results = append(results, res)
+			continue
+		}
+		b.mu.Lock()
+		cam.cfg.Value = value
+		cam.updated = time.Now()
+		b.mu.Unlock()
+		res.Value = &value
+		results = append(results, res)
+	}
+	return marshalAction(results)
+}
@@ -0,0 +1,61 @@
+package hikvision
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// FunctionTemperature reports the camera's internal temperature in degrees
+// Celsius as a read-only value.
+const FunctionTemperature = "temperature"
+
+// Default temperature switch range, covering the operating range of
+// outdoor cameras.
+const (
+	defaultTemperatureMin = -40
+	defaultTemperatureMax = 100
+)
+
+// temperatureStep is the resolution of the temperature switch.
+const temperatureStep = 0.1
+
+const deviceStatusPath = "/ISAPI/System/status"
+
+// temperatureElement matches the first temperature reading in a DeviceStatus
+// document. Firmware differs in the element name (deviceTemperature,
+// Temperature, temperature inside a TempInfo list), so any element whose
+// name ends in "emperature" and holds a number is accepted.
+var temperatureElement = regexp.MustCompile(`<(\w*[Tt]emperature)>\s*(-?\d+(?:\.\d+)?)\s*</`)
+
+// temperatureRange returns the configured temperature_min and
+// temperature_max, or the defaults if neither is set.
+func (cfg CameraConfig) temperatureRange() (float64, float64) {
+	if cfg.TemperatureMin == 0 && cfg.TemperatureMax == 0 {
+		return defaultTemperatureMin, defaultTemperatureMax
+	}
+	return cfg.TemperatureMin, cfg.TemperatureMax
+}
+
+// getTemperature reads the camera's internal temperature from the device
+// status document.
+func (c *camera) getTemperature() (float64, error) {
+	doc, err := c.getDocument(deviceStatusPath)
+	if err != nil {
+		return 0, err
+	}
+	return parseTemperature(doc)
+}
+
+// parseTemperature extracts the temperature from a DeviceStatus document.
+func parseTemperature(doc []byte) (float64, error) {
+	m := temperatureElement.FindSubmatch(doc)
+	if m == nil {
+		return 0, fmt.Errorf("camera does not report a temperature")
+	}
+	v, err := strconv.ParseFloat(string(m[2]), 64)
+	if err != nil {
+		return 0, fmt.Errorf("decode %s: %w", m[1], err)
+	}
+	return v, nil
+}
@@ -0,0 +1,440 @@
+// Package httpjson implements a config-driven SwitchBackend for devices with
+// a JSON-over-HTTP API (Tasmota, Shelly, Home Assistant, ...). Each switch is
+// described entirely in config by request templates for writing and a
+// JSONPath extractor for reading, so new devices need no Go code.
+//
+// Example Tasmota relay:
+//
+//	{
+//	    "name": "Dew heater",
+//	    "set":  {"url": "http://192.168.1.50/cm?cmnd=Power%20{state}"},
+//	    "get":  {"url": "http://192.168.1.50/cm?cmnd=Power", "value_path": "$.POWER"},
+//	    "state_on": "ON", "state_off": "OFF"
+//	}
+//
+// or, with the built-in Tasmota profile (see Profile):
+//
+//	{"name": "Dew heater", "profile": "tasmota-relay", "host": "192.168.1.50"}
+package httpjson
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"alpaca-switch/backend"
+
+	"github.com/icholy/digest"
+)
+
+// SwitchConfig describes one HTTP-controlled switch.
+type SwitchConfig struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+	Step        float64 `json:"step"`
+	ReadOnly    bool    `json:"readonly"`
+	Value       float64 `json:"value"` // cached last-known value
+
+	Auth Auth `json:"auth"`
+
+	// Set is used for every write. On and Off, when present, replace it for
+	// writes of Max and Min respectively (e.g. Home Assistant turn_on/turn_off).
+	Set *RequestTemplate `json:"set"`
+	On  *RequestTemplate `json:"on"`
+	Off *RequestTemplate `json:"off"`
+
+	// Get reads the current value. Without it the cached value is reported.
+	Get *ReadTemplate `json:"get"`
+
+	// StateOn / StateOff are the texts substituted for {state} and
+	// recognised in string responses (default "on" / "off").
+	StateOn  string `json:"state_on"`
+	StateOff string `json:"state_off"`
+
+	// Profile names a built-in Profile supplying the requests and state
+	// texts not set above, for Host and Channel.
+	Profile string `json:"profile,omitempty"`
+	Host    string `json:"host,omitempty"`
+	Channel *int   `json:"channel,omitempty"`
+
+	backend.SwitchOptions
+}
+
+// host returns the host of the switch's first configured request URL, or
+// "" if it has none.
+func (cfg SwitchConfig) host() string {
+	for _, t := range []*RequestTemplate{cfg.Set, cfg.On, cfg.Off} {
+		if t != nil {
+			return urlHost(t.URL)
+		}
+	}
+	if cfg.Get != nil {
+		return urlHost(cfg.Get.URL)
+	}
+	return ""
+}
+
+// urlHost returns the host part of a request URL template.
+func urlHost(raw string) string {
+	if u, err := url.Parse(raw); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+// Settings holds backend-wide options for the httpjson backend.
+type Settings struct {
+	// PollSeconds is the default refresh interval for switches without a
+	// per-switch poll_seconds override. Zero disables background polling.
+	PollSeconds int `json:"poll_seconds"`
+
+	backend.CommonSettings
+}
+
+// httpSwitch is the runtime representation of one switch.
+type httpSwitch struct {
+	cfg    SwitchConfig // with its profile resolved
+	client *http.Client
+	// configured is the switch as configured, before its profile was
+	// resolved, so Configs exports the profile rather than its requests.
+	configured SwitchConfig
+}
+
+// Backend implements backend.SwitchBackend for JSON-over-HTTP devices.
+type Backend struct {
+	mu        sync.RWMutex
+	switches  []*httpSwitch
+	settings  Settings
+	connected bool
+}
+
+const requestTimeout = 5 * time.Second
+
+// New creates an httpjson backend from a list of switch configs.
+func New(cfgs []SwitchConfig, settings Settings) *Backend {
+	switches := make([]*httpSwitch, len(cfgs))
+	for i, cfg := range cfgs {
+		configured := cfg
+		if r, err := cfg.Resolve(); err != nil {
+			log.Printf("[httpjson] warning: switch %d (%s): %v", i, cfg.Name, err)
+		} else {
+			cfg = r
+		}
+		if cfg.Max == 0 && cfg.Min == 0 {
+			cfg.Max = 1
+		}
+		if cfg.Step == 0 {
+			cfg.Step = 1
+		}
+		if cfg.StateOn == "" {
+			cfg.StateOn = "on"
+		}
+		if cfg.StateOff == "" {
+			cfg.StateOff = "off"
+		}
+		client := &http.Client{Timeout: requestTimeout}
+		if strings.EqualFold(cfg.Auth.Mode, "digest") {
+			client.Transport = &digest.Transport{
+				Username: cfg.Auth.Username,
+				Password: cfg.Auth.Password,
+			}
+		}
+		switches[i] = &httpSwitch{cfg: cfg, client: client, configured: configured}
+	}
+	return &Backend{switches: switches, settings: settings}
+}
+
+// Connect refreshes all readable switches and then marks the backend connected.
+func (b *Backend) Connect() error {
+	b.refreshStates()
+	b.mu.Lock()
+	b.connected = true
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *Backend) refreshStates() {
+	var wg sync.WaitGroup
+	for i := range b.switches {
+		if b.switches[i].cfg.Get == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := b.PollSwitchValue(i)
+			if err != nil {
+				log.Printf("[httpjson] warning: switch %d query failed: %v (keeping cached value)", i, err)
+				return
+			}
+			b.SetCachedValue(i, v)
+		}(i)
+	}
+	wg.Wait()
+	log.Println("[httpjson] state refresh complete")
+}
+
+// Disconnect marks the backend disconnected.
+func (b *Backend) Disconnect() {
+	b.mu.Lock()
+	b.connected = false
+	b.mu.Unlock()
+}
+
+// IsConnected reports whether the backend is connected.
+func (b *Backend) IsConnected() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.connected
+}
+
+// BackendType returns "httpjson".
+func (b *Backend) BackendType() string { return "httpjson" }
+
+// ClampsValues reports whether clamp_values is set.
+func (b *Backend) ClampsValues() bool { return b.settings.ClampsValues() }
+
+// OptimizesWrites reports whether write_mode is optimize, and the
+// write_max_age_seconds freshness limit.
+func (b *Backend) OptimizesWrites() (bool, time.Duration) { return b.settings.OptimizesWrites() }
+
+// NamePrefix returns the name_prefix setting.
+func (b *Backend) NamePrefix() string { return b.settings.NamePrefix }
+
+// NumSwitches returns the number of configured switches.
+func (b *Backend) NumSwitches() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.switches)
+}
+
+func (b *Backend) get(id int) (*httpSwitch, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.switches) {
+		return nil, fmt.Errorf("invalid switch id %d", id)
+	}
+	return b.switches[id], nil
+}
+
+// GetName returns the name of switch id.
+func (b *Backend) GetName(id int) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.switches) {
+		return ""
+	}
+	return b.switches[id].cfg.Name
+}
+
+// SetName sets the name of switch id.
+func (b *Backend) SetName(id int, name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id < 0 || id >= len(b.switches) {
+		return fmt.Errorf("invalid switch id %d", id)
+	}
+	b.switches[id].cfg.Name = name
+	return nil
+}
+
+// GetDescription returns the description of switch id. Without one it
+// expands description_template ({name}, {host}), falling back to the name.
+func (b *Backend) GetDescription(id int) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.switches) {
+		return ""
+	}
+	cfg := b.switches[id].cfg
+	if cfg.Description != "" {
+		return cfg.Description
+	}
+	if b.settings.DescriptionTemplate != "" {
+		return backend.ExpandDescription(b.settings.DescriptionTemplate, map[string]string{
+			"name": cfg.Name,
+			"host": cfg.host(),
+		})
+	}
+	return cfg.Name
+}
+
+// GetCanWrite reports whether switch id is writable.
+func (b *Backend) GetCanWrite(id int) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.switches) {
+		return false
+	}
+	cfg := b.switches[id].cfg
+	return !cfg.ReadOnly && (cfg.Set != nil || cfg.On != nil || cfg.Off != nil)
+}
+
+// GetMin returns the minimum value of switch id.
+func (b *Backend) GetMin(id int) float64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.switches) {
+		return 0
+	}
+	return b.switches[id].cfg.Min
+}
+
+// GetMax returns the maximum value of switch id.
+func (b *Backend) GetMax(id int) float64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.switches) {
+		return 1
+	}
+	return b.switches[id].cfg.Max
+}
+
+// GetStep returns the step size of switch id.
+func (b *Backend) GetStep(id int) float64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.switches) {
+		return 1
+	}
+	return b.switches[id].cfg.Step
+}
+
+// GetSwitch returns the cached on/off state of switch id.
+func (b *Backend) GetSwitch(id int) (bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.switches) {
+		return false, fmt.Errorf("invalid switch id %d", id)
+	}
+	return b.switches[id].cfg.Value > b.switches[id].cfg.Min, nil
+}
+
+// GetSwitchValue returns the cached value of switch id.
+func (b *Backend) GetSwitchValue(id int) (float64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.switches) {
+		return 0, fmt.Errorf("invalid switch id %d", id)
+	}
+	return b.switches[id].cfg.Value, nil
+}
+
+// SetSwitch writes Max (on) or Min (off) to switch id.
+func (b *Backend) SetSwitch(id int, state bool) error {
+	sw, err := b.get(id)
+	if err != nil {
+		return err
+	}
+	if state {
+		return b.SetSwitchValue(id, sw.cfg.Max)
+	}
+	return b.SetSwitchValue(id, sw.cfg.Min)
+}
+
+// SetSwitchValue sends the configured write request for value to switch id.
+func (b *Backend) SetSwitchValue(id int, value float64) error {
+	sw, err := b.get(id)
+	if err != nil {
+		return err
+	}
+	if !b.GetCanWrite(id) {
+		return errors.New("switch is read-only")
+	}
+	cfg := sw.cfg
+	state := cfg.StateOff
+	if value > cfg.Min {
+		state = cfg.StateOn
+	}
+	tmpl := cfg.Set
+	switch {
+	case value >= cfg.Max && cfg.On != nil:
+		tmpl = cfg.On
+	case value <= cfg.Min && cfg.Off != nil:
+		tmpl = cfg.Off
+	}
+	if tmpl == nil {
+		return fmt.Errorf("no request configured to write value %v", value)
+	}
+	if _, err := tmpl.do(sw.client, cfg.Auth, value, state); err != nil {
+		return err
+	}
+	b.SetCachedValue(id, value)
+	log.Printf("[httpjson] switch %d (%s) set to %v", id, cfg.Name, value)
+	return nil
+}
+
+// SwitchOptions returns the per-switch options configured for switch id.
+func (b *Backend) SwitchOptions(id int) backend.SwitchOptions {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.switches) {
+		return backend.SwitchOptions{}
+	}
+	return b.switches[id].cfg.SwitchOptions
+}
+
+// PollInterval returns the background refresh interval for switch id.
+// Switches without a get request are never polled.
+func (b *Backend) PollInterval(id int) time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.switches) || b.switches[id].cfg.Get == nil {
+		return 0
+	}
+	return b.switches[id].cfg.PollInterval(b.settings.PollSeconds)
+}
+
+// PollSwitchValue performs the get request for switch id and extracts its value.
+func (b *Backend) PollSwitchValue(id int) (float64, error) {
+	sw, err := b.get(id)
+	if err != nil {
+		return 0, err
+	}
+	cfg := sw.cfg
+	if cfg.Get == nil {
+		return 0, errors.New("no get request configured")
+	}
+	data, err := cfg.Get.do(sw.client, cfg.Auth, cfg.Value, "")
+	if err != nil {
+		return 0, err
+	}
+	raw, err := extract(data, cfg.Get.ValuePath)
+	if err != nil {
+		return 0, err
+	}
+	return toValue(raw, cfg.StateOn, cfg.StateOff)
+}
+
+// SetCachedValue stores a value for switch id.
+func (b *Backend) SetCachedValue(id int, value float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id < 0 || id >= len(b.switches) {
+		return
+	}
+	b.switches[id].cfg.Value = value
+}
+
+// Configs returns a snapshot of all switch configs (for config persistence).
+func (b *Backend) Configs() []SwitchConfig {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	out := make([]SwitchConfig, len(b.switches))
+	for i, s := range b.switches {
+		out[i] = s.cfg
+		if s.cfg.Profile != "" {
+			c := s.configured
+			out[i].Set, out[i].On, out[i].Off, out[i].Get = c.Set, c.On, c.Off, c.Get
+			out[i].StateOn, out[i].StateOff = c.StateOn, c.StateOff
+		}
+	}
+	return out
+}
@@ -0,0 +1,207 @@
+package httpjson
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"alpaca-switch/backend"
+)
+
+// device is an httptest server recording the requests it receives and
+// answering each with reply.
+type device struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string // "METHOD /path?query body"
+	headers  []http.Header
+	reply    string
+}
+
+func newDevice(t *testing.T, reply string) *device {
+	d := &device{reply: reply}
+	d.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		req := r.Method + " " + r.URL.RequestURI()
+		if len(body) > 0 {
+			req += " " + string(body)
+		}
+		d.requests = append(d.requests, req)
+		d.headers = append(d.headers, r.Header.Clone())
+		io.WriteString(w, d.reply)
+	}))
+	t.Cleanup(d.Close)
+	return d
+}
+
+// last returns the last request received.
+func (d *device) last() (string, http.Header) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.requests) == 0 {
+		return "", nil
+	}
+	return d.requests[len(d.requests)-1], d.headers[len(d.headers)-1]
+}
+
+func (d *device) setReply(s string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.reply = s
+}
+
+// A Tasmota-style relay: state texts in the URL and a string response.
+func TestTemplateRelay(t *testing.T) {
+	dev := newDevice(t, `{"POWER":"OFF"}`)
+	b := New([]SwitchConfig{{
+		Name:     "Relay",
+		Set:      &RequestTemplate{URL: dev.URL + "/cm?cmnd=Power%20{state}"},
+		Get:      &ReadTemplate{RequestTemplate: RequestTemplate{URL: dev.URL + "/cm?cmnd=Power"}, ValuePath: "$.POWER"},
+		StateOn:  "ON",
+		StateOff: "OFF",
+	}}, Settings{})
+
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if req, _ := dev.last(); req != "GET /cm?cmnd=Power%20ON" {
+		t.Errorf("switching on sent %q", req)
+	}
+	if on, _ := b.GetSwitch(0); !on {
+		t.Error("cached state off after switching on")
+	}
+
+	if v, err := b.PollSwitchValue(0); err != nil || v != 0 {
+		t.Errorf("PollSwitchValue = %v, %v; want 0", v, err)
+	}
+	dev.setReply(`{"POWER":"ON"}`)
+	if v, err := b.PollSwitchValue(0); err != nil || v != 1 {
+		t.Errorf("PollSwitchValue = %v, %v; want 1", v, err)
+	}
+}
+
+// A dimmer with a JSON POST body, bearer auth and a nested numeric reading.
+func TestTemplateDimmer(t *testing.T) {
+	dev := newDevice(t, `{"lights":[{"brightness":42}]}`)
+	b := New([]SwitchConfig{{
+		Name: "Dimmer",
+		Max:  100,
+		Auth: Auth{Mode: "bearer", Token: "t0k"},
+		Set: &RequestTemplate{
+			Method:  http.MethodPost,
+			URL:     dev.URL + "/light",
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    `{"brightness":{value}}`,
+		},
+		Get: &ReadTemplate{RequestTemplate: RequestTemplate{URL: dev.URL + "/state"}, ValuePath: "$.lights[0].brightness"},
+	}}, Settings{})
+
+	if err := b.SetSwitchValue(0, 65); err != nil {
+		t.Fatal(err)
+	}
+	req, header := dev.last()
+	if req != `POST /light {"brightness":65}` {
+		t.Errorf("SetSwitchValue(65) sent %q", req)
+	}
+	if got := header.Get("Authorization"); got != "Bearer t0k" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if v, err := b.PollSwitchValue(0); err != nil || v != 42 {
+		t.Errorf("PollSwitchValue = %v, %v; want 42", v, err)
+	}
+}
+
+// Separate on and off requests replace set for Max and Min.
+func TestTemplateOnOff(t *testing.T) {
+	dev := newDevice(t, `{}`)
+	b := New([]SwitchConfig{{
+		Name: "Scene",
+		On:   &RequestTemplate{Method: http.MethodPost, URL: dev.URL + "/turn_on"},
+		Off:  &RequestTemplate{Method: http.MethodPost, URL: dev.URL + "/turn_off"},
+	}}, Settings{})
+
+	for _, tc := range []struct {
+		on   bool
+		want string
+	}{{true, "POST /turn_on"}, {false, "POST /turn_off"}} {
+		if err := b.SetSwitch(0, tc.on); err != nil {
+			t.Fatal(err)
+		}
+		if req, _ := dev.last(); req != tc.want {
+			t.Errorf("SetSwitch(%v) sent %q, want %q", tc.on, req, tc.want)
+		}
+	}
+}
+
+// A non-2xx reply fails the write and leaves the cache alone.
+func TestTemplateErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	b := New([]SwitchConfig{{Name: "Relay", Set: &RequestTemplate{URL: srv.URL + "/{state}"}}}, Settings{})
+
+	err := b.SetSwitch(0, true)
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("SetSwitch = %v, want a 403 error", err)
+	}
+	if v, _ := b.GetSwitchValue(0); v != 0 {
+		t.Errorf("cached value = %v after a failed write, want 0", v)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	doc := []byte(`{"a":{"b":[true,{"c":"on"}]},"n":1.5}`)
+	for path, want := range map[string]interface{}{
+		"$.a.b[0]":   true,
+		"$.a.b[1].c": "on",
+	} {
+		if got, err := extract(doc, path); err != nil || got != want {
+			t.Errorf("extract(%s) = %v, %v; want %v", path, got, err, want)
+		}
+	}
+	for _, path := range []string{"$.missing", "$.a.b[5]", "$.n.x", "$.a.b[x]"} {
+		if _, err := extract(doc, path); err == nil {
+			t.Errorf("extract(%s) succeeded", path)
+		}
+	}
+}
+
+// With tracing on, request and response bodies are logged with the
+// switch's credentials masked.
+func TestTraceRedactsCredentials(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	backend.SetTrace(true)
+	defer backend.SetTrace(false)
+
+	dev := newDevice(t, `{"ok":true,"token":"s3cr3t"}`)
+	b := New([]SwitchConfig{{
+		Name: "Relay",
+		Auth: Auth{Mode: "bearer", Token: "s3cr3t"},
+		Set:  &RequestTemplate{Method: http.MethodPost, URL: dev.URL + "/set", Body: `{"auth":"s3cr3t","on":{value}}`},
+	}}, Settings{})
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "s3cr3t") {
+		t.Errorf("trace leaks the token: %q", out)
+	}
+	if !strings.Contains(out, `request: {"auth":"***","on":1}`) || !strings.Contains(out, `"token":"***"`) {
+		t.Errorf("trace lacks the redacted bodies: %q", out)
+	}
+}
@@ -0,0 +1,120 @@
+package httpjson
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Profile is a reusable set of request templates for one kind of device,
+// selected with SwitchConfig.Profile so a switch needs only a host instead
+// of full templates. Besides {value} and {state}, its URLs, headers and
+// bodies may contain {host} (SwitchConfig.Host) and {channel}
+// (SwitchConfig.Channel, or DefaultChannel when unset).
+type Profile struct {
+	Set *RequestTemplate
+	On  *RequestTemplate
+	Off *RequestTemplate
+	Get *ReadTemplate
+
+	StateOn  string
+	StateOff string
+
+	// DefaultChannel is substituted for {channel} when the switch sets none.
+	DefaultChannel string
+}
+
+// profiles are the built-in profiles by name.
+var profiles = map[string]Profile{
+	// Tasmota relay. Single-relay devices answer Power with "POWER", so the
+	// channel is left out unless set; multi-relay devices number relays 1-8.
+	"tasmota-relay": {
+		Set:      &RequestTemplate{URL: "http://{host}/cm?cmnd=Power{channel}%20{state}"},
+		Get:      &ReadTemplate{RequestTemplate: RequestTemplate{URL: "http://{host}/cm?cmnd=Power{channel}"}, ValuePath: "$.POWER{channel}"},
+		StateOn:  "ON",
+		StateOff: "OFF",
+	},
+	// Shelly Gen1 (Shelly 1, 1PM, 2.5, Plug S) relay API, relays from 0.
+	"shelly-gen1": {
+		Set:            &RequestTemplate{URL: "http://{host}/relay/{channel}?turn={state}"},
+		Get:            &ReadTemplate{RequestTemplate: RequestTemplate{URL: "http://{host}/relay/{channel}"}, ValuePath: "$.ison"},
+		StateOn:        "on",
+		StateOff:       "off",
+		DefaultChannel: "0",
+	},
+	// Shelly Gen2/Plus RPC Switch component, switch IDs from 0.
+	"shelly-gen2": {
+		Set:            &RequestTemplate{URL: "http://{host}/rpc/Switch.Set?id={channel}&on={state}"},
+		Get:            &ReadTemplate{RequestTemplate: RequestTemplate{URL: "http://{host}/rpc/Switch.GetStatus?id={channel}"}, ValuePath: "$.output"},
+		StateOn:        "true",
+		StateOff:       "false",
+		DefaultChannel: "0",
+	},
+}
+
+// Profiles returns the names of the built-in profiles, sorted.
+func Profiles() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns cfg with the requests and state texts of its profile
+// filled in, {host} and {channel} expanded. Templates and state texts set
+// explicitly in cfg win over the profile's, so a profile can be adjusted
+// per switch. Without a profile cfg is returned unchanged.
+func (cfg SwitchConfig) Resolve() (SwitchConfig, error) {
+	if cfg.Profile == "" {
+		return cfg, nil
+	}
+	p, ok := profiles[cfg.Profile]
+	if !ok {
+		return cfg, fmt.Errorf("unknown profile %q (built in: %s)", cfg.Profile, strings.Join(Profiles(), ", "))
+	}
+	if cfg.Host == "" {
+		return cfg, fmt.Errorf("profile %q needs a host", cfg.Profile)
+	}
+	channel := p.DefaultChannel
+	if cfg.Channel != nil {
+		channel = strconv.Itoa(*cfg.Channel)
+	}
+	r := strings.NewReplacer("{host}", cfg.Host, "{channel}", channel)
+	if cfg.Set == nil && cfg.On == nil && cfg.Off == nil {
+		cfg.Set = p.Set.expandProfile(r)
+		cfg.On = p.On.expandProfile(r)
+		cfg.Off = p.Off.expandProfile(r)
+	}
+	if cfg.Get == nil && p.Get != nil {
+		cfg.Get = &ReadTemplate{
+			RequestTemplate: *p.Get.RequestTemplate.expandProfile(r),
+			ValuePath:       r.Replace(p.Get.ValuePath),
+		}
+	}
+	if cfg.StateOn == "" {
+		cfg.StateOn = p.StateOn
+	}
+	if cfg.StateOff == "" {
+		cfg.StateOff = p.StateOff
+	}
+	return cfg, nil
+}
+
+// expandProfile returns a copy of t with the profile placeholders replaced
+// by r, or nil if t is nil.
+func (t *RequestTemplate) expandProfile(r *strings.Replacer) *RequestTemplate {
+	if t == nil {
+		return nil
+	}
+	out := &RequestTemplate{Method: t.Method, URL: r.Replace(t.URL), Body: r.Replace(t.Body)}
+	if len(t.Headers) > 0 {
+		out.Headers = make(map[string]string, len(t.Headers))
+		for k, v := range t.Headers {
+			out.Headers[k] = r.Replace(v)
+		}
+	}
+	return out
+}
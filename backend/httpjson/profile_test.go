@@ -0,0 +1,130 @@
+package httpjson
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// A profile-based switch sends exactly the requests of the equivalent
+// explicit template config.
+func TestProfileMatchesTemplates(t *testing.T) {
+	two := 2
+	for _, tc := range []struct {
+		name     string
+		profile  SwitchConfig
+		explicit func(url string) SwitchConfig
+		reply    string
+	}{
+		{
+			name:    "tasmota",
+			profile: SwitchConfig{Profile: "tasmota-relay"},
+			explicit: func(url string) SwitchConfig {
+				return SwitchConfig{
+					Set:      &RequestTemplate{URL: url + "/cm?cmnd=Power%20{state}"},
+					Get:      &ReadTemplate{RequestTemplate: RequestTemplate{URL: url + "/cm?cmnd=Power"}, ValuePath: "$.POWER"},
+					StateOn:  "ON",
+					StateOff: "OFF",
+				}
+			},
+			reply: `{"POWER":"ON"}`,
+		},
+		{
+			name:    "tasmota channel",
+			profile: SwitchConfig{Profile: "tasmota-relay", Channel: &two},
+			explicit: func(url string) SwitchConfig {
+				return SwitchConfig{
+					Set:      &RequestTemplate{URL: url + "/cm?cmnd=Power2%20{state}"},
+					Get:      &ReadTemplate{RequestTemplate: RequestTemplate{URL: url + "/cm?cmnd=Power2"}, ValuePath: "$.POWER2"},
+					StateOn:  "ON",
+					StateOff: "OFF",
+				}
+			},
+			reply: `{"POWER2":"ON"}`,
+		},
+		{
+			name:    "shelly gen1",
+			profile: SwitchConfig{Profile: "shelly-gen1"},
+			explicit: func(url string) SwitchConfig {
+				return SwitchConfig{
+					Set:      &RequestTemplate{URL: url + "/relay/0?turn={state}"},
+					Get:      &ReadTemplate{RequestTemplate: RequestTemplate{URL: url + "/relay/0"}, ValuePath: "$.ison"},
+					StateOn:  "on",
+					StateOff: "off",
+				}
+			},
+			reply: `{"ison":true}`,
+		},
+		{
+			name:    "shelly gen2",
+			profile: SwitchConfig{Profile: "shelly-gen2", Channel: &two},
+			explicit: func(url string) SwitchConfig {
+				return SwitchConfig{
+					Set:      &RequestTemplate{URL: url + "/rpc/Switch.Set?id=2&on={state}"},
+					Get:      &ReadTemplate{RequestTemplate: RequestTemplate{URL: url + "/rpc/Switch.GetStatus?id=2"}, ValuePath: "$.output"},
+					StateOn:  "true",
+					StateOff: "false",
+				}
+			},
+			reply: `{"output":true}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests [2][]string
+			for i := range requests {
+				dev := newDevice(t, tc.reply)
+				cfg := tc.explicit(dev.URL)
+				if i == 1 {
+					cfg = tc.profile
+					cfg.Host = strings.TrimPrefix(dev.URL, "http://")
+				}
+				b := New([]SwitchConfig{cfg}, Settings{})
+				if err := b.SetSwitch(0, true); err != nil {
+					t.Fatal(err)
+				}
+				if err := b.SetSwitch(0, false); err != nil {
+					t.Fatal(err)
+				}
+				if v, err := b.PollSwitchValue(0); err != nil || v != 1 {
+					t.Errorf("PollSwitchValue = %v, %v; want 1", v, err)
+				}
+				dev.mu.Lock()
+				requests[i] = dev.requests
+				dev.mu.Unlock()
+			}
+			if !slices.Equal(requests[0], requests[1]) {
+				t.Errorf("profile sent %q, templates sent %q", requests[1], requests[0])
+			}
+		})
+	}
+}
+
+// Explicit templates override the profile's, and Configs exports the
+// profile rather than the requests it expands to.
+func TestProfileOverrides(t *testing.T) {
+	dev := newDevice(t, `{"POWER":"OFF"}`)
+	host := strings.TrimPrefix(dev.URL, "http://")
+	b := New([]SwitchConfig{{
+		Name: "Relay", Profile: "tasmota-relay", Host: host,
+		Set: &RequestTemplate{URL: dev.URL + "/cm?cmnd=Backlog%20Power%20{state}"},
+	}}, Settings{})
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if req, _ := dev.last(); req != "GET /cm?cmnd=Backlog%20Power%20ON" {
+		t.Errorf("switching on sent %q, want the overriding template with the profile's state text", req)
+	}
+	cfg := b.Configs()[0]
+	if cfg.Profile != "tasmota-relay" || cfg.Get != nil || cfg.StateOn != "" {
+		t.Errorf("exported config = %+v, want the profile without its expanded requests", cfg)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	if _, err := (SwitchConfig{Profile: "sonoff-diy", Host: "relay"}).Resolve(); err == nil || !strings.Contains(err.Error(), "tasmota-relay") {
+		t.Errorf("unknown profile = %v, want an error listing the built-in profiles", err)
+	}
+	if _, err := (SwitchConfig{Profile: "shelly-gen1"}).Resolve(); err == nil {
+		t.Error("profile without a host accepted")
+	}
+}
@@ -0,0 +1,165 @@
+package httpjson
+
+// request.go builds HTTP requests from config templates and extracts values
+// from JSON responses using a small JSONPath subset.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"alpaca-switch/backend"
+)
+
+// RequestTemplate describes one HTTP call. URL, header values and Body may
+// contain the placeholders {value} (numeric value being written) and
+// {state} (the switch's StateOn or StateOff text).
+type RequestTemplate struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// ReadTemplate is a RequestTemplate whose JSON response is parsed with a
+// JSONPath expression (e.g. "$.POWER" or "$.relays[0].ison").
+type ReadTemplate struct {
+	RequestTemplate
+	ValuePath string `json:"value_path"`
+}
+
+// Auth selects how requests are authenticated.
+type Auth struct {
+	Mode     string `json:"mode"` // none | basic | digest | bearer
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+}
+
+// expand substitutes {value} and {state} in s.
+func expand(s string, value float64, state string) string {
+	return strings.NewReplacer(
+		"{value}", strconv.FormatFloat(value, 'f', -1, 64),
+		"{state}", state,
+	).Replace(s)
+}
+
+// do executes t against client and returns the response body.
+func (t RequestTemplate) do(client *http.Client, auth Auth, value float64, state string) ([]byte, error) {
+	method := t.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	url := expand(t.URL, value, state)
+	var body io.Reader
+	if t.Body != "" {
+		expanded := expand(t.Body, value, state)
+		backend.Tracef("httpjson %s %s request: %s", method, url, backend.Redact(expanded, auth.Password, auth.Token))
+		body = strings.NewReader(expanded)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	for k, v := range t.Headers {
+		req.Header.Set(k, expand(v, value, state))
+	}
+	switch strings.ToLower(auth.Mode) {
+	case "basic":
+		req.SetBasicAuth(auth.Username, auth.Password)
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	backend.Tracef("httpjson %s %s response %d: %s", method, url, resp.StatusCode, backend.Redact(string(data), auth.Password, auth.Token))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &backend.StatusError{Code: resp.StatusCode, Err: fmt.Errorf("%s %s returned %d: %s", method, url, resp.StatusCode, string(data))}
+	}
+	return data, nil
+}
+
+// extract evaluates a JSONPath expression such as "$.a.b[0].c" against data.
+// Only child (.name) and index ([n]) selectors are supported.
+func extract(data []byte, path string) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	p := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	for p != "" {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			key := p[:end]
+			p = p[end:]
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: %q is not an object", path, key)
+			}
+			if v, ok = obj[key]; !ok {
+				return nil, fmt.Errorf("%s: key %q not found", path, key)
+			}
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%s: unterminated index", path)
+			}
+			idx, err := strconv.Atoi(p[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid index %q", path, p[1:end])
+			}
+			p = p[end+1:]
+			arr, ok := v.([]interface{})
+			if !ok || idx < 0 || idx >= len(arr) {
+				return nil, fmt.Errorf("%s: index %d out of range", path, idx)
+			}
+			v = arr[idx]
+		default:
+			return nil, fmt.Errorf("%s: unexpected %q", path, p[0])
+		}
+	}
+	return v, nil
+}
+
+// toValue converts an extracted JSON value to a switch value. Booleans map
+// to 0/1, strings equal to stateOn/stateOff (case-insensitive) map to 1/0,
+// and numeric strings are parsed.
+func toValue(v interface{}, stateOn, stateOff string) (float64, error) {
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	case json.Number:
+		return x.Float64()
+	case string:
+		switch {
+		case strings.EqualFold(x, stateOn):
+			return 1, nil
+		case strings.EqualFold(x, stateOff):
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(x, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot interpret %q as a switch value", x)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("cannot interpret %v as a switch value", v)
+}
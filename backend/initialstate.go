@@ -0,0 +1,35 @@
+package backend
+
+import (
+	"log"
+	"time"
+)
+
+// ApplyInitialStates sets every writable switch configured with
+// initial_state to that value, one after another, pausing stagger between
+// successive writes so loads do not all draw inrush current at once.
+// initial_state is in the switch's native units, also for present_as
+// percent switches. Failures are logged and the sequence continues.
+func (r *Router) ApplyInitialStates(stagger time.Duration) {
+	applied := 0
+	for id, ref := range r.tbl().index {
+		state := r.options(ref).InitialState
+		if state == nil {
+			continue
+		}
+		name := ref.backend.GetName(ref.localID)
+		if !ref.backend.GetCanWrite(ref.localID) {
+			log.Printf("[startup] switch %d (%s) is read-only; ignoring initial_state", id, name)
+			continue
+		}
+		if applied > 0 && stagger > 0 {
+			time.Sleep(stagger)
+		}
+		applied++
+		if err := r.setNativeValue(id, ref, *state); err != nil {
+			log.Printf("[startup] switch %d (%s): applying initial_state %v failed: %v", id, name, *state, err)
+			continue
+		}
+		log.Printf("[startup] switch %d (%s) set to initial_state %v", id, name, *state)
+	}
+}
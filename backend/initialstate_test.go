@@ -0,0 +1,69 @@
+package backend
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// initial_state is native even on a percent switch: 200 of 0-255 is
+// written as 200, not read as 200 %.
+func TestInitialStateNativeOnPercentSwitch(t *testing.T) {
+	state := 200.0
+	fake := newFakeSwitches(0)
+	fake.max = 255
+	fake.opts[0] = SwitchOptions{PresentAs: PresentPercent, InitialState: &state}
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+
+	r.ApplyInitialStates(0)
+	if v := fake.value(0); v != 200 {
+		t.Errorf("native value = %v after initial_state 200, want 200", v)
+	}
+	if v, err := r.GetSwitchValue(0); err != nil || v != 78 {
+		t.Errorf("presented value = %v, %v; want 78 (%%)", v, err)
+	}
+}
+
+// timedWrites is a fake backend that records when each write arrives.
+type timedWrites struct {
+	*fakeSwitches
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func (f *timedWrites) SetSwitchValue(id int, value float64) error {
+	f.mu.Lock()
+	f.times = append(f.times, time.Now())
+	f.mu.Unlock()
+	return f.fakeSwitches.SetSwitchValue(id, value)
+}
+
+// power_on_stagger_ms spaces successive initial_state writes; switches
+// without an initial_state, or read-only ones, add no delay.
+func TestInitialStateStagger(t *testing.T) {
+	on := 1.0
+	fake := &timedWrites{fakeSwitches: newFakeSwitches(0, 0, 0, 0)}
+	fake.readOnly = map[int]bool{2: true}
+	fake.opts[0].InitialState = &on
+	fake.opts[2].InitialState = &on
+	fake.opts[3].InitialState = &on
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+
+	const stagger = 50 * time.Millisecond
+	start := time.Now()
+	r.ApplyInitialStates(stagger)
+	elapsed := time.Since(start)
+
+	if len(fake.times) != 2 {
+		t.Fatalf("%d initial_state writes, want 2 (switch 1 has none, switch 2 is read-only)", len(fake.times))
+	}
+	if gap := fake.times[1].Sub(fake.times[0]); gap < stagger {
+		t.Errorf("writes %v apart, want at least %v", gap, stagger)
+	}
+	if elapsed >= 2*stagger {
+		t.Errorf("ApplyInitialStates took %v, want a single %v pause", elapsed, stagger)
+	}
+	if fake.value(0) != 1 || fake.value(1) != 0 || fake.value(3) != 1 {
+		t.Errorf("values = %v, %v, %v; want 1, 0, 1", fake.value(0), fake.value(1), fake.value(3))
+	}
+}
@@ -0,0 +1,73 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+)
+
+// Invalidate marks the cached value of switch id, or of every switch if id
+// is negative, as unknown: its last-contact and hardware stamps are cleared
+// and the next read queries hardware live instead of answering from cache.
+// This helps verify live-read paths and recover from a bad cached value
+// without a restart.
+func (r *Router) Invalidate(id int) error {
+	t := r.tbl()
+	if id >= len(t.index) {
+		return errInvalidID(id)
+	}
+	ids := []int{id}
+	if id < 0 {
+		ids = ids[:0]
+		for i := range t.index {
+			ids = append(ids, i)
+		}
+	}
+	for _, id := range ids {
+		ref := t.index[id]
+		t.invalid[id].Store(true)
+		t.lastContact[id].Store(0)
+		if inv, ok := ref.backend.(Invalidator); ok {
+			inv.InvalidateCache(ref.localID)
+		}
+	}
+	if id < 0 {
+		log.Printf("Invalidated the cached values of all %d switches", len(ids))
+	} else {
+		log.Printf("Invalidated the cached value of switch %d (%s)", id, t.index[id].backend.GetName(t.index[id].localID))
+	}
+	return nil
+}
+
+// refreshInvalid re-reads switch id from hardware if its cached value was
+// invalidated, committing the result like a poll. Switches whose backend
+// cannot read live (not a Poller) keep their cached value.
+func (r *Router) refreshInvalid(id int, ref switchRef) error {
+	t := r.tbl()
+	if id >= len(t.invalid) || !t.invalid[id].Load() {
+		return nil
+	}
+	p, ok := ref.backend.(Poller)
+	if !ok || !ref.backend.IsConnected() {
+		return nil
+	}
+	if err := r.breakerErr(id); err != nil {
+		return err
+	}
+	value, err := p.PollSwitchValue(ref.localID)
+	r.recordResult(id, err)
+	if err != nil {
+		return fmt.Errorf("live read after invalidation: %w", err)
+	}
+	r.validated(id)
+	var pending *float64
+	r.commitPolled(id, ref, p, r.clamp(id, ref, value), false, &pending)
+	return nil
+}
+
+// validated clears the invalidation of switch id after a successful live
+// read made by the backend itself.
+func (r *Router) validated(id int) {
+	if t := r.tbl(); id < len(t.invalid) {
+		t.invalid[id].Store(false)
+	}
+}
@@ -0,0 +1,40 @@
+package backend
+
+import "testing"
+
+// After invalidation the next read queries the hardware once, picking up a
+// change the cache missed; later reads are served from the cache again.
+func TestInvalidateForcesLiveRead(t *testing.T) {
+	fake := newFakeSwitches(0, 0)
+	fake.live = []float64{1, 1}
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+
+	if on, _ := r.GetSwitch(0); on || fake.pollCount(0) != 0 {
+		t.Fatalf("GetSwitch before invalidation = %v with %d polls, want the cached false", on, fake.pollCount(0))
+	}
+	if err := r.Invalidate(0); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := r.GetSwitch(0); err != nil || !on {
+		t.Errorf("GetSwitch after invalidation = %v, %v; want the live true", on, err)
+	}
+	r.GetSwitch(0)
+	if n := fake.pollCount(0); n != 1 {
+		t.Errorf("%d hardware reads after invalidation, want 1", n)
+	}
+	if fake.pollCount(1) != 0 {
+		t.Error("invalidating switch 0 made switch 1 read live")
+	}
+
+	// Without an ID every switch is invalidated.
+	if err := r.Invalidate(-1); err != nil {
+		t.Fatal(err)
+	}
+	r.GetSwitch(1)
+	if n := fake.pollCount(1); n != 1 {
+		t.Errorf("%d hardware reads of switch 1 after invalidating all, want 1", n)
+	}
+	if err := r.Invalidate(5); err == nil {
+		t.Error("Invalidate accepted an out-of-range ID")
+	}
+}
@@ -0,0 +1,172 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// keepalive is the dead-man timer of one switch that was turned on
+// (SwitchOptions.KeepaliveSeconds).
+type keepalive struct {
+	timer *time.Timer
+}
+
+// keepaliveTimeout returns the keep-alive timeout of switch ref, or 0 if it
+// has none.
+func (r *Router) keepaliveTimeout(ref switchRef) time.Duration {
+	return time.Duration(r.options(ref).KeepaliveSeconds) * time.Second
+}
+
+// keepaliveWritten arms or disarms the dead-man timer of switch id after
+// value (native) was written to it: turning the switch on, or writing on
+// again, (re)starts the timer, turning it off stops it.
+func (r *Router) keepaliveWritten(id int, ref switchRef, value float64) {
+	timeout := r.keepaliveTimeout(ref)
+	if timeout <= 0 {
+		return
+	}
+	if value <= ref.backend.GetMin(ref.localID) {
+		r.disarmKeepalive(ref)
+		return
+	}
+	r.armKeepalive(ref, timeout)
+	log.Printf("[keepalive] switch %d (%s) turns off in %v unless kept alive", id, r.GetName(id), timeout)
+}
+
+// armKeepalive (re)starts the dead-man timer of switch ref, unless the
+// Router's timers were stopped.
+func (r *Router) armKeepalive(ref switchRef, timeout time.Duration) {
+	r.keepaliveMu.Lock()
+	defer r.keepaliveMu.Unlock()
+	if r.keepalivesStopped {
+		return
+	}
+	if k := r.keepalives[ref]; k != nil {
+		k.timer.Stop()
+	}
+	if r.keepalives == nil {
+		r.keepalives = make(map[switchRef]*keepalive)
+	}
+	k := &keepalive{}
+	k.timer = time.AfterFunc(timeout, func() { r.keepaliveExpired(ref, k, timeout) })
+	r.keepalives[ref] = k
+}
+
+// disarmKeepalive stops the dead-man timer of switch ref, if armed.
+func (r *Router) disarmKeepalive(ref switchRef) {
+	r.keepaliveMu.Lock()
+	defer r.keepaliveMu.Unlock()
+	if k := r.keepalives[ref]; k != nil {
+		k.timer.Stop()
+		delete(r.keepalives, ref)
+	}
+}
+
+// keepaliveExpired turns switch ref off when its dead-man timer k ran out.
+// If the write fails it is retried after another timeout, so the switch is
+// not left on because the device was briefly unreachable.
+func (r *Router) keepaliveExpired(ref switchRef, k *keepalive, timeout time.Duration) {
+	r.keepaliveMu.Lock()
+	current := r.keepalives[ref] == k
+	if current {
+		delete(r.keepalives, ref)
+	}
+	r.keepaliveMu.Unlock()
+	if !current {
+		return // kept alive or turned off meanwhile
+	}
+	id := -1
+	for i, ir := range r.tbl().index {
+		if ir == ref {
+			id = i
+			break
+		}
+	}
+	if id < 0 {
+		return // no longer indexed
+	}
+	name := r.GetName(id)
+	if err := r.guardWrite(); err != nil {
+		log.Printf("[keepalive] switch %d (%s): no keep-alive within %v, but not turning off: %v; checking again in %v", id, name, timeout, err, timeout)
+		r.armKeepalive(ref, timeout)
+		return
+	}
+	log.Printf("[keepalive] switch %d (%s): no keep-alive within %v, turning off", id, name, timeout)
+	if err := r.SetSwitch(id, false); err != nil {
+		log.Printf("[keepalive] switch %d (%s): turning off failed: %v; retrying in %v", id, name, err, timeout)
+		r.armKeepalive(ref, timeout)
+	}
+}
+
+// SetWriteGuard installs fn to veto the writes the Router makes on its own
+// rather than for a client, such as turning off a switch whose keep-alive
+// ran out: while fn returns an error those writes are held back. The server
+// uses it so maintenance mode freezes automation too.
+func (r *Router) SetWriteGuard(fn func() error) { r.writeGuard.Store(&fn) }
+
+// guardWrite returns the write guard's veto, if any.
+func (r *Router) guardWrite() error {
+	if fn := r.writeGuard.Load(); fn != nil {
+		return (*fn)()
+	}
+	return nil
+}
+
+// KeepAlive restarts the dead-man timer of switch id, which must have
+// keepalive_seconds set and be on. Clients call it more often than the
+// timeout to keep the switch powered.
+func (r *Router) KeepAlive(id int) error {
+	ref, ok := r.ref(id)
+	if !ok {
+		return errInvalidID(id)
+	}
+	timeout := r.keepaliveTimeout(ref)
+	if timeout <= 0 {
+		return r.wrapErr(id, ref, fmt.Errorf("%w: keepalive_seconds is not set", ErrInvalidOperation))
+	}
+	r.keepaliveMu.Lock()
+	armed := r.keepalives[ref] != nil
+	r.keepaliveMu.Unlock()
+	if !armed {
+		return r.wrapErr(id, ref, fmt.Errorf("%w: the switch is off; turn it on to start its keep-alive timer", ErrInvalidOperation))
+	}
+	r.armKeepalive(ref, timeout)
+	return nil
+}
+
+// ArmKeepalives starts the dead-man timer of every keepalive_seconds switch
+// found on without one running, e.g. after the driver restarted or its
+// config was reloaded mid-session, so those switches are not left on.
+func (r *Router) ArmKeepalives() {
+	for id, ref := range r.tbl().index {
+		timeout := r.keepaliveTimeout(ref)
+		if timeout <= 0 {
+			continue
+		}
+		r.keepaliveMu.Lock()
+		armed := r.keepalives[ref] != nil
+		r.keepaliveMu.Unlock()
+		if armed {
+			continue
+		}
+		v, err := ref.backend.GetSwitchValue(ref.localID)
+		if err != nil || v <= ref.backend.GetMin(ref.localID) {
+			continue
+		}
+		r.armKeepalive(ref, timeout)
+		log.Printf("[keepalive] switch %d (%s) is on; turns off in %v unless kept alive", id, r.GetName(id), timeout)
+	}
+}
+
+// StopKeepalives stops every dead-man timer for good, leaving the switches
+// as they are, when the Router is replaced on reload.
+func (r *Router) StopKeepalives() {
+	r.keepaliveMu.Lock()
+	defer r.keepaliveMu.Unlock()
+	r.keepalivesStopped = true
+	for ref, k := range r.keepalives {
+		k.timer.Stop()
+		delete(r.keepalives, ref)
+	}
+}
@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// An expired keep-alive does not switch off while the write guard (the
+// server's maintenance mode) vetoes it, and does once the veto is lifted.
+func TestKeepaliveHeldByWriteGuard(t *testing.T) {
+	fake := newFakeSwitches(0)
+	fake.opts[0].KeepaliveSeconds = 1
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+	defer r.StopKeepalives()
+
+	var maintenance atomic.Bool
+	maintenance.Store(true)
+	r.SetWriteGuard(func() error {
+		if maintenance.Load() {
+			return errors.New("maintenance mode is on")
+		}
+		return nil
+	})
+
+	if err := r.SetSwitch(0, true); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1300 * time.Millisecond)
+	if v := fake.value(0); v != 1 {
+		t.Fatalf("switch turned off by keep-alive expiry during maintenance (value %v)", v)
+	}
+
+	maintenance.Store(false)
+	time.Sleep(1000 * time.Millisecond)
+	if v := fake.value(0); v != 0 {
+		t.Errorf("switch still on after maintenance ended and the keep-alive ran out again (value %v)", v)
+	}
+}
@@ -0,0 +1,101 @@
+package mi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"alpaca-switch/backend"
+)
+
+// Action maps a named custom action to a miIO method call, e.g.
+// {"method": "set_angle_enable", "params": ["on"]} for a fan's oscillation.
+type Action struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	// ReadOnly marks a command that only queries the device, e.g.
+	// get_prop, so it may run in maintenance mode. Others are assumed to
+	// change device state.
+	ReadOnly bool `json:"read_only,omitempty"`
+}
+
+// Actions returns the names of all actions declared on any Mi device.
+func (b *Backend) Actions() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	seen := make(map[string]bool)
+	var names []string
+	for _, d := range b.devices {
+		for name := range d.Actions {
+			name = strings.ToLower(name)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Action sends the miIO command declared for name on device id. When id is
+// -1 the action must be declared on exactly one device.
+func (b *Backend) Action(name string, id int, _ string) (string, error) {
+	b.mu.RLock()
+	if id < 0 {
+		for i, d := range b.devices {
+			if _, ok := lookupAction(d, name); ok {
+				if id >= 0 {
+					b.mu.RUnlock()
+					return "", fmt.Errorf("action %q is declared on several devices; pass a switch ID as the first parameter", name)
+				}
+				id = i
+			}
+		}
+	}
+	if id < 0 || id >= len(b.devices) {
+		b.mu.RUnlock()
+		return "", fmt.Errorf("%w: %q", backend.ErrActionNotImplemented, name)
+	}
+	d := b.devices[id]
+	b.mu.RUnlock()
+
+	action, ok := lookupAction(d, name)
+	if !ok {
+		return "", fmt.Errorf("%w: %q is not declared for device %d", backend.ErrActionNotImplemented, name, id)
+	}
+	b.deviceLock[id].Lock()
+	defer b.deviceLock[id].Unlock()
+	result, err := Call(d.Addr(), d.Token, action.Method, action.Params)
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// ActionWrites reports whether action name may change device state: it
+// does unless declared read_only on device id, or with id -1 on every
+// device declaring it.
+func (b *Backend) ActionWrites(name string, id int) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for i, d := range b.devices {
+		if id >= 0 && i != id {
+			continue
+		}
+		if a, ok := lookupAction(d, name); ok && !a.ReadOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupAction finds a device action by case-insensitive name.
+func lookupAction(d Device, name string) (Action, bool) {
+	for n, a := range d.Actions {
+		if strings.EqualFold(n, name) {
+			return a, true
+		}
+	}
+	return Action{}, false
+}
@@ -0,0 +1,64 @@
+package mi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// Discover broadcasts a miIO hello and returns the devices that answer and
+// are not configured yet. Provisioned devices hide their token in the hello
+// reply, so it is reported as still needed; a factory-fresh device reveals
+// it and is listed ready to add.
+func (b *Backend) Discover(timeout time.Duration) ([]backend.DiscoveredDevice, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	hello := make([]byte, 32)
+	copy(hello, []byte{0x21, 0x31, 0x00, 0x20})
+	for i := 4; i < 32; i++ {
+		hello[i] = 0xFF
+	}
+	if _, err := conn.WriteToUDP(hello, &net.UDPAddr{IP: net.IPv4bcast, Port: 54321}); err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	configured := make(map[string]bool, len(b.devices))
+	for _, d := range b.devices {
+		configured[d.IP] = true
+	}
+	b.mu.RUnlock()
+
+	var found []backend.DiscoveredDevice
+	seen := make(map[string]bool)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 1024)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break // deadline reached
+		}
+		ip := src.IP.String()
+		if n < 32 || configured[ip] || seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		dev := backend.DiscoveredDevice{
+			Type:    "mi",
+			Address: ip,
+			ID:      hex.EncodeToString(buf[8:12]),
+		}
+		token := buf[16:32]
+		if bytes.Equal(token, bytes.Repeat([]byte{0xFF}, 16)) || bytes.Equal(token, make([]byte, 16)) {
+			dev.Needs = []string{"token"}
+		}
+		found = append(found, dev)
+	}
+	return found, nil
+}
@@ -1,17 +1,23 @@
 package mi
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
 	"log"
-	"os"
+	"math"
+	"net"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"alpaca-switch/backend"
 )
 
 // Device holds configuration and state for one Mi smart plug.
 type Device struct {
 	IP          string `json:"ip"`
+	Port        int    `json:"port,omitempty"`
 	Token       string `json:"token"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
@@ -20,36 +26,271 @@ type Device struct {
 	Step        int64  `json:"step"`
 	Canwrite    bool   `json:"canwrite"`
 	Value       int64  `json:"value"`
+
+	// Actions declares named custom actions mapped to miIO commands.
+	Actions map[string]Action `json:"actions,omitempty"`
+
+	// Outlets turns the entry into a multi-outlet power strip: each outlet
+	// becomes its own on/off switch sharing the entry's IP and token.
+	Outlets []Outlet `json:"outlets,omitempty"`
+
+	// Outlet is the strip channel (MIoT service ID) this switch drives, set
+	// when an Outlets entry is expanded. Zero means the whole plug.
+	Outlet int `json:"outlet,omitempty"`
+
+	// Properties turns the entry into a multi-property device such as a
+	// fan: each property becomes its own switch sharing the entry's IP and
+	// token, e.g. power, speed level and oscillation.
+	Properties []Property `json:"properties,omitempty"`
+
+	// SIID and PIID address the MIoT property this switch drives, set when
+	// a Properties entry is expanded. PropertyType is its value type.
+	SIID         int    `json:"siid,omitempty"`
+	PIID         int    `json:"piid,omitempty"`
+	PropertyType string `json:"property_type,omitempty"`
+
+	// GetSwitchMode is how getswitch answers when the range is more than
+	// on/off: GetSwitchStrict (default) or GetSwitchThreshold.
+	GetSwitchMode string `json:"getswitch_mode,omitempty"`
+
+	// RSSISwitch adds a read-only switch reporting the device's Wi-Fi
+	// signal strength in dBm, named RSSIName (default "<name> signal").
+	RSSISwitch bool   `json:"rssi_switch,omitempty"`
+	RSSIName   string `json:"rssi_name,omitempty"`
+
+	// RSSI marks the signal switch added for an RSSISwitch entry.
+	RSSI bool `json:"rssi,omitempty"`
+
+	backend.SwitchOptions
+}
+
+// Outlet configures one socket of a multi-outlet Mi power strip.
+type Outlet struct {
+	// Channel is the outlet's MIoT service ID, usually 2 for the first
+	// socket, 3 for the second and so on.
+	Channel     int    `json:"channel"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Value       int64  `json:"value"`
+
+	backend.SwitchOptions
+}
+
+// Property value types selectable with Property.Type.
+const (
+	// PropertyBool is a true/false property, such as power or oscillation.
+	PropertyBool = "bool"
+	// PropertyInt is a numeric property, such as a speed level.
+	PropertyInt = "int"
+)
+
+// Property configures one MIoT property of a multi-property Mi device.
+type Property struct {
+	// SIID and PIID are the property's MIoT service and property IDs,
+	// e.g. siid 2 piid 2 for a fan's speed level.
+	SIID int `json:"siid"`
+	PIID int `json:"piid"`
+	// Type is PropertyBool or PropertyInt. Default: bool for a 0-1 range,
+	// int otherwise.
+	Type        string `json:"type,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Min         int64  `json:"min"`
+	Max         int64  `json:"max"`
+	Step        int64  `json:"step"`
+	Canwrite    bool   `json:"canwrite"`
+	Value       int64  `json:"value"`
+	// GetSwitchMode overrides the device entry's getswitch_mode.
+	GetSwitchMode string `json:"getswitch_mode,omitempty"`
+
+	backend.SwitchOptions
+}
+
+// Behaviours selectable with Device.GetSwitchMode for switches whose range
+// is more than on/off, such as a fan's speed level.
+const (
+	// GetSwitchStrict fails getswitch with InvalidOperation, as ASCOM
+	// asks; clients must use getswitchvalue.
+	GetSwitchStrict = "strict"
+	// GetSwitchThreshold answers getswitch with whether the value is
+	// above Min, for clients that treat every switch as boolean.
+	GetSwitchThreshold = "threshold"
+)
+
+// expandProperties replaces every device entry that declares Properties
+// with one device per property.
+func expandProperties(devices []Device) []Device {
+	var out []Device
+	for _, d := range devices {
+		if len(d.Properties) == 0 {
+			out = append(out, d)
+			continue
+		}
+		for _, p := range d.Properties {
+			pd := d
+			pd.Properties = nil
+			pd.SIID, pd.PIID, pd.PropertyType = p.SIID, p.PIID, p.Type
+			pd.Name = p.Name
+			pd.Description = p.Description
+			pd.Min, pd.Max, pd.Step = p.Min, p.Max, p.Step
+			pd.Canwrite = p.Canwrite
+			pd.Value = p.Value
+			if p.GetSwitchMode != "" {
+				pd.GetSwitchMode = p.GetSwitchMode
+			}
+			pd.SwitchOptions = p.SwitchOptions
+			out = append(out, pd)
+		}
+	}
+	return out
+}
+
+// expandOutlets replaces every device entry that declares Outlets with one
+// on/off device per outlet.
+func expandOutlets(devices []Device) []Device {
+	var out []Device
+	for _, d := range devices {
+		if len(d.Outlets) == 0 {
+			out = append(out, d)
+			continue
+		}
+		for _, o := range d.Outlets {
+			sd := d
+			sd.Outlets = nil
+			sd.Outlet = o.Channel
+			sd.Name = o.Name
+			sd.Description = o.Description
+			sd.Min, sd.Max, sd.Step = 0, 1, 1
+			sd.Value = o.Value
+			sd.SwitchOptions = o.SwitchOptions
+			out = append(out, sd)
+		}
+	}
+	return out
+}
+
+// Settings holds backend-wide options for the Mi backend.
+type Settings struct {
+	// PollSeconds is the default refresh interval for devices without a
+	// per-device poll_seconds override. Zero disables background polling.
+	PollSeconds int `json:"poll_seconds"`
+
+	// StateFile is the JSON file device state is persisted to and restored
+	// from on startup. Empty disables persistence.
+	StateFile string `json:"state_file"`
+
+	// StateStore selects where state is persisted: backend.StoreFile (the
+	// default, state_file), backend.StoreMemory, or a kind registered with
+	// backend.RegisterStore, which reads state_file as its location.
+	StateStore string `json:"state_store"`
+
+	// Backups is the number of rolling backups (state_file.bak,
+	// state_file.bak.2, ...) kept of the previous state before each save.
+	Backups int `json:"backups"`
+
+	// StateIndent sets how the state file is indented: "tab", "none" for
+	// compact single-line output, or a number of spaces. Empty means 4
+	// spaces.
+	StateIndent string `json:"state_indent"`
+
+	backend.CommonSettings
+
+	// SaveDelayMs coalesces state-file writes: a change marks the state
+	// dirty and it is written at most once per this many milliseconds,
+	// plus on Disconnect. Zero writes on every change.
+	SaveDelayMs int `json:"save_delay_ms"`
+
+	// QueryTimeoutSeconds bounds the parallel state query on Connect as a
+	// whole: devices that have not answered by then are abandoned and keep
+	// their cached values. Zero uses defaultQueryTimeout; negative waits
+	// for every device.
+	QueryTimeoutSeconds int `json:"query_timeout_seconds"`
+}
+
+// defaultQueryTimeout is the Connect query deadline when
+// Settings.QueryTimeoutSeconds is zero.
+const defaultQueryTimeout = 15 * time.Second
+
+// queryTimeout resolves Settings.QueryTimeoutSeconds; zero means no limit.
+func (s Settings) queryTimeout() time.Duration {
+	switch {
+	case s.QueryTimeoutSeconds < 0:
+		return 0
+	case s.QueryTimeoutSeconds == 0:
+		return defaultQueryTimeout
+	}
+	return time.Duration(s.QueryTimeoutSeconds) * time.Second
 }
 
 // Backend implements backend.SwitchBackend for Xiaomi Mi smart plugs.
 type Backend struct {
 	mu         sync.RWMutex
 	devices    []Device
+	settings   Settings
 	connected  bool
-	savePath   string
-	deviceLock []sync.Mutex // per-device operation lock
+	store      backend.Store // nil: no persistence
+	deviceLock []*sync.Mutex // per-device operation lock, shared by outlets of one strip
+	updated    []time.Time   // when each device's Value was last read or set on hardware
+
+	// saveErr is the last persistence failure (nil once a save succeeds);
+	// saveLogged is when it was last logged, to rate-limit repeats.
+	saveErr    error
+	saveLogged time.Time
+
+	// saveTimer is the pending coalesced save (Settings.SaveDelayMs), nil
+	// when the state on disk is current.
+	saveMu    sync.Mutex
+	saveTimer *time.Timer
 }
 
-// New creates a Mi backend from a slice of device configs.
-// savePath is the JSON file to persist state to (may be empty to skip persistence).
-func New(devices []Device, savePath string) *Backend {
-	return &Backend{
+// New creates a Mi backend from a slice of device configs, expanding
+// power strips into one switch per outlet. If the state store (by default
+// settings.StateFile) holds saved state, the cached values and names saved
+// there override those from the config.
+func New(devices []Device, settings Settings) *Backend {
+	devices = expandProperties(expandOutlets(expandRSSI(devices)))
+	b := &Backend{
 		devices:    devices,
-		savePath:   savePath,
-		deviceLock: make([]sync.Mutex, len(devices)),
+		settings:   settings,
+		deviceLock: make([]*sync.Mutex, len(devices)),
+		updated:    make([]time.Time, len(devices)),
+	}
+	// Outlets of one strip, and properties of one device, share a lock so
+	// their handshakes never interleave.
+	locks := make(map[string]*sync.Mutex)
+	for i, d := range devices {
+		switch d.GetSwitchMode {
+		case "", GetSwitchStrict, GetSwitchThreshold:
+		default:
+			log.Printf("[mi] warning: device %d (%s): getswitch_mode must be %q or %q, got %q; using %q",
+				i, d.Name, GetSwitchStrict, GetSwitchThreshold, d.GetSwitchMode, GetSwitchStrict)
+		}
+		if locks[d.Addr()] == nil {
+			locks[d.Addr()] = new(sync.Mutex)
+		}
+		b.deviceLock[i] = locks[d.Addr()]
+	}
+	store, err := backend.OpenStore(backend.StoreConfig{Kind: settings.StateStore, Path: settings.StateFile, Backups: settings.Backups})
+	if err != nil {
+		log.Printf("[mi] warning: %v; state is not persisted", err)
+	}
+	b.store = store
+	b.load()
+	b.checkStateDir()
+	if _, err := stateIndent(settings.StateIndent); err != nil {
+		log.Printf("[mi] warning: %v; using 4 spaces", err)
 	}
+	return b
 }
 
-// Connect marks the backend connected and kicks off a background state refresh.
+// Connect refreshes the state of all devices and then marks the backend
+// connected. It blocks until every device has answered or timed out.
 func (b *Backend) Connect() error {
+	b.queryAllDeviceStates()
+	b.save()
 	b.mu.Lock()
 	b.connected = true
 	b.mu.Unlock()
-	go func() {
-		b.queryAllDeviceStates()
-		b.save()
-	}()
 	return nil
 }
 
@@ -58,7 +299,7 @@ func (b *Backend) Disconnect() {
 	b.mu.Lock()
 	b.connected = false
 	b.mu.Unlock()
-	b.save()
+	b.flushSave()
 }
 
 // IsConnected reports whether the backend is connected.
@@ -68,7 +309,21 @@ func (b *Backend) IsConnected() bool {
 	return b.connected
 }
 
-// NumSwitches returns the number of Mi devices.
+// BackendType returns "mi".
+func (b *Backend) BackendType() string { return "mi" }
+
+// ClampsValues reports whether clamp_values is set.
+func (b *Backend) ClampsValues() bool { return b.settings.ClampsValues() }
+
+// OptimizesWrites reports whether write_mode is optimize, and the
+// write_max_age_seconds freshness limit.
+func (b *Backend) OptimizesWrites() (bool, time.Duration) { return b.settings.OptimizesWrites() }
+
+// NamePrefix returns the name_prefix setting.
+func (b *Backend) NamePrefix() string { return b.settings.NamePrefix }
+
+// NumSwitches returns the number of Mi switches: one per plug, plus one per
+// outlet of each power strip.
 func (b *Backend) NumSwitches() int {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
@@ -93,22 +348,31 @@ func (b *Backend) SetName(id int, name string) error {
 	b.mu.Lock()
 	b.devices[id].Name = name
 	b.mu.Unlock()
-	b.save()
+	b.requestSave()
 	return nil
 }
 
-// GetDescription returns the description for device id.
-// Falls back to the device name if no description is set.
+// GetDescription returns the description for device id. Without one it
+// expands description_template ({name}, {ip}, {outlet}), falling back to
+// the device name.
 func (b *Backend) GetDescription(id int) string {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	if id < 0 || id >= len(b.devices) {
 		return ""
 	}
-	if b.devices[id].Description != "" {
-		return b.devices[id].Description
+	d := b.devices[id]
+	if d.Description != "" {
+		return d.Description
 	}
-	return b.devices[id].Name
+	if b.settings.DescriptionTemplate != "" {
+		return backend.ExpandDescription(b.settings.DescriptionTemplate, map[string]string{
+			"name":   d.Name,
+			"ip":     d.IP,
+			"outlet": strconv.Itoa(d.Outlet),
+		})
+	}
+	return d.Name
 }
 
 // GetCanWrite reports whether device id is writable.
@@ -151,17 +415,24 @@ func (b *Backend) GetStep(id int) float64 {
 	return float64(b.devices[id].Step)
 }
 
-// GetSwitch returns the on/off state of device id.
+// GetSwitch returns the on/off state of device id. For a switch with a
+// wider range it fails with ErrInvalidOperation, or with getswitch_mode
+// "threshold" reports whether the value is above Min.
 func (b *Backend) GetSwitch(id int) (bool, error) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	if id < 0 || id >= len(b.devices) {
 		return false, fmt.Errorf("invalid device id %d", id)
 	}
-	if b.devices[id].Max > 1 {
-		return false, errors.New("device is not a simple on/off switch")
+	d := b.devices[id]
+	if d.Max > 1 || d.RSSI {
+		if d.GetSwitchMode == GetSwitchThreshold {
+			return d.Value > d.Min, nil
+		}
+		return false, fmt.Errorf("%w: device is not a simple on/off switch (range %d-%d); use getswitchvalue, or set getswitch_mode to %q",
+			backend.ErrInvalidOperation, d.Min, d.Max, GetSwitchThreshold)
 	}
-	return b.devices[id].Value != 0, nil
+	return d.Value != 0, nil
 }
 
 // GetSwitchValue returns the numeric value of device id.
@@ -174,37 +445,160 @@ func (b *Backend) GetSwitchValue(id int) (float64, error) {
 	return float64(b.devices[id].Value), nil
 }
 
-// SetSwitch turns device id on or off.
+// SetSwitch turns device id on or off. A property switch is set to its
+// Max or Min.
 // A per-device lock ensures rapid successive calls are serialised so that
 // the second command always uses a fresh discovery stamp from the device.
 func (b *Backend) SetSwitch(id int, state bool) error {
 	if id < 0 || id >= len(b.devices) {
 		return fmt.Errorf("invalid device id %d", id)
 	}
+	value := int64(0)
+	if state {
+		value = 1
+	}
+	b.mu.RLock()
+	d := b.devices[id]
+	b.mu.RUnlock()
+	if d.isProperty() {
+		value = d.Min
+		if state {
+			value = d.Max
+		}
+	}
+	return b.setValue(id, state, value)
+}
+
+// setValue sends the power command (state) or, for a property switch,
+// value to device id and, on success, caches value.
+func (b *Backend) setValue(id int, state bool, value int64) error {
 	b.deviceLock[id].Lock()
 	defer b.deviceLock[id].Unlock()
 
 	b.mu.RLock()
-	host, token := b.devices[id].IP, b.devices[id].Token
+	d := b.devices[id]
 	b.mu.RUnlock()
-	if err := SetSwitch(host, token, state); err != nil {
+	if err := sendValue(d, state, value); err != nil {
 		return err
 	}
 	b.mu.Lock()
-	if state {
-		b.devices[id].Value = 1
+	b.devices[id].Value = value
+	b.updated[id] = time.Now()
+	b.mu.Unlock()
+	b.requestSave()
+	if d.isProperty() {
+		log.Printf("[mi] switch %d (siid %d piid %d) set to %d", id, d.SIID, d.PIID, value)
 	} else {
-		b.devices[id].Value = 0
+		log.Printf("[mi] switch %d set to %v", id, state)
 	}
-	b.mu.Unlock()
-	b.save()
-	log.Printf("[mi] switch %d set to %v", id, state)
 	return nil
 }
 
-// SetSwitchValue sets device id by numeric value (0 = off, non-zero = on).
+// stepTolerance is how far, as a fraction of the step, a written value may
+// be from a valid step and still be rounded onto it (absorbing float noise
+// such as 0.9999999) rather than rejected.
+const stepTolerance = 1e-6
+
+// SetSwitchValue sets device id by numeric value (Min = off, anything else
+// = on). Device values are integers, so the value must lie within Min..Max
+// on a multiple of Step; fractional values such as 1.9 are rejected with
+// ErrInvalidValue instead of being silently truncated.
 func (b *Backend) SetSwitchValue(id int, value float64) error {
-	return b.SetSwitch(id, value != 0)
+	if id < 0 || id >= len(b.devices) {
+		return fmt.Errorf("invalid device id %d", id)
+	}
+	b.mu.RLock()
+	d := b.devices[id]
+	b.mu.RUnlock()
+	step := d.Step
+	if step <= 0 {
+		step = 1
+	}
+	if value < float64(d.Min) || value > float64(d.Max) {
+		return fmt.Errorf("%w: %v is outside %d-%d", backend.ErrInvalidValue, value, d.Min, d.Max)
+	}
+	steps := (value - float64(d.Min)) / float64(step)
+	if math.Abs(steps-math.Round(steps)) > stepTolerance {
+		return fmt.Errorf("%w: %v is not a multiple of step %d from %d", backend.ErrInvalidValue, value, step, d.Min)
+	}
+	rounded := d.Min + int64(math.Round(steps))*step
+	return b.setValue(id, rounded != d.Min, rounded)
+}
+
+// SwitchOptions returns the per-switch options configured for device id.
+func (b *Backend) SwitchOptions(id int) backend.SwitchOptions {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.devices) {
+		return backend.SwitchOptions{}
+	}
+	return b.devices[id].SwitchOptions
+}
+
+// PollInterval returns the background refresh interval for device id.
+func (b *Backend) PollInterval(id int) time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.devices) {
+		return 0
+	}
+	return b.devices[id].PollInterval(b.settings.PollSeconds)
+}
+
+// PollSwitchValue queries the live power state or property value of device id.
+func (b *Backend) PollSwitchValue(id int) (float64, error) {
+	if id < 0 || id >= len(b.devices) {
+		return 0, fmt.Errorf("invalid device id %d", id)
+	}
+	b.deviceLock[id].Lock()
+	defer b.deviceLock[id].Unlock()
+
+	b.mu.RLock()
+	d := b.devices[id]
+	b.mu.RUnlock()
+	value, err := readValue(d)
+	if err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	b.updated[id] = time.Now()
+	b.mu.Unlock()
+	return float64(value), nil
+}
+
+// SetCachedValue stores a polled value for device id, persisting it if it changed.
+func (b *Backend) SetCachedValue(id int, value float64) {
+	b.mu.Lock()
+	if id < 0 || id >= len(b.devices) || b.devices[id].Value == int64(value) {
+		b.mu.Unlock()
+		return
+	}
+	b.devices[id].Value = int64(value)
+	name := b.devices[id].Name
+	b.mu.Unlock()
+	b.requestSave()
+	log.Printf("[mi] device %d (%s) changed externally to %v", id, name, value)
+}
+
+// LastUpdated returns when device id's value was last read from or written
+// to the plug, or the zero time if it is still the persisted value.
+func (b *Backend) LastUpdated(id int) time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.updated) {
+		return time.Time{}
+	}
+	return b.updated[id]
+}
+
+// InvalidateCache clears device id's hardware stamp, so its value reads as
+// unverified until it is next read from the plug.
+func (b *Backend) InvalidateCache(id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id >= 0 && id < len(b.updated) {
+		b.updated[id] = time.Time{}
+	}
 }
 
 // Devices returns a copy of the device list (for config serialisation).
@@ -216,52 +610,162 @@ func (b *Backend) Devices() []Device {
 	return cp
 }
 
-// queryAllDeviceStates fetches live power state from all Mi devices in parallel.
+// queryAllDeviceStates fetches live power state from all Mi devices in
+// parallel, giving up on devices still unanswered after the query timeout.
+// Their cached values are kept, and answers arriving after the deadline are
+// discarded so the state saved after Connect is the one that was logged.
 func (b *Backend) queryAllDeviceStates() {
 	log.Println("[mi] querying device states...")
 	b.mu.RLock()
 	devices := make([]Device, len(b.devices))
 	copy(devices, b.devices)
+	timeout := b.settings.queryTimeout()
 	b.mu.RUnlock()
 
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 	var wg sync.WaitGroup
+	finished := make([]bool, len(devices)) // guarded by b.mu
 	for i := range devices {
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			state, err := GetSwitch(devices[i].IP, devices[i].Token)
+			b.deviceLock[i].Lock()
+			value, err := readValue(devices[i])
+			b.deviceLock[i].Unlock()
 			if err != nil {
 				log.Printf("[mi] warning: device %d query failed: %v (keeping cached value)", i, err)
+				b.mu.Lock()
+				finished[i] = true
+				b.mu.Unlock()
 				return
 			}
 			b.mu.Lock()
-			if state {
-				b.devices[i].Value = 1
-			} else {
-				b.devices[i].Value = 0
+			if ctx.Err() != nil {
+				b.mu.Unlock()
+				return
 			}
+			finished[i] = true
+			b.devices[i].Value = value
+			b.updated[i] = time.Now()
 			name := b.devices[i].Name
 			b.mu.Unlock()
-			log.Printf("[mi] device %d (%s): %v", i, name, state)
+			if devices[i].isProperty() || devices[i].RSSI {
+				log.Printf("[mi] device %d (%s): %d", i, name, value)
+			} else {
+				log.Printf("[mi] device %d (%s): %v", i, name, value != 0)
+			}
 		}(i)
 	}
-	wg.Wait()
-	log.Println("[mi] device state query complete")
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("[mi] device state query complete")
+	case <-ctx.Done():
+		b.mu.Lock()
+		var late []string
+		for i, ok := range finished {
+			if !ok {
+				late = append(late, fmt.Sprintf("%d (%s)", i, b.devices[i].Name))
+			}
+		}
+		b.mu.Unlock()
+		log.Printf("[mi] warning: device state query timed out after %v; keeping cached values for %s",
+			timeout, strings.Join(late, ", "))
+	}
 }
 
-// save persists device state to savePath (if set).
-func (b *Backend) save() {
-	if b.savePath == "" {
-		return
+// Addr returns the device's miIO address: IP and Port (default
+// DefaultPort) as "ip:port".
+func (d Device) Addr() string {
+	port := d.Port
+	if port == 0 {
+		port = DefaultPort
 	}
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	data, err := json.MarshalIndent(b.devices, "", "    ")
+	return net.JoinHostPort(d.IP, strconv.Itoa(port))
+}
+
+// isProperty reports whether d drives a MIoT property rather than power.
+func (d Device) isProperty() bool { return d.PIID > 0 }
+
+// boolProperty reports whether d's property takes true/false rather than
+// a number.
+func (d Device) boolProperty() bool {
+	switch d.PropertyType {
+	case PropertyBool:
+		return true
+	case PropertyInt:
+		return false
+	}
+	return d.Min == 0 && d.Max == 1
+}
+
+// readValue queries the live value of d: its Wi-Fi signal strength, its
+// MIoT property, or 1/0 for its power state.
+func readValue(d Device) (int64, error) {
+	if d.RSSI {
+		return readRSSI(d)
+	}
+	if !d.isProperty() {
+		on, err := readPower(d)
+		if on {
+			return 1, err
+		}
+		return 0, err
+	}
+	v, err := GetProperty(d.Addr(), d.Token, d.SIID, d.PIID)
 	if err != nil {
-		log.Printf("[mi] save error: %v", err)
-		return
+		return 0, err
+	}
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case float64:
+		return int64(math.Round(v)), nil
 	}
-	if err := os.WriteFile(b.savePath, data, 0644); err != nil {
-		log.Printf("[mi] save error: %v", err)
+	return 0, fmt.Errorf("siid %d piid %d: unexpected value %v", d.SIID, d.PIID, v)
+}
+
+// sendValue writes value to d's MIoT property, or switches its power to
+// on.
+func sendValue(d Device, on bool, value int64) error {
+	if d.RSSI {
+		return errRSSIReadOnly
+	}
+	if !d.isProperty() {
+		return sendPower(d, on)
+	}
+	if d.boolProperty() {
+		return SetProperty(d.Addr(), d.Token, d.SIID, d.PIID, value != 0)
+	}
+	return SetProperty(d.Addr(), d.Token, d.SIID, d.PIID, value)
+}
+
+// readPower queries the live power state of d, addressing its outlet when
+// it is one socket of a power strip.
+func readPower(d Device) (bool, error) {
+	if d.Outlet > 0 {
+		return GetOutlet(d.Addr(), d.Token, d.Outlet)
+	}
+	return GetSwitch(d.Addr(), d.Token)
+}
+
+// sendPower switches d on or off, addressing its outlet when it is one
+// socket of a power strip.
+func sendPower(d Device, on bool) error {
+	if d.Outlet > 0 {
+		return SetOutlet(d.Addr(), d.Token, d.Outlet, on)
 	}
+	return SetSwitch(d.Addr(), d.Token, on)
 }
@@ -0,0 +1,376 @@
+package mi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"alpaca-switch/backend"
+	"alpaca-switch/internal/testutil"
+)
+
+const testToken = "00112233445566778899aabbccddeeff"
+
+// newPlug starts a fake plug on a free loopback port and a backend for
+// devices, whose IP, Port and Token are filled in.
+func newPlug(t *testing.T, devices ...Device) (*testutil.MiIO, *Backend) {
+	t.Helper()
+	fake, err := testutil.NewMiIOPort("127.0.0.1", 0, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fake.Close() })
+	for i := range devices {
+		devices[i].IP, devices[i].Port, devices[i].Token = "127.0.0.1", fake.Port(), testToken
+	}
+	return fake, New(devices, Settings{})
+}
+
+func TestDeviceAddr(t *testing.T) {
+	for _, tc := range []struct {
+		d    Device
+		want string
+	}{
+		{Device{IP: "10.0.0.5"}, "10.0.0.5:54321"},
+		{Device{IP: "10.0.0.5", Port: 4321}, "10.0.0.5:4321"},
+		{Device{IP: "fe80::1", Port: 4321}, "[fe80::1]:4321"},
+	} {
+		if got := tc.d.Addr(); got != tc.want {
+			t.Errorf("Addr(%s, port %d) = %q, want %q", tc.d.IP, tc.d.Port, got, tc.want)
+		}
+		if got := miioAddr(tc.d.Addr()); got != tc.want {
+			t.Errorf("miioAddr(%q) = %q, want it unchanged", tc.d.Addr(), got)
+		}
+	}
+	if got := miioAddr("10.0.0.5"); got != "10.0.0.5:54321" {
+		t.Errorf("miioAddr without a port = %q, want the default port", got)
+	}
+}
+
+// Every request goes to the device's configured port: the fake plug
+// listens on a free port, never 54321.
+func TestConfiguredPort(t *testing.T) {
+	fake, b := newPlug(t, Device{Name: "plug", Max: 1, Step: 1, Canwrite: true})
+	if fake.Port() == DefaultPort {
+		t.Skip("fake plug happened to get the default port")
+	}
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatalf("SetSwitch via port %d: %v", fake.Port(), err)
+	}
+	fake.Lock()
+	defer fake.Unlock()
+	if fake.Power != "on" {
+		t.Errorf("plug power = %q, want \"on\"", fake.Power)
+	}
+}
+
+func TestPlugPower(t *testing.T) {
+	fake, b := newPlug(t, Device{Name: "plug", Max: 1, Step: 1, Canwrite: true})
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatalf("SetSwitch(on): %v", err)
+	}
+	fake.Lock()
+	power := fake.Power
+	fake.Unlock()
+	if power != "on" {
+		t.Errorf("plug power = %q, want \"on\"", power)
+	}
+
+	fake.Lock()
+	fake.Power = "off"
+	fake.Unlock()
+	if v, err := b.PollSwitchValue(0); err != nil || v != 0 {
+		t.Errorf("PollSwitchValue after the plug switched off = %v, %v; want 0", v, err)
+	}
+}
+
+func TestPropertySwitches(t *testing.T) {
+	fake, b := newPlug(t, Device{Name: "fan", Properties: []Property{
+		{SIID: 2, PIID: 1, Name: "power", Max: 1, Step: 1, Canwrite: true},
+		{SIID: 2, PIID: 2, Name: "speed", Min: 1, Max: 4, Step: 1, Canwrite: true},
+	}})
+	fake.Lock()
+	fake.Properties[testutil.MIoTProperty{SIID: 2, PIID: 1}] = false
+	fake.Properties[testutil.MIoTProperty{SIID: 2, PIID: 2}] = float64(1)
+	fake.Unlock()
+
+	if err := b.SetSwitchValue(1, 3); err != nil {
+		t.Fatalf("SetSwitchValue(speed, 3): %v", err)
+	}
+	fake.Lock()
+	speed, power := fake.Properties[testutil.MIoTProperty{SIID: 2, PIID: 2}], fake.Properties[testutil.MIoTProperty{SIID: 2, PIID: 1}]
+	fake.Unlock()
+	if speed != float64(3) || power != false {
+		t.Errorf("fan properties = power %v, speed %v; want false, 3", power, speed)
+	}
+}
+
+func TestPowerStripOutlets(t *testing.T) {
+	fake, b := newPlug(t, Device{Name: "strip", Outlets: []Outlet{
+		{Channel: 2, Name: "mount"},
+		{Channel: 3, Name: "heater"},
+	}})
+	fake.Lock()
+	fake.Outlets[2], fake.Outlets[3] = false, true
+	fake.Unlock()
+
+	if n := b.NumSwitches(); n != 2 {
+		t.Fatalf("NumSwitches = %d, want one per outlet", n)
+	}
+	if b.GetName(0) != "mount" || b.GetName(1) != "heater" {
+		t.Errorf("switch names = %q, %q; want mount, heater", b.GetName(0), b.GetName(1))
+	}
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatalf("SetSwitch(mount, on): %v", err)
+	}
+	fake.Lock()
+	mount, heater := fake.Outlets[2], fake.Outlets[3]
+	fake.Unlock()
+	if !mount || !heater {
+		t.Errorf("outlets = mount %v, heater %v; want both on", mount, heater)
+	}
+	if err := b.SetSwitch(1, false); err != nil {
+		t.Fatalf("SetSwitch(heater, off): %v", err)
+	}
+	if v, err := b.PollSwitchValue(1); err != nil || v != 0 {
+		t.Errorf("PollSwitchValue(heater) = %v, %v; want 0", v, err)
+	}
+	if v, err := b.PollSwitchValue(0); err != nil || v != 1 {
+		t.Errorf("PollSwitchValue(mount) = %v, %v; want 1", v, err)
+	}
+}
+
+// Fractional values on integer steps are rejected, not truncated; float
+// noise next to a valid step is rounded onto it.
+func TestFractionalValues(t *testing.T) {
+	fake, b := newPlug(t, Device{Name: "fan", Properties: []Property{
+		{SIID: 2, PIID: 2, Name: "speed", Min: 1, Max: 4, Step: 1, Canwrite: true},
+	}})
+	key := testutil.MIoTProperty{SIID: 2, PIID: 2}
+	fake.Lock()
+	fake.Properties[key] = float64(1)
+	fake.Unlock()
+
+	for _, v := range []float64{1.9, 2.5, 0.5, 4.1} {
+		if err := b.SetSwitchValue(0, v); !errors.Is(err, backend.ErrInvalidValue) {
+			t.Errorf("SetSwitchValue(%v) = %v, want ErrInvalidValue", v, err)
+		}
+	}
+	fake.Lock()
+	speed := fake.Properties[key]
+	fake.Unlock()
+	if speed != float64(1) {
+		t.Errorf("speed = %v after rejected writes, want 1", speed)
+	}
+
+	if err := b.SetSwitchValue(0, 2.9999999999); err != nil {
+		t.Fatalf("SetSwitchValue(2.9999999999): %v", err)
+	}
+	fake.Lock()
+	speed = fake.Properties[key]
+	fake.Unlock()
+	if speed != float64(3) {
+		t.Errorf("speed = %v, want 3", speed)
+	}
+}
+
+func TestOfflinePlug(t *testing.T) {
+	fake, b := newPlug(t, Device{Name: "plug", Max: 1, Step: 1, Canwrite: true})
+	fake.Lock()
+	fake.Silent = true
+	fake.Unlock()
+	if err := b.SetSwitch(0, true); err == nil {
+		t.Error("SetSwitch succeeded against an offline plug")
+	}
+	if v, _ := b.GetSwitchValue(0); v != 0 {
+		t.Errorf("cached value = %v after a failed write, want 0", v)
+	}
+}
+
+// A device that never answers is abandoned at query_timeout_seconds, keeping
+// its cached value, while the others are still refreshed.
+func TestQueryTimeout(t *testing.T) {
+	fake, _ := newPlug(t)
+	hung, err := testutil.NewMiIOPort("127.0.0.1", 0, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hung.Close()
+	hung.Lock()
+	hung.Silent = true
+	hung.Unlock()
+	fake.Lock()
+	fake.Power = "on"
+	fake.Unlock()
+
+	b := New([]Device{
+		{Name: "ok", IP: "127.0.0.1", Port: fake.Port(), Token: testToken, Max: 1, Step: 1, Canwrite: true},
+		{Name: "hung", IP: "127.0.0.1", Port: hung.Port(), Token: testToken, Max: 1, Step: 1, Canwrite: true, Value: 1},
+	}, Settings{QueryTimeoutSeconds: 1})
+	start := time.Now()
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Connect took %v with a 1s query timeout", elapsed)
+	}
+	if v, _ := b.GetSwitchValue(0); v != 1 {
+		t.Errorf("answering plug = %v, want its queried value 1", v)
+	}
+	if v, _ := b.GetSwitchValue(1); v != 1 {
+		t.Errorf("hung plug = %v, want its cached value 1", v)
+	}
+}
+
+// An RSSI switch reports the signal strength from miIO.info and is
+// read-only.
+func TestRSSISwitch(t *testing.T) {
+	fake, b := newPlug(t, Device{Name: "plug", Max: 1, Step: 1, Canwrite: true, RSSISwitch: true})
+	fake.Lock()
+	fake.Results["miIO.info"] = json.RawMessage(`{"model":"chuangmi.plug.m1","fw_ver":"1.2.4_16","ap":{"ssid":"observatory","rssi":-63}}`)
+	fake.Unlock()
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if n, name := b.NumSwitches(), b.GetName(1); n != 2 || name != "plug signal" {
+		t.Fatalf("%d switches, second %q; want the plug and \"plug signal\"", n, name)
+	}
+	if v, err := b.GetSwitchValue(1); err != nil || v != -63 {
+		t.Errorf("signal = %v, %v; want -63", v, err)
+	}
+	if min, max := b.GetMin(1), b.GetMax(1); min != -100 || max != 0 {
+		t.Errorf("signal range = %v to %v, want -100 to 0 dBm", min, max)
+	}
+	if b.GetCanWrite(1) {
+		t.Error("signal switch reports CanWrite")
+	}
+	if err := b.SetSwitchValue(1, -20); !errors.Is(err, backend.ErrInvalidOperation) {
+		t.Errorf("SetSwitchValue on the signal switch = %v, want ErrInvalidOperation", err)
+	}
+
+	// A reply without the ap section is an error, not a reading.
+	fake.Lock()
+	fake.Results["miIO.info"] = json.RawMessage(`{"model":"chuangmi.plug.m1"}`)
+	fake.Unlock()
+	if _, err := b.PollSwitchValue(1); err == nil {
+		t.Error("PollSwitchValue succeeded on a reply without a signal strength")
+	}
+}
+
+// A multi-level switch fails getswitch with InvalidOperation unless its
+// getswitch_mode is "threshold", which reports whether it is above Min.
+func TestGetSwitchMode(t *testing.T) {
+	fake, b := newPlug(t, Device{Name: "fan", GetSwitchMode: GetSwitchThreshold, Properties: []Property{
+		{SIID: 2, PIID: 2, Name: "strict speed", Min: 1, Max: 4, Step: 1, Canwrite: true, Value: 1, GetSwitchMode: GetSwitchStrict},
+		{SIID: 2, PIID: 3, Name: "speed", Min: 1, Max: 4, Step: 1, Canwrite: true, Value: 1},
+	}})
+	fake.Lock()
+	fake.Properties[testutil.MIoTProperty{SIID: 2, PIID: 2}] = float64(1)
+	fake.Properties[testutil.MIoTProperty{SIID: 2, PIID: 3}] = float64(1)
+	fake.Unlock()
+
+	if _, err := b.GetSwitch(0); !errors.Is(err, backend.ErrInvalidOperation) {
+		t.Errorf("GetSwitch in strict mode = %v, want ErrInvalidOperation", err)
+	}
+	if on, err := b.GetSwitch(1); err != nil || on {
+		t.Errorf("GetSwitch at the minimum in threshold mode = %v, %v; want false", on, err)
+	}
+	if err := b.SetSwitchValue(1, 3); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := b.GetSwitch(1); err != nil || !on {
+		t.Errorf("GetSwitch above the minimum in threshold mode = %v, %v; want true", on, err)
+	}
+}
+
+// With tracing on, the decrypted miIO payloads are logged without the token.
+func TestTraceMiIOPayloads(t *testing.T) {
+	_, b := newPlug(t, Device{Name: "plug", Max: 1, Step: 1, Canwrite: true})
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	backend.SetTrace(true)
+	defer backend.SetTrace(false)
+
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `"method":"set_power"`) || !strings.Contains(out, "mi 127.0.0.1") {
+		t.Errorf("trace lacks the set_power request: %q", out)
+	}
+	if strings.Contains(out, testToken) {
+		t.Errorf("trace leaks the token: %q", out)
+	}
+}
+
+// A named action sends its declared method and params, and returns the
+// device's result.
+func TestAction(t *testing.T) {
+	fake, b := newPlug(t, Device{Name: "fan", Max: 1, Step: 1, Canwrite: true, Actions: map[string]Action{
+		"Oscillate": {Method: "set_angle_enable", Params: []interface{}{"on"}},
+	}})
+	fake.Lock()
+	fake.Results["set_angle_enable"] = json.RawMessage(`["ok"]`)
+	fake.Unlock()
+
+	if got := b.Actions(); !slices.Equal(got, []string{"oscillate"}) {
+		t.Errorf("Actions = %v, want [oscillate]", got)
+	}
+	out, err := b.Action("oscillate", -1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != `["ok"]` {
+		t.Errorf("Action result = %s, want [\"ok\"]", out)
+	}
+	fake.Lock()
+	method, params := fake.Methods[len(fake.Methods)-1], fake.Params[len(fake.Params)-1]
+	fake.Unlock()
+	if method != "set_angle_enable" || !reflect.DeepEqual(params, []interface{}{"on"}) {
+		t.Errorf("sent %s %v, want set_angle_enable [on]", method, params)
+	}
+
+	if _, err := b.Action("reboot", 0, ""); !errors.Is(err, backend.ErrActionNotImplemented) {
+		t.Errorf("undeclared action = %v, want ErrActionNotImplemented", err)
+	}
+}
+
+// Declared actions count as writes unless marked read_only.
+func TestActionWrites(t *testing.T) {
+	b := New([]Device{
+		{Name: "fan", Actions: map[string]Action{
+			"oscillate": {Method: "set_angle_enable", Params: []interface{}{"on"}},
+			"status":    {Method: "get_prop", Params: []interface{}{"power"}, ReadOnly: true},
+		}},
+		{Name: "heater", Actions: map[string]Action{
+			"status": {Method: "set_power", Params: []interface{}{"on"}},
+		}},
+	}, Settings{})
+	for _, tc := range []struct {
+		name string
+		id   int
+		want bool
+	}{
+		{"oscillate", 0, true},
+		{"status", 0, false},
+		{"status", 1, true},
+		{"status", -1, true}, // writes on one of the devices declaring it
+		{"reboot", -1, false},
+	} {
+		if got := b.ActionWrites(tc.name, tc.id); got != tc.want {
+			t.Errorf("ActionWrites(%q, %d) = %v, want %v", tc.name, tc.id, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package mi
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"alpaca-switch/backend"
+)
+
+// Range of an RSSI switch, in dBm.
+const (
+	rssiMin = -100
+	rssiMax = 0
+)
+
+var errRSSIReadOnly = fmt.Errorf("%w: signal switches are read-only", backend.ErrInvalidOperation)
+
+// expandRSSI inserts, after every device entry with RSSISwitch set, a
+// read-only switch reporting the device's Wi-Fi signal strength. It is
+// polled at the entry's poll_seconds, so signal dips can be lined up with
+// failed commands. The entry's RSSISwitch is cleared and the new switch
+// marked RSSI, so an exported config expands to the same switches again.
+func expandRSSI(devices []Device) []Device {
+	var out []Device
+	for _, d := range devices {
+		if !d.RSSISwitch {
+			out = append(out, d)
+			continue
+		}
+		d.RSSISwitch = false
+		out = append(out, d)
+		sd := Device{
+			IP:       d.IP,
+			Port:     d.Port,
+			Token:    d.Token,
+			Name:     d.RSSIName,
+			Min:      rssiMin,
+			Max:      rssiMax,
+			Step:     1,
+			Canwrite: false,
+			Value:    rssiMin,
+			RSSI:     true,
+		}
+		if sd.Name == "" {
+			sd.Name = d.Name + " signal"
+		}
+		sd.PollSeconds = d.PollSeconds
+		out = append(out, sd)
+	}
+	return out
+}
+
+// readRSSI queries the device's Wi-Fi signal strength in dBm from the
+// "ap" section of its miIO.info reply.
+func readRSSI(d Device) (int64, error) {
+	result, err := Call(d.Addr(), d.Token, "miIO.info", []interface{}{})
+	if err != nil {
+		return 0, err
+	}
+	var info struct {
+		AP *struct {
+			RSSI *int64 `json:"rssi"`
+		} `json:"ap"`
+	}
+	if err := json.Unmarshal(result, &info); err != nil {
+		return 0, fmt.Errorf("parsing miIO.info: %w", err)
+	}
+	if info.AP == nil || info.AP.RSSI == nil {
+		return 0, fmt.Errorf("miIO.info reports no Wi-Fi signal strength")
+	}
+	return *info.AP.RSSI, nil
+}
@@ -0,0 +1,179 @@
+package mi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// load restores cached values and names from the state store, matching
+// each saved entry to the switch with the same stateKey. Nothing saved yet
+// is not an error.
+func (b *Backend) load() {
+	if b.store == nil {
+		return
+	}
+	data, err := b.store.Load()
+	if err != nil {
+		log.Printf("[mi] load error: %v", err)
+		return
+	}
+	if data == nil {
+		return
+	}
+	var saved []Device
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("[mi] load error: parsing %s: %v", b.store, err)
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sd := range saved {
+		for i := range b.devices {
+			if b.devices[i].stateKey() == sd.stateKey() {
+				b.devices[i].Value = sd.Value
+				if sd.Name != "" {
+					b.devices[i].Name = sd.Name
+				}
+			}
+		}
+	}
+	log.Printf("[mi] restored state from %s", b.store)
+}
+
+// stateKey identifies the switch d in the state file: the device address
+// and token, the strip outlet or MIoT property it drives, and whether it is
+// the device's signal switch (RSSI is that marker, not a reading). Names
+// are left out, since they can be changed through SetName.
+func (d Device) stateKey() string {
+	return fmt.Sprintf("%s/%s/%d/%d.%d/%t", d.Addr(), d.Token, d.Outlet, d.SIID, d.PIID, d.RSSI)
+}
+
+// saveLogInterval is how often a persistent save failure is re-logged.
+const saveLogInterval = 10 * time.Minute
+
+// checkStateDir warns at startup if the state store cannot be written
+// (e.g. the state file's directory is read-only), so a misconfigured
+// deployment is obvious before the first save. The backend keeps working
+// from memory and retries on every save.
+func (b *Backend) checkStateDir() {
+	c, ok := b.store.(backend.StoreChecker)
+	if !ok {
+		return
+	}
+	if err := c.Check(); err != nil {
+		b.saveErr = fmt.Errorf("state file not writable: %w", err)
+		b.saveLogged = time.Now()
+		log.Printf("[mi] warning: %v; running with in-memory state only until it becomes writable", b.saveErr)
+	}
+}
+
+// save persists device state to the state store (if any). A failure is logged once
+// and then at most every saveLogInterval while it persists; Health reports
+// it until a save succeeds again.
+func (b *Backend) save() {
+	if b.store == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, err := marshalState(b.devices, b.settings.StateIndent)
+	if err == nil {
+		err = b.store.Save(data)
+	}
+	if err == nil {
+		if b.saveErr != nil {
+			log.Printf("[mi] state file %s is writable again", b.store)
+			b.saveErr = nil
+		}
+		return
+	}
+	first := b.saveErr == nil
+	b.saveErr = fmt.Errorf("state file not writable: %w", err)
+	if first || time.Since(b.saveLogged) >= saveLogInterval {
+		log.Printf("[mi] save error: %v (repeats suppressed for %v)", err, saveLogInterval)
+		b.saveLogged = time.Now()
+	}
+}
+
+// requestSave persists a state change: immediately, or with SaveDelayMs set
+// by scheduling one save for the end of the delay, which picks up every
+// change made until then.
+func (b *Backend) requestSave() {
+	if b.settings.SaveDelayMs <= 0 {
+		b.save()
+		return
+	}
+	b.saveMu.Lock()
+	defer b.saveMu.Unlock()
+	if b.saveTimer == nil {
+		b.saveTimer = time.AfterFunc(time.Duration(b.settings.SaveDelayMs)*time.Millisecond, b.flushSave)
+	}
+}
+
+// flushSave writes a pending coalesced save now, so nothing is lost on
+// Disconnect or shutdown. Without one the state on disk is current and is
+// left alone: a backend replaced by a config reload is disconnected after
+// its successor has saved, and must not overwrite the shared state file
+// with its old device list.
+func (b *Backend) flushSave() {
+	b.saveMu.Lock()
+	pending := b.saveTimer != nil
+	if pending {
+		b.saveTimer.Stop()
+		b.saveTimer = nil
+	}
+	b.saveMu.Unlock()
+	if pending {
+		b.save()
+	}
+}
+
+// stateIndent resolves a state_indent setting to the indent string passed
+// to json.MarshalIndent; "" means compact output.
+func stateIndent(setting string) (string, error) {
+	switch setting {
+	case "":
+		return "    ", nil
+	case "tab":
+		return "\t", nil
+	case "none":
+		return "", nil
+	}
+	n, err := strconv.Atoi(setting)
+	if err != nil || n < 0 || n > 16 {
+		return "    ", fmt.Errorf("invalid state_indent %q (want \"tab\", \"none\" or a number of spaces)", setting)
+	}
+	return strings.Repeat(" ", n), nil
+}
+
+// marshalState serialises devices in the configured indent style. Struct
+// fields keep their declaration order and map keys are sorted, so saving
+// unchanged state always produces identical bytes. The output ends with a
+// newline so line-based diffs stay clean.
+func marshalState(devices []Device, setting string) ([]byte, error) {
+	indent, _ := stateIndent(setting)
+	var data []byte
+	var err error
+	if indent == "" {
+		data, err = json.Marshal(devices)
+	} else {
+		data, err = json.MarshalIndent(devices, "", indent)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Health reports a persistent state-file write failure, if any.
+func (b *Backend) Health() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.saveErr
+}
@@ -0,0 +1,223 @@
+package mi
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"alpaca-switch/backend"
+)
+
+func fanConfig() []Device {
+	return []Device{{
+		IP:    "127.0.0.1",
+		Token: "00112233445566778899aabbccddeeff",
+		Name:  "Fan",
+		Properties: []Property{
+			{SIID: 2, PIID: 1, Name: "Fan power", Min: 0, Max: 1, Step: 1, Canwrite: true},
+			{SIID: 2, PIID: 2, Name: "Fan speed", Min: 1, Max: 4, Step: 1, Canwrite: true, Value: 1},
+		},
+		RSSISwitch: true,
+	}}
+}
+
+// Two properties of one device, plus its signal switch, must each get back
+// their own saved name and value.
+func TestStateRoundTripProperties(t *testing.T) {
+	settings := Settings{StateFile: filepath.Join(t.TempDir(), "state.json")}
+
+	b := New(fanConfig(), settings)
+	if n := b.NumSwitches(); n != 3 {
+		t.Fatalf("NumSwitches = %d, want 3", n)
+	}
+	names := map[int]string{}
+	for id := 0; id < b.NumSwitches(); id++ {
+		names[id] = b.GetName(id)
+	}
+	power, speed := -1, -1
+	for id := 0; id < b.NumSwitches(); id++ {
+		switch names[id] {
+		case "Fan power":
+			power = id
+		case "Fan speed":
+			speed = id
+		}
+	}
+	if power < 0 || speed < 0 {
+		t.Fatalf("property switches not found in %v", names)
+	}
+	if err := b.SetName(power, "Dew fan"); err != nil {
+		t.Fatal(err)
+	}
+	b.SetCachedValue(power, 1)
+	b.SetCachedValue(speed, 3)
+
+	r := New(fanConfig(), settings)
+	for id := 0; id < r.NumSwitches(); id++ {
+		v, _ := r.GetSwitchValue(id)
+		switch id {
+		case power:
+			if got := r.GetName(id); got != "Dew fan" || v != 1 {
+				t.Errorf("power switch restored as %q = %v, want \"Dew fan\" = 1", got, v)
+			}
+		case speed:
+			if got := r.GetName(id); got != "Fan speed" || v != 3 {
+				t.Errorf("speed switch restored as %q = %v, want \"Fan speed\" = 3", got, v)
+			}
+		default:
+			if got := r.GetName(id); got != names[id] {
+				t.Errorf("switch %d restored as %q, want %q", id, got, names[id])
+			}
+		}
+		if u := r.LastUpdated(id); !u.IsZero() {
+			t.Errorf("switch %d restored with LastUpdated %v, want zero (not yet confirmed)", id, u)
+		}
+	}
+}
+
+// A saved entry for another port of the same IP is a different device.
+func TestStateKeyIncludesPort(t *testing.T) {
+	a := Device{IP: "10.0.0.5", Token: "t"}
+	b := Device{IP: "10.0.0.5", Port: DefaultPort, Token: "t"}
+	c := Device{IP: "10.0.0.5", Port: 54322, Token: "t"}
+	if a.stateKey() != b.stateKey() {
+		t.Errorf("default port and explicit %d should match: %q vs %q", DefaultPort, a.stateKey(), b.stateKey())
+	}
+	if a.stateKey() == c.stateKey() {
+		t.Errorf("different ports should not match: %q", a.stateKey())
+	}
+}
+
+// Disconnecting a backend without a pending save must not rewrite the
+// state file, which a reloaded successor may already have updated.
+func TestDisconnectLeavesCurrentStateAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	settings := Settings{StateFile: path, SaveDelayMs: 50}
+
+	old := New(fanConfig(), settings)
+	old.save()
+	successor := New(fanConfig(), settings)
+	if err := successor.SetName(0, "Renamed"); err != nil {
+		t.Fatal(err)
+	}
+	successor.flushSave()
+
+	old.Disconnect()
+	if got := New(fanConfig(), settings).GetName(0); got != "Renamed" {
+		t.Errorf("after disconnecting the replaced backend, switch 0 is %q, want \"Renamed\"", got)
+	}
+
+	// A pending change is still written on Disconnect.
+	successor.SetCachedValue(1, 4)
+	successor.Disconnect()
+	if v, _ := New(fanConfig(), settings).GetSwitchValue(1); v != 4 {
+		t.Errorf("pending value not flushed on Disconnect: got %v, want 4", v)
+	}
+}
+
+// A state file that cannot be written is reported by Health and logged
+// once, not on every save, and clears once a save succeeds.
+func TestUnwritableStateBacksOff(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	dir := filepath.Join(t.TempDir(), "missing")
+	b := New(fanConfig(), Settings{StateFile: filepath.Join(dir, "state.json")})
+	if b.Health() == nil {
+		t.Fatal("Health = nil with the state directory missing")
+	}
+	for i := 0; i < 5; i++ {
+		b.SetCachedValue(1, float64(i%4+1))
+	}
+	if n := strings.Count(buf.String(), "not writable"); n != 1 {
+		t.Errorf("save failure logged %d times over 5 saves, want once at startup:\n%s", n, buf.String())
+	}
+	if v, _ := b.GetSwitchValue(1); v != 1 {
+		t.Errorf("value kept in memory = %v, want 1", v)
+	}
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	b.SetCachedValue(1, 2)
+	if err := b.Health(); err != nil {
+		t.Errorf("Health = %v after a successful save, want nil", err)
+	}
+	if !strings.Contains(buf.String(), "writable again") {
+		t.Errorf("recovery not logged:\n%s", buf.String())
+	}
+}
+
+// The state file follows state_indent and is byte-identical across saves
+// of unchanged state.
+func TestStateIndent(t *testing.T) {
+	for setting, want := range map[string]string{
+		"":     "[\n    {\n",
+		"2":    "[\n  {\n",
+		"tab":  "[\n\t{\n",
+		"none": "[{",
+	} {
+		path := filepath.Join(t.TempDir(), "state.json")
+		b := New(fanConfig(), Settings{StateFile: path, StateIndent: setting})
+		b.save()
+		first, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(first), want) || !strings.HasSuffix(string(first), "]\n") {
+			t.Errorf("state_indent %q: file starts %q, want %q and a trailing newline", setting, first[:min(len(first), 12)], want)
+		}
+		b.save()
+		New(fanConfig(), Settings{StateFile: path, StateIndent: setting}).save()
+		if second, _ := os.ReadFile(path); !bytes.Equal(first, second) {
+			t.Errorf("state_indent %q: unchanged state saved differently:\n%s\n%s", setting, first, second)
+		}
+	}
+
+	if _, err := stateIndent("wide"); err == nil {
+		t.Error("stateIndent(\"wide\") accepted")
+	}
+}
+
+// description_template fills in descriptions from device fields, but an
+// explicit description wins.
+func TestDescriptionTemplate(t *testing.T) {
+	settings := Settings{CommonSettings: backend.CommonSettings{DescriptionTemplate: "{name} at {ip}, outlet {outlet}"}}
+	b := New([]Device{
+		{IP: "10.0.0.7", Token: testToken, Name: "strip", Outlets: []Outlet{{Channel: 2, Name: "Mount"}, {Channel: 3, Name: "Heater", Description: "Dew heater"}}},
+	}, settings)
+	if got := b.GetDescription(0); got != "Mount at 10.0.0.7, outlet 2" {
+		t.Errorf("templated description = %q", got)
+	}
+	if got := b.GetDescription(1); got != "Dew heater" {
+		t.Errorf("explicit description = %q, want \"Dew heater\"", got)
+	}
+}
+
+// State saved to a pluggable store is restored from it by a new backend.
+func TestStateStoreRoundTrip(t *testing.T) {
+	shared := &backend.MemoryStore{}
+	backend.RegisterStore("mi-test", func(backend.StoreConfig) (backend.Store, error) { return shared, nil })
+	settings := Settings{StateStore: "mi-test"}
+
+	b := New(fanConfig(), settings)
+	if err := b.SetName(0, "Dew fan"); err != nil {
+		t.Fatal(err)
+	}
+	b.SetCachedValue(1, 3)
+	if data, _ := shared.Load(); len(data) == 0 {
+		t.Fatal("nothing saved to the store")
+	}
+
+	r := New(fanConfig(), settings)
+	if got := r.GetName(0); got != "Dew fan" {
+		t.Errorf("name = %q, want \"Dew fan\"", got)
+	}
+	if v, _ := r.GetSwitchValue(1); v != 3 {
+		t.Errorf("value = %v, want 3", v)
+	}
+}
@@ -12,82 +12,204 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
+
+	"alpaca-switch/backend"
 )
 
+// DefaultPort is the standard miIO UDP port.
+const DefaultPort = 54321
+
 // SetSwitch turns a Xiaomi Mi Smart Plug on or off.
-// host is the device IP (optionally with port, e.g. "192.168.1.171:54321");
+// host is the device IP, optionally with a port (e.g. "192.168.1.171:54321"),
+// which defaults to DefaultPort;
 // token is a 32-character hex authentication string.
 func SetSwitch(host, token string, on bool) error {
-	tokenBytes, err := hex.DecodeString(token)
-	if err != nil {
-		return fmt.Errorf("decoding token: %w", err)
+	state := "off"
+	if on {
+		state = "on"
 	}
-	deviceID, stamp, err := discoverDevice(host)
+	result, err := Call(host, token, "set_power", []interface{}{state})
 	if err != nil {
-		return fmt.Errorf("discovery: %w", err)
+		return err
 	}
-	return setPower(host, tokenBytes, deviceID, stamp, on)
+	// Expect: {"result":["ok"],"id":1}
+	var ok []string
+	if err := json.Unmarshal(result, &ok); err != nil {
+		return fmt.Errorf("parsing confirmation: %w", err)
+	}
+	if len(ok) == 0 || ok[0] != "ok" {
+		return fmt.Errorf("unexpected confirmation: %s", string(result))
+	}
+	return nil
 }
 
 // GetSwitch returns the live on/off state of a Xiaomi Mi Smart Plug.
 func GetSwitch(host, token string) (bool, error) {
+	result, err := Call(host, token, "get_prop", []interface{}{"power"})
+	if err != nil {
+		return false, err
+	}
+	var props []string
+	if err := json.Unmarshal(result, &props); err != nil {
+		return false, fmt.Errorf("parsing response: %w", err)
+	}
+	if len(props) > 0 {
+		return props[0] == "on", nil
+	}
+	return false, fmt.Errorf("no power state in response")
+}
+
+// miotProperty addresses one MIoT property: service ID (siid) and property
+// ID (piid). Power-strip outlets are services whose power is property 1.
+type miotProperty struct {
+	DID   string      `json:"did,omitempty"`
+	SIID  int         `json:"siid"`
+	PIID  int         `json:"piid"`
+	Value interface{} `json:"value,omitempty"`
+	Code  int         `json:"code,omitempty"`
+}
+
+// SetProperty writes one MIoT property (siid/piid) of a device, e.g. a
+// fan's speed level or oscillation.
+func SetProperty(host, token string, siid, piid int, value interface{}) error {
+	prop := miotProperty{DID: fmt.Sprint(siid), SIID: siid, PIID: piid, Value: value}
+	result, err := Call(host, token, "set_properties", []interface{}{prop})
+	if err != nil {
+		return err
+	}
+	var props []miotProperty
+	if err := json.Unmarshal(result, &props); err != nil {
+		return fmt.Errorf("parsing confirmation: %w", err)
+	}
+	if len(props) == 0 {
+		return fmt.Errorf("unexpected confirmation: %s", string(result))
+	}
+	if props[0].Code != 0 {
+		return fmt.Errorf("%w: siid %d piid %d: device error %d", backend.ErrRejected, siid, piid, props[0].Code)
+	}
+	return nil
+}
+
+// GetProperty returns the live value of one MIoT property (siid/piid) of a
+// device, as decoded from JSON: a bool, float64 or string.
+func GetProperty(host, token string, siid, piid int) (interface{}, error) {
+	prop := miotProperty{DID: fmt.Sprint(siid), SIID: siid, PIID: piid}
+	result, err := Call(host, token, "get_properties", []interface{}{prop})
+	if err != nil {
+		return nil, err
+	}
+	var props []miotProperty
+	if err := json.Unmarshal(result, &props); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	if len(props) == 0 {
+		return nil, fmt.Errorf("no value for siid %d piid %d in response", siid, piid)
+	}
+	if props[0].Code != 0 {
+		return nil, fmt.Errorf("%w: siid %d piid %d: device error %d", backend.ErrRejected, siid, piid, props[0].Code)
+	}
+	return props[0].Value, nil
+}
+
+// SetOutlet turns one outlet of a multi-outlet Mi power strip on or off.
+// outlet is the strip's MIoT service ID for that socket (usually 2, 3, 4…).
+func SetOutlet(host, token string, outlet int, on bool) error {
+	return SetProperty(host, token, outlet, 1, on)
+}
+
+// GetOutlet returns the live on/off state of one outlet of a multi-outlet
+// Mi power strip.
+func GetOutlet(host, token string, outlet int) (bool, error) {
+	value, err := GetProperty(host, token, outlet, 1)
+	if err != nil {
+		return false, err
+	}
+	on, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("outlet %d: unexpected power value %v", outlet, value)
+	}
+	return on, nil
+}
+
+// Call performs the hello handshake, sends a miIO command (method/params)
+// to host and returns the raw "result" field of the device's reply.
+// Device-level errors ({"error":{...}}) are returned as Go errors.
+func Call(host, token, method string, params []interface{}) (json.RawMessage, error) {
 	tokenBytes, err := hex.DecodeString(token)
 	if err != nil {
-		return false, fmt.Errorf("decoding token: %w", err)
+		return nil, fmt.Errorf("decoding token: %w", err)
 	}
 	deviceID, stamp, err := discoverDevice(host)
 	if err != nil {
-		return false, fmt.Errorf("discovery: %w", err)
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if params == nil {
+		params = []interface{}{}
 	}
-
 	command := map[string]interface{}{
 		"id":     1,
-		"method": "get_prop",
-		"params": []interface{}{"power"},
+		"method": method,
+		"params": params,
 	}
 	jsonData, err := json.Marshal(command)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	backend.Tracef("mi %s request: %s", host, backend.Redact(string(jsonData), token))
 	encrypted, err := encryptPayload(jsonData, tokenBytes)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	packet := buildPacket(tokenBytes, deviceID, stamp, encrypted)
 
-	conn, err := net.DialTimeout("udp", fmt.Sprintf("%s:54321", host), 5*time.Second)
+	conn, err := net.DialTimeout("udp", miioAddr(host), 5*time.Second)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	defer conn.Close()
-	conn.SetDeadline(time.Now().Add(3 * time.Second))
-
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
 	if _, err = conn.Write(packet); err != nil {
-		return false, err
+		return nil, err
 	}
-	buf := make([]byte, 1024)
+	buf := make([]byte, 4096)
 	n, err := conn.Read(buf)
 	if err != nil {
-		return false, fmt.Errorf("reading response: %w", err)
+		return nil, fmt.Errorf("no response from device: %w", err)
 	}
 	if n < 32 {
-		return false, fmt.Errorf("response too short (%d bytes)", n)
+		return nil, fmt.Errorf("%w: response too short (%d bytes)", backend.ErrMalformedResponse, n)
 	}
 	decrypted, err := decryptPayload(buf[32:n], tokenBytes)
 	if err != nil {
-		return false, fmt.Errorf("decrypting response: %w", err)
+		return nil, fmt.Errorf("%w: decrypting response (wrong token?): %w", backend.ErrMalformedResponse, err)
 	}
+	backend.Tracef("mi %s response: %s", host, backend.Redact(string(decrypted), token))
+
+	// Check for device-level error: {"error":{"code":-10000,"message":"..."}}
 	var resp struct {
-		Result []string `json:"result"`
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
 	}
 	if err := json.Unmarshal(decrypted, &resp); err != nil {
-		return false, fmt.Errorf("parsing response: %w", err)
+		return nil, fmt.Errorf("parsing response: %w", err)
 	}
-	if len(resp.Result) > 0 {
-		return resp.Result[0] == "on", nil
+	if resp.Error != nil {
+		return nil, fmt.Errorf("%w: device error %d: %s", backend.ErrRejected, resp.Error.Code, resp.Error.Message)
 	}
-	return false, fmt.Errorf("no power state in response")
+	return resp.Result, nil
+}
+
+// miioAddr returns host with DefaultPort added unless it already has a port.
+func miioAddr(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(DefaultPort))
 }
 
 // discoverDevice sends a hello packet and returns (deviceID, stamp).
@@ -100,7 +222,7 @@ func discoverDevice(ipAddress string) ([]byte, []byte, error) {
 	for i := 4; i < 32; i++ {
 		hello[i] = 0xFF
 	}
-	conn, err := net.DialTimeout("udp", fmt.Sprintf("%s:54321", ipAddress), 5*time.Second)
+	conn, err := net.DialTimeout("udp", miioAddr(ipAddress), 5*time.Second)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -120,71 +242,6 @@ func discoverDevice(ipAddress string) ([]byte, []byte, error) {
 	return buf[8:12], buf[12:16], nil
 }
 
-// setPower sends a set_power command to ipAddress and waits for confirmation.
-func setPower(ipAddress string, token, deviceID, stamp []byte, powerOn bool) error {
-	state := "off"
-	if powerOn {
-		state = "on"
-	}
-	command := map[string]interface{}{
-		"id":     1,
-		"method": "set_power",
-		"params": []interface{}{state},
-	}
-	jsonData, err := json.Marshal(command)
-	if err != nil {
-		return err
-	}
-	encrypted, err := encryptPayload(jsonData, token)
-	if err != nil {
-		return err
-	}
-	packet := buildPacket(token, deviceID, stamp, encrypted)
-
-	conn, err := net.DialTimeout("udp", fmt.Sprintf("%s:54321", ipAddress), 5*time.Second)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-	conn.SetDeadline(time.Now().Add(5 * time.Second))
-	if _, err = conn.Write(packet); err != nil {
-		return err
-	}
-	buf := make([]byte, 1024)
-	n, err := conn.Read(buf)
-	if err != nil {
-		return fmt.Errorf("no confirmation from device: %w", err)
-	}
-	if n < 32 {
-		return fmt.Errorf("confirmation response too short (%d bytes)", n)
-	}
-	decrypted, err := decryptPayload(buf[32:n], token)
-	if err != nil {
-		return fmt.Errorf("decrypting confirmation: %w", err)
-	}
-	// Check for device-level error: {"error":{"code":-10000,"message":"..."}}
-	var errResp struct {
-		Error *struct {
-			Code    int    `json:"code"`
-			Message string `json:"message"`
-		} `json:"error"`
-	}
-	if json.Unmarshal(decrypted, &errResp) == nil && errResp.Error != nil {
-		return fmt.Errorf("device error %d: %s", errResp.Error.Code, errResp.Error.Message)
-	}
-	// Expect: {"result":["ok"],"id":1}
-	var okResp struct {
-		Result []string `json:"result"`
-	}
-	if err := json.Unmarshal(decrypted, &okResp); err != nil {
-		return fmt.Errorf("parsing confirmation: %w", err)
-	}
-	if len(okResp.Result) == 0 || okResp.Result[0] != "ok" {
-		return fmt.Errorf("unexpected confirmation: %s", string(decrypted))
-	}
-	return nil
-}
-
 // buildPacket frames an encrypted payload into a Xiaomi protocol packet.
 func buildPacket(token, deviceID, stamp, encryptedData []byte) []byte {
 	pkt := make([]byte, 32+len(encryptedData))
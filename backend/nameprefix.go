@@ -0,0 +1,50 @@
+package backend
+
+import "strings"
+
+// NamePrefixer is implemented by backends configured with a name_prefix
+// (e.g. "[Cam] ") that the Router puts in front of their switch names, so
+// clients can tell at a glance which backend a switch belongs to.
+type NamePrefixer interface {
+	NamePrefix() string
+}
+
+// displayName returns the name clients see for switch ref: its backend's
+// name with the backend's name prefix in front. A switch renamed through
+// SetName keeps exactly the name it was given, and a name that already
+// starts with the prefix (e.g. a rename restored from a state file) is not
+// prefixed twice.
+func (r *Router) displayName(ref switchRef) string {
+	name := ref.backend.GetName(ref.localID)
+	p, ok := ref.backend.(NamePrefixer)
+	if !ok || p.NamePrefix() == "" || strings.HasPrefix(name, p.NamePrefix()) {
+		return name
+	}
+	r.renamedMu.Lock()
+	renamed := r.renamed[ref]
+	r.renamedMu.Unlock()
+	if renamed {
+		return name
+	}
+	return p.NamePrefix() + name
+}
+
+// markRenamed records that switch ref was renamed through SetName, so its
+// new name is shown without the backend's name prefix.
+func (r *Router) markRenamed(ref switchRef) {
+	r.renamedMu.Lock()
+	defer r.renamedMu.Unlock()
+	if r.renamed == nil {
+		r.renamed = make(map[switchRef]bool)
+	}
+	r.renamed[ref] = true
+}
+
+// BaseName returns the name of switch id without its backend's name prefix,
+// i.e. the name it is referred to by in the config.
+func (r *Router) BaseName(id int) string {
+	if ref, ok := r.ref(id); ok {
+		return ref.backend.GetName(ref.localID)
+	}
+	return ""
+}
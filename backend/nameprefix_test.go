@@ -0,0 +1,39 @@
+package backend
+
+import (
+	"slices"
+	"testing"
+)
+
+// prefixedSwitches is a fake backend with a name_prefix.
+type prefixedSwitches struct {
+	*namedSwitches
+	prefix string
+}
+
+func (p prefixedSwitches) NamePrefix() string { return p.prefix }
+
+func TestNamePrefix(t *testing.T) {
+	cams := prefixedSwitches{newNamedSwitches("hikvision", "Roof", "[Cam] Dome"), "[Cam] "}
+	plugs := newNamedSwitches("mi", "Mount")
+	r := NewRouter([]SwitchBackend{cams, plugs}, Options{})
+
+	// Names already carrying the prefix are not prefixed twice.
+	if got := switchNames(r); !slices.Equal(got, []string{"[Cam] Roof", "[Cam] Dome", "Mount"}) {
+		t.Errorf("names = %q", got)
+	}
+
+	// A name set through SetName is shown as given.
+	if err := r.SetName(0, "Roof IR"); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.GetName(0); got != "Roof IR" {
+		t.Errorf("renamed switch = %q, want \"Roof IR\" without the prefix", got)
+	}
+	if err := r.SetName(1, "[Cam] Pier"); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.GetName(1); got != "[Cam] Pier" {
+		t.Errorf("switch renamed with the prefix = %q, want it once", got)
+	}
+}
@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"fmt"
+	"time"
+)
+
+// onlineSwitches serves the read-only "<name> online" switches added for
+// switches with SwitchOptions.OnlineSwitch set. Each reports whether the
+// driver's last hardware operation on its target switch succeeded, so
+// client sequences can branch on device connectivity. A new set is built
+// with every switch table.
+type onlineSwitches struct {
+	router  *Router
+	targets []switchRef
+}
+
+// reachable reports whether switch target has been confirmed by hardware
+// and its last hardware operation (read, write or poll) did not fail.
+func (o *onlineSwitches) reachable(target switchRef) bool {
+	t := o.router.tbl()
+	for id, ref := range t.index {
+		if ref != target {
+			continue
+		}
+		if id < len(t.failing) && t.failing[id].Load() {
+			return false
+		}
+		return !o.router.LastUpdated(id).IsZero()
+	}
+	return false
+}
+
+func (o *onlineSwitches) target(id int) (switchRef, bool) {
+	if id < 0 || id >= len(o.targets) {
+		return switchRef{}, false
+	}
+	return o.targets[id], true
+}
+
+func (o *onlineSwitches) NumSwitches() int { return len(o.targets) }
+
+func (o *onlineSwitches) GetName(id int) string {
+	if ref, ok := o.target(id); ok {
+		return o.router.displayName(ref) + " online"
+	}
+	return ""
+}
+
+func (o *onlineSwitches) SetName(int, string) error { return errOnlineReadOnly }
+
+func (o *onlineSwitches) GetDescription(id int) string {
+	if ref, ok := o.target(id); ok {
+		return "On while " + o.router.displayName(ref) + " is reachable"
+	}
+	return ""
+}
+
+func (o *onlineSwitches) GetCanWrite(int) bool { return false }
+func (o *onlineSwitches) GetMin(int) float64   { return 0 }
+func (o *onlineSwitches) GetMax(int) float64   { return 1 }
+func (o *onlineSwitches) GetStep(int) float64  { return 1 }
+
+func (o *onlineSwitches) GetSwitch(id int) (bool, error) {
+	ref, ok := o.target(id)
+	if !ok {
+		return false, fmt.Errorf("invalid online switch id %d", id)
+	}
+	return o.reachable(ref), nil
+}
+
+func (o *onlineSwitches) GetSwitchValue(id int) (float64, error) {
+	on, err := o.GetSwitch(id)
+	if on {
+		return 1, err
+	}
+	return 0, err
+}
+
+// LastUpdated is the target's last confirmed hardware contact, so an
+// online switch is stale exactly while its device has never answered.
+func (o *onlineSwitches) LastUpdated(id int) time.Time {
+	ref, ok := o.target(id)
+	if !ok {
+		return time.Time{}
+	}
+	for gid, r := range o.router.tbl().index {
+		if r == ref {
+			return o.router.LastUpdated(gid)
+		}
+	}
+	return time.Time{}
+}
+
+func (o *onlineSwitches) SetSwitch(int, bool) error         { return errOnlineReadOnly }
+func (o *onlineSwitches) SetSwitchValue(int, float64) error { return errOnlineReadOnly }
+func (o *onlineSwitches) Connect() error                    { return nil }
+func (o *onlineSwitches) Disconnect()                       {}
+func (o *onlineSwitches) IsConnected() bool                 { return true }
+func (o *onlineSwitches) BackendType() string               { return "online" }
+
+var errOnlineReadOnly = fmt.Errorf("%w: online switches are read-only and named after their device", ErrInvalidOperation)
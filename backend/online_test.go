@@ -0,0 +1,52 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+)
+
+// The online switch follows the outcome of the last hardware operation on
+// its target.
+func TestOnlineSwitch(t *testing.T) {
+	fake := newFakeSwitches(0, 0)
+	fake.opts[0].OnlineSwitch = true
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+	if n := r.NumSwitches(); n != 3 {
+		t.Fatalf("NumSwitches = %d, want 2 switches and 1 online switch", n)
+	}
+	if name := r.GetName(2); name != "fake 0 online" {
+		t.Errorf("online switch name = %q, want \"fake 0 online\"", name)
+	}
+	online := func() bool {
+		t.Helper()
+		on, err := r.GetSwitch(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return on
+	}
+
+	if online() {
+		t.Error("online before any contact with the device")
+	}
+	if err := r.SetSwitch(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if !online() {
+		t.Error("offline after a successful write")
+	}
+	fake.mu.Lock()
+	fake.err = errors.New("no route to host")
+	fake.mu.Unlock()
+	r.SetSwitch(0, false)
+	if online() {
+		t.Error("online after a failed write")
+	}
+
+	if r.GetCanWrite(2) {
+		t.Error("online switch reports CanWrite")
+	}
+	if err := r.SetSwitch(2, true); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("SetSwitch on the online switch = %v, want ErrInvalidOperation", err)
+	}
+}
@@ -0,0 +1,111 @@
+package onvif
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// wsDiscoveryAddr is the WS-Discovery multicast address.
+var wsDiscoveryAddr = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 3702}
+
+const probeTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<e:Envelope xmlns:e="http://www.w3.org/2003/05/soap-envelope" xmlns:w="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<e:Header><w:MessageID>uuid:%s</w:MessageID><w:To e:mustUnderstand="true">urn:schemas-xmlsoap-org:ws:2005:04:discovery</w:To><w:Action e:mustUnderstand="true">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</w:Action></e:Header>
+<e:Body><d:Probe><d:Types>dn:NetworkVideoTransmitter</d:Types></d:Probe></e:Body>
+</e:Envelope>`
+
+// probeMatches is the body of a WS-Discovery ProbeMatches reply.
+type probeMatches struct {
+	Matches []struct {
+		Address string `xml:"EndpointReference>Address"`
+		Scopes  string `xml:"Scopes"`
+		XAddrs  string `xml:"XAddrs"`
+	} `xml:"Body>ProbeMatches>ProbeMatch"`
+}
+
+// Discover sends a WS-Discovery probe for ONVIF video transmitters and
+// returns the cameras that answer and are not configured yet.
+func (b *Backend) Discover(timeout time.Duration) ([]backend.DiscoveredDevice, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	id := make([]byte, 16)
+	rand.Read(id)
+	probe := fmt.Sprintf(probeTemplate, fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]))
+	if _, err := conn.WriteToUDP([]byte(probe), wsDiscoveryAddr); err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	configured := make(map[string]bool, len(b.cameras))
+	for _, c := range b.cameras {
+		configured[hostOnly(c.cfg.Host)] = true
+	}
+	b.mu.RUnlock()
+
+	var found []backend.DiscoveredDevice
+	seen := make(map[string]bool)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 16384)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break // deadline reached
+		}
+		var pm probeMatches
+		if xml.Unmarshal(buf[:n], &pm) != nil {
+			continue
+		}
+		for _, m := range pm.Matches {
+			xaddrs := strings.Fields(m.XAddrs)
+			if len(xaddrs) == 0 {
+				continue
+			}
+			u, err := url.Parse(xaddrs[0])
+			if err != nil || u.Host == "" {
+				continue
+			}
+			if configured[hostOnly(u.Host)] || seen[u.Host] {
+				continue
+			}
+			seen[u.Host] = true
+			found = append(found, backend.DiscoveredDevice{
+				Type:    "onvif",
+				Address: u.Host,
+				Model:   scopeValue(m.Scopes, "hardware"),
+				ID:      strings.TrimPrefix(m.Address, "urn:uuid:"),
+				Needs:   []string{"username", "password"},
+			})
+		}
+	}
+	return found, nil
+}
+
+// scopeValue returns the value of an onvif://www.onvif.org/<key>/<value> scope.
+func scopeValue(scopes, key string) string {
+	prefix := "onvif://www.onvif.org/" + key + "/"
+	for _, s := range strings.Fields(scopes) {
+		if strings.HasPrefix(s, prefix) {
+			v, _ := url.PathUnescape(strings.TrimPrefix(s, prefix))
+			return v
+		}
+	}
+	return ""
+}
+
+// hostOnly strips any port from host.
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
@@ -0,0 +1,90 @@
+package onvif
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IR cut filter modes (tt:IrCutFilterMode). A camera in AUTO reads as day mode.
+const (
+	irCutOn  = "ON"  // filter in: day mode, IR blocked
+	irCutOff = "OFF" // filter out: night mode, IR passes
+)
+
+// resolve looks up the camera's imaging service address and video source
+// token, caching them for later calls.
+func (c *camera) resolve() (imagingURL, source string, err error) {
+	c.endpointMu.Lock()
+	defer c.endpointMu.Unlock()
+	if c.imagingURL != "" && c.source != "" {
+		return c.imagingURL, c.source, nil
+	}
+
+	var caps struct {
+		Media   string `xml:"Capabilities>Media>XAddr"`
+		Imaging string `xml:"Capabilities>Imaging>XAddr"`
+	}
+	body := `<GetCapabilities xmlns="` + nsDevice + `"><Category>All</Category></GetCapabilities>`
+	if err := c.call(c.deviceURL(), body, &caps); err != nil {
+		return "", "", fmt.Errorf("GetCapabilities: %w", err)
+	}
+	if caps.Imaging == "" {
+		return "", "", fmt.Errorf("camera does not offer the ONVIF imaging service")
+	}
+
+	source = c.cfg.VideoSource
+	if source == "" {
+		if caps.Media == "" {
+			return "", "", fmt.Errorf("camera does not offer the ONVIF media service")
+		}
+		var sources struct {
+			Sources []struct {
+				Token string `xml:"token,attr"`
+			} `xml:"VideoSources"`
+		}
+		if err := c.call(caps.Media, `<GetVideoSources xmlns="`+nsMedia+`"/>`, &sources); err != nil {
+			return "", "", fmt.Errorf("GetVideoSources: %w", err)
+		}
+		if len(sources.Sources) == 0 {
+			return "", "", fmt.Errorf("camera reports no video sources")
+		}
+		source = sources.Sources[0].Token
+	}
+	c.imagingURL, c.source = caps.Imaging, source
+	return c.imagingURL, c.source, nil
+}
+
+// getIRCut reads the IR cut filter mode (ON, OFF or AUTO).
+func (c *camera) getIRCut() (string, error) {
+	url, source, err := c.resolve()
+	if err != nil {
+		return "", err
+	}
+	var settings struct {
+		IrCutFilter string `xml:"ImagingSettings>IrCutFilter"`
+	}
+	body := `<GetImagingSettings xmlns="` + nsImaging + `"><VideoSourceToken>` + escape(source) + `</VideoSourceToken></GetImagingSettings>`
+	if err := c.call(url, body, &settings); err != nil {
+		return "", fmt.Errorf("GetImagingSettings: %w", err)
+	}
+	if settings.IrCutFilter == "" {
+		return "", fmt.Errorf("camera does not report an IR cut filter")
+	}
+	return strings.ToUpper(settings.IrCutFilter), nil
+}
+
+// setIRCut sets the IR cut filter mode.
+func (c *camera) setIRCut(mode string) error {
+	url, source, err := c.resolve()
+	if err != nil {
+		return err
+	}
+	body := `<SetImagingSettings xmlns="` + nsImaging + `" xmlns:tt="` + nsSchema + `">` +
+		`<VideoSourceToken>` + escape(source) + `</VideoSourceToken>` +
+		`<ImagingSettings><tt:IrCutFilter>` + mode + `</tt:IrCutFilter></ImagingSettings>` +
+		`<ForcePersistence>true</ForcePersistence></SetImagingSettings>`
+	if err := c.call(url, body, nil); err != nil {
+		return fmt.Errorf("SetImagingSettings: %w", err)
+	}
+	return nil
+}
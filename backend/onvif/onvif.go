@@ -0,0 +1,379 @@
+// Package onvif implements a SwitchBackend for generic IP cameras through the
+// ONVIF imaging service. Each CameraConfig entry becomes one switch that
+// controls the IR cut filter: on = night mode (filter out, IR illumination
+// visible), off = day mode (filter in).
+//
+// Requests are SOAP over HTTP authenticated with a WS-Security
+// UsernameToken digest, so the camera's clock must be roughly correct.
+//
+// Host field supports an optional port, e.g. "192.168.1.20:8080".
+package onvif
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// CameraConfig holds connection details and cached state for one ONVIF camera.
+type CameraConfig struct {
+	Host        string  `json:"host"`
+	Username    string  `json:"username"`
+	Password    string  `json:"password"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	UniqueID    string  `json:"uniqueid"`
+	Value       float64 `json:"value"` // cached last-known state: 0=day, 1=night
+
+	// DeviceURL overrides the device service address (default
+	// http://<host>/onvif/device_service).
+	DeviceURL string `json:"device_url,omitempty"`
+	// VideoSource is the video source token to control (default: the
+	// camera's first video source).
+	VideoSource string `json:"video_source,omitempty"`
+
+	backend.SwitchOptions
+}
+
+// Settings holds backend-wide options for the ONVIF backend.
+type Settings struct {
+	// PollSeconds is the default refresh interval for cameras without a
+	// per-camera poll_seconds override. Zero disables background polling.
+	PollSeconds int `json:"poll_seconds"`
+
+	backend.CommonSettings
+}
+
+// camera is the runtime representation of one camera switch.
+type camera struct {
+	cfg     CameraConfig
+	client  *http.Client
+	updated time.Time // when cfg.Value was last read from or written to the camera
+
+	// endpointMu guards the service address and source token looked up
+	// on first use.
+	endpointMu sync.Mutex
+	imagingURL string
+	source     string
+}
+
+// Backend implements backend.SwitchBackend for ONVIF IR cut filters.
+type Backend struct {
+	mu        sync.RWMutex
+	cameras   []*camera
+	settings  Settings
+	connected bool
+}
+
+const cameraRequestTimeout = 5 * time.Second
+
+// New creates an ONVIF backend from a list of camera configs.
+func New(cfgs []CameraConfig, settings Settings) *Backend {
+	cams := make([]*camera, len(cfgs))
+	for i, cfg := range cfgs {
+		cams[i] = &camera{
+			cfg:    cfg,
+			client: &http.Client{Timeout: cameraRequestTimeout},
+		}
+	}
+	return &Backend{cameras: cams, settings: settings}
+}
+
+func (c *camera) deviceURL() string {
+	if c.cfg.DeviceURL != "" {
+		return c.cfg.DeviceURL
+	}
+	return fmt.Sprintf("http://%s/onvif/device_service", c.cfg.Host)
+}
+
+// readValue returns 1 if the camera is in night mode (IR cut filter out), else 0.
+func (c *camera) readValue() (float64, error) {
+	mode, err := c.getIRCut()
+	if err != nil {
+		return 0, err
+	}
+	if mode == irCutOff {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// Connect queries the current mode of all cameras and marks the backend
+// connected. It blocks until every camera has answered or timed out.
+func (b *Backend) Connect() error {
+	b.refreshStates()
+	b.mu.Lock()
+	b.connected = true
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *Backend) refreshStates() {
+	okCount := 0
+	failCount := 0
+	for i, cam := range b.cameras {
+		value, err := cam.readValue()
+		if err != nil {
+			failCount++
+			log.Printf("[onvif] warning: could not query camera %d (%s): %v", i, cam.cfg.Host, err)
+			continue
+		}
+		okCount++
+		b.mu.Lock()
+		cam.cfg.Value = value
+		cam.updated = time.Now()
+		b.mu.Unlock()
+	}
+	log.Printf("[onvif] state refresh complete: %d ok, %d failed", okCount, failCount)
+}
+
+// Disconnect marks the backend disconnected.
+func (b *Backend) Disconnect() {
+	b.mu.Lock()
+	b.connected = false
+	b.mu.Unlock()
+}
+
+// IsConnected reports whether the backend is connected.
+func (b *Backend) IsConnected() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.connected
+}
+
+// BackendType returns "onvif".
+func (b *Backend) BackendType() string { return "onvif" }
+
+// ClampsValues reports whether clamp_values is set.
+func (b *Backend) ClampsValues() bool { return b.settings.ClampsValues() }
+
+// OptimizesWrites reports whether write_mode is optimize, and the
+// write_max_age_seconds freshness limit.
+func (b *Backend) OptimizesWrites() (bool, time.Duration) { return b.settings.OptimizesWrites() }
+
+// NamePrefix returns the name_prefix setting.
+func (b *Backend) NamePrefix() string { return b.settings.NamePrefix }
+
+// NumSwitches returns the number of cameras (one switch per camera).
+func (b *Backend) NumSwitches() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.cameras)
+}
+
+// GetName returns the camera name for switch id.
+func (b *Backend) GetName(id int) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.cameras) {
+		return ""
+	}
+	return b.cameras[id].cfg.Name
+}
+
+// SetName sets a custom name for switch id.
+func (b *Backend) SetName(id int, name string) error {
+	if id < 0 || id >= len(b.cameras) {
+		return fmt.Errorf("invalid camera id %d", id)
+	}
+	b.mu.Lock()
+	b.cameras[id].cfg.Name = name
+	b.mu.Unlock()
+	return nil
+}
+
+// GetDescription returns the description for switch id. Without one it
+// expands description_template ({name}, {host}), falling back to "<name>
+// IR night mode".
+func (b *Backend) GetDescription(id int) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.cameras) {
+		return ""
+	}
+	cfg := b.cameras[id].cfg
+	if cfg.Description != "" {
+		return cfg.Description
+	}
+	if b.settings.DescriptionTemplate != "" {
+		return backend.ExpandDescription(b.settings.DescriptionTemplate, map[string]string{
+			"name": cfg.Name,
+			"host": cfg.Host,
+		})
+	}
+	return fmt.Sprintf("%s IR night mode", cfg.Name)
+}
+
+// GetCanWrite always returns true.
+func (b *Backend) GetCanWrite(_ int) bool { return true }
+
+// GetMin returns the minimum value (0 = day mode).
+func (b *Backend) GetMin(_ int) float64 { return 0 }
+
+// GetMax returns the maximum value (1 = night mode).
+func (b *Backend) GetMax(_ int) float64 { return 1 }
+
+// GetStep returns the step size (1).
+func (b *Backend) GetStep(_ int) float64 { return 1 }
+
+// GetSwitch queries the live IR cut filter mode from the camera and caches it.
+func (b *Backend) GetSwitch(id int) (bool, error) {
+	b.mu.RLock()
+	if id < 0 || id >= len(b.cameras) {
+		b.mu.RUnlock()
+		return false, fmt.Errorf("invalid camera id %d", id)
+	}
+	cam := b.cameras[id]
+	b.mu.RUnlock()
+
+	value, err := cam.readValue()
+	if err != nil {
+		return false, err
+	}
+	b.mu.Lock()
+	cam.cfg.Value = value
+	cam.updated = time.Now()
+	b.mu.Unlock()
+	return value != 0, nil
+}
+
+// ReadsLive reports that GetSwitch queries the camera directly.
+func (b *Backend) ReadsLive() bool { return true }
+
+// GetSwitchValue returns the cached numeric value (0.0 or 1.0).
+func (b *Backend) GetSwitchValue(id int) (float64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.cameras) {
+		return 0, fmt.Errorf("invalid camera id %d", id)
+	}
+	return b.cameras[id].cfg.Value, nil
+}
+
+// SetSwitch switches camera id to night mode (true) or day mode (false).
+func (b *Backend) SetSwitch(id int, state bool) error {
+	b.mu.RLock()
+	if id < 0 || id >= len(b.cameras) {
+		b.mu.RUnlock()
+		return fmt.Errorf("invalid camera id %d", id)
+	}
+	cam := b.cameras[id]
+	b.mu.RUnlock()
+
+	mode := irCutOn
+	if state {
+		mode = irCutOff
+	}
+	if err := cam.setIRCut(mode); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	if state {
+		cam.cfg.Value = 1
+	} else {
+		cam.cfg.Value = 0
+	}
+	cam.updated = time.Now()
+	b.mu.Unlock()
+	log.Printf("[onvif] camera %d (%s) night mode set to %v", id, cam.cfg.Name, state)
+	return nil
+}
+
+// SetSwitchValue sets the mode by numeric value (0 = day, non-zero = night).
+func (b *Backend) SetSwitchValue(id int, value float64) error {
+	return b.SetSwitch(id, value != 0)
+}
+
+// SwitchOptions returns the per-switch options configured for camera id.
+func (b *Backend) SwitchOptions(id int) backend.SwitchOptions {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.cameras) {
+		return backend.SwitchOptions{}
+	}
+	return b.cameras[id].cfg.SwitchOptions
+}
+
+// PollInterval returns the background refresh interval for camera id.
+func (b *Backend) PollInterval(id int) time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.cameras) {
+		return 0
+	}
+	return b.cameras[id].cfg.PollInterval(b.settings.PollSeconds)
+}
+
+// PollSwitchValue queries the live mode of camera id.
+func (b *Backend) PollSwitchValue(id int) (float64, error) {
+	b.mu.RLock()
+	if id < 0 || id >= len(b.cameras) {
+		b.mu.RUnlock()
+		return 0, fmt.Errorf("invalid camera id %d", id)
+	}
+	cam := b.cameras[id]
+	b.mu.RUnlock()
+
+	value, err := cam.readValue()
+	if err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	cam.updated = time.Now()
+	b.mu.Unlock()
+	return value, nil
+}
+
+// SetCachedValue stores a polled mode for camera id.
+func (b *Backend) SetCachedValue(id int, value float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id < 0 || id >= len(b.cameras) {
+		return
+	}
+	b.cameras[id].cfg.Value = value
+}
+
+// LastUpdated returns when camera id's mode was last read from or written
+// to the camera, or the zero time if it is still the config value.
+func (b *Backend) LastUpdated(id int) time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.cameras) {
+		return time.Time{}
+	}
+	return b.cameras[id].updated
+}
+
+// InvalidateCache clears camera id's hardware stamp, so its value reads as
+// unverified until it is next read from the camera.
+func (b *Backend) InvalidateCache(id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id >= 0 && id < len(b.cameras) {
+		b.cameras[id].updated = time.Time{}
+	}
+}
+
+// Configs returns a snapshot of all camera configs (for config persistence).
+func (b *Backend) Configs() []CameraConfig {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	out := make([]CameraConfig, len(b.cameras))
+	for i, c := range b.cameras {
+		out[i] = c.cfg
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package onvif
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"alpaca-switch/backend"
+	"alpaca-switch/internal/testutil"
+)
+
+// newCamera starts a fake camera and a connected backend with one switch
+// configured by cfg, whose Host is filled in.
+func newCamera(t *testing.T, cfg CameraConfig) (*testutil.ONVIF, *Backend) {
+	t.Helper()
+	fake := testutil.NewONVIF()
+	t.Cleanup(fake.Close)
+	cfg.Host = fake.Host()
+	if cfg.Name == "" {
+		cfg.Name = "cam"
+	}
+	b := New([]CameraConfig{cfg}, Settings{})
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(b.Disconnect)
+	return fake, b
+}
+
+func TestIRCutFilter(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{})
+
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatalf("SetSwitch(night): %v", err)
+	}
+	fake.Lock()
+	mode, sources := fake.IrCutFilter, fake.SetSources
+	fake.Unlock()
+	if mode != "OFF" {
+		t.Errorf("IR cut filter = %q after switching to night, want \"OFF\"", mode)
+	}
+	if !slices.Equal(sources, []string{"VideoSource_1"}) {
+		t.Errorf("SetImagingSettings sources = %v, want the camera's first video source", sources)
+	}
+
+	fake.Lock()
+	fake.IrCutFilter = "AUTO"
+	fake.Unlock()
+	if on, err := b.GetSwitch(0); err != nil || on {
+		t.Errorf("GetSwitch in AUTO = %v, %v; want day (false)", on, err)
+	}
+}
+
+// The service addresses and source token are looked up once and reused,
+// and a configured video source skips GetVideoSources.
+func TestResolveOnce(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{VideoSource: "main"})
+	for i := 0; i < 3; i++ {
+		if _, err := b.GetSwitch(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.SetSwitch(0, false); err != nil {
+		t.Fatal(err)
+	}
+	fake.Lock()
+	defer fake.Unlock()
+	var caps, sources int
+	for _, op := range fake.Requests {
+		switch op {
+		case "GetCapabilities":
+			caps++
+		case "GetVideoSources":
+			sources++
+		}
+	}
+	if caps != 1 || sources != 0 {
+		t.Errorf("%d GetCapabilities and %d GetVideoSources in %v, want 1 and 0", caps, sources, fake.Requests)
+	}
+	if !slices.Equal(fake.SetSources, []string{"main"}) {
+		t.Errorf("SetImagingSettings sources = %v, want [main]", fake.SetSources)
+	}
+}
+
+func TestCredentialsSendSecurityHeader(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{Username: "admin", Password: "secret"})
+	if _, err := b.GetSwitch(0); err != nil {
+		t.Fatal(err)
+	}
+	fake.Lock()
+	defer fake.Unlock()
+	for i, auth := range fake.Authenticated {
+		if !auth {
+			t.Errorf("request %d (%s) sent without a UsernameToken", i, fake.Requests[i])
+		}
+	}
+}
+
+func TestSOAPFault(t *testing.T) {
+	fake, b := newCamera(t, CameraConfig{})
+	fake.Lock()
+	fake.Fault = "Sender not authorized"
+	fake.Unlock()
+	if err := b.SetSwitch(0, true); !errors.Is(err, backend.ErrRejected) {
+		t.Errorf("SetSwitch against a faulting camera = %v, want ErrRejected", err)
+	}
+	if v, _ := b.GetSwitchValue(0); v != 0 {
+		t.Errorf("cached value = %v after a failed write, want 0", v)
+	}
+}
+
+func TestNoImagingService(t *testing.T) {
+	fake := testutil.NewONVIF()
+	defer fake.Close()
+	fake.NoImaging = true
+	b := New([]CameraConfig{{Name: "cam", Host: fake.Host()}}, Settings{})
+	if _, err := b.GetSwitch(0); err == nil {
+		t.Error("GetSwitch succeeded on a camera without the imaging service")
+	}
+}
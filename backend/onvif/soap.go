@@ -0,0 +1,99 @@
+package onvif
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// ONVIF service namespaces.
+const (
+	nsDevice  = "http://www.onvif.org/ver10/device/wsdl"
+	nsMedia   = "http://www.onvif.org/ver10/media/wsdl"
+	nsImaging = "http://www.onvif.org/ver20/imaging/wsdl"
+	nsSchema  = "http://www.onvif.org/ver10/schema"
+)
+
+const envelopeTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">
+<s:Header>%s</s:Header>
+<s:Body>%s</s:Body>
+</s:Envelope>`
+
+// securityHeader builds a WS-Security UsernameToken header with a password
+// digest, Base64(SHA1(nonce + created + password)), as ONVIF requires.
+func securityHeader(username, password string) string {
+	if username == "" {
+		return ""
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	created := time.Now().UTC().Format(time.RFC3339)
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(password))
+	digest := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	var b strings.Builder
+	b.WriteString(`<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"><UsernameToken><Username>`)
+	xml.EscapeText(&b, []byte(username))
+	fmt.Fprintf(&b, `</Username><Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">%s</Password>`, digest)
+	fmt.Fprintf(&b, `<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-soap-message-security-1.0#Base64Binary">%s</Nonce>`, base64.StdEncoding.EncodeToString(nonce))
+	fmt.Fprintf(&b, `<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">%s</Created></UsernameToken></Security>`, created)
+	return b.String()
+}
+
+// soapEnvelope is the response envelope; Body.Inner holds the response element.
+type soapEnvelope struct {
+	Body struct {
+		Fault *struct {
+			Reason string `xml:"Reason>Text"`
+		} `xml:"Fault"`
+		Inner []byte `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+// call posts a SOAP request with body to url and decodes the response
+// element into out (which may be nil).
+func (c *camera) call(url, body string, out interface{}) error {
+	payload := fmt.Sprintf(envelopeTemplate, securityHeader(c.cfg.Username, c.cfg.Password), body)
+	backend.Tracef("onvif POST %s request: %s", url, backend.Redact(body, c.cfg.Password))
+	resp, err := c.client.Post(url, "application/soap+xml; charset=utf-8", strings.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("POST %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	backend.Tracef("onvif POST %s response %d: %s", url, resp.StatusCode, backend.Redact(string(data), c.cfg.Password))
+
+	var env soapEnvelope
+	if err := xml.Unmarshal(data, &env); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &backend.StatusError{Code: resp.StatusCode, Err: fmt.Errorf("camera returned %d", resp.StatusCode)}
+		}
+		return fmt.Errorf("decode response: %w", err)
+	}
+	if env.Body.Fault != nil {
+		return fmt.Errorf("%w: SOAP fault: %s", backend.ErrRejected, strings.TrimSpace(env.Body.Fault.Reason))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &backend.StatusError{Code: resp.StatusCode, Err: fmt.Errorf("camera returned %d", resp.StatusCode)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := xml.Unmarshal(bytes.TrimSpace(env.Body.Inner), out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
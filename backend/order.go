@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"log"
+	"strings"
+)
+
+// matchesOrderRef reports whether switch ref is named by an Options.Order
+// entry: its name, or "<type>:<name>" to tell apart switches of the same
+// name on different backends. Both compare case-insensitively.
+func matchesOrderRef(ref switchRef, entry string) bool {
+	name := ref.backend.GetName(ref.localID)
+	return strings.EqualFold(entry, name) || strings.EqualFold(entry, typeName(ref.backend)+":"+name)
+}
+
+// orderIndex moves the switches listed in Options.Order to the front of
+// refs, in the listed order. Unlisted switches follow in their usual
+// backend-then-local order. An entry matching several switches places
+// them all, in their usual order.
+func (r *Router) orderIndex(refs []switchRef) []switchRef {
+	out := make([]switchRef, 0, len(refs))
+	placed := make([]bool, len(refs))
+	for _, entry := range r.opts.Order {
+		for i, ref := range refs {
+			if !placed[i] && matchesOrderRef(ref, entry) {
+				out = append(out, ref)
+				placed[i] = true
+			}
+		}
+	}
+	for i, ref := range refs {
+		if !placed[i] {
+			out = append(out, ref)
+		}
+	}
+	return out
+}
+
+// checkOrder warns about Options.Order entries that match no switch.
+func (r *Router) checkOrder() {
+	t := r.tbl()
+	refs := append(append([]switchRef(nil), t.index...), t.hidden...)
+	for _, entry := range r.opts.Order {
+		found := false
+		for _, ref := range refs {
+			if matchesOrderRef(ref, entry) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Printf("Warning: switch_order entry %q matches no switch", entry)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package backend
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSwitchOrder(t *testing.T) {
+	buf := captureLog(t)
+	power := newNamedSwitches("mi", "Mount", "Heater", "Camera")
+	cams := newNamedSwitches("hikvision", "Camera", "Roof IR")
+	r := NewRouter([]SwitchBackend{power, cams}, Options{Order: []string{
+		"hikvision:camera", "heater", "mount", "nosuch",
+	}})
+
+	// Listed switches first, in the listed order; the rest in their usual
+	// backend-then-local order.
+	want := []string{"Camera", "Heater", "Mount", "Camera", "Roof IR"}
+	if got := switchNames(r); !slices.Equal(got, want) {
+		t.Fatalf("switch order = %v, want %v", got, want)
+	}
+	if err := r.SetSwitch(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if cams.value(0) != 1 || power.value(2) != 0 {
+		t.Error("switch 0 is not the hikvision Camera")
+	}
+	if !strings.Contains(buf.String(), `switch_order entry "nosuch" matches no switch`) {
+		t.Errorf("no warning for the unmatched entry:\n%s", buf.String())
+	}
+
+	// Without an order the index is backend-then-local.
+	plain := NewRouter([]SwitchBackend{power, cams}, Options{})
+	if got := switchNames(plain); !slices.Equal(got, []string{"Mount", "Heater", "Camera", "Camera", "Roof IR"}) {
+		t.Errorf("default order = %v", got)
+	}
+}
@@ -0,0 +1,464 @@
+// Package pdu implements a SwitchBackend for the outlets of managed
+// (switched) power distribution units, such as APC and Eaton rack PDUs,
+// over SNMP v1/v2c. Each SwitchConfig entry is one on/off switch for one
+// outlet: its state is read from, and switched through, the vendor's
+// outlet objects.
+//
+// Example:
+//
+//	{"name": "Mount", "host": "192.168.1.40", "community": "private", "outlet": 3}
+package pdu
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// Vendors selectable with SwitchConfig.Vendor.
+const (
+	// VendorAPC drives APC Switched Rack PDUs (PowerNet MIB rPDU outlet
+	// objects).
+	VendorAPC = "apc"
+	// VendorEaton drives Eaton ePDUs (EATON-EPDU-MIB outlet control
+	// objects, first PDU of a daisy chain).
+	VendorEaton = "eaton"
+	// VendorCustom uses the objects given in SwitchConfig.OIDs.
+	VendorCustom = "custom"
+)
+
+// OIDs are the SNMP objects of one outlet. "{outlet}" in an OID is
+// replaced by the outlet number.
+type OIDs struct {
+	// State is read for the outlet state; StateOn is its value when on.
+	State   string `json:"state"`
+	StateOn int64  `json:"state_on"`
+	// On and Off are set to OnValue and OffValue to switch the outlet;
+	// they may be the same object.
+	On       string `json:"on"`
+	OnValue  int64  `json:"on_value"`
+	Off      string `json:"off"`
+	OffValue int64  `json:"off_value"`
+}
+
+// vendorOIDs are the built-in outlet objects of each vendor.
+var vendorOIDs = map[string]OIDs{
+	// rPDUOutletStatusOutletState (1 = on) and
+	// rPDUOutletControlOutletCommand (1 = immediateOn, 2 = immediateOff).
+	VendorAPC: {
+		State: ".1.3.6.1.4.1.318.1.1.12.3.5.1.1.4.{outlet}", StateOn: 1,
+		On: ".1.3.6.1.4.1.318.1.1.12.3.3.1.1.4.{outlet}", OnValue: 1,
+		Off: ".1.3.6.1.4.1.318.1.1.12.3.3.1.1.4.{outlet}", OffValue: 2,
+	},
+	// outletControlStatus (1 = on), and outletControlOnCmd and
+	// outletControlOffCmd, whose value is a delay in seconds (0 = now).
+	VendorEaton: {
+		State: ".1.3.6.1.4.1.534.6.6.7.6.6.1.2.0.{outlet}", StateOn: 1,
+		On: ".1.3.6.1.4.1.534.6.6.7.6.6.1.4.0.{outlet}", OnValue: 0,
+		Off: ".1.3.6.1.4.1.534.6.6.7.6.6.1.3.0.{outlet}", OffValue: 0,
+	},
+}
+
+// SwitchConfig describes one switched PDU outlet.
+type SwitchConfig struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Value       float64 `json:"value"` // cached last-known state: 0=off, 1=on
+
+	// Host is the PDU address, optionally with a port (default 161).
+	Host string `json:"host"`
+	// Community is the SNMP community with write access (default
+	// "private").
+	Community string `json:"community"`
+	// Outlet is the outlet number, starting at 1.
+	Outlet int `json:"outlet"`
+	// Vendor selects the outlet objects: VendorAPC (default), VendorEaton
+	// or VendorCustom.
+	Vendor string `json:"vendor,omitempty"`
+	// OIDs are the outlet objects with VendorCustom.
+	OIDs *OIDs `json:"oids,omitempty"`
+
+	backend.SwitchOptions
+}
+
+// defaultCommunity is the SNMP community used when none is configured.
+const defaultCommunity = "private"
+
+// Validate checks the host, outlet and vendor of cfg.
+func (cfg SwitchConfig) Validate() error {
+	if cfg.Host == "" {
+		return fmt.Errorf("host is empty")
+	}
+	if cfg.Outlet < 1 {
+		return fmt.Errorf("outlet must be 1 or more, got %d", cfg.Outlet)
+	}
+	switch cfg.Vendor {
+	case "", VendorAPC, VendorEaton:
+	case VendorCustom:
+		if cfg.OIDs == nil {
+			return fmt.Errorf("vendor %q needs oids", VendorCustom)
+		}
+		for _, oid := range []string{cfg.OIDs.State, cfg.OIDs.On, cfg.OIDs.Off} {
+			if _, err := encodeOID(strings.ReplaceAll(oid, "{outlet}", "1")); err != nil {
+				return fmt.Errorf("oids: %w", err)
+			}
+		}
+	default:
+		return fmt.Errorf("vendor must be %q, %q or %q, got %q", VendorAPC, VendorEaton, VendorCustom, cfg.Vendor)
+	}
+	return nil
+}
+
+// oids returns cfg's outlet objects with the outlet number filled in.
+func (cfg SwitchConfig) oids() OIDs {
+	o := vendorOIDs[VendorAPC]
+	switch cfg.Vendor {
+	case VendorEaton:
+		o = vendorOIDs[VendorEaton]
+	case VendorCustom:
+		o = *cfg.OIDs
+	}
+	outlet := strconv.Itoa(cfg.Outlet)
+	o.State = strings.ReplaceAll(o.State, "{outlet}", outlet)
+	o.On = strings.ReplaceAll(o.On, "{outlet}", outlet)
+	o.Off = strings.ReplaceAll(o.Off, "{outlet}", outlet)
+	return o
+}
+
+// SNMP versions selectable with Settings.SNMPVersion.
+const (
+	SNMPv1  = "1"
+	SNMPv2c = "2c"
+)
+
+// Settings holds backend-wide options for the PDU backend.
+type Settings struct {
+	// PollSeconds is the default refresh interval for outlets without a
+	// per-switch poll_seconds override. Zero disables background polling.
+	PollSeconds int `json:"poll_seconds"`
+
+	// SNMPVersion is SNMPv2c (default) or SNMPv1.
+	SNMPVersion string `json:"snmp_version"`
+
+	// TimeoutSeconds bounds each SNMP request (default 3).
+	TimeoutSeconds int `json:"timeout_seconds"`
+
+	backend.CommonSettings
+}
+
+// defaultTimeout is the SNMP request deadline when
+// Settings.TimeoutSeconds is zero.
+const defaultTimeout = 3 * time.Second
+
+// outlet is the runtime representation of one switched outlet.
+type outlet struct {
+	cfg     SwitchConfig
+	client  client
+	updated time.Time // when cfg.Value was last read from or written to the PDU
+}
+
+// Backend implements backend.SwitchBackend for SNMP-switched PDU outlets.
+type Backend struct {
+	mu        sync.RWMutex
+	outlets   []*outlet
+	settings  Settings
+	connected bool
+}
+
+// New creates a PDU backend from a list of switch configs.
+func New(cfgs []SwitchConfig, settings Settings) *Backend {
+	version := version2c
+	switch settings.SNMPVersion {
+	case "", SNMPv2c:
+	case SNMPv1:
+		version = version1
+	default:
+		log.Printf("[pdu] warning: snmp_version must be %q or %q, got %q; using %q",
+			SNMPv2c, SNMPv1, settings.SNMPVersion, SNMPv2c)
+	}
+	timeout := time.Duration(settings.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	outlets := make([]*outlet, len(cfgs))
+	for i, cfg := range cfgs {
+		if err := cfg.Validate(); err != nil {
+			log.Printf("[pdu] switch %d (%s): %v; it will fail every operation", i, cfg.Name, err)
+		}
+		community := cfg.Community
+		if community == "" {
+			community = defaultCommunity
+		}
+		outlets[i] = &outlet{
+			cfg:    cfg,
+			client: client{host: cfg.Host, community: community, version: version, timeout: timeout},
+		}
+	}
+	return &Backend{outlets: outlets, settings: settings}
+}
+
+// Connect queries the state of every outlet and marks the backend
+// connected.
+func (b *Backend) Connect() error {
+	b.refreshStates()
+	b.mu.Lock()
+	b.connected = true
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *Backend) refreshStates() {
+	okCount := 0
+	failCount := 0
+	for i := range b.outlets {
+		value, err := b.PollSwitchValue(i)
+		if err != nil {
+			failCount++
+			log.Printf("[pdu] warning: switch %d query failed: %v (keeping cached value)", i, err)
+			continue
+		}
+		okCount++
+		b.SetCachedValue(i, value)
+	}
+	log.Printf("[pdu] state refresh complete: %d ok, %d failed", okCount, failCount)
+}
+
+// Disconnect marks the backend disconnected.
+func (b *Backend) Disconnect() {
+	b.mu.Lock()
+	b.connected = false
+	b.mu.Unlock()
+}
+
+// IsConnected reports whether the backend is connected.
+func (b *Backend) IsConnected() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.connected
+}
+
+// BackendType returns "pdu".
+func (b *Backend) BackendType() string { return "pdu" }
+
+// ClampsValues reports whether clamp_values is set.
+func (b *Backend) ClampsValues() bool { return b.settings.ClampsValues() }
+
+// OptimizesWrites reports whether write_mode is optimize, and the
+// write_max_age_seconds freshness limit.
+func (b *Backend) OptimizesWrites() (bool, time.Duration) { return b.settings.OptimizesWrites() }
+
+// NamePrefix returns the name_prefix setting.
+func (b *Backend) NamePrefix() string { return b.settings.NamePrefix }
+
+// NumSwitches returns the number of configured outlets.
+func (b *Backend) NumSwitches() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.outlets)
+}
+
+// get returns switch id's outlet, failing if its config is invalid.
+func (b *Backend) get(id int) (*outlet, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.outlets) {
+		return nil, fmt.Errorf("invalid switch id %d", id)
+	}
+	o := b.outlets[id]
+	if err := o.cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// GetName returns the name of switch id.
+func (b *Backend) GetName(id int) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.outlets) {
+		return ""
+	}
+	return b.outlets[id].cfg.Name
+}
+
+// SetName sets the name of switch id.
+func (b *Backend) SetName(id int, name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id < 0 || id >= len(b.outlets) {
+		return fmt.Errorf("invalid switch id %d", id)
+	}
+	b.outlets[id].cfg.Name = name
+	return nil
+}
+
+// GetDescription returns the description of switch id. Without one it
+// expands description_template ({name}, {host}, {outlet}), falling back to
+// the PDU host and outlet.
+func (b *Backend) GetDescription(id int) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.outlets) {
+		return ""
+	}
+	cfg := b.outlets[id].cfg
+	if cfg.Description != "" {
+		return cfg.Description
+	}
+	if b.settings.DescriptionTemplate != "" {
+		return backend.ExpandDescription(b.settings.DescriptionTemplate, map[string]string{
+			"name":   cfg.Name,
+			"host":   cfg.Host,
+			"outlet": strconv.Itoa(cfg.Outlet),
+		})
+	}
+	return fmt.Sprintf("%s (PDU %s outlet %d)", cfg.Name, cfg.Host, cfg.Outlet)
+}
+
+// GetCanWrite returns true: every outlet can be switched.
+func (b *Backend) GetCanWrite(int) bool { return true }
+
+// GetMin returns the minimum value (0).
+func (b *Backend) GetMin(int) float64 { return 0 }
+
+// GetMax returns the maximum value (1).
+func (b *Backend) GetMax(int) float64 { return 1 }
+
+// GetStep returns the step size (1).
+func (b *Backend) GetStep(int) float64 { return 1 }
+
+// GetSwitch returns the cached state of switch id.
+func (b *Backend) GetSwitch(id int) (bool, error) {
+	value, err := b.GetSwitchValue(id)
+	return value != 0, err
+}
+
+// GetSwitchValue returns the cached value of switch id.
+func (b *Backend) GetSwitchValue(id int) (float64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.outlets) {
+		return 0, fmt.Errorf("invalid switch id %d", id)
+	}
+	return b.outlets[id].cfg.Value, nil
+}
+
+// SetSwitch switches the outlet of switch id on or off and, once the PDU
+// has accepted the command, caches the new state.
+func (b *Backend) SetSwitch(id int, state bool) error {
+	o, err := b.get(id)
+	if err != nil {
+		return err
+	}
+	oids := o.cfg.oids()
+	if state {
+		err = o.client.set(oids.On, oids.OnValue)
+	} else {
+		err = o.client.set(oids.Off, oids.OffValue)
+	}
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	o.cfg.Value = boolValue(state)
+	o.updated = time.Now()
+	b.mu.Unlock()
+	log.Printf("[pdu] switch %d (%s) set to %v", id, b.GetName(id), state)
+	return nil
+}
+
+// SetSwitchValue sets switch id by numeric value: 0 = off, non-zero = on.
+func (b *Backend) SetSwitchValue(id int, value float64) error {
+	return b.SetSwitch(id, value != 0)
+}
+
+// SwitchOptions returns the per-switch options configured for switch id.
+func (b *Backend) SwitchOptions(id int) backend.SwitchOptions {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.outlets) {
+		return backend.SwitchOptions{}
+	}
+	return b.outlets[id].cfg.SwitchOptions
+}
+
+// PollInterval returns the background refresh interval for switch id.
+func (b *Backend) PollInterval(id int) time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.outlets) {
+		return 0
+	}
+	return b.outlets[id].cfg.PollInterval(b.settings.PollSeconds)
+}
+
+// PollSwitchValue reads the live state of switch id's outlet.
+func (b *Backend) PollSwitchValue(id int) (float64, error) {
+	o, err := b.get(id)
+	if err != nil {
+		return 0, err
+	}
+	oids := o.cfg.oids()
+	state, err := o.client.get(oids.State)
+	if err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	o.updated = time.Now()
+	b.mu.Unlock()
+	return boolValue(state == oids.StateOn), nil
+}
+
+// SetCachedValue stores a value for switch id.
+func (b *Backend) SetCachedValue(id int, value float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id < 0 || id >= len(b.outlets) {
+		return
+	}
+	b.outlets[id].cfg.Value = value
+}
+
+// LastUpdated returns when switch id's state was last read from or written
+// to the PDU, or the zero time if it is still the config value.
+func (b *Backend) LastUpdated(id int) time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.outlets) {
+		return time.Time{}
+	}
+	return b.outlets[id].updated
+}
+
+// InvalidateCache clears switch id's hardware stamp, so its value reads as
+// unverified until it is next read from the PDU.
+func (b *Backend) InvalidateCache(id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id >= 0 && id < len(b.outlets) {
+		b.outlets[id].updated = time.Time{}
+	}
+}
+
+// Configs returns a snapshot of all switch configs (for config persistence).
+func (b *Backend) Configs() []SwitchConfig {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	out := make([]SwitchConfig, len(b.outlets))
+	for i, o := range b.outlets {
+		out[i] = o.cfg
+	}
+	return out
+}
+
+func boolValue(on bool) float64 {
+	if on {
+		return 1
+	}
+	return 0
+}
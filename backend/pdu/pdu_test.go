@@ -0,0 +1,138 @@
+package pdu
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"alpaca-switch/backend"
+	"alpaca-switch/internal/testutil"
+)
+
+// newPDU starts a fake APC PDU with outlets 1 to 3 off and a backend for
+// cfgs, whose Host is filled in.
+func newPDU(t *testing.T, settings Settings, cfgs ...SwitchConfig) (*testutil.PDU, *Backend) {
+	t.Helper()
+	fake, err := testutil.NewPDU()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fake.Close() })
+	fake.Lock()
+	fake.Outlets = map[int]bool{1: false, 2: false, 3: false}
+	fake.Unlock()
+	for i := range cfgs {
+		cfgs[i].Host = fake.Host()
+	}
+	return fake, New(cfgs, settings)
+}
+
+func TestOutlets(t *testing.T) {
+	for _, version := range []string{SNMPv2c, SNMPv1} {
+		t.Run("v"+version, func(t *testing.T) {
+			fake, b := newPDU(t, Settings{SNMPVersion: version},
+				SwitchConfig{Name: "Mount", Outlet: 1},
+				SwitchConfig{Name: "Dew heaters", Outlet: 3})
+			fake.Lock()
+			fake.Outlets[3] = true
+			fake.Unlock()
+			if err := b.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			for id, want := range []bool{false, true} {
+				if on, err := b.GetSwitch(id); err != nil || on != want {
+					t.Errorf("switch %d after Connect = %v, %v; want %v", id, on, err, want)
+				}
+			}
+
+			if err := b.SetSwitch(0, true); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.SetSwitch(1, false); err != nil {
+				t.Fatal(err)
+			}
+			fake.Lock()
+			outlets := []bool{fake.Outlets[1], fake.Outlets[3]}
+			fake.Unlock()
+			if !slices.Equal(outlets, []bool{true, false}) {
+				t.Errorf("outlets 1 and 3 = %v, want [true false]", outlets)
+			}
+			if on, _ := b.GetSwitch(0); !on {
+				t.Error("cached state after switching on is off")
+			}
+
+			fake.Lock()
+			fake.Outlets[1] = false
+			fake.Unlock()
+			if v, err := b.PollSwitchValue(0); err != nil || v != 0 {
+				t.Errorf("PollSwitchValue = %v, %v; want 0", v, err)
+			}
+		})
+	}
+}
+
+// A command for an outlet the PDU doesn't have is rejected, and the cached
+// state is left alone.
+func TestMissingOutlet(t *testing.T) {
+	_, b := newPDU(t, Settings{}, SwitchConfig{Name: "Nowhere", Outlet: 9})
+	if err := b.SetSwitch(0, true); !errors.Is(err, backend.ErrRejected) {
+		t.Errorf("SetSwitch on a missing outlet = %v, want ErrRejected", err)
+	}
+	if on, _ := b.GetSwitch(0); on {
+		t.Error("cached state changed by a rejected command")
+	}
+	if _, err := b.PollSwitchValue(0); !errors.Is(err, backend.ErrRejected) {
+		t.Errorf("PollSwitchValue on a missing outlet = %v, want ErrRejected", err)
+	}
+}
+
+// The agent ignores requests with the wrong community, so they time out.
+func TestWrongCommunity(t *testing.T) {
+	fake, b := newPDU(t, Settings{TimeoutSeconds: 1}, SwitchConfig{Name: "Mount", Outlet: 1, Community: "public"})
+	err := b.SetSwitch(0, true)
+	if err == nil || !strings.Contains(err.Error(), "no SNMP reply") {
+		t.Errorf("SetSwitch with the wrong community = %v, want a timeout", err)
+	}
+	fake.Lock()
+	defer fake.Unlock()
+	if fake.Outlets[1] || len(fake.Requests) != 0 {
+		t.Errorf("agent answered %v with the wrong community", fake.Requests)
+	}
+}
+
+func TestCustomOIDs(t *testing.T) {
+	fake, b := newPDU(t, Settings{}, SwitchConfig{Name: "Camera", Outlet: 2, Vendor: VendorCustom, OIDs: &OIDs{
+		State: ".1.3.6.1.4.1.318.1.1.12.3.5.1.1.4.{outlet}", StateOn: 1,
+		On: ".1.3.6.1.4.1.318.1.1.12.3.3.1.1.4.{outlet}", OnValue: 3,
+		Off: ".1.3.6.1.4.1.318.1.1.12.3.3.1.1.4.{outlet}", OffValue: 2,
+	}})
+	if err := b.SetSwitch(0, true); err != nil {
+		t.Fatal(err)
+	}
+	fake.Lock()
+	defer fake.Unlock()
+	want := []string{"set .1.3.6.1.4.1.318.1.1.12.3.3.1.1.4.2 = 3"}
+	if !slices.Equal(fake.Requests, want) || !fake.Outlets[2] {
+		t.Errorf("requests = %v, want %v switching outlet 2 on", fake.Requests, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		cfg SwitchConfig
+		ok  bool
+	}{
+		{SwitchConfig{Host: "pdu", Outlet: 1}, true},
+		{SwitchConfig{Host: "pdu", Outlet: 8, Vendor: VendorEaton}, true},
+		{SwitchConfig{Outlet: 1}, false},
+		{SwitchConfig{Host: "pdu"}, false},
+		{SwitchConfig{Host: "pdu", Outlet: 1, Vendor: "raritan"}, false},
+		{SwitchConfig{Host: "pdu", Outlet: 1, Vendor: VendorCustom}, false},
+		{SwitchConfig{Host: "pdu", Outlet: 1, Vendor: VendorCustom, OIDs: &OIDs{State: "x", On: "1.3", Off: "1.3"}}, false},
+	} {
+		if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("Validate(%+v) = %v, want ok %v", tc.cfg, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package pdu
+
+// snmp.go implements the small part of SNMP v1/v2c the backend needs: a Get
+// or Set of one INTEGER object per request, BER-encoded over UDP.
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// DefaultPort is the standard SNMP agent UDP port.
+const DefaultPort = 161
+
+// BER tags used in SNMP messages.
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagOID         = 0x06
+	tagSequence    = 0x30
+	tagCounter32   = 0x41
+	tagGauge32     = 0x42
+	tagTimeTicks   = 0x43
+	tagCounter64   = 0x46
+
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMibView   = 0x82
+
+	pduGet      = 0xa0
+	pduResponse = 0xa2
+	pduSet      = 0xa3
+)
+
+// SNMP versions as sent in the message header.
+const (
+	version1  = 0
+	version2c = 1
+)
+
+// errorStatus names the SNMP error-status values of a response.
+var errorStatus = map[int64]string{
+	1: "tooBig", 2: "noSuchName", 3: "badValue", 4: "readOnly", 5: "genErr",
+	6: "noAccess", 7: "wrongType", 8: "wrongLength", 9: "wrongEncoding",
+	10: "wrongValue", 11: "noCreation", 12: "inconsistentValue",
+	13: "resourceUnavailable", 14: "commitFailed", 15: "undoFailed",
+	16: "authorizationError", 17: "notWritable", 18: "inconsistentName",
+}
+
+// client sends SNMP requests to one agent.
+type client struct {
+	host      string // host[:port]
+	community string
+	version   int
+	timeout   time.Duration
+}
+
+// addr returns the agent address, adding DefaultPort if host has none.
+func (c client) addr() string {
+	if _, _, err := net.SplitHostPort(c.host); err == nil {
+		return c.host
+	}
+	return net.JoinHostPort(c.host, strconv.Itoa(DefaultPort))
+}
+
+// get reads the INTEGER object oid.
+func (c client) get(oid string) (int64, error) {
+	return c.request(pduGet, oid, nil)
+}
+
+// set writes value to the INTEGER object oid.
+func (c client) set(oid string, value int64) error {
+	_, err := c.request(pduSet, oid, &value)
+	return err
+}
+
+// request sends one Get (value nil) or Set PDU for oid and returns the
+// INTEGER value in the response. An agent given the wrong community does
+// not answer at all, so a timeout hints at it.
+func (c client) request(pdu byte, oid string, value *int64) (int64, error) {
+	encOID, err := encodeOID(oid)
+	if err != nil {
+		return 0, err
+	}
+	var idBytes [4]byte
+	rand.Read(idBytes[:])
+	reqID := int64(binary.BigEndian.Uint32(idBytes[:]) & 0x7fffffff)
+
+	val := tlv(tagNull, nil)
+	if value != nil {
+		val = tlv(tagInteger, encodeInt(*value))
+	}
+	varbind := tlv(tagSequence, append(tlv(tagOID, encOID), val...))
+	body := concat(
+		tlv(tagInteger, encodeInt(reqID)),
+		tlv(tagInteger, encodeInt(0)),
+		tlv(tagInteger, encodeInt(0)),
+		tlv(tagSequence, varbind),
+	)
+	msg := tlv(tagSequence, concat(
+		tlv(tagInteger, encodeInt(int64(c.version))),
+		tlv(tagOctetString, []byte(c.community)),
+		tlv(pdu, body),
+	))
+	if value != nil {
+		backend.Tracef("pdu SNMP set %s %s = %d", c.addr(), oid, *value)
+	} else {
+		backend.Tracef("pdu SNMP get %s %s", c.addr(), oid)
+	}
+
+	conn, err := net.DialTimeout("udp", c.addr(), c.timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.Write(msg); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return 0, fmt.Errorf("no SNMP reply from %s within %v (is the community right?): %w", c.addr(), c.timeout, err)
+			}
+			return 0, err
+		}
+		id, result, err := parseResponse(buf[:n], oid)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s: %v", backend.ErrMalformedResponse, c.addr(), err)
+		}
+		if id != reqID {
+			continue // a late reply to an earlier request
+		}
+		backend.Tracef("pdu SNMP %s %s response: %v", c.addr(), oid, result)
+		return result.value, result.err
+	}
+}
+
+// varResult is the outcome of a response: the INTEGER value, or the error
+// the agent reported.
+type varResult struct {
+	value int64
+	err   error
+}
+
+func (r varResult) String() string {
+	if r.err != nil {
+		return r.err.Error()
+	}
+	return strconv.FormatInt(r.value, 10)
+}
+
+// parseResponse decodes a Response PDU to a one-object request for oid,
+// returning its request ID and result.
+func parseResponse(msg []byte, oid string) (int64, varResult, error) {
+	tag, content, _, err := readTLV(msg)
+	if err != nil || tag != tagSequence {
+		return 0, varResult{}, errors.New("not an SNMP message")
+	}
+	fields, err := readAll(content)
+	if err != nil || len(fields) != 3 || fields[2].tag != pduResponse {
+		return 0, varResult{}, errors.New("not an SNMP response")
+	}
+	pdu, err := readAll(fields[2].content)
+	if err != nil || len(pdu) != 4 {
+		return 0, varResult{}, errors.New("malformed response PDU")
+	}
+	reqID := decodeInt(pdu[0].content)
+	status := decodeInt(pdu[1].content)
+	if status != 0 {
+		name := errorStatus[status]
+		if name == "" {
+			name = "error " + strconv.FormatInt(status, 10)
+		}
+		return reqID, varResult{err: fmt.Errorf("%w: agent answered %s for %s", backend.ErrRejected, name, oid)}, nil
+	}
+	binds, err := readAll(pdu[3].content)
+	if err != nil || len(binds) != 1 {
+		return 0, varResult{}, errors.New("expected one variable binding")
+	}
+	bind, err := readAll(binds[0].content)
+	if err != nil || len(bind) != 2 {
+		return 0, varResult{}, errors.New("malformed variable binding")
+	}
+	switch bind[1].tag {
+	case tagInteger:
+		return reqID, varResult{value: decodeInt(bind[1].content)}, nil
+	case tagCounter32, tagGauge32, tagTimeTicks, tagCounter64:
+		return reqID, varResult{value: int64(decodeUint(bind[1].content))}, nil
+	case tagNoSuchObject, tagNoSuchInstance, tagEndOfMibView:
+		return reqID, varResult{err: fmt.Errorf("%w: agent has no object %s (wrong outlet number or vendor?)", backend.ErrRejected, oid)}, nil
+	}
+	return reqID, varResult{err: fmt.Errorf("%w: %s is not an integer (BER tag 0x%02x)", backend.ErrMalformedResponse, oid, bind[1].tag)}, nil
+}
+
+type element struct {
+	tag     byte
+	content []byte
+}
+
+// readTLV splits the first BER element off buf.
+func readTLV(buf []byte) (tag byte, content, rest []byte, err error) {
+	if len(buf) < 2 {
+		return 0, nil, nil, errors.New("truncated element")
+	}
+	tag = buf[0]
+	length := int(buf[1])
+	pos := 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 3 || len(buf) < 2+n {
+			return 0, nil, nil, errors.New("unsupported length")
+		}
+		length = 0
+		for _, b := range buf[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		pos += n
+	}
+	if len(buf) < pos+length {
+		return 0, nil, nil, errors.New("truncated element")
+	}
+	return tag, buf[pos : pos+length], buf[pos+length:], nil
+}
+
+// readAll splits buf into its BER elements.
+func readAll(buf []byte) ([]element, error) {
+	var out []element
+	for len(buf) > 0 {
+		tag, content, rest, err := readTLV(buf)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, element{tag, content})
+		buf = rest
+	}
+	return out, nil
+}
+
+func tlv(tag byte, content []byte) []byte {
+	n := len(content)
+	var out []byte
+	switch {
+	case n < 0x80:
+		out = []byte{tag, byte(n)}
+	case n < 0x100:
+		out = []byte{tag, 0x81, byte(n)}
+	default:
+		out = []byte{tag, 0x82, byte(n >> 8), byte(n)}
+	}
+	return append(out, content...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// encodeInt returns the minimal two's-complement encoding of v.
+func encodeInt(v int64) []byte {
+	var out []byte
+	for {
+		out = append([]byte{byte(v)}, out...)
+		next := v >> 8
+		if (next == 0 && v&0x80 == 0) || (next == -1 && v&0x80 != 0) {
+			return out
+		}
+		v = next
+	}
+}
+
+func decodeInt(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+func decodeUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// encodeOID encodes a dotted OID such as ".1.3.6.1.2.1.1.3.0".
+func encodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	arcs := make([]uint64, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", oid)
+		}
+		arcs[i] = n
+	}
+	if arcs[0] > 2 || (arcs[0] < 2 && arcs[1] >= 40) {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	out := encodeArc(arcs[0]*40 + arcs[1])
+	for _, a := range arcs[2:] {
+		out = append(out, encodeArc(a)...)
+	}
+	return out, nil
+}
+
+// encodeArc encodes one OID arc in base 128, high bit set on all but the
+// last byte.
+func encodeArc(a uint64) []byte {
+	out := []byte{byte(a & 0x7f)}
+	for a >>= 7; a > 0; a >>= 7 {
+		out = append([]byte{byte(a&0x7f) | 0x80}, out...)
+	}
+	return out
+}
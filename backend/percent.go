@@ -0,0 +1,57 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+	"math"
+)
+
+// PresentPercent is the SwitchOptions.PresentAs mode that exposes a switch
+// as 0-100 whatever its native range.
+const PresentPercent = "percent"
+
+// percent reports whether switch ref is presented as a percentage. A switch
+// without a usable range is always presented natively.
+func (r *Router) percent(ref switchRef) bool {
+	return r.options(ref).PresentAs == PresentPercent &&
+		ref.backend.GetMax(ref.localID) > ref.backend.GetMin(ref.localID)
+}
+
+// percentStep is the presented step of a percent switch: one native step
+// in percent, but no finer than 1 so clients get whole percentages.
+func percentStep(ref switchRef) float64 {
+	min, max, step := ref.backend.GetMin(ref.localID), ref.backend.GetMax(ref.localID), ref.backend.GetStep(ref.localID)
+	return math.Max(100*step/(max-min), 1)
+}
+
+// toPercent converts a native value to its presented percentage, rounded
+// to the presented step.
+func toPercent(ref switchRef, value float64) float64 {
+	min, max := ref.backend.GetMin(ref.localID), ref.backend.GetMax(ref.localID)
+	step := percentStep(ref)
+	return math.Round((value-min)/(max-min)*100/step) * step
+}
+
+// fromPercent converts a presented percentage to the nearest valid native
+// value.
+func fromPercent(ref switchRef, pct float64) (float64, error) {
+	if pct < 0 || pct > 100 {
+		return 0, fmt.Errorf("%w: %v is outside 0-100 (present_as %q)", ErrInvalidValue, pct, PresentPercent)
+	}
+	min, max, step := ref.backend.GetMin(ref.localID), ref.backend.GetMax(ref.localID), ref.backend.GetStep(ref.localID)
+	value := min + pct/100*(max-min)
+	if step > 0 {
+		value = min + math.Round((value-min)/step)*step
+	}
+	return math.Min(value, max), nil
+}
+
+// checkPresentAs warns about unknown present_as modes, which are ignored.
+func (r *Router) checkPresentAs() {
+	for id, ref := range r.tbl().index {
+		if mode := r.options(ref).PresentAs; mode != "" && mode != PresentPercent {
+			log.Printf("Warning: switch %d (%s) has unknown present_as %q; presenting native values",
+				id, ref.backend.GetName(ref.localID), mode)
+		}
+	}
+}
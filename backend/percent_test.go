@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+)
+
+// present_as percent exposes a 0-255 device as 0-100 in whole percent.
+func TestPresentAsPercent(t *testing.T) {
+	fake := newFakeSwitches(0)
+	fake.max = 255
+	fake.opts[0].PresentAs = PresentPercent
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+
+	if min, max, step := r.GetMin(0), r.GetMax(0), r.GetStep(0); min != 0 || max != 100 || step != 1 {
+		t.Errorf("range = %v-%v step %v, want 0-100 step 1", min, max, step)
+	}
+	for _, tc := range []struct{ pct, native float64 }{{0, 0}, {50, 128}, {100, 255}, {20, 51}} {
+		if err := r.SetSwitchValue(0, tc.pct); err != nil {
+			t.Fatalf("SetSwitchValue(%v%%): %v", tc.pct, err)
+		}
+		if v := fake.value(0); v != tc.native {
+			t.Errorf("SetSwitchValue(%v%%) wrote %v, want %v", tc.pct, v, tc.native)
+		}
+		if v, err := r.GetSwitchValue(0); err != nil || v != tc.pct {
+			t.Errorf("GetSwitchValue after writing %v%% = %v, %v", tc.pct, v, err)
+		}
+	}
+	if err := r.SetSwitchValue(0, 101); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("SetSwitchValue(101%%) = %v, want ErrInvalidValue", err)
+	}
+}
+
+// A coarse native step is presented as its size in percent.
+func TestPresentAsPercentCoarseStep(t *testing.T) {
+	fake := newFakeSwitches(0)
+	fake.max = 4
+	fake.opts[0].PresentAs = PresentPercent
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+
+	if step := r.GetStep(0); step != 25 {
+		t.Errorf("step = %v for a 0-4 device, want 25", step)
+	}
+	if err := r.SetSwitchValue(0, 60); err != nil {
+		t.Fatal(err)
+	}
+	if v := fake.value(0); v != 2 {
+		t.Errorf("60%% wrote native %v, want the nearest step 2", v)
+	}
+	if v, _ := r.GetSwitchValue(0); v != 50 {
+		t.Errorf("GetSwitchValue = %v, want 50", v)
+	}
+}
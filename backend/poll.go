@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"log"
+	"time"
+)
+
+// StartPolling launches the refresh scheduler. Every switch whose backend
+// implements Poller and reports a non-zero PollInterval is refreshed on its
+// own ticker; switches with a zero interval are never auto-polled. Polls are
+// skipped while the owning backend is disconnected.
+//
+// Switches with the Debounce option only commit a changed value once it has
+// been read on two consecutive polls.
+func (r *Router) StartPolling() {
+	r.pollMu.Lock()
+	defer r.pollMu.Unlock()
+	if r.pollStop != nil {
+		return
+	}
+	r.pollStop = make(chan struct{})
+	for globalID, ref := range r.tbl().index {
+		p, ok := ref.backend.(Poller)
+		if !ok {
+			continue
+		}
+		interval := p.PollInterval(ref.localID)
+		if interval <= 0 {
+			continue
+		}
+		log.Printf("[poll] switch %d (%s) every %v", globalID, ref.backend.GetName(ref.localID), interval)
+		go r.pollLoop(r.pollStop, globalID, ref, p, interval, r.options(ref).Debounce)
+	}
+}
+
+// StopPolling stops all refresh loops started by StartPolling.
+func (r *Router) StopPolling() {
+	r.pollMu.Lock()
+	defer r.pollMu.Unlock()
+	if r.pollStop == nil {
+		return
+	}
+	close(r.pollStop)
+	r.pollStop = nil
+}
+
+func (r *Router) pollLoop(stop <-chan struct{}, globalID int, ref switchRef, p Poller, interval time.Duration, debounce bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var pending *float64 // debounce: changed value awaiting confirmation
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if !ref.backend.IsConnected() {
+			continue
+		}
+		if r.breakerOpen(globalID) {
+			continue
+		}
+		value, err := p.PollSwitchValue(ref.localID)
+		r.recordResult(globalID, err)
+		if err != nil {
+			log.Printf("[poll] switch %d refresh failed: %v", globalID, err)
+			continue
+		}
+		r.commitPolled(globalID, ref, p, r.clamp(globalID, ref, value), debounce, &pending)
+	}
+}
+
+// commitPolled is the scheduler's update step: it stores a polled value in
+// the backend cache and emits a change event, subject to debouncing. A value
+// within the switch's deadband of the cached one counts as unchanged.
+func (r *Router) commitPolled(globalID int, ref switchRef, p Poller, value float64, debounce bool, pending **float64) {
+	old, err := ref.backend.GetSwitchValue(ref.localID)
+	if err == nil && (old == value || r.inDeadband(ref, old, value)) {
+		*pending = nil
+		return
+	}
+	if debounce && (*pending == nil || **pending != value) {
+		*pending = &value
+		return
+	}
+	*pending = nil
+	p.SetCachedValue(ref.localID, value)
+	r.notifyChange(globalID, old, value)
+}
@@ -0,0 +1,122 @@
+package backend
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPollIntervalOverride(t *testing.T) {
+	zero, five := 0, 5
+	for _, tc := range []struct {
+		opts        SwitchOptions
+		defaultSecs int
+		want        time.Duration
+	}{
+		{SwitchOptions{}, 10, 10 * time.Second},
+		{SwitchOptions{}, 0, 0},
+		{SwitchOptions{PollSeconds: &five}, 10, 5 * time.Second},
+		{SwitchOptions{PollSeconds: &five}, 0, 5 * time.Second},
+		{SwitchOptions{PollSeconds: &zero}, 10, 0},
+	} {
+		if got := tc.opts.PollInterval(tc.defaultSecs); got != tc.want {
+			t.Errorf("PollInterval(%d) with poll_seconds %v = %v, want %v", tc.defaultSecs, tc.opts.PollSeconds, got, tc.want)
+		}
+	}
+}
+
+// Each switch is polled at its own interval; a zero interval is never polled.
+func TestPollingSchedule(t *testing.T) {
+	fake := newFakeSwitches(0, 0, 0)
+	fake.interval = []time.Duration{20 * time.Millisecond, 100 * time.Millisecond, 0}
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+	r.StartPolling()
+	time.Sleep(330 * time.Millisecond)
+	r.StopPolling()
+
+	fast, slow, never := fake.pollCount(0), fake.pollCount(1), fake.pollCount(2)
+	if fast < 10 || fast > 17 {
+		t.Errorf("20ms switch polled %d times in 330ms, want about 16", fast)
+	}
+	if slow < 2 || slow > 3 {
+		t.Errorf("100ms switch polled %d times in 330ms, want 3", slow)
+	}
+	if never != 0 {
+		t.Errorf("zero-interval switch polled %d times", never)
+	}
+}
+
+// A polled change is committed to the cache; a disconnected backend is not
+// polled.
+func TestPollingCommitsChanges(t *testing.T) {
+	fake := newFakeSwitches(0)
+	fake.live = []float64{1}
+	fake.interval = []time.Duration{10 * time.Millisecond}
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+	r.StartPolling()
+	defer r.StopPolling()
+
+	time.Sleep(50 * time.Millisecond)
+	if v := fake.value(0); v != 1 {
+		t.Errorf("cached value = %v after polling, want 1", v)
+	}
+
+	fake.Disconnect()
+	time.Sleep(20 * time.Millisecond)
+	before := fake.pollCount(0)
+	time.Sleep(50 * time.Millisecond)
+	if n := fake.pollCount(0) - before; n != 0 {
+		t.Errorf("disconnected switch polled %d times", n)
+	}
+}
+
+// With debounce, a polled change is only committed once it has been read
+// twice in a row, so a single-poll flap never reaches the cache.
+func TestDebounce(t *testing.T) {
+	for _, debounce := range []bool{false, true} {
+		fake := newFakeSwitches(0)
+		r := NewRouter([]SwitchBackend{fake}, Options{})
+		var changes []float64
+		r.OnChange(func(id int, old, new float64) { changes = append(changes, new) })
+		ref, _ := r.ref(0)
+
+		var pending *float64
+		for _, v := range []float64{1, 0, 1, 0, 1, 1, 1, 0, 0} {
+			r.commitPolled(0, ref, fake, v, debounce, &pending)
+		}
+		want := []float64{1, 0, 1, 0, 1, 0}
+		if debounce {
+			want = []float64{1, 0}
+		}
+		if !slices.Equal(changes, want) {
+			t.Errorf("debounce %v: committed %v, want %v", debounce, changes, want)
+		}
+	}
+}
+
+// A change found by the scheduler reaches the change hooks like any other
+// change, once.
+func TestPollingEmitsChanges(t *testing.T) {
+	fake := newFakeSwitches(0, 0)
+	fake.live = []float64{1, 0}
+	fake.interval = []time.Duration{10 * time.Millisecond, 10 * time.Millisecond}
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+	var mu sync.Mutex
+	var changes []string
+	r.OnChange(func(id int, old, value float64) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, fmt.Sprintf("%d: %v->%v", id, old, value))
+	})
+	r.StartPolling()
+	time.Sleep(60 * time.Millisecond)
+	r.StopPolling()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(changes) != 1 || changes[0] != "0: 0->1" {
+		t.Errorf("changes = %q, want switch 0 turning on once", changes)
+	}
+}
@@ -0,0 +1,46 @@
+package backend
+
+import (
+	"log"
+	"time"
+)
+
+// Write modes selectable with a backend's write_mode setting.
+const (
+	// WriteStrict sends every write to the hardware (the default).
+	WriteStrict = "strict"
+	// WriteOptimize skips writes that would not change the switch's value.
+	WriteOptimize = "optimize"
+)
+
+// WriteOptimizing is implemented by backends that can be configured to skip
+// writes that would not change a switch's value, for hardware that
+// misbehaves when told to turn on while already on.
+type WriteOptimizing interface {
+	// OptimizesWrites reports whether redundant writes are skipped, and how
+	// recently the value must have been confirmed by hardware for a write to
+	// count as redundant (zero: any confirmed value).
+	OptimizesWrites() (bool, time.Duration)
+}
+
+// redundantWrite reports whether writing value to switch id can be skipped:
+// its backend optimizes writes and the current value, confirmed by hardware
+// recently enough, already equals value. A value only restored from config
+// is never trusted.
+func (r *Router) redundantWrite(id int, ref switchRef, current, value float64) bool {
+	w, ok := ref.backend.(WriteOptimizing)
+	if !ok {
+		return false
+	}
+	optimize, maxAge := w.OptimizesWrites()
+	if !optimize || current != value {
+		return false
+	}
+	updated := r.LastUpdated(id)
+	if updated.IsZero() || (maxAge > 0 && time.Since(updated) > maxAge) {
+		return false
+	}
+	log.Printf("Switch %d (%s) is already %v; skipping write (write_mode is %q)",
+		id, ref.backend.GetName(ref.localID), value, WriteOptimize)
+	return true
+}
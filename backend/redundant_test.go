@@ -0,0 +1,51 @@
+package backend
+
+import "testing"
+
+// settingsFake is a fake backend with the given common settings.
+type settingsFake struct {
+	*fakeSwitches
+	CommonSettings
+}
+
+func TestRedundantWrites(t *testing.T) {
+	for _, tc := range []struct {
+		mode       string
+		wantWrites int
+	}{
+		{WriteOptimize, 1},
+		{WriteStrict, 2},
+		{"", 2},
+	} {
+		fake := newFakeSwitches(1)
+		r := NewRouter([]SwitchBackend{settingsFake{fake, CommonSettings{WriteMode: tc.mode}}}, Options{})
+		// The first write confirms the value; the second repeats it.
+		for i := 0; i < 2; i++ {
+			if err := r.SetSwitch(0, true); err != nil {
+				t.Fatalf("write_mode %q: SetSwitch: %v", tc.mode, err)
+			}
+		}
+		if fake.writes != tc.wantWrites {
+			t.Errorf("write_mode %q: %d writes turning on a switch twice, want %d", tc.mode, fake.writes, tc.wantWrites)
+		}
+	}
+}
+
+// A write that changes the value, or one whose current value was never
+// confirmed by hardware, is sent even when optimizing.
+func TestOptimizeSendsNeededWrites(t *testing.T) {
+	fake := newFakeSwitches(1)
+	r := NewRouter([]SwitchBackend{settingsFake{fake, CommonSettings{WriteMode: WriteOptimize}}}, Options{})
+	if err := r.SetSwitch(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if fake.writes != 1 {
+		t.Errorf("%d writes with an unconfirmed value, want 1", fake.writes)
+	}
+	if err := r.SetSwitch(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if fake.writes != 2 || fake.value(0) != 0 {
+		t.Errorf("%d writes, value %v after turning off; want 2 writes, 0", fake.writes, fake.value(0))
+	}
+}
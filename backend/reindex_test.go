@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// hubSwitches is a fake hub whose switches come and go at runtime,
+// notifying the Router through CountNotifier.
+type hubSwitches struct {
+	*namedSwitches
+	notify func()
+}
+
+func (h *hubSwitches) OnSwitchCountChange(fn func()) { h.notify = fn }
+
+func (h *hubSwitches) NumSwitches() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.names)
+}
+
+func (h *hubSwitches) GetName(id int) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.names[id]
+}
+
+// PollSwitchValue fails for a switch already gone, as a poll may still
+// be running between its removal and the re-index.
+func (h *hubSwitches) PollSwitchValue(id int) (float64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if id >= len(h.values) {
+		return 0, fmt.Errorf("invalid switch id %d", id)
+	}
+	h.polls[id]++
+	return h.values[id], nil
+}
+
+// add gives the hub a new switch polled every interval, and notifies.
+func (h *hubSwitches) add(name string, interval time.Duration) {
+	h.mu.Lock()
+	h.names = append(h.names, name)
+	h.values = append(h.values, 0)
+	h.opts = append(h.opts, SwitchOptions{})
+	h.polls = append(h.polls, 0)
+	h.interval = append(h.interval, interval)
+	h.mu.Unlock()
+	h.notify()
+}
+
+// removeLast drops the hub's last switch, and notifies.
+func (h *hubSwitches) removeLast() {
+	h.mu.Lock()
+	n := len(h.names) - 1
+	h.names, h.values, h.opts, h.polls, h.interval = h.names[:n], h.values[:n], h.opts[:n], h.polls[:n], h.interval[:n]
+	h.mu.Unlock()
+	h.notify()
+}
+
+func newHub(names ...string) *hubSwitches {
+	h := &hubSwitches{namedSwitches: newNamedSwitches("hub", names...)}
+	h.interval = make([]time.Duration, len(names))
+	return h
+}
+
+// A backend that gains or loses switches is re-indexed: NumSwitches and
+// the IDs follow, per-switch state moves with each switch, and polling
+// covers the new set.
+func TestReindex(t *testing.T) {
+	hub := newHub("relay 1")
+	plug := newNamedSwitches("plug", "mount")
+	r := NewRouter([]SwitchBackend{hub, plug}, Options{})
+	r.StartPolling()
+	defer r.StopPolling()
+
+	if err := r.SetSwitch(1, true); err != nil {
+		t.Fatal(err)
+	}
+
+	hub.add("relay 2", 10*time.Millisecond)
+	if got, want := switchNames(r), []string{"relay 1", "relay 2", "mount"}; !slices.Equal(got, want) {
+		t.Fatalf("switches after the hub gained one = %q, want %q", got, want)
+	}
+	if r.LastContact(2).IsZero() || !r.LastContact(1).IsZero() {
+		t.Errorf("last contact did not follow the mount to ID 2 (relay 2 %v, mount %v)", r.LastContact(1), r.LastContact(2))
+	}
+	if on, err := r.GetSwitch(2); err != nil || !on {
+		t.Errorf("GetSwitch(mount at ID 2) = %v, %v; want on", on, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if hub.pollCount(1) == 0 {
+		t.Error("the new switch was not polled after the re-index")
+	}
+
+	hub.removeLast()
+	if got, want := switchNames(r), []string{"relay 1", "mount"}; !slices.Equal(got, want) {
+		t.Errorf("switches after the hub lost one = %q, want %q", got, want)
+	}
+	if _, err := r.GetSwitch(2); err == nil {
+		t.Error("GetSwitch(2) succeeded after the switch count dropped to 2")
+	}
+}
+
+// With an ID map, known switches keep their IDs across a re-index and a
+// new switch takes the next free one.
+func TestReindexStableIDs(t *testing.T) {
+	hub := newHub("relay 1")
+	r := NewRouter([]SwitchBackend{hub, newNamedSwitches("plug", "mount")},
+		Options{IDMapFile: filepath.Join(t.TempDir(), "ids.json")})
+	hub.add("relay 2", 0)
+	if got, want := switchNames(r), []string{"relay 1", "mount", "relay 2"}; !slices.Equal(got, want) {
+		t.Errorf("switches after the hub gained one = %q, want %q", got, want)
+	}
+}
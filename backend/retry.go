@@ -0,0 +1,120 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync/atomic"
+	"syscall"
+)
+
+// RetryPolicy decides which errors from devices are transient and worth
+// retrying, and which are permanent and should fail fast. Transient:
+// connection refused or reset, unreachable hosts, timeouts, HTTP 5xx, 408
+// and 429. Permanent: other HTTP 4xx (including authentication failures),
+// malformed or rejected replies and invalid requests.
+type RetryPolicy struct {
+	// RetryStatus lists extra HTTP status codes to treat as transient.
+	RetryStatus []int `json:"retry_status,omitempty"`
+	// PermanentStatus lists HTTP status codes to treat as permanent, e.g.
+	// 503 for a device that answers it while switched off.
+	PermanentStatus []int `json:"permanent_status,omitempty"`
+	// RetryUnknown treats errors the policy cannot classify as transient.
+	// By default they are permanent.
+	RetryUnknown bool `json:"retry_unknown,omitempty"`
+}
+
+// HTTPStatuser is implemented by errors that carry an HTTP status code.
+type HTTPStatuser interface {
+	HTTPStatus() int
+}
+
+// StatusError is an HTTP reply with an unsuccessful status code.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string   { return e.Err.Error() }
+func (e *StatusError) Unwrap() error   { return e.Err }
+func (e *StatusError) HTTPStatus() int { return e.Code }
+
+// retryPolicy is the policy used by Retryable, set from the config.
+var retryPolicy atomic.Pointer[RetryPolicy]
+
+// SetRetryPolicy replaces the policy used by Retryable.
+func SetRetryPolicy(p RetryPolicy) { retryPolicy.Store(&p) }
+
+// Retryable reports whether err is transient under the configured policy.
+func Retryable(err error) bool {
+	p := retryPolicy.Load()
+	if p == nil {
+		p = &RetryPolicy{}
+	}
+	return p.Retryable(err)
+}
+
+// Retryable reports whether err is transient under p.
+func (p RetryPolicy) Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, permanent := range []error{
+		ErrInvalidValue, ErrInvalidOperation, ErrNotConnected, ErrActionNotImplemented,
+		ErrMalformedResponse, ErrRejected, context.Canceled,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+
+	var status HTTPStatuser
+	if errors.As(err, &status) {
+		code := status.HTTPStatus()
+		switch {
+		case slices.Contains(p.PermanentStatus, code):
+			return false
+		case slices.Contains(p.RetryStatus, code):
+			return true
+		}
+		return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	for _, transient := range []error{
+		syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EPIPE,
+		syscall.EHOSTUNREACH, syscall.ENETUNREACH, io.EOF, io.ErrUnexpectedEOF,
+	} {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	var jsonSyntax *json.SyntaxError
+	var jsonType *json.UnmarshalTypeError
+	var xmlSyntax *xml.SyntaxError
+	if errors.As(err, &jsonSyntax) || errors.As(err, &jsonType) || errors.As(err, &xmlSyntax) {
+		return false
+	}
+	return p.RetryUnknown
+}
@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func statusErr(code int) error {
+	return &StatusError{Code: code, Err: fmt.Errorf("HTTP %d", code)}
+}
+
+func TestRetryable(t *testing.T) {
+	syntaxErr := json.Unmarshal([]byte("{x"), &struct{}{})
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), true},
+		{"i/o timeout", os.ErrDeadlineExceeded, true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"HTTP 500", statusErr(http.StatusInternalServerError), true},
+		{"HTTP 503", statusErr(http.StatusServiceUnavailable), true},
+		{"HTTP 429", statusErr(http.StatusTooManyRequests), true},
+		{"HTTP 401", statusErr(http.StatusUnauthorized), false},
+		{"HTTP 404", statusErr(http.StatusNotFound), false},
+		{"malformed", fmt.Errorf("decode: %w", ErrMalformedResponse), false},
+		{"JSON syntax", syntaxErr, false},
+		{"rejected", fmt.Errorf("%w: bad state", ErrRejected), false},
+		{"invalid value", fmt.Errorf("%w: 7", ErrInvalidValue), false},
+		{"canceled", context.Canceled, false},
+		{"unknown", errors.New("something odd"), false},
+	} {
+		if got := (RetryPolicy{}).Retryable(tc.err); got != tc.want {
+			t.Errorf("%s: Retryable(%v) = %v, want %v", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRetryPolicyOverrides(t *testing.T) {
+	p := RetryPolicy{PermanentStatus: []int{503}, RetryStatus: []int{409}, RetryUnknown: true}
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{statusErr(503), false},
+		{statusErr(409), true},
+		{statusErr(500), true},
+		{errors.New("something odd"), true},
+	} {
+		if got := p.Retryable(tc.err); got != tc.want {
+			t.Errorf("Retryable(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+
+	defer SetRetryPolicy(RetryPolicy{})
+	SetRetryPolicy(p)
+	if !Retryable(errors.New("something odd")) {
+		t.Error("Retryable ignores the policy set with SetRetryPolicy")
+	}
+}
@@ -0,0 +1,38 @@
+package backend
+
+import "time"
+
+// CommonSettings holds the options every backend accepts in its
+// *_settings block. Each backend's Settings embeds it, so the keys sit
+// alongside the backend's own ones in the config file.
+type CommonSettings struct {
+	// ClampValues pins values read from hardware to each switch's
+	// [Min, Max] range, logging readings that fall outside it.
+	ClampValues bool `json:"clamp_values"`
+
+	// WriteMode is WriteStrict (default) to send every write, or
+	// WriteOptimize to skip writes that would not change the value.
+	WriteMode string `json:"write_mode"`
+
+	// WriteMaxAgeSeconds, with WriteOptimize, only skips a write if the
+	// value was confirmed by hardware within this many seconds. Zero trusts
+	// any confirmed value.
+	WriteMaxAgeSeconds int `json:"write_max_age_seconds"`
+
+	// NamePrefix is put in front of every switch name shown to clients,
+	// e.g. "[Cam] ", except for switches renamed through SetName.
+	NamePrefix string `json:"name_prefix"`
+
+	// DescriptionTemplate builds descriptions for switches without an
+	// explicit description, e.g. "{name} on {host}".
+	DescriptionTemplate string `json:"description_template"`
+}
+
+// ClampsValues reports whether clamp_values is set.
+func (c CommonSettings) ClampsValues() bool { return c.ClampValues }
+
+// OptimizesWrites reports whether write_mode is optimize, and the
+// write_max_age_seconds freshness limit.
+func (c CommonSettings) OptimizesWrites() (bool, time.Duration) {
+	return c.WriteMode == WriteOptimize, time.Duration(c.WriteMaxAgeSeconds) * time.Second
+}
@@ -0,0 +1,26 @@
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// The shared settings are read from the same level as a backend's own keys.
+func TestCommonSettingsFlatKeys(t *testing.T) {
+	var s struct {
+		PollSeconds int `json:"poll_seconds"`
+		CommonSettings
+	}
+	doc := `{"poll_seconds": 5, "clamp_values": true, "write_mode": "optimize",
+		"write_max_age_seconds": 30, "name_prefix": "[Cam] ", "description_template": "{name}"}`
+	if err := json.Unmarshal([]byte(doc), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.PollSeconds != 5 || !s.ClampsValues() || s.NamePrefix != "[Cam] " || s.DescriptionTemplate != "{name}" {
+		t.Errorf("decoded %+v", s)
+	}
+	if optimize, maxAge := s.OptimizesWrites(); !optimize || maxAge != 30*time.Second {
+		t.Errorf("OptimizesWrites = %v, %v; want true, 30s", optimize, maxAge)
+	}
+}
@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"log"
+	"time"
+)
+
+// settle is the settle window of one switch after a write
+// (SwitchOptions.SettleMs): the relay has been told to move but has not
+// physically finished.
+type settle struct {
+	from, to float64 // native values the switch is moving between
+	until    time.Time
+}
+
+// settleTime returns the settle time of switch ref, or 0 if it has none.
+func (r *Router) settleTime(ref switchRef) time.Duration {
+	return time.Duration(r.options(ref).SettleMs) * time.Millisecond
+}
+
+// settleWrite holds the caller of a write that moved switch ref from old to
+// value for its settle time, so the write only reports success once the
+// device has actually switched. Reads meanwhile report the switch as still
+// in transition (see settlingFrom).
+func (r *Router) settleWrite(id int, ref switchRef, old, value float64) {
+	d := r.settleTime(ref)
+	if d <= 0 {
+		return
+	}
+	s := &settle{from: old, to: value, until: time.Now().Add(d)}
+	r.settleMu.Lock()
+	if r.settling == nil {
+		r.settling = make(map[switchRef]*settle)
+	}
+	r.settling[ref] = s
+	r.settleMu.Unlock()
+	Tracef("switch %d (%s) settling for %v", id, r.GetName(id), d)
+
+	time.Sleep(d)
+
+	r.settleMu.Lock()
+	if r.settling[ref] == s {
+		delete(r.settling, ref)
+	}
+	r.settleMu.Unlock()
+}
+
+// settlingFrom returns the value switch ref is moving away from while it is
+// in its settle window, and whether it is.
+func (r *Router) settlingFrom(ref switchRef) (float64, bool) {
+	r.settleMu.Lock()
+	defer r.settleMu.Unlock()
+	s := r.settling[ref]
+	if s == nil || !time.Now().Before(s.until) {
+		return 0, false
+	}
+	return s.from, true
+}
+
+// Settling reports whether switch id is busy: written, but still inside its
+// settle_ms window.
+func (r *Router) Settling(id int) bool {
+	ref, ok := r.ref(id)
+	if !ok {
+		return false
+	}
+	_, busy := r.settlingFrom(ref)
+	return busy
+}
+
+// checkSettleTimes warns about negative settle_ms values, which are ignored.
+func (r *Router) checkSettleTimes() {
+	for id, ref := range r.tbl().index {
+		if ms := r.options(ref).SettleMs; ms < 0 {
+			log.Printf("Warning: switch %d (%s): settle_ms %d is negative; ignoring it", id, r.GetName(id), ms)
+		}
+	}
+}
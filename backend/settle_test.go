@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+// A write returns only after settle_ms, and until then reads report the
+// state being left while Settling reports the switch busy.
+func TestSettleWindow(t *testing.T) {
+	fake := newFakeSwitches(0, 0)
+	fake.opts[0].SettleMs = 300
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- r.SetSwitch(0, true) }()
+	time.Sleep(100 * time.Millisecond)
+
+	if !r.Settling(0) {
+		t.Error("Settling = false inside the settle window")
+	}
+	if on, err := r.GetSwitch(0); err != nil || on {
+		t.Errorf("GetSwitch while settling = %v, %v; want the old state (off)", on, err)
+	}
+	if v, err := r.GetSwitchValue(0); err != nil || v != 0 {
+		t.Errorf("GetSwitchValue while settling = %v, %v; want 0", v, err)
+	}
+	if fake.value(0) != 1 {
+		t.Error("device not written before the settle window")
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("SetSwitch returned after %v, before the 300ms settle time", elapsed)
+	}
+	if r.Settling(0) {
+		t.Error("Settling = true after the write returned")
+	}
+	if on, err := r.GetSwitch(0); err != nil || !on {
+		t.Errorf("GetSwitch after settling = %v, %v; want on", on, err)
+	}
+
+	// A switch without settle_ms returns at once.
+	start = time.Now()
+	if err := r.SetSwitch(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond || r.Settling(1) {
+		t.Errorf("write without settle_ms took %v (settling %v)", elapsed, r.Settling(1))
+	}
+}
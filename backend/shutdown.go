@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// SwitchOffForShutdown turns off every switch configured with
+// off_on_shutdown, in parallel, and waits until they have all answered or
+// ctx expires. Failures are logged; the caller proceeds with shutdown either
+// way.
+func (r *Router) SwitchOffForShutdown(ctx context.Context) {
+	var wg sync.WaitGroup
+	for id, ref := range r.tbl().index {
+		if !r.options(ref).OffOnShutdown || !ref.backend.GetCanWrite(ref.localID) {
+			continue
+		}
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			name := r.GetName(id)
+			if err := r.SetSwitch(id, false); err != nil {
+				log.Printf("[shutdown] switch %d (%s): turning off failed: %v", id, name, err)
+				return
+			}
+			log.Printf("[shutdown] switch %d (%s) turned off", id, name)
+		}(id)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Print("[shutdown] timed out waiting for switches to turn off")
+	}
+}
@@ -0,0 +1,163 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// stableIndex reorders refs so each switch keeps the global ID recorded for
+// it in Options.IDMapFile. Switches are identified by "<type>:<name>".
+// Unknown switches take the lowest free IDs; IDs whose switch has left the
+// config and that no new switch fills are kept as unassigned placeholders,
+// so the IDs above them do not shift. The updated map is saved back.
+func (r *Router) stableIndex(refs []switchRef) []switchRef {
+	saved := make(map[string]int)
+	if data, err := os.ReadFile(r.opts.IDMapFile); err == nil {
+		if err := json.Unmarshal(data, &saved); err != nil {
+			log.Printf("Warning: ignoring %s: %v", r.opts.IDMapFile, err)
+			saved = make(map[string]int)
+		}
+	} else if !os.IsNotExist(err) {
+		log.Printf("Warning: reading %s: %v", r.opts.IDMapFile, err)
+	}
+
+	keys := switchKeys(refs)
+	byID := make(map[int]int) // global ID -> position in refs
+	var unplaced []int
+	for i, key := range keys {
+		id, ok := saved[key]
+		if _, taken := byID[id]; ok && id >= 0 && !taken {
+			byID[id] = i
+		} else {
+			unplaced = append(unplaced, i)
+		}
+	}
+
+	// Fill free IDs from the bottom up, preferring slots no saved switch
+	// claims so a removed device that comes back can reclaim its ID.
+	claimed := make(map[int]bool)
+	for _, id := range saved {
+		claimed[id] = true
+	}
+	size := len(refs)
+	for id := range byID {
+		if id+1 > size {
+			size = id + 1
+		}
+	}
+	var free, reclaimable []int
+	for id := 0; id < size; id++ {
+		if _, used := byID[id]; used {
+			continue
+		}
+		if claimed[id] {
+			reclaimable = append(reclaimable, id)
+		} else {
+			free = append(free, id)
+		}
+	}
+	free = append(free, reclaimable...)
+	for _, i := range unplaced {
+		if len(free) > 0 {
+			byID[free[0]] = i
+			free = free[1:]
+		} else {
+			byID[size] = i
+			size++
+		}
+	}
+
+	index := make([]switchRef, size)
+	idMap := make(map[string]int)
+	for key, id := range saved {
+		if _, used := byID[id]; !used && id < size {
+			idMap[key] = id // placeholder: remember for the device's return
+		}
+	}
+	for id := 0; id < size; id++ {
+		if i, ok := byID[id]; ok {
+			index[id] = refs[i]
+			idMap[keys[i]] = id
+		} else {
+			index[id] = switchRef{backend: unassigned{}, localID: id}
+			log.Printf("Switch %d is unassigned (its device was removed from the config)", id)
+		}
+	}
+	r.idMapMu.Lock()
+	r.idMap = idMap
+	r.idMapMu.Unlock()
+	r.saveIDMap()
+	return index
+}
+
+// switchKeys returns the stable identity of each switch, disambiguating
+// duplicate names within a backend with a "#n" suffix.
+func switchKeys(refs []switchRef) []string {
+	keys := make([]string, len(refs))
+	count := make(map[string]int)
+	for i, ref := range refs {
+		key := typeName(ref.backend) + ":" + ref.backend.GetName(ref.localID)
+		count[key]++
+		if n := count[key]; n > 1 {
+			key = fmt.Sprintf("%s#%d", key, n)
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+// renameStableID re-keys switch id after a rename so it keeps its ID.
+func (r *Router) renameStableID(id int) {
+	if r.opts.IDMapFile == "" {
+		return
+	}
+	keys := switchKeys(r.tbl().index)
+	r.idMapMu.Lock()
+	for key, mapped := range r.idMap {
+		if mapped == id {
+			delete(r.idMap, key)
+		}
+	}
+	r.idMap[keys[id]] = id
+	r.idMapMu.Unlock()
+	r.saveIDMap()
+}
+
+// saveIDMap writes the key→ID map to Options.IDMapFile.
+func (r *Router) saveIDMap() {
+	r.idMapMu.Lock()
+	defer r.idMapMu.Unlock()
+	data, err := json.MarshalIndent(r.idMap, "", "    ")
+	if err != nil {
+		log.Printf("Warning: encoding switch ID map: %v", err)
+		return
+	}
+	if err := os.WriteFile(r.opts.IDMapFile, append(data, '\n'), 0644); err != nil {
+		log.Printf("Warning: saving %s: %v", r.opts.IDMapFile, err)
+	}
+}
+
+// unassigned stands in for a switch ID whose device is no longer configured.
+// It is read-only, always off and rejects writes.
+type unassigned struct{}
+
+func (unassigned) NumSwitches() int                    { return 0 }
+func (unassigned) GetName(int) string                  { return "(unassigned)" }
+func (unassigned) SetName(int, string) error           { return errUnassigned }
+func (unassigned) GetDescription(int) string           { return "No device is configured for this switch ID" }
+func (unassigned) GetCanWrite(int) bool                { return false }
+func (unassigned) GetMin(int) float64                  { return 0 }
+func (unassigned) GetMax(int) float64                  { return 1 }
+func (unassigned) GetStep(int) float64                 { return 1 }
+func (unassigned) GetSwitch(int) (bool, error)         { return false, nil }
+func (unassigned) GetSwitchValue(int) (float64, error) { return 0, nil }
+func (unassigned) SetSwitch(int, bool) error           { return errUnassigned }
+func (unassigned) SetSwitchValue(int, float64) error   { return errUnassigned }
+func (unassigned) Connect() error                      { return nil }
+func (unassigned) Disconnect()                         {}
+func (unassigned) IsConnected() bool                   { return true }
+func (unassigned) BackendType() string                 { return "unassigned" }
+
+var errUnassigned = fmt.Errorf("%w: no device is configured for this switch ID", ErrInvalidOperation)
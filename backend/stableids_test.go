@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// namedSwitches is a fake backend whose switches are told apart by name,
+// as the ID map does.
+type namedSwitches struct {
+	*fakeSwitches
+	kind  string
+	names []string
+}
+
+func newNamedSwitches(kind string, names ...string) *namedSwitches {
+	return &namedSwitches{fakeSwitches: newFakeSwitches(make([]float64, len(names))...), kind: kind, names: names}
+}
+
+func (n *namedSwitches) BackendType() string   { return n.kind }
+func (n *namedSwitches) GetName(id int) string { return n.names[id] }
+func (n *namedSwitches) SetName(id int, name string) error {
+	n.names[id] = name
+	return nil
+}
+
+// switchNames lists the switch names of r by global ID.
+func switchNames(r *Router) []string {
+	out := make([]string, r.NumSwitches())
+	for id := range out {
+		out[id] = r.GetName(id)
+	}
+	return out
+}
+
+func TestStableIDs(t *testing.T) {
+	opts := Options{IDMapFile: filepath.Join(t.TempDir(), "ids.json")}
+	check := func(step string, r *Router, want ...string) {
+		t.Helper()
+		got := switchNames(r)
+		if len(got) != len(want) {
+			t.Fatalf("%s: switches %q, want %q", step, got, want)
+		}
+		for id := range want {
+			if got[id] != want[id] {
+				t.Errorf("%s: switch %d is %q, want %q (all: %q)", step, id, got[id], want[id], got)
+			}
+		}
+	}
+
+	check("initial", NewRouter([]SwitchBackend{
+		newNamedSwitches("cam", "roof", "dome"),
+		newNamedSwitches("plug", "mount", "heater"),
+	}, opts), "roof", "dome", "mount", "heater")
+
+	// Removing the cameras leaves their IDs unassigned instead of shifting
+	// the plugs down.
+	check("cameras removed", NewRouter([]SwitchBackend{
+		newNamedSwitches("plug", "mount", "heater"),
+	}, opts), "(unassigned)", "(unassigned)", "mount", "heater")
+
+	// Reordering the config and adding a switch keeps the known IDs; the
+	// new switch takes the next free one.
+	plugs := newNamedSwitches("plug", "focuser", "heater", "mount")
+	r := NewRouter([]SwitchBackend{plugs, newNamedSwitches("cam", "dome", "roof")}, opts)
+	check("reordered", r, "roof", "dome", "mount", "heater", "focuser")
+
+	// A switch renamed through SetName keeps its ID under the new name.
+	if err := r.SetName(2, "mount power"); err != nil {
+		t.Fatal(err)
+	}
+	check("renamed", NewRouter([]SwitchBackend{
+		newNamedSwitches("cam", "roof", "dome"),
+		newNamedSwitches("plug", "mount power", "heater", "focuser"),
+	}, opts), "roof", "dome", "mount power", "heater", "focuser")
+}
@@ -0,0 +1,52 @@
+package backend
+
+import (
+	"log"
+	"math"
+)
+
+// GetStateNames returns the configured labels for switch id's values, where
+// names[i] labels Min + i*Step, or nil if none are configured.
+func (r *Router) GetStateNames(id int) []string {
+	if ref, ok := r.ref(id); ok {
+		return r.options(ref).StateNames
+	}
+	return nil
+}
+
+// StateName returns the label for value on switch id, or "" if the switch
+// has no state names or value falls outside them.
+func (r *Router) StateName(id int, value float64) string {
+	names := r.GetStateNames(id)
+	if len(names) == 0 {
+		return ""
+	}
+	step := r.GetStep(id)
+	if step <= 0 {
+		step = 1
+	}
+	i := int(math.Round((value - r.GetMin(id)) / step))
+	if i < 0 || i >= len(names) {
+		return ""
+	}
+	return names[i]
+}
+
+// checkStateNames warns about switches whose state_names do not cover
+// exactly one label per value step.
+func (r *Router) checkStateNames() {
+	for id, ref := range r.tbl().index {
+		names := r.options(ref).StateNames
+		if len(names) == 0 {
+			continue
+		}
+		min, max, step := ref.backend.GetMin(ref.localID), ref.backend.GetMax(ref.localID), ref.backend.GetStep(ref.localID)
+		if step <= 0 {
+			step = 1
+		}
+		if want := int(math.Round((max-min)/step)) + 1; len(names) != want {
+			log.Printf("Warning: switch %d (%s) has %d state_names but %d states (min %v, max %v, step %v)",
+				id, ref.backend.GetName(ref.localID), len(names), want, min, max, step)
+		}
+	}
+}
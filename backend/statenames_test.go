@@ -0,0 +1,28 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStateNames(t *testing.T) {
+	fake := newFakeSwitches(0, 0)
+	fake.max = 2
+	fake.opts[0].StateNames = []string{"off", "low", "high"}
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+
+	if got := r.GetStateNames(0); !reflect.DeepEqual(got, []string{"off", "low", "high"}) {
+		t.Errorf("GetStateNames(0) = %v", got)
+	}
+	if got := r.GetStateNames(1); got != nil {
+		t.Errorf("GetStateNames(1) = %v for a switch without names, want nil", got)
+	}
+	for value, want := range map[float64]string{0: "off", 1: "low", 2: "high", 3: ""} {
+		if got := r.StateName(0, value); got != want {
+			t.Errorf("StateName(0, %v) = %q, want %q", value, got, want)
+		}
+	}
+	if got := r.StateName(1, 1); got != "" {
+		t.Errorf("StateName(1, 1) = %q for a switch without names, want \"\"", got)
+	}
+}
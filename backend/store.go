@@ -0,0 +1,193 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Store persists a backend's state as one opaque document, so backends do
+// not depend on where it is kept. The document format is the backend's own.
+type Store interface {
+	// Load returns the saved document, or nil and no error if nothing has
+	// been saved yet.
+	Load() ([]byte, error)
+
+	// Save replaces the saved document with data.
+	Save(data []byte) error
+
+	// String describes where the state is kept, for log messages.
+	String() string
+}
+
+// StoreChecker is implemented by stores that can tell at startup whether
+// saving will work, e.g. a file store whose directory is read-only.
+type StoreChecker interface {
+	Check() error
+}
+
+// Store kinds selectable with StoreConfig.Kind.
+const (
+	// StoreFile keeps the state in a JSON file (the default).
+	StoreFile = "file"
+	// StoreMemory keeps the state in memory only; it is lost on exit.
+	StoreMemory = "memory"
+)
+
+// StoreConfig selects and configures a Store.
+type StoreConfig struct {
+	// Kind is a registered store kind; empty means StoreFile.
+	Kind string
+	// Path is where the store keeps its data, e.g. the file name.
+	Path string
+	// Backups is the number of rolling backups a file store keeps.
+	Backups int
+}
+
+// StoreOpener creates a Store from its config.
+type StoreOpener func(cfg StoreConfig) (Store, error)
+
+var (
+	storesMu sync.Mutex
+	stores   = map[string]StoreOpener{
+		StoreFile:   func(cfg StoreConfig) (Store, error) { return &FileStore{Path: cfg.Path, Backups: cfg.Backups}, nil },
+		StoreMemory: func(StoreConfig) (Store, error) { return &MemoryStore{}, nil },
+	}
+)
+
+// RegisterStore makes a store kind available to OpenStore, e.g. an SQLite
+// or key-value store compiled into a custom build.
+func RegisterStore(kind string, open StoreOpener) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	stores[kind] = open
+}
+
+// OpenStore creates the store selected by cfg. A file store without a path
+// means persistence is off: it returns nil and no error.
+func OpenStore(cfg StoreConfig) (Store, error) {
+	if cfg.Kind == "" {
+		cfg.Kind = StoreFile
+	}
+	if cfg.Kind == StoreFile && cfg.Path == "" {
+		return nil, nil
+	}
+	storesMu.Lock()
+	open, ok := stores[cfg.Kind]
+	var kinds []string
+	for k := range stores {
+		kinds = append(kinds, k)
+	}
+	storesMu.Unlock()
+	if !ok {
+		sort.Strings(kinds)
+		return nil, fmt.Errorf("unknown state store %q (available: %v)", cfg.Kind, kinds)
+	}
+	return open(cfg)
+}
+
+// FileStore keeps the state document in a file, replaced atomically on
+// every save, optionally keeping rolling backups of earlier versions.
+type FileStore struct {
+	Path    string
+	Backups int
+}
+
+func (f *FileStore) Load() ([]byte, error) {
+	data, err := os.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (f *FileStore) Save(data []byte) error {
+	return writeFileAtomic(f.Path, data, f.Backups)
+}
+
+func (f *FileStore) String() string { return f.Path }
+
+// Check reports whether the file's directory is writable.
+func (f *FileStore) Check() error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), ".write-test*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	return nil
+}
+
+// MemoryStore keeps the state document in memory, for ephemeral setups
+// and tests.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (m *MemoryStore) Load() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]byte(nil), m.data...), nil
+}
+
+func (m *MemoryStore) Save(data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemoryStore) String() string { return "memory" }
+
+// writeFileAtomic replaces path with data via a temporary file and rename,
+// so a crash never leaves a half-written file. If backups > 0 the previous
+// contents are first copied to path.bak, with older copies rotated to
+// path.bak.2 ... path.bak.<backups>.
+func writeFileAtomic(path string, data []byte, backups int) error {
+	if backups > 0 {
+		if err := rotateBackups(path, backups); err != nil {
+			return fmt.Errorf("backing up %s: %w", path, err)
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func backupName(path string, n int) string {
+	if n == 1 {
+		return path + ".bak"
+	}
+	return fmt.Sprintf("%s.bak.%d", path, n)
+}
+
+// rotateBackups shifts path.bak.(n-1) to path.bak.n and copies the current
+// contents of path to path.bak.
+func rotateBackups(path string, n int) error {
+	current, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil // nothing to back up yet
+	}
+	if err != nil {
+		return err
+	}
+	for i := n; i > 1; i-- {
+		if err := os.Rename(backupName(path, i-1), backupName(path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.WriteFile(backupName(path, 1), current, 0644)
+}
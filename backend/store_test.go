@@ -0,0 +1,83 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Each save keeps the previous contents in path.bak, rotating older copies
+// up to the configured number of backups.
+func TestFileStoreBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := &FileStore{Path: path, Backups: 2}
+
+	for _, doc := range []string{"one", "two", "three", "four"} {
+		if err := store.Save([]byte(doc)); err != nil {
+			t.Fatalf("Save(%q): %v", doc, err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		path:            "four",
+		path + ".bak":   "three",
+		path + ".bak.2": "two",
+	} {
+		got, err := os.ReadFile(name)
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", filepath.Base(name), got, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".bak.3"); !os.IsNotExist(err) {
+		t.Errorf("found a third backup with backups set to 2 (err %v)", err)
+	}
+}
+
+// Without backups configured a save leaves no .bak file behind.
+func TestFileStoreNoBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := &FileStore{Path: path}
+	for _, doc := range []string{"one", "two"} {
+		if err := store.Save([]byte(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("backup written with backups off (err %v)", err)
+	}
+	if got, err := store.Load(); err != nil || string(got) != "two" {
+		t.Errorf("Load = %q, %v; want \"two\"", got, err)
+	}
+}
+
+func TestMemoryStoreRoundTrip(t *testing.T) {
+	store, err := OpenStore(StoreConfig{Kind: StoreMemory})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Load(); err != nil || got != nil {
+		t.Errorf("Load before any save = %q, %v; want nil", got, err)
+	}
+	doc := []byte(`{"a":1}`)
+	if err := store.Save(doc); err != nil {
+		t.Fatal(err)
+	}
+	doc[2] = 'b' // the store keeps its own copy
+	if got, err := store.Load(); err != nil || string(got) != `{"a":1}` {
+		t.Errorf("Load = %q, %v; want the saved document", got, err)
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	if store, err := OpenStore(StoreConfig{}); store != nil || err != nil {
+		t.Errorf("file store without a path = %v, %v; want persistence off", store, err)
+	}
+	if _, err := OpenStore(StoreConfig{Kind: "nosuch"}); err == nil {
+		t.Error("unknown store kind accepted")
+	}
+	shared := &MemoryStore{}
+	RegisterStore("test-shared", func(StoreConfig) (Store, error) { return shared, nil })
+	if store, err := OpenStore(StoreConfig{Kind: "test-shared"}); err != nil || store != Store(shared) {
+		t.Errorf("registered kind = %v, %v; want its store", store, err)
+	}
+}
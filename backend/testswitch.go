@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ActionTestSwitch is the built-in commissioning action: it turns a switch
+// on, reads it back, turns it off and reads it back again.
+const ActionTestSwitch = "testswitch"
+
+// Wait between a write and its read-back in testswitch, unless overridden.
+const (
+	defaultTestWait = 2 * time.Second
+	maxTestWait     = 10 * time.Second
+)
+
+// testConfirm is the testswitch parameter that confirms cycling a
+// require_confirm switch, as Confirm=true does for setswitch.
+const testConfirm = "confirm"
+
+// testSwitch runs the testswitch action. params is "<id> [wait seconds]
+// [confirm]". Each step is reported on its own line; a failing step does not
+// stop the sequence, so the switch is always left off if the hardware
+// allows it.
+func (r *Router) testSwitch(params string) (string, error) {
+	fields := strings.Fields(params)
+	confirmed := false
+	if n := len(fields); n > 1 && strings.EqualFold(fields[n-1], testConfirm) {
+		confirmed = true
+		fields = fields[:n-1]
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", fmt.Errorf("%w: %s takes a switch ID, an optional wait in seconds and an optional %q", ErrInvalidValue, ActionTestSwitch, testConfirm)
+	}
+	id, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return "", fmt.Errorf("%w: switch ID %q", ErrInvalidValue, fields[0])
+	}
+	ref, ok := r.ref(id)
+	if !ok {
+		return "", errInvalidID(id)
+	}
+	if !ref.backend.GetCanWrite(ref.localID) {
+		return "", fmt.Errorf("%w: switch %d is read-only", ErrInvalidOperation, id)
+	}
+	// The test turns the switch both on and off, so a require_confirm
+	// switch needs confirming whichever state is guarded.
+	for _, value := range []float64{r.GetMax(id), r.GetMin(id)} {
+		if err := r.CheckConfirm(id, value, confirmed); err != nil {
+			return "", fmt.Errorf("%w (add %q to the %s parameters)", err, testConfirm, ActionTestSwitch)
+		}
+	}
+	wait := defaultTestWait
+	if len(fields) == 2 {
+		secs, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || secs < 0 || secs > maxTestWait.Seconds() {
+			return "", fmt.Errorf("%w: wait must be between 0 and %.0f seconds, got %q", ErrInvalidValue, maxTestWait.Seconds(), fields[1])
+		}
+		wait = time.Duration(secs * float64(time.Second))
+	}
+
+	var report []string
+	passed := true
+	step := func(on bool) {
+		state := "off"
+		if on {
+			state = "on"
+		}
+		if err := r.SetSwitch(id, on); err != nil {
+			report = append(report, fmt.Sprintf("set %s: FAIL (%v)", state, err))
+			passed = false
+			return
+		}
+		report = append(report, fmt.Sprintf("set %s: ok", state))
+		time.Sleep(wait)
+		got, source, err := r.readBack(id, ref)
+		switch {
+		case err != nil:
+			report = append(report, fmt.Sprintf("read back: FAIL (%v)", err))
+			passed = false
+		case got != on:
+			report = append(report, fmt.Sprintf("read back (%s): FAIL (expected %s)", source, state))
+			passed = false
+		default:
+			report = append(report, fmt.Sprintf("read back (%s): ok", source))
+		}
+	}
+	step(true)
+	step(false)
+
+	result := "PASS"
+	if !passed {
+		result = "FAIL"
+	}
+	log.Printf("[test] switch %d (%s): %s", id, ref.backend.GetName(ref.localID), result)
+	return fmt.Sprintf("switch %d (%s)\n%s\n%s", id, ref.backend.GetName(ref.localID), strings.Join(report, "\n"), result), nil
+}
+
+// readBack reads switch id's state from hardware where the backend can
+// (Poller), otherwise through GetSwitch. source says whether the value
+// came from the device or the cache.
+func (r *Router) readBack(id int, ref switchRef) (on bool, source string, err error) {
+	if p, ok := ref.backend.(Poller); ok {
+		value, err := p.PollSwitchValue(ref.localID)
+		r.recordResult(id, err)
+		if err != nil {
+			return false, "live", r.wrapErr(id, ref, err)
+		}
+		return value > ref.backend.GetMin(ref.localID), "live", nil
+	}
+	source = "cached"
+	if lr, ok := ref.backend.(LiveReader); ok && lr.ReadsLive() {
+		source = "live"
+	}
+	on, err = r.GetSwitch(id)
+	return on, source, err
+}
@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTestSwitchPasses(t *testing.T) {
+	fake := newFakeSwitches(0)
+	fake.live = []float64{0}
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+
+	out, err := r.Action(ActionTestSwitch, "0 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "switch 0 (fake 0)\nset on: ok\nread back (live): ok\nset off: ok\nread back (live): ok\nPASS"
+	if out != want {
+		t.Errorf("testswitch report:\n%s\nwant:\n%s", out, want)
+	}
+	if fake.writes != 2 || fake.pollCount(0) != 2 || fake.value(0) != 0 {
+		t.Errorf("%d writes, %d reads, final value %v; want on, read, off, read", fake.writes, fake.pollCount(0), fake.value(0))
+	}
+}
+
+// A switch that acknowledges a write without switching fails the read-back
+// and the test, but is still turned off.
+func TestTestSwitchDetectsIgnoredWrite(t *testing.T) {
+	fake := newFakeSwitches(0)
+	fake.live = []float64{0}
+	fake.ignore = 1
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+
+	out, err := r.Action(ActionTestSwitch, "0 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "read back (live): FAIL (expected on)") || !strings.HasSuffix(out, "\nFAIL") {
+		t.Errorf("testswitch report for an ignored write:\n%s", out)
+	}
+	if !strings.Contains(out, "set off: ok") {
+		t.Errorf("switch not turned off after the failed step:\n%s", out)
+	}
+}
+
+func TestTestSwitchRejects(t *testing.T) {
+	fake := newFakeSwitches(0, 0)
+	fake.readOnly = map[int]bool{1: true}
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+	for params, want := range map[string]error{
+		"":      ErrInvalidValue,
+		"x":     ErrInvalidValue,
+		"0 60":  ErrInvalidValue,
+		"0 1 2": ErrInvalidValue,
+		"1":     ErrInvalidOperation,
+	} {
+		if _, err := r.Action(ActionTestSwitch, params); !errors.Is(err, want) {
+			t.Errorf("testswitch %q = %v, want %v", params, err, want)
+		}
+	}
+	if _, err := r.Action(ActionTestSwitch, "5"); err == nil {
+		t.Error("testswitch on an unknown switch succeeded")
+	}
+	if fake.writes != 0 {
+		t.Errorf("%d writes from rejected tests, want none", fake.writes)
+	}
+}
+
+// A require_confirm switch is only cycled with "confirm" in the
+// parameters, whichever state is guarded.
+func TestTestSwitchRequiresConfirm(t *testing.T) {
+	fake := newFakeSwitches(0, 0)
+	fake.opts[0] = SwitchOptions{RequireConfirm: true}
+	fake.opts[1] = SwitchOptions{RequireConfirm: true, ConfirmState: ConfirmOn}
+	r := NewRouter([]SwitchBackend{fake}, Options{})
+
+	for _, params := range []string{"0 0", "1 0", "0"} {
+		if _, err := r.Action(ActionTestSwitch, params); !errors.Is(err, ErrInvalidOperation) {
+			t.Errorf("testswitch %q without confirm = %v, want ErrInvalidOperation", params, err)
+		}
+	}
+	if fake.writes != 0 {
+		t.Fatalf("%d writes from unconfirmed tests, want none", fake.writes)
+	}
+
+	for _, params := range []string{"0 0 confirm", "1 0 CONFIRM"} {
+		if _, err := r.Action(ActionTestSwitch, params); err != nil {
+			t.Errorf("testswitch %q = %v", params, err)
+		}
+	}
+	if fake.writes != 4 {
+		t.Errorf("%d writes from confirmed tests, want on and off for each", fake.writes)
+	}
+}
@@ -0,0 +1,39 @@
+package backend
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// tracing enables logging of raw device payloads (--trace). It is verbose
+// and may expose device details, so it is off by default.
+var tracing atomic.Bool
+
+// SetTrace turns payload tracing on or off.
+func SetTrace(on bool) { tracing.Store(on) }
+
+// Tracing reports whether payload tracing is enabled.
+func Tracing() bool { return tracing.Load() }
+
+// Tracef logs a trace message if tracing is enabled.
+func Tracef(format string, args ...interface{}) {
+	if tracing.Load() {
+		log.Printf("[trace] "+format, args...)
+	}
+}
+
+// secretFields matches JSON and XML fields that carry credentials.
+var secretFields = regexp.MustCompile(`(?i)("(?:token|password|passwd|secret)"\s*:\s*")[^"]*(")|(<(?:password|token)>)[^<]*(</)`)
+
+// Redact masks every occurrence of the given secrets in s, as well as the
+// values of token/password fields in JSON or XML payloads.
+func Redact(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, "***")
+		}
+	}
+	return secretFields.ReplaceAllString(s, "$1$3***$2$4")
+}
@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the standard logger into a buffer for the rest of
+// the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestTracefOnlyWhenTracing(t *testing.T) {
+	buf := captureLog(t)
+	Tracef("payload %s", "off")
+	SetTrace(true)
+	defer SetTrace(false)
+	Tracef("payload %s", "on")
+
+	out := buf.String()
+	if strings.Contains(out, "payload off") {
+		t.Errorf("traced with tracing off: %q", out)
+	}
+	if !strings.Contains(out, "[trace] payload on") {
+		t.Errorf("not traced with tracing on: %q", out)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	for in, want := range map[string]string{
+		`{"token":"abc123","value":1}`:                      `{"token":"***","value":1}`,
+		`{"Password" : "hunter2"}`:                          `{"Password" : "***"}`,
+		`<userName>admin</userName><password>pw</password>`: `<userName>admin</userName><password>***</password>`,
+		`GET /cm?user=admin&password=s3cr3t`:                `GET /cm?user=admin&password=***`,
+	} {
+		if got := Redact(in, "s3cr3t"); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package uhubctl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// defaultCommand runs uhubctl from PATH.
+var defaultCommand = []string{"uhubctl"}
+
+const defaultTimeout = 10 * time.Second
+
+// hubLocation matches a uhubctl hub location such as "1", "1-1" or
+// "2-1.4". Checking it keeps a location from being read as an option.
+var hubLocation = regexp.MustCompile(`^[0-9]+(-[0-9]+(\.[0-9]+)*)?$`)
+
+// portStatus matches a port line of uhubctl's output, e.g.
+// "  Port 2: 0100 power" or "  Port 1: 0000 off".
+var portStatus = regexp.MustCompile(`^\s*Port\s+(\d+):\s+[0-9a-fA-F]{4}\s*(.*)$`)
+
+// runner invokes uhubctl. Arguments are passed as an argv list, never
+// through a shell, so config values cannot inject commands.
+type runner struct {
+	command []string
+	timeout time.Duration
+}
+
+// run executes uhubctl for one port, with action "on", "off" or "" for a
+// status query, and returns the port's power state as reported last, i.e.
+// after the action.
+func (r runner) run(location string, port int, action string) (bool, error) {
+	args := append(append([]string(nil), r.command[1:]...), "-l", location, "-p", strconv.Itoa(port))
+	if action != "" {
+		args = append(args, "-a", action)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, r.command[0], args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	backend.Tracef("uhubctl %s: exit %v, output: %s", strings.Join(args, " "), err, stdout.String())
+	if ctx.Err() != nil {
+		return false, fmt.Errorf("uhubctl timed out after %v: %w", r.timeout, ctx.Err())
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return false, fmt.Errorf("uhubctl -l %s -p %d: %w: %s", location, port, err, msg)
+	}
+	return parseStatus(stdout.String(), port)
+}
+
+// parseStatus returns the power state of port from uhubctl output. A port
+// is on when its status flags include "power". The last line for the port
+// wins, so after an action the new status is used.
+func parseStatus(out string, port int) (bool, error) {
+	found, on := false, false
+	for _, line := range strings.Split(out, "\n") {
+		m := portStatus.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if n, _ := strconv.Atoi(m[1]); n != port {
+			continue
+		}
+		found = true
+		on = false
+		for _, flag := range strings.Fields(m[2]) {
+			if flag == "power" {
+				on = true
+			}
+		}
+	}
+	if !found {
+		return false, errors.New("uhubctl output has no status for port " + strconv.Itoa(port))
+	}
+	return on, nil
+}
@@ -0,0 +1,369 @@
+// Package uhubctl implements a SwitchBackend for USB-powered devices
+// (focusers, cameras, dew controllers) by switching the power of USB hub
+// ports with uhubctl (https://github.com/mvp/uhubctl). Each SwitchConfig
+// entry is one on/off switch for one port of a hub that supports per-port
+// power switching.
+//
+// Example:
+//
+//	{"name": "Focuser", "location": "1-1", "port": 2}
+package uhubctl
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// SwitchConfig describes one switched hub port.
+type SwitchConfig struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Value       float64 `json:"value"` // cached last-known state: 0=off, 1=on
+
+	// Location is the hub location as listed by uhubctl, e.g. "1-1".
+	Location string `json:"location"`
+	// Port is the hub port number, starting at 1.
+	Port int `json:"port"`
+
+	backend.SwitchOptions
+}
+
+// Validate checks the hub location and port of cfg.
+func (cfg SwitchConfig) Validate() error {
+	if !hubLocation.MatchString(cfg.Location) {
+		return fmt.Errorf("location must be a uhubctl hub location such as \"1-1\", got %q", cfg.Location)
+	}
+	if cfg.Port < 1 {
+		return fmt.Errorf("port must be 1 or more, got %d", cfg.Port)
+	}
+	return nil
+}
+
+// Settings holds backend-wide options for the uhubctl backend.
+type Settings struct {
+	// PollSeconds is the default refresh interval for switches without a
+	// per-switch poll_seconds override. Zero disables background polling.
+	PollSeconds int `json:"poll_seconds"`
+
+	// Command is the program and leading arguments to run, e.g.
+	// ["sudo", "-n", "uhubctl"]. Default: ["uhubctl"].
+	Command []string `json:"command"`
+
+	// TimeoutSeconds bounds each uhubctl invocation (default 10).
+	TimeoutSeconds int `json:"timeout_seconds"`
+
+	backend.CommonSettings
+}
+
+// port is the runtime representation of one switched port.
+type port struct {
+	cfg     SwitchConfig
+	updated time.Time // when cfg.Value was last read from or written to the hub
+}
+
+// Backend implements backend.SwitchBackend for uhubctl-switched USB ports.
+type Backend struct {
+	mu        sync.RWMutex
+	ports     []*port
+	settings  Settings
+	connected bool
+
+	// execMu serialises uhubctl runs: concurrent runs against the same hub
+	// can interfere with each other.
+	execMu sync.Mutex
+	runner runner
+}
+
+// New creates a uhubctl backend from a list of switch configs.
+func New(cfgs []SwitchConfig, settings Settings) *Backend {
+	ports := make([]*port, len(cfgs))
+	for i, cfg := range cfgs {
+		if err := cfg.Validate(); err != nil {
+			log.Printf("[uhubctl] switch %d (%s): %v; it will fail every operation", i, cfg.Name, err)
+		}
+		ports[i] = &port{cfg: cfg}
+	}
+	r := runner{command: settings.Command, timeout: time.Duration(settings.TimeoutSeconds) * time.Second}
+	if len(r.command) == 0 {
+		r.command = defaultCommand
+	}
+	if r.timeout <= 0 {
+		r.timeout = defaultTimeout
+	}
+	return &Backend{ports: ports, settings: settings, runner: r}
+}
+
+// run invokes uhubctl for switch id; see runner.run.
+func (b *Backend) run(id int, action string) (bool, error) {
+	p, err := b.get(id)
+	if err != nil {
+		return false, err
+	}
+	if err := p.cfg.Validate(); err != nil {
+		return false, err
+	}
+	b.execMu.Lock()
+	defer b.execMu.Unlock()
+	return b.runner.run(p.cfg.Location, p.cfg.Port, action)
+}
+
+// Connect queries the power state of every port and marks the backend
+// connected.
+func (b *Backend) Connect() error {
+	b.refreshStates()
+	b.mu.Lock()
+	b.connected = true
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *Backend) refreshStates() {
+	okCount := 0
+	failCount := 0
+	for i := range b.ports {
+		value, err := b.PollSwitchValue(i)
+		if err != nil {
+			failCount++
+			log.Printf("[uhubctl] warning: switch %d query failed: %v (keeping cached value)", i, err)
+			continue
+		}
+		okCount++
+		b.SetCachedValue(i, value)
+	}
+	log.Printf("[uhubctl] state refresh complete: %d ok, %d failed", okCount, failCount)
+}
+
+// Disconnect marks the backend disconnected.
+func (b *Backend) Disconnect() {
+	b.mu.Lock()
+	b.connected = false
+	b.mu.Unlock()
+}
+
+// IsConnected reports whether the backend is connected.
+func (b *Backend) IsConnected() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.connected
+}
+
+// BackendType returns "uhubctl".
+func (b *Backend) BackendType() string { return "uhubctl" }
+
+// ClampsValues reports whether clamp_values is set.
+func (b *Backend) ClampsValues() bool { return b.settings.ClampsValues() }
+
+// OptimizesWrites reports whether write_mode is optimize, and the
+// write_max_age_seconds freshness limit.
+func (b *Backend) OptimizesWrites() (bool, time.Duration) { return b.settings.OptimizesWrites() }
+
+// NamePrefix returns the name_prefix setting.
+func (b *Backend) NamePrefix() string { return b.settings.NamePrefix }
+
+// NumSwitches returns the number of configured ports.
+func (b *Backend) NumSwitches() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.ports)
+}
+
+func (b *Backend) get(id int) (*port, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.ports) {
+		return nil, fmt.Errorf("invalid switch id %d", id)
+	}
+	return b.ports[id], nil
+}
+
+// GetName returns the name of switch id.
+func (b *Backend) GetName(id int) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.ports) {
+		return ""
+	}
+	return b.ports[id].cfg.Name
+}
+
+// SetName sets the name of switch id.
+func (b *Backend) SetName(id int, name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id < 0 || id >= len(b.ports) {
+		return fmt.Errorf("invalid switch id %d", id)
+	}
+	b.ports[id].cfg.Name = name
+	return nil
+}
+
+// GetDescription returns the description of switch id. Without one it
+// expands description_template ({name}, {location}, {port}), falling back to
+// the hub location and port.
+func (b *Backend) GetDescription(id int) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.ports) {
+		return ""
+	}
+	cfg := b.ports[id].cfg
+	if cfg.Description != "" {
+		return cfg.Description
+	}
+	if b.settings.DescriptionTemplate != "" {
+		return backend.ExpandDescription(b.settings.DescriptionTemplate, map[string]string{
+			"name":     cfg.Name,
+			"location": cfg.Location,
+			"port":     strconv.Itoa(cfg.Port),
+		})
+	}
+	return fmt.Sprintf("%s (USB hub %s port %d)", cfg.Name, cfg.Location, cfg.Port)
+}
+
+// GetCanWrite returns true: every port can be switched.
+func (b *Backend) GetCanWrite(int) bool { return true }
+
+// GetMin returns the minimum value (0).
+func (b *Backend) GetMin(int) float64 { return 0 }
+
+// GetMax returns the maximum value (1).
+func (b *Backend) GetMax(int) float64 { return 1 }
+
+// GetStep returns the step size (1).
+func (b *Backend) GetStep(int) float64 { return 1 }
+
+// GetSwitch returns the cached power state of switch id.
+func (b *Backend) GetSwitch(id int) (bool, error) {
+	value, err := b.GetSwitchValue(id)
+	return value != 0, err
+}
+
+// GetSwitchValue returns the cached value of switch id.
+func (b *Backend) GetSwitchValue(id int) (float64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.ports) {
+		return 0, fmt.Errorf("invalid switch id %d", id)
+	}
+	return b.ports[id].cfg.Value, nil
+}
+
+// SetSwitch powers the port of switch id on or off and caches the state
+// uhubctl reports afterwards.
+func (b *Backend) SetSwitch(id int, state bool) error {
+	action := "off"
+	if state {
+		action = "on"
+	}
+	on, err := b.run(id, action)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.ports[id].cfg.Value = boolValue(on)
+	b.ports[id].updated = time.Now()
+	b.mu.Unlock()
+	if on != state {
+		return fmt.Errorf("uhubctl reports the port %s after switching it %s; the hub may not support per-port power switching", onOff(on), action)
+	}
+	log.Printf("[uhubctl] switch %d (%s) set to %v", id, b.GetName(id), on)
+	return nil
+}
+
+// SetSwitchValue sets switch id by numeric value: 0 = off, non-zero = on.
+func (b *Backend) SetSwitchValue(id int, value float64) error {
+	return b.SetSwitch(id, value != 0)
+}
+
+// SwitchOptions returns the per-switch options configured for switch id.
+func (b *Backend) SwitchOptions(id int) backend.SwitchOptions {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.ports) {
+		return backend.SwitchOptions{}
+	}
+	return b.ports[id].cfg.SwitchOptions
+}
+
+// PollInterval returns the background refresh interval for switch id.
+func (b *Backend) PollInterval(id int) time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.ports) {
+		return 0
+	}
+	return b.ports[id].cfg.PollInterval(b.settings.PollSeconds)
+}
+
+// PollSwitchValue queries the live power state of switch id's port.
+func (b *Backend) PollSwitchValue(id int) (float64, error) {
+	on, err := b.run(id, "")
+	if err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	b.ports[id].updated = time.Now()
+	b.mu.Unlock()
+	return boolValue(on), nil
+}
+
+// SetCachedValue stores a value for switch id.
+func (b *Backend) SetCachedValue(id int, value float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id < 0 || id >= len(b.ports) {
+		return
+	}
+	b.ports[id].cfg.Value = value
+}
+
+// LastUpdated returns when switch id's state was last read from or written
+// to the hub, or the zero time if it is still the config value.
+func (b *Backend) LastUpdated(id int) time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if id < 0 || id >= len(b.ports) {
+		return time.Time{}
+	}
+	return b.ports[id].updated
+}
+
+// InvalidateCache clears switch id's hardware stamp, so its value reads as
+// unverified until it is next read from the hub.
+func (b *Backend) InvalidateCache(id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id >= 0 && id < len(b.ports) {
+		b.ports[id].updated = time.Time{}
+	}
+}
+
+// Configs returns a snapshot of all switch configs (for config persistence).
+func (b *Backend) Configs() []SwitchConfig {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	out := make([]SwitchConfig, len(b.ports))
+	for i, p := range b.ports {
+		out[i] = p.cfg
+	}
+	return out
+}
+
+func boolValue(on bool) float64 {
+	if on {
+		return 1
+	}
+	return 0
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,149 @@
+package uhubctl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHelperProcess is not a real test: run as the configured uhubctl
+// command, it emulates uhubctl's output for one hub whose port states are
+// kept in the file named by UHUBCTL_STATE ("on" or "off" per line, port 1
+// first).
+func TestHelperProcess(t *testing.T) {
+	state := os.Getenv("UHUBCTL_STATE")
+	if state == "" {
+		return
+	}
+	defer os.Exit(0)
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	var location, port, action string
+	for i := 1; i+1 < len(args); i += 2 {
+		switch args[i] {
+		case "-l":
+			location = args[i+1]
+		case "-p":
+			port = args[i+1]
+		case "-a":
+			action = args[i+1]
+		}
+	}
+	if location != "1-1" {
+		fmt.Fprintf(os.Stderr, "No compatible devices detected at location %s!\n", location)
+		os.Exit(1)
+	}
+	data, _ := os.ReadFile(state)
+	ports := strings.Fields(string(data))
+	status := func() {
+		fmt.Println("Current status for hub 1-1 [2109:2813 VIA Labs, Inc. USB2.0 Hub, USB 2.10, 4 ports, ppps]")
+		for i, s := range ports {
+			if p := fmt.Sprint(i + 1); port == "" || p == port {
+				if s == "on" {
+					fmt.Printf("  Port %s: 0100 power\n", p)
+				} else {
+					fmt.Printf("  Port %s: 0000 off\n", p)
+				}
+			}
+		}
+	}
+	status()
+	if action != "" {
+		var n int
+		fmt.Sscan(port, &n)
+		ports[n-1] = action
+		os.WriteFile(state, []byte(strings.Join(ports, "\n")), 0644)
+		fmt.Printf("Sending power %s to hub 1-1 port %s\n", action, port)
+		status()
+	}
+}
+
+// newHub returns a backend whose uhubctl is the helper process, with the
+// hub's ports starting in the given states.
+func newHub(t *testing.T, ports []string, cfgs ...SwitchConfig) (*Backend, string) {
+	t.Helper()
+	state := filepath.Join(t.TempDir(), "ports")
+	if err := os.WriteFile(state, []byte(strings.Join(ports, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("UHUBCTL_STATE", state)
+	return New(cfgs, Settings{Command: []string{os.Args[0], "-test.run=TestHelperProcess", "--"}}), state
+}
+
+func TestUhubctlPorts(t *testing.T) {
+	b, state := newHub(t, []string{"off", "on", "off"},
+		SwitchConfig{Name: "Focuser", Location: "1-1", Port: 2},
+		SwitchConfig{Name: "Camera", Location: "1-1", Port: 3})
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range []bool{true, false} {
+		if on, err := b.GetSwitch(id); err != nil || on != want {
+			t.Errorf("switch %d after Connect = %v, %v; want %v", id, on, err, want)
+		}
+	}
+
+	if err := b.SetSwitch(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if on, _ := b.GetSwitch(1); !on {
+		t.Error("cached state after powering on is off")
+	}
+	if data, _ := os.ReadFile(state); strings.Fields(string(data))[2] != "on" {
+		t.Errorf("hub ports = %q, want port 3 on", data)
+	}
+
+	if v, err := b.PollSwitchValue(0); err != nil || v != 1 {
+		t.Errorf("PollSwitchValue = %v, %v; want 1", v, err)
+	}
+}
+
+func TestUhubctlErrors(t *testing.T) {
+	b, _ := newHub(t, []string{"on"}, SwitchConfig{Name: "Missing", Location: "2-1", Port: 1})
+	if err := b.SetSwitch(0, true); err == nil || !strings.Contains(err.Error(), "No compatible devices") {
+		t.Errorf("SetSwitch on a missing hub = %v, want uhubctl's error message", err)
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	out := `Current status for hub 1-1 [2109:2813 VIA Labs, Inc. USB2.0 Hub, USB 2.10, 4 ports, ppps]
+  Port 1: 0503 power highspeed enable connect [0bda:8153 Realtek USB 10/100/1000 LAN]
+  Port 2: 0100 power
+Sending power off to hub 1-1 port 2
+Current status for hub 1-1 [2109:2813 VIA Labs, Inc. USB2.0 Hub, USB 2.10, 4 ports, ppps]
+  Port 2: 0000 off
+`
+	for _, tc := range []struct {
+		port   int
+		on, ok bool
+	}{
+		{1, true, true},
+		{2, false, true}, // the status after the action wins
+		{3, false, false},
+	} {
+		on, err := parseStatus(out, tc.port)
+		if on != tc.on || (err == nil) != tc.ok {
+			t.Errorf("port %d: parseStatus = %v, %v; want %v (ok %v)", tc.port, on, err, tc.on, tc.ok)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		cfg SwitchConfig
+		ok  bool
+	}{
+		{SwitchConfig{Location: "1-1", Port: 2}, true},
+		{SwitchConfig{Location: "2-1.4", Port: 1}, true},
+		{SwitchConfig{Location: "-a", Port: 1}, false},
+		{SwitchConfig{Location: "1-1", Port: 0}, false},
+	} {
+		if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("Validate(%q port %d) = %v, want ok %v", tc.cfg.Location, tc.cfg.Port, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"fmt"
+	"math"
+)
+
+// Boolean value modes control how SetSwitchValue treats values written to
+// on/off switches (Max-Min equal to Step).
+const (
+	// BooleanRound rounds to the nearest valid state: 0.4 is off, 0.6 and
+	// 2.0 are on.
+	BooleanRound = "round"
+	// BooleanReject rejects anything but exactly Min or Max with InvalidValue.
+	BooleanReject = "reject"
+)
+
+// CheckRange reports a Min/Max/Step combination clients cannot step
+// through: Max below Min, a negative Step, or a range that is not a whole
+// number of steps (Min 0, Max 100, Step 30 never reaches 100). A zero Step
+// means the default of 1.
+func CheckRange(min, max, step float64) error {
+	if max < min {
+		return fmt.Errorf("max (%v) is below min (%v)", max, min)
+	}
+	if step < 0 {
+		return fmt.Errorf("step (%v) must not be negative", step)
+	}
+	if step == 0 {
+		step = 1
+	}
+	steps := (max - min) / step
+	if math.Abs(steps-math.Round(steps)) > 1e-9*math.Max(1, steps) {
+		return fmt.Errorf("range %v-%v is not a whole number of steps of %v (%.4g steps)", min, max, step, steps)
+	}
+	return nil
+}
+
+// isBoolean reports whether switch ref only has two states.
+func isBoolean(ref switchRef) bool {
+	min, max, step := ref.backend.GetMin(ref.localID), ref.backend.GetMax(ref.localID), ref.backend.GetStep(ref.localID)
+	return max-min == step
+}
+
+// normalizeValue applies the Router's BooleanValueMode to a value written
+// to an on/off switch. Values for multi-level switches pass through.
+func (r *Router) normalizeValue(ref switchRef, value float64) (float64, error) {
+	if !isBoolean(ref) {
+		return value, nil
+	}
+	min, max := ref.backend.GetMin(ref.localID), ref.backend.GetMax(ref.localID)
+	if value == min || value == max {
+		return value, nil
+	}
+	if r.opts.BooleanValueMode == BooleanReject {
+		return 0, fmt.Errorf("%w: %v is not valid for an on/off switch, expected %v or %v (boolean_value_mode is %q)",
+			ErrInvalidValue, value, min, max, BooleanReject)
+	}
+	if math.Abs(value-min) < math.Abs(value-max) {
+		return min, nil
+	}
+	return max, nil
+}
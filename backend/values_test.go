@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBooleanValueMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode  string
+		value float64
+		want  float64 // written value; -1 means rejected
+	}{
+		{BooleanRound, 0.4, 0},
+		{BooleanRound, 0.6, 1},
+		{BooleanRound, 2.0, 1},
+		{BooleanRound, 1, 1},
+		{BooleanReject, 0.4, -1},
+		{BooleanReject, 0.6, -1},
+		{BooleanReject, 2.0, -1},
+		{BooleanReject, 1, 1},
+		{"", 0.6, 1}, // round is the default
+	} {
+		fake := newFakeSwitches(0.5)
+		r := NewRouter([]SwitchBackend{fake}, Options{BooleanValueMode: tc.mode})
+		err := r.SetSwitchValue(0, tc.value)
+		if tc.want < 0 {
+			if !errors.Is(err, ErrInvalidValue) {
+				t.Errorf("%q mode, %v: error %v, want ErrInvalidValue", tc.mode, tc.value, err)
+			}
+			if fake.writes != 0 {
+				t.Errorf("%q mode, %v: rejected value was written", tc.mode, tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q mode, %v: %v", tc.mode, tc.value, err)
+		} else if v := fake.value(0); v != tc.want {
+			t.Errorf("%q mode, %v: wrote %v, want %v", tc.mode, tc.value, v, tc.want)
+		}
+	}
+}
+
+// Multi-level switches take any value unchanged.
+func TestBooleanValueModeSkipsMultiLevel(t *testing.T) {
+	fake := newFakeSwitches(0)
+	fake.max = 4
+	r := NewRouter([]SwitchBackend{fake}, Options{BooleanValueMode: BooleanReject})
+	if err := r.SetSwitchValue(0, 2); err != nil || fake.value(0) != 2 {
+		t.Errorf("SetSwitchValue(2) on a 0-4 switch = %v, value %v", err, fake.value(0))
+	}
+}
+
+func TestCheckRange(t *testing.T) {
+	for _, tc := range []struct {
+		min, max, step float64
+		ok             bool
+	}{
+		{0, 1, 1, true},
+		{0, 100, 10, true},
+		{0, 100, 0, true}, // zero step means 1
+		{1, 4, 1, true},
+		{0, 1, 0.1, true}, // within floating-point tolerance
+		{-10, 10, 2.5, true},
+		{5, 5, 1, true},
+		{0, 100, 30, false},
+		{0, 1, 0.3, false},
+		{10, 0, 1, false},
+		{0, 10, -1, false},
+	} {
+		err := CheckRange(tc.min, tc.max, tc.step)
+		if (err == nil) != tc.ok {
+			t.Errorf("CheckRange(%v, %v, %v) = %v, want ok %v", tc.min, tc.max, tc.step, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"alpaca-switch/backend"
+)
+
+// discoveryPort is the ASCOM Alpaca UDP discovery port.
+const discoveryPort = 32227
+
+// logStartupBanner logs a summary of the effective configuration so users
+// can confirm which options are active.
+func logStartupBanner(cfg *Config, path string) {
+	for _, line := range startupBanner(cfg, path) {
+		log.Printf("[startup] %s", line)
+	}
+}
+
+// startupBanner describes cfg: config source, ports, backends, persistence
+// files and enabled optional features. It names devices but never includes
+// credentials, tokens, headers or URLs, so it is safe to paste into a bug
+// report.
+func startupBanner(cfg *Config, path string) []string {
+	lines := []string{
+		"config: " + path,
+		fmt.Sprintf("alpaca: port %d, device number %d, discovery on UDP %d, api_versions %v",
+			cfg.AlpacaPort, cfg.DeviceNumber, discoveryPort, cfg.APIVersions),
+	}
+	if cfg.BindAddress != "" {
+		lines[1] += ", bound to " + cfg.BindAddress
+	}
+	if len(cfg.DiscoveryIfaces) > 0 {
+		lines[1] += ", discovery interfaces " + strings.Join(cfg.DiscoveryIfaces, ", ")
+	}
+
+	backendLine := func(kind string, names []string, poll int, clamp bool, writeMode string, extra ...string) {
+		if len(names) == 0 {
+			return
+		}
+		opts := extra
+		if poll > 0 {
+			opts = append(opts, fmt.Sprintf("poll %ds", poll))
+		}
+		if clamp {
+			opts = append(opts, "clamp_values")
+		}
+		if writeMode == backend.WriteOptimize {
+			opts = append(opts, "write_mode optimize")
+		}
+		line := fmt.Sprintf("%s: %d (%s)", kind, len(names), strings.Join(names, ", "))
+		if len(opts) > 0 {
+			line += "; " + strings.Join(opts, ", ")
+		}
+		lines = append(lines, line)
+	}
+
+	var names []string
+	for _, d := range cfg.MiDevices {
+		names = append(names, d.Name)
+	}
+	var miExtra []string
+	if cfg.MiSettings.SaveDelayMs > 0 {
+		miExtra = append(miExtra, fmt.Sprintf("save_delay_ms %d", cfg.MiSettings.SaveDelayMs))
+	}
+	backendLine("mi", names, cfg.MiSettings.PollSeconds, cfg.MiSettings.ClampValues, cfg.MiSettings.WriteMode, miExtra...)
+
+	names = nil
+	for _, c := range cfg.HikvisionCameras {
+		names = append(names, c.Name)
+	}
+	var hikExtra []string
+	if m := cfg.HikvisionSettings.ConnectMode; m != "" {
+		hikExtra = append(hikExtra, "connect_mode "+m)
+	}
+	if cfg.HikvisionSettings.CachedOnError {
+		hikExtra = append(hikExtra, "cached_on_error")
+	}
+	if cfg.HikvisionSettings.IRSubscription {
+		hikExtra = append(hikExtra, "ir_subscription")
+	}
+	backendLine("hikvision", names, cfg.HikvisionSettings.PollSeconds, cfg.HikvisionSettings.ClampValues, cfg.HikvisionSettings.WriteMode, hikExtra...)
+
+	names = nil
+	for _, s := range cfg.HTTPJSONSwitches {
+		names = append(names, s.Name)
+	}
+	backendLine("httpjson", names, cfg.HTTPJSONSettings.PollSeconds, cfg.HTTPJSONSettings.ClampValues, cfg.HTTPJSONSettings.WriteMode)
+
+	names = nil
+	for _, c := range cfg.ONVIFCameras {
+		names = append(names, c.Name)
+	}
+	backendLine("onvif", names, cfg.ONVIFSettings.PollSeconds, cfg.ONVIFSettings.ClampValues, cfg.ONVIFSettings.WriteMode)
+
+	names = nil
+	for _, s := range cfg.UhubctlSwitches {
+		names = append(names, s.Name)
+	}
+	var uhubctlExtra []string
+	if len(cfg.UhubctlSettings.Command) > 0 {
+		uhubctlExtra = append(uhubctlExtra, "command "+strings.Join(cfg.UhubctlSettings.Command, " "))
+	}
+	backendLine("uhubctl", names, cfg.UhubctlSettings.PollSeconds, cfg.UhubctlSettings.ClampValues, cfg.UhubctlSettings.WriteMode, uhubctlExtra...)
+
+	names = nil
+	for _, s := range cfg.PDUSwitches {
+		names = append(names, s.Name)
+	}
+	var pduExtra []string
+	if v := cfg.PDUSettings.SNMPVersion; v != "" {
+		pduExtra = append(pduExtra, "SNMP v"+v)
+	}
+	backendLine("pdu", names, cfg.PDUSettings.PollSeconds, cfg.PDUSettings.ClampValues, cfg.PDUSettings.WriteMode, pduExtra...)
+
+	names = nil
+	for _, a := range cfg.AggregateSwitches {
+		names = append(names, a.Name)
+	}
+	backendLine("aggregate", names, 0, false, "")
+
+	var files []string
+	if k := cfg.MiSettings.StateStore; k != "" && k != backend.StoreFile {
+		files = append(files, "mi state_store "+k)
+	}
+	for _, f := range []struct{ key, path string }{
+		{"mi state_file", cfg.MiSettings.StateFile},
+		{"maintenance_file", cfg.MaintenanceFile},
+		{"unique_id_file", cfg.UniqueIDFile},
+		{"switch_id_file", cfg.SwitchIDFile},
+		{"history_file", cfg.HistoryFile},
+	} {
+		if f.path != "" {
+			files = append(files, f.key+" "+f.path)
+		}
+	}
+	if len(files) > 0 {
+		lines = append(lines, "persistence: "+strings.Join(files, ", "))
+	} else {
+		lines = append(lines, "persistence: none")
+	}
+
+	var features []string
+	if cfg.Maintenance {
+		features = append(features, "maintenance")
+	}
+	if cfg.BreakerFailures > 0 {
+		features = append(features, fmt.Sprintf("circuit breaker (%d failures, %ds cooldown, %ds disconnect grace)",
+			cfg.BreakerFailures, cfg.BreakerCooldown, cfg.DisconnectGrace))
+	}
+	if len(cfg.ConnectOrder) > 0 {
+		features = append(features, fmt.Sprintf("connect_order (%d rules)", len(cfg.ConnectOrder)))
+	}
+	if cfg.AutoConnect {
+		features = append(features, "auto_connect")
+	}
+	if cfg.ConnectOnStart {
+		features = append(features, "auto_connect_on_start")
+	}
+	if cfg.IgnoreEmpty {
+		features = append(features, "ignore_empty_backends")
+	}
+	if cfg.BooleanValueMode == backend.BooleanReject {
+		features = append(features, "boolean_value_mode reject")
+	}
+	if cfg.ExposeReadOnly != nil && !*cfg.ExposeReadOnly {
+		features = append(features, "read-only switches hidden")
+	}
+	if cfg.RequestTimeout > 0 {
+		features = append(features, fmt.Sprintf("request timeout %ds", cfg.RequestTimeout))
+	}
+	if cfg.MaxRequests > 0 {
+		features = append(features, fmt.Sprintf("max %d concurrent requests", cfg.MaxRequests))
+	}
+	if cfg.PowerOnStagger > 0 {
+		features = append(features, fmt.Sprintf("power-on stagger %dms", cfg.PowerOnStagger))
+	}
+	if cfg.HistorySize > 0 {
+		features = append(features, fmt.Sprintf("history (%d per switch)", cfg.HistorySize))
+	}
+	if f := cfg.DebugFaults; f != nil && debugFaults {
+		features = append(features, fmt.Sprintf("debug_faults (%dms latency, %dms jitter, %g%% errors)",
+			f.LatencyMs, f.JitterMs, f.ErrorRate*100))
+	}
+	if len(features) == 0 {
+		features = append(features, "none")
+	}
+	lines = append(lines, "features: "+strings.Join(features, ", "))
+	return lines
+}
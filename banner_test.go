@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStartupBanner(t *testing.T) {
+	cfg := exportTestConfig()
+	cfg.DeviceNumber = 0
+	cfg.APIVersions = []uint32{1}
+	cfg.MiSettings.StateFile = "/var/lib/alpaca/mi.json"
+	cfg.HistorySize = 50
+	cfg.Maintenance = true
+
+	banner := strings.Join(startupBanner(cfg, "settings.json"), "\n")
+	for _, want := range []string{
+		"config: settings.json",
+		"alpaca: port 4567, device number 0, discovery on UDP 32227",
+		"mi: 1 (strip)",
+		"hikvision: 1 (Roof cam)",
+		"persistence: mi state_file /var/lib/alpaca/mi.json",
+		"features: maintenance, history (50 per switch)",
+	} {
+		if !strings.Contains(banner, want) {
+			t.Errorf("banner lacks %q:\n%s", want, banner)
+		}
+	}
+	for _, secret := range []string{"8f3a9c1e5b7d2f4a6c8e0b1d3f5a7c9e", "s3cr3t", "admin", "10.0.0.9"} {
+		if strings.Contains(banner, secret) {
+			t.Errorf("banner leaks %q:\n%s", secret, banner)
+		}
+	}
+}
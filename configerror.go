@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// decodeConfig unmarshals data into cfg. With strict set, fields the config
+// structs do not know are rejected, catching misspelt keys. Errors are
+// rewritten to point at a line and column in the file.
+func decodeConfig(data []byte, cfg *Config, strict bool) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(cfg); err != nil {
+		return describeJSONError(data, err)
+	}
+	return nil
+}
+
+// unknownField matches the error DisallowUnknownFields produces.
+var unknownField = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+
+// describeJSONError turns an encoding/json error into one naming the line,
+// column and (where known) field at fault.
+func describeJSONError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, col := lineCol(data, syntaxErr.Offset)
+		return fmt.Errorf("line %d, column %d: %v (look for a missing or trailing comma, or an unquoted key)", line, col, syntaxErr)
+	case errors.As(err, &typeErr):
+		line, col := lineCol(data, typeErr.Offset)
+		field := typeErr.Field
+		if field == "" {
+			field = "(top level)"
+		}
+		return fmt.Errorf("line %d, column %d: field %q must be %s, got JSON %s", line, col, field, typeErr.Type, typeErr.Value)
+	case errors.Is(err, io.EOF):
+		return errors.New("file is empty")
+	}
+	if m := unknownField.FindStringSubmatch(err.Error()); m != nil {
+		if i := bytes.Index(data, []byte(strconv.Quote(m[1]))); i >= 0 {
+			line, col := lineCol(data, int64(i)+1)
+			return fmt.Errorf("line %d, column %d: unknown field %q", line, col, m[1])
+		}
+		return fmt.Errorf("unknown field %q", m[1])
+	}
+	return err
+}
+
+// lineCol converts a 1-based byte offset as reported by encoding/json
+// (the position just after the offending byte) into a line and column.
+func lineCol(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line, col = 1, 1
+	for _, c := range data[:max(offset-1, 0)] {
+		if c == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config string
+		strict bool
+		want   string
+	}{
+		{"trailing comma", "{\n  \"alpaca_port\": 11111,\n}", false, "line 3, column 1:"},
+		{"wrong type", "{\n  \"device_number\": 0,\n  \"alpaca_port\": \"11111\"\n}", false, `line 3, column 24: field "alpaca_port" must be int`},
+		{"unknown field", "{\n  \"alpaca_port\": 11111,\n  \"alpaka_port\": 1\n}", true, `line 3, column 3: unknown field "alpaka_port"`},
+		{"empty", "", false, "file is empty"},
+	} {
+		var cfg Config
+		err := decodeConfig([]byte(tc.config), &cfg, tc.strict)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error = %v, want one containing %q", tc.name, err, tc.want)
+		}
+	}
+
+	// Unknown fields are only rejected in strict mode.
+	var cfg Config
+	if err := decodeConfig([]byte(`{"alpaka_port": 1, "alpaca_port": 2}`), &cfg, false); err != nil || cfg.AlpacaPort != 2 {
+		t.Errorf("lenient decode = %v (port %d), want no error", err, cfg.AlpacaPort)
+	}
+}
+
+func TestLineCol(t *testing.T) {
+	data := []byte("ab\ncd\nef")
+	for offset, want := range map[int64][2]int{1: {1, 1}, 3: {1, 3}, 4: {2, 1}, 8: {3, 2}, 100: {3, 2}} {
+		if line, col := lineCol(data, offset); line != want[0] || col != want[1] {
+			t.Errorf("lineCol(%d) = %d:%d, want %d:%d", offset, line, col, want[0], want[1])
+		}
+	}
+}
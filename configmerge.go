@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// listKeys are the top-level config keys whose arrays are concatenated
+// across files. Every other key is taken from the last file that sets it;
+// settings objects such as mi_settings are merged key by key.
+var listKeys = map[string]bool{
+	"mi_devices":         true,
+	"hikvision_cameras":  true,
+	"httpjson_switches":  true,
+	"onvif_cameras":      true,
+	"uhubctl_switches":   true,
+	"pdu_switches":       true,
+	"aggregate_switches": true,
+	"connect_order":      true,
+	"switch_order":       true,
+}
+
+// configFiles expands a --config value into the files to load: a
+// comma-separated list of files and directories, where a directory
+// contributes its *.json files in name order.
+func configFiles(path string) ([]string, error) {
+	var files []string
+	for _, p := range strings.Split(path, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", p, err)
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(p, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no *.json config files", p)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no config file given")
+	}
+	return files, nil
+}
+
+// mergeConfigFiles reads files and merges them into one JSON document, in
+// order, so later files take precedence. Each file is checked on its own
+// first so errors name the file at fault. A switch name or uniqueid defined
+// in two different files is an error.
+func mergeConfigFiles(files []string, strict bool) ([]byte, error) {
+	merged := make(map[string]json.RawMessage)
+	origin := make(map[string]string) // key (or key.subkey) -> file that set it
+	owners := make(map[string]string) // conflict key -> file that defined it
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+		var part Config
+		if err := decodeConfig(data, &part, strict); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", file, err)
+		}
+		if err := claimIdentities(&part, file, owners); err != nil {
+			return nil, err
+		}
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", file, err)
+		}
+		if err := mergeDocument(merged, doc, file, origin); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// mergeDocument merges the top-level keys of doc (from file) into merged.
+func mergeDocument(merged, doc map[string]json.RawMessage, file string, origin map[string]string) error {
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := doc[key]
+		prev, exists := merged[key]
+		switch {
+		case !exists:
+			merged[key] = val
+			origin[key] = file
+		case listKeys[key]:
+			var a, b []json.RawMessage
+			if err := json.Unmarshal(prev, &a); err != nil {
+				return fmt.Errorf("merging %s: %s: %w", file, key, err)
+			}
+			if err := json.Unmarshal(val, &b); err != nil {
+				return fmt.Errorf("merging %s: %s: %w", file, key, err)
+			}
+			joined, err := json.Marshal(append(a, b...))
+			if err != nil {
+				return err
+			}
+			merged[key] = joined
+		case isObject(prev) && isObject(val):
+			var a, b map[string]json.RawMessage
+			if err := json.Unmarshal(prev, &a); err != nil {
+				return fmt.Errorf("merging %s: %s: %w", file, key, err)
+			}
+			if err := json.Unmarshal(val, &b); err != nil {
+				return fmt.Errorf("merging %s: %s: %w", file, key, err)
+			}
+			for sub, v := range b {
+				path := key + "." + sub
+				if old, ok := a[sub]; ok && !sameJSON(old, v) {
+					log.Printf("Warning: %s: %s overrides the value from %s", file, path, origin[path])
+				}
+				a[sub] = v
+				origin[path] = file
+			}
+			joined, err := json.Marshal(a)
+			if err != nil {
+				return err
+			}
+			merged[key] = joined
+		default:
+			if !sameJSON(prev, val) {
+				log.Printf("Warning: %s: %s overrides the value from %s", file, key, origin[key])
+			}
+			merged[key] = val
+			origin[key] = file
+		}
+	}
+	return nil
+}
+
+// claimIdentities records the switch names and uniqueids defined by part,
+// failing if another file already defined one of them.
+func claimIdentities(part *Config, file string, owners map[string]string) error {
+	var ids []string
+	for _, d := range part.MiDevices {
+		if len(d.Outlets) == 0 && len(d.Properties) == 0 {
+			ids = append(ids, fmt.Sprintf("switch name %q", d.Name))
+		}
+		for _, o := range d.Outlets {
+			ids = append(ids, fmt.Sprintf("switch name %q", o.Name))
+		}
+		for _, p := range d.Properties {
+			ids = append(ids, fmt.Sprintf("switch name %q", p.Name))
+		}
+		if d.RSSISwitch {
+			name := d.RSSIName
+			if name == "" {
+				name = d.Name + " signal"
+			}
+			ids = append(ids, fmt.Sprintf("switch name %q", name))
+		}
+	}
+	for _, c := range part.HikvisionCameras {
+		ids = append(ids, fmt.Sprintf("switch name %q", c.Name))
+		if c.UniqueID != "" {
+			ids = append(ids, "uniqueid "+c.UniqueID)
+		}
+	}
+	for _, s := range part.HTTPJSONSwitches {
+		ids = append(ids, fmt.Sprintf("switch name %q", s.Name))
+	}
+	for _, c := range part.ONVIFCameras {
+		ids = append(ids, fmt.Sprintf("switch name %q", c.Name))
+		if c.UniqueID != "" {
+			ids = append(ids, "uniqueid "+c.UniqueID)
+		}
+	}
+	for _, s := range part.UhubctlSwitches {
+		ids = append(ids, fmt.Sprintf("switch name %q", s.Name))
+	}
+	for _, s := range part.PDUSwitches {
+		ids = append(ids, fmt.Sprintf("switch name %q", s.Name))
+	}
+	for _, a := range part.AggregateSwitches {
+		ids = append(ids, fmt.Sprintf("switch name %q", a.Name))
+	}
+	for _, id := range ids {
+		if owner, ok := owners[id]; ok && owner != file {
+			return fmt.Errorf("merging %s: %s is also defined in %s", file, id, owner)
+		}
+		owners[id] = file
+	}
+	return nil
+}
+
+func isObject(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) > 0 && raw[0] == '{'
+}
+
+// sameJSON reports whether a and b encode the same value, ignoring layout.
+func sameJSON(a, b json.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
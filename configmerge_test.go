@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigs writes each name/content pair into a new directory.
+func writeConfigs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestMergeConfigDirectory(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{
+		"10-server.json": `{"alpaca_port": 4567, "mi_settings": {"poll_seconds": 10, "save_delay_ms": 100}}`,
+		"20-mi.json":     `{"mi_devices": [{"ip": "10.0.0.5", "token": "8f3a9c1e5b7d2f4a6c8e0b1d3f5a7c9e", "name": "Mount"}], "mi_settings": {"poll_seconds": 30}}`,
+		"30-more.json":   `{"mi_devices": [{"ip": "10.0.0.6", "token": "8f3a9c1e5b7d2f4a6c8e0b1d3f5a7c9f", "name": "Heater"}], "hikvision_cameras": [{"host": "10.0.0.9", "name": "Roof cam"}]}`,
+		"notes.txt":      `not a config file`,
+	})
+	cfg, err := loadConfig(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AlpacaPort != 4567 {
+		t.Errorf("alpaca_port = %d, want 4567", cfg.AlpacaPort)
+	}
+	if len(cfg.MiDevices) != 2 || cfg.MiDevices[0].Name != "Mount" || cfg.MiDevices[1].Name != "Heater" {
+		t.Errorf("mi_devices = %+v, want Mount then Heater", cfg.MiDevices)
+	}
+	if len(cfg.HikvisionCameras) != 1 {
+		t.Errorf("hikvision_cameras = %+v, want the roof camera", cfg.HikvisionCameras)
+	}
+	// Settings objects merge key by key, later files winning.
+	if cfg.MiSettings.PollSeconds != 30 || cfg.MiSettings.SaveDelayMs != 100 {
+		t.Errorf("mi_settings = poll %d, save delay %d; want 30 and 100", cfg.MiSettings.PollSeconds, cfg.MiSettings.SaveDelayMs)
+	}
+}
+
+func TestMergeConfigConflicts(t *testing.T) {
+	a := writeConfigs(t, map[string]string{"a.json": `{"mi_devices": [{"ip": "10.0.0.5", "token": "8f3a9c1e5b7d2f4a6c8e0b1d3f5a7c9e", "name": "Mount"}]}`})
+	b := writeConfigs(t, map[string]string{"b.json": `{"hikvision_cameras": [{"host": "10.0.0.9", "name": "Mount"}]}`})
+	_, err := loadConfig(filepath.Join(a, "a.json")+","+filepath.Join(b, "b.json"), false)
+	if err == nil || !strings.Contains(err.Error(), `switch name "Mount"`) || !strings.Contains(err.Error(), "a.json") {
+		t.Errorf("merging a duplicate switch name = %v, want a conflict naming the first file", err)
+	}
+
+	bad := writeConfigs(t, map[string]string{"a.json": `{}`, "b.json": "{\n  \"alpaca_port\": 1,\n}"})
+	if _, err := loadConfig(bad, false); err == nil || !strings.Contains(err.Error(), "b.json") {
+		t.Errorf("merging a malformed file = %v, want an error naming b.json", err)
+	}
+
+	if _, err := configFiles(t.TempDir()); err == nil {
+		t.Error("configFiles accepted a directory without *.json files")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"alpaca-switch/backend"
+	"alpaca-switch/server"
+)
+
+// ConnectDependency declares that a backend must connect after others, and
+// optionally only once a prerequisite switch (e.g. a PoE switch plug) is on.
+type ConnectDependency struct {
+	Backend       string   `json:"backend"`
+	After         []string `json:"after"`
+	WaitForSwitch string   `json:"wait_for_switch"`
+	WaitSeconds   int      `json:"wait_seconds"`
+}
+
+const defaultPrerequisiteWait = 60 * time.Second
+
+// resolveConnectOrder groups backend type names into stages such that every
+// backend appears in a later stage than everything it depends on. Backends
+// within a stage have no ordering constraint and connect in parallel.
+func resolveConnectOrder(types []string, deps []ConnectDependency) ([][]string, error) {
+	known := make(map[string]bool, len(types))
+	for _, t := range types {
+		known[t] = true
+	}
+	after := make(map[string][]string)
+	for _, d := range deps {
+		if !known[d.Backend] {
+			return nil, fmt.Errorf("connect dependency for unknown backend %q", d.Backend)
+		}
+		for _, a := range d.After {
+			if !known[a] {
+				return nil, fmt.Errorf("backend %q depends on unknown backend %q", d.Backend, a)
+			}
+			after[d.Backend] = append(after[d.Backend], a)
+		}
+	}
+
+	done := make(map[string]bool, len(types))
+	var stages [][]string
+	for len(done) < len(types) {
+		var stage []string
+		for _, t := range types {
+			if done[t] {
+				continue
+			}
+			ready := true
+			for _, a := range after[t] {
+				if !done[a] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				stage = append(stage, t)
+			}
+		}
+		if len(stage) == 0 {
+			var pending []string
+			for _, t := range types {
+				if !done[t] {
+					pending = append(pending, t)
+				}
+			}
+			sort.Strings(pending)
+			return nil, fmt.Errorf("connect dependency cycle between %s", strings.Join(pending, ", "))
+		}
+		for _, t := range stage {
+			done[t] = true
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// buildConnectPlan turns the resolved stages into a server.ConnectPlan,
+// attaching prerequisite-switch waits where configured.
+func buildConnectPlan(router *backend.Router, deps []ConnectDependency) (server.ConnectPlan, error) {
+	byType := make(map[string]backend.SwitchBackend)
+	var types []string
+	for _, b := range router.Backends() {
+		t, ok := b.(backend.Typed)
+		if !ok {
+			continue
+		}
+		byType[t.BackendType()] = b
+		types = append(types, t.BackendType())
+	}
+	stages, err := resolveConnectOrder(types, deps)
+	if err != nil {
+		return nil, err
+	}
+	depByType := make(map[string]ConnectDependency)
+	for _, d := range deps {
+		depByType[d.Backend] = d
+	}
+
+	plan := make(server.ConnectPlan, len(stages))
+	for i, stage := range stages {
+		for _, t := range stage {
+			target := server.ConnectTarget{Backend: byType[t]}
+			if d := depByType[t]; d.WaitForSwitch != "" {
+				id := findSwitchByName(router, d.WaitForSwitch)
+				if id < 0 {
+					return nil, fmt.Errorf("backend %q waits for unknown switch %q", t, d.WaitForSwitch)
+				}
+				timeout := defaultPrerequisiteWait
+				if d.WaitSeconds > 0 {
+					timeout = time.Duration(d.WaitSeconds) * time.Second
+				}
+				target.Prerequisite = waitForSwitchOn(router, id, timeout)
+			}
+			plan[i] = append(plan[i], target)
+		}
+		log.Printf("Connect stage %d: %s", i+1, strings.Join(stage, ", "))
+	}
+	return plan, nil
+}
+
+func findSwitchByName(router *backend.Router, name string) int {
+	for id := 0; id < router.NumSwitches(); id++ {
+		if router.BaseName(id) == name {
+			return id
+		}
+	}
+	return -1
+}
+
+// waitForSwitchOn returns a prerequisite that polls switch id once a second
+// until it reports on, giving up after timeout.
+func waitForSwitchOn(router *backend.Router, id int, timeout time.Duration) func() error {
+	return func() error {
+		deadline := time.Now().Add(timeout)
+		for {
+			if on, err := router.GetSwitch(id); err == nil && on {
+				return nil
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("prerequisite switch %d (%s) not on after %v", id, router.GetName(id), timeout)
+			}
+			time.Sleep(time.Second)
+		}
+	}
+}
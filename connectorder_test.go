@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveConnectOrder(t *testing.T) {
+	types := []string{"mi", "hikvision", "httpjson", "onvif"}
+	for _, tc := range []struct {
+		name string
+		deps []ConnectDependency
+		want [][]string
+	}{
+		{"no dependencies", nil, [][]string{{"mi", "hikvision", "httpjson", "onvif"}}},
+		{
+			"cameras after the PoE plug",
+			[]ConnectDependency{{Backend: "hikvision", After: []string{"mi"}}, {Backend: "onvif", After: []string{"mi"}}},
+			[][]string{{"mi", "httpjson"}, {"hikvision", "onvif"}},
+		},
+		{
+			"chain",
+			[]ConnectDependency{{Backend: "onvif", After: []string{"hikvision"}}, {Backend: "hikvision", After: []string{"mi"}}},
+			[][]string{{"mi", "httpjson"}, {"hikvision"}, {"onvif"}},
+		},
+	} {
+		got, err := resolveConnectOrder(types, tc.deps)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: stages %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestResolveConnectOrderErrors(t *testing.T) {
+	types := []string{"mi", "hikvision"}
+	for _, tc := range []struct {
+		deps []ConnectDependency
+		want string
+	}{
+		{[]ConnectDependency{{Backend: "mi", After: []string{"hikvision"}}, {Backend: "hikvision", After: []string{"mi"}}}, "cycle between hikvision, mi"},
+		{[]ConnectDependency{{Backend: "pdu", After: []string{"mi"}}}, `unknown backend "pdu"`},
+		{[]ConnectDependency{{Backend: "mi", After: []string{"pdu"}}}, `unknown backend "pdu"`},
+	} {
+		_, err := resolveConnectOrder(types, tc.deps)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("deps %+v: error %v, want one containing %q", tc.deps, err, tc.want)
+		}
+	}
+}
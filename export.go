@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"alpaca-switch/backend"
+	"alpaca-switch/backend/hikvision"
+	"alpaca-switch/backend/httpjson"
+	"alpaca-switch/backend/mi"
+	"alpaca-switch/backend/onvif"
+	"alpaca-switch/backend/pdu"
+	"alpaca-switch/backend/uhubctl"
+)
+
+// redacted replaces secrets in a redacted config export.
+const redacted = "REDACTED"
+
+// activeConfig is the most recently loaded config, the base for exports.
+var activeConfig atomic.Pointer[Config]
+
+// exportConfig returns the active config with every device list replaced by
+// the live state of rt's backends, so runtime renames and cached values are
+// kept. Mi power strips and multi-property devices and Hikvision motion and
+// event switches are exported in their expanded form, one entry per switch.
+// With redact set, passwords, tokens and request headers are replaced and
+// the result is not reloadable.
+func exportConfig(rt *backend.Router, redact bool) interface{} {
+	cfg := *activeConfig.Load()
+	for _, b := range rt.Backends() {
+		switch b := b.(type) {
+		case *mi.Backend:
+			cfg.MiDevices = b.Devices()
+			for i := range cfg.MiDevices {
+				cfg.MiDevices[i].Outlets = nil
+				cfg.MiDevices[i].Properties = nil
+				if redact {
+					cfg.MiDevices[i].Token = redacted
+				}
+			}
+		case *hikvision.Backend:
+			cfg.HikvisionCameras = b.Configs()
+			for i := range cfg.HikvisionCameras {
+				c := &cfg.HikvisionCameras[i]
+				c.MotionSwitch, c.MotionName = false, ""
+				c.EventSwitches = nil
+				if redact {
+					c.Password = redacted
+					c.Headers = redactHeaders(c.Headers)
+				}
+			}
+		case *httpjson.Backend:
+			cfg.HTTPJSONSwitches = b.Configs()
+			if redact {
+				for i := range cfg.HTTPJSONSwitches {
+					redactSwitch(&cfg.HTTPJSONSwitches[i])
+				}
+			}
+		case *onvif.Backend:
+			cfg.ONVIFCameras = b.Configs()
+			if redact {
+				for i := range cfg.ONVIFCameras {
+					cfg.ONVIFCameras[i].Password = redacted
+				}
+			}
+		case *uhubctl.Backend:
+			cfg.UhubctlSwitches = b.Configs()
+		case *pdu.Backend:
+			cfg.PDUSwitches = b.Configs()
+			if redact {
+				for i := range cfg.PDUSwitches {
+					cfg.PDUSwitches[i].Community = redacted
+				}
+			}
+		}
+	}
+	cfg.AggregateSwitches = rt.Aggregates()
+	// An empty list would read back as an empty backend section; keep
+	// unused backends unused.
+	if len(cfg.MiDevices) == 0 {
+		cfg.MiDevices = nil
+	}
+	if len(cfg.HikvisionCameras) == 0 {
+		cfg.HikvisionCameras = nil
+	}
+	if len(cfg.HTTPJSONSwitches) == 0 {
+		cfg.HTTPJSONSwitches = nil
+	}
+	if len(cfg.ONVIFCameras) == 0 {
+		cfg.ONVIFCameras = nil
+	}
+	if len(cfg.UhubctlSwitches) == 0 {
+		cfg.UhubctlSwitches = nil
+	}
+	if len(cfg.PDUSwitches) == 0 {
+		cfg.PDUSwitches = nil
+	}
+	return &cfg
+}
+
+// redactSwitch masks the credentials and request headers of an HTTP/JSON
+// switch. Request templates are copied so the live config is untouched.
+func redactSwitch(s *httpjson.SwitchConfig) {
+	if s.Auth.Password != "" {
+		s.Auth.Password = redacted
+	}
+	if s.Auth.Token != "" {
+		s.Auth.Token = redacted
+	}
+	for _, t := range []**httpjson.RequestTemplate{&s.Set, &s.On, &s.Off} {
+		if *t != nil {
+			cp := **t
+			cp.Headers = redactHeaders(cp.Headers)
+			*t = &cp
+		}
+	}
+	if s.Get != nil {
+		cp := *s.Get
+		cp.Headers = redactHeaders(cp.Headers)
+		s.Get = &cp
+	}
+}
+
+// redactHeaders returns a copy of headers with every value masked.
+func redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	out := make(map[string]string, len(headers))
+	for k := range headers {
+		out[k] = redacted
+	}
+	return out
+}
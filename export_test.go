@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"alpaca-switch/backend"
+	"alpaca-switch/backend/hikvision"
+	"alpaca-switch/backend/mi"
+)
+
+func exportTestConfig() *Config {
+	return &Config{
+		AlpacaPort: 4567,
+		MiDevices: []mi.Device{{IP: "10.0.0.5", Token: "8f3a9c1e5b7d2f4a6c8e0b1d3f5a7c9e", Name: "strip", Outlets: []mi.Outlet{
+			{Channel: 2, Name: "Mount", Value: 1},
+			{Channel: 3, Name: "Heater"},
+		}}},
+		HikvisionCameras: []hikvision.CameraConfig{{Name: "Roof cam", Host: "10.0.0.9", Username: "admin", Password: "s3cr3t", MotionSwitch: true}},
+	}
+}
+
+// Exporting the live state and loading the result gives a router with the
+// same switches, names and values, including runtime renames.
+func TestExportRoundTrip(t *testing.T) {
+	cfg := exportTestConfig()
+	activeConfig.Store(cfg)
+	rt := backend.NewRouter(lintBackends(cfg), backend.Options{})
+	if err := rt.SetName(1, "Dew heater"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(exportConfig(rt, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadConfig(path, true)
+	if err != nil {
+		t.Fatalf("loading the export: %v\n%s", err, data)
+	}
+	if loaded.AlpacaPort != 4567 {
+		t.Errorf("alpaca_port = %d after the round trip, want 4567", loaded.AlpacaPort)
+	}
+	again := backend.NewRouter(lintBackends(loaded), backend.Options{})
+	if again.NumSwitches() != rt.NumSwitches() {
+		t.Fatalf("%d switches after the round trip, want %d", again.NumSwitches(), rt.NumSwitches())
+	}
+	for id := 0; id < rt.NumSwitches(); id++ {
+		v1, _ := rt.GetSwitchValue(id)
+		v2, _ := again.GetSwitchValue(id)
+		if rt.GetName(id) != again.GetName(id) || v1 != v2 {
+			t.Errorf("switch %d: %q = %v before, %q = %v after", id, rt.GetName(id), v1, again.GetName(id), v2)
+		}
+	}
+	if loaded.HikvisionCameras[0].Password != "s3cr3t" {
+		t.Error("unredacted export lost the camera password")
+	}
+}
+
+func TestExportRedacts(t *testing.T) {
+	cfg := exportTestConfig()
+	activeConfig.Store(cfg)
+	rt := backend.NewRouter(lintBackends(cfg), backend.Options{})
+
+	data, err := json.Marshal(exportConfig(rt, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"8f3a9c1e5b7d2f4a6c8e0b1d3f5a7c9e", "s3cr3t"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("redacted export contains %q:\n%s", secret, data)
+		}
+	}
+	if cfg.HikvisionCameras[0].Password != "s3cr3t" {
+		t.Error("redacting changed the live config")
+	}
+}
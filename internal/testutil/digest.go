@@ -0,0 +1,43 @@
+package testutil
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// digestRealm and digestNonce make up the fake camera's Digest challenge.
+// A fixed nonce is enough for tests.
+const (
+	digestRealm = "IP Camera"
+	digestNonce = "4e6f6e6365466f7254657374"
+)
+
+// digestValid reports whether r carries a Digest Authorization header
+// (qop "auth") answering the fake's challenge for user and pass.
+func digestValid(r *http.Request, user, pass string) bool {
+	header, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Digest ")
+	if !ok {
+		return false
+	}
+	f := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			f[k] = strings.Trim(v, `"`)
+		}
+	}
+	if f["username"] != user || f["realm"] != digestRealm || f["nonce"] != digestNonce {
+		return false
+	}
+	ha1 := md5Hex(user + ":" + digestRealm + ":" + pass)
+	ha2 := md5Hex(r.Method + ":" + f["uri"])
+	want := md5Hex(strings.Join([]string{ha1, digestNonce, f["nc"], f["cnonce"], f["qop"], ha2}, ":"))
+	return f["response"] == want
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
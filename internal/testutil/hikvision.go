@@ -0,0 +1,478 @@
+package testutil
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Hikvision is a fake Hikvision camera serving the ISAPI Hardware service
+// (IR light on/off), the imaging IR-cut filter, the image supplement-light
+// service (brightness), motion detection, device info, device status
+// (temperature) and the alarm event stream. It requires Digest
+// authentication only when Password is set.
+type Hikvision struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// IRMode is the IrLightSwitch mode: "open" (on) or "close" (off).
+	IRMode string
+	// NoHardware makes /ISAPI/System/Hardware answer 404, like firmware
+	// that only offers the imaging IR-cut filter.
+	NoHardware bool
+	// IrcutFilterType is the IR-cut filter mode: "day", "night" or "auto".
+	IrcutFilterType string
+	// IRBrightness and WhiteBrightness are the supplement-light levels (0-100).
+	IRBrightness    int
+	WhiteBrightness int
+	// LightMode is the supplementLightMode: "irLight", "colorVuWhiteLight"
+	// or "close".
+	LightMode string
+	// MotionEnabled is the motion-detection state; MotionDocument is the
+	// body of the last motionDetection PUT.
+	MotionEnabled  bool
+	MotionDocument string
+	// Temperature is the internal temperature reported by /ISAPI/System/status.
+	Temperature float64
+	// Model, Serial and Firmware are reported by /ISAPI/System/deviceInfo.
+	Model    string
+	Serial   string
+	Firmware string
+	// Username and Password, with Password set, are the Digest credentials
+	// every request must carry; others are answered 401 with a challenge.
+	Username string
+	Password string
+	// FailStatus, if non-zero, is returned for every request instead of
+	// a normal response, to simulate camera errors.
+	FailStatus int
+	// FailPuts maps request paths to a status returned for PUTs to them,
+	// to simulate one of the camera's services rejecting writes.
+	FailPuts map[string]int
+	// Requests records "METHOD /path" for every request received.
+	Requests []string
+
+	// streams are the open alarm streams; SendEvent writes to each.
+	streams map[chan string]bool
+}
+
+// NewHikvision starts a fake camera with the IR light off. Close it when done.
+func NewHikvision() *Hikvision {
+	h := &Hikvision{
+		IRMode:          "close",
+		IrcutFilterType: "day",
+		LightMode:       "irLight",
+		Model:           "DS-2CD2343G0-I",
+		Serial:          "DS-2CD2343G0-I20200101AAWRD00000000",
+		Firmware:        "V5.5.0",
+		Temperature:     21.5,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ISAPI/System/Hardware", h.handleHardware)
+	mux.HandleFunc("/ISAPI/Image/channels/1/IrcutFilter", h.handleIrcutFilter)
+	mux.HandleFunc("/ISAPI/Image/channels/1/supplementLight", h.handleSupplementLight)
+	mux.HandleFunc("/ISAPI/System/Video/inputs/channels/1/motionDetection", h.handleMotionDetection)
+	mux.HandleFunc("/ISAPI/System/deviceInfo", h.handleDeviceInfo)
+	mux.HandleFunc("/ISAPI/System/status", h.handleDeviceStatus)
+	mux.HandleFunc("/ISAPI/Event/notification/alertStream", h.handleAlertStream)
+	h.Server = httptest.NewServer(h.record(mux))
+	return h
+}
+
+// Host returns the camera address in CameraConfig.Host form ("127.0.0.1:port").
+func (h *Hikvision) Host() string {
+	return strings.TrimPrefix(h.URL, "http://")
+}
+
+// Lock and Unlock guard the exported fields while the server is running.
+func (h *Hikvision) Lock()   { h.mu.Lock() }
+func (h *Hikvision) Unlock() { h.mu.Unlock() }
+
+func (h *Hikvision) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		h.Requests = append(h.Requests, r.Method+" "+r.URL.Path)
+		fail := h.FailStatus
+		if r.Method == http.MethodPut && h.FailPuts[r.URL.Path] != 0 {
+			fail = h.FailPuts[r.URL.Path]
+		}
+		user, pass := h.Username, h.Password
+		h.mu.Unlock()
+		if fail != 0 {
+			http.Error(w, http.StatusText(fail), fail)
+			return
+		}
+		if pass != "" && !digestValid(r, user, pass) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm=%q, qop="auth", nonce=%q`, digestRealm, digestNonce))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type hardwareService struct {
+	XMLName       xml.Name `xml:"HardwareService"`
+	IrLightSwitch struct {
+		Mode string `xml:"mode"`
+	} `xml:"IrLightSwitch"`
+}
+
+func (h *Hikvision) handleHardware(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	missing := h.NoHardware
+	h.mu.Unlock()
+	if missing {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		var doc hardwareService
+		h.mu.Lock()
+		doc.IrLightSwitch.Mode = h.IRMode
+		h.mu.Unlock()
+		writeXML(w, doc)
+	case http.MethodPut:
+		var doc hardwareService
+		if err := decodeXML(r, &doc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if doc.IrLightSwitch.Mode != "open" && doc.IrLightSwitch.Mode != "close" {
+			http.Error(w, "invalid mode", http.StatusBadRequest)
+			return
+		}
+		h.mu.Lock()
+		h.IRMode = doc.IrLightSwitch.Mode
+		h.mu.Unlock()
+		writeResponseStatus(w)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+const ircutFilterTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<IrcutFilter version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<IrcutFilterType>%s</IrcutFilterType>
+<nightToDayFilterLevel>4</nightToDayFilterLevel>
+<nightToDayFilterTime>5</nightToDayFilterTime>
+</IrcutFilter>
+`
+
+var ircutFilterTypeElement = regexp.MustCompile(`<IrcutFilterType>\s*(\w+)\s*</`)
+
+func (h *Hikvision) handleIrcutFilter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.mu.Lock()
+		body := fmt.Sprintf(ircutFilterTemplate, h.IrcutFilterType)
+		h.mu.Unlock()
+		w.Header().Set("Content-Type", "application/xml")
+		io.WriteString(w, body)
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		m := ircutFilterTypeElement.FindSubmatch(body)
+		if m == nil {
+			http.Error(w, "no IrcutFilterType element", http.StatusBadRequest)
+			return
+		}
+		switch mode := string(m[1]); mode {
+		case "day", "night", "auto":
+			h.mu.Lock()
+			h.IrcutFilterType = mode
+			h.mu.Unlock()
+			writeResponseStatus(w)
+		default:
+			http.Error(w, "invalid IrcutFilterType", http.StatusBadRequest)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+const supplementLightTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<SupplementLight version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<supplementLightMode>%s</supplementLightMode>
+<mixedLightBrightnessRegulatMode>manual</mixedLightBrightnessRegulatMode>
+<whiteLightBrightness>%d</whiteLightBrightness>
+<irLightBrightness>%d</irLightBrightness>
+</SupplementLight>
+`
+
+var lightModeElement = regexp.MustCompile(`<supplementLightMode>\s*(\w+)\s*</`)
+
+var brightnessElement = regexp.MustCompile(`<(irLightBrightness|whiteLightBrightness)>\s*(-?\d+)\s*</`)
+
+func (h *Hikvision) handleSupplementLight(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.mu.Lock()
+		body := fmt.Sprintf(supplementLightTemplate, h.LightMode, h.WhiteBrightness, h.IRBrightness)
+		h.mu.Unlock()
+		w.Header().Set("Content-Type", "application/xml")
+		io.WriteString(w, body)
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		matches := brightnessElement.FindAllSubmatch(body, -1)
+		if len(matches) == 0 {
+			http.Error(w, "no brightness element", http.StatusBadRequest)
+			return
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if m := lightModeElement.FindSubmatch(body); m != nil {
+			h.LightMode = string(m[1])
+		}
+		for _, m := range matches {
+			v, _ := strconv.Atoi(string(m[2]))
+			if v < 0 || v > 100 {
+				http.Error(w, "brightness out of range", http.StatusBadRequest)
+				return
+			}
+			if string(m[1]) == "irLightBrightness" {
+				h.IRBrightness = v
+			} else {
+				h.WhiteBrightness = v
+			}
+		}
+		writeResponseStatus(w)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// motionDetectionTemplate mirrors a real camera's document, including the
+// nested <enabled> elements that must be left alone.
+const motionDetectionTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<MotionDetection version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<enabled>%t</enabled>
+<enableHighlight>false</enableHighlight>
+<samplingInterval>2</samplingInterval>
+<startTriggerTime>500</startTriggerTime>
+<endTriggerTime>500</endTriggerTime>
+<regionType>grid</regionType>
+<Grid>
+<rowGranularity>18</rowGranularity>
+<columnGranularity>22</columnGranularity>
+</Grid>
+<MotionDetectionLayout version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<sensitivityLevel>60</sensitivityLevel>
+<layout>
+<gridMap>fffffcfffffcfffffcfffffcfffffcfffffcfffffcfffffcfffffcfffffcfffffcfffffcfffffcfffffcfffffcfffffcfffffcfffffc</gridMap>
+</layout>
+<targetType>human,vehicle</targetType>
+</MotionDetectionLayout>
+<HumanRecognitionModeSearchCfg>
+<enabled>false</enabled>
+</HumanRecognitionModeSearchCfg>
+</MotionDetection>
+`
+
+var motionEnabledElement = regexp.MustCompile(`<enabled>\s*(true|false)\s*</enabled>`)
+
+func (h *Hikvision) handleMotionDetection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.mu.Lock()
+		body := fmt.Sprintf(motionDetectionTemplate, h.MotionEnabled)
+		h.mu.Unlock()
+		w.Header().Set("Content-Type", "application/xml")
+		io.WriteString(w, body)
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		m := motionEnabledElement.FindSubmatch(body)
+		if m == nil {
+			http.Error(w, "no enabled element", http.StatusBadRequest)
+			return
+		}
+		h.mu.Lock()
+		h.MotionEnabled = string(m[1]) == "true"
+		h.MotionDocument = string(body)
+		h.mu.Unlock()
+		writeResponseStatus(w)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Hikvision) handleDeviceInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	type deviceInfo struct {
+		XMLName         xml.Name `xml:"DeviceInfo"`
+		DeviceName      string   `xml:"deviceName"`
+		Model           string   `xml:"model"`
+		SerialNumber    string   `xml:"serialNumber"`
+		MACAddress      string   `xml:"macAddress"`
+		FirmwareVersion string   `xml:"firmwareVersion"`
+	}
+	h.mu.Lock()
+	doc := deviceInfo{
+		DeviceName:      "IP CAMERA",
+		Model:           h.Model,
+		SerialNumber:    h.Serial,
+		MACAddress:      "00:11:22:33:44:55",
+		FirmwareVersion: h.Firmware,
+	}
+	h.mu.Unlock()
+	writeXML(w, doc)
+}
+
+// deviceStatusTemplate mirrors the DeviceStatus document of a real camera,
+// with the temperature among CPU and memory figures.
+const deviceStatusTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<DeviceStatus version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<currentDeviceTime>2024-01-01T00:00:00+00:00</currentDeviceTime>
+<deviceUpTime>86400</deviceUpTime>
+<CPUList>
+<CPU>
+<cpuDescription>ARM</cpuDescription>
+<cpuUtilization>12</cpuUtilization>
+</CPU>
+</CPUList>
+<MemoryList>
+<Memory>
+<memoryDescription>DDR Memory</memoryDescription>
+<memoryUsage>120.000</memoryUsage>
+<memoryAvailable>392.000</memoryAvailable>
+</Memory>
+</MemoryList>
+<deviceTemperature>%.1f</deviceTemperature>
+</DeviceStatus>
+`
+
+func (h *Hikvision) handleDeviceStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.mu.Lock()
+	body := fmt.Sprintf(deviceStatusTemplate, h.Temperature)
+	h.mu.Unlock()
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, body)
+}
+
+const eventAlertTemplate = `--boundary
+Content-Type: application/xml; charset="UTF-8"
+Content-Length: %d
+
+%s
+`
+
+const eventNotificationTemplate = `<EventNotificationAlert version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<ipAddress>192.168.1.64</ipAddress>
+<portNo>80</portNo>
+<protocol>HTTP</protocol>
+<channelID>1</channelID>
+<dateTime>2024-01-01T00:00:00+00:00</dateTime>
+<activePostCount>1</activePostCount>
+<eventType>%s</eventType>
+<eventState>%s</eventState>
+<eventDescription>%s alarm</eventDescription>
+</EventNotificationAlert>`
+
+// SendEvent writes an EventNotificationAlert with the given eventType (e.g.
+// "VMD", "shelteralarm", "videoloss") and eventState ("active" or
+// "inactive") to every open alarm stream.
+func (h *Hikvision) SendEvent(eventType, state string) {
+	doc := fmt.Sprintf(eventNotificationTemplate, eventType, state, eventType)
+	part := fmt.Sprintf(eventAlertTemplate, len(doc), doc)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.streams {
+		select {
+		case ch <- part:
+		default: // the client is not reading; drop the event
+		}
+	}
+}
+
+// CloseEventStreams ends every open alarm stream, as a camera reboot would.
+func (h *Hikvision) CloseEventStreams() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.streams {
+		close(ch)
+		delete(h.streams, ch)
+	}
+}
+
+// EventStreams returns the number of open alarm streams.
+func (h *Hikvision) EventStreams() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.streams)
+}
+
+func (h *Hikvision) handleAlertStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ch := make(chan string, 16)
+	h.mu.Lock()
+	if h.streams == nil {
+		h.streams = make(map[chan string]bool)
+	}
+	h.streams[ch] = true
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.streams, ch)
+		h.mu.Unlock()
+	}()
+	w.Header().Set("Content-Type", "multipart/mixed; boundary=boundary")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case part, ok := <-ch:
+			if !ok {
+				return
+			}
+			io.WriteString(w, part)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func decodeXML(r *http.Request, v interface{}) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(body, v)
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, xml.Header)
+	w.Write(data)
+}
+
+// writeResponseStatus sends the ISAPI success document returned by PUTs.
+func writeResponseStatus(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, xml.Header+`<ResponseStatus version="2.0"><statusCode>1</statusCode><statusString>OK</statusString></ResponseStatus>`)
+}
@@ -0,0 +1,241 @@
+package testutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// miIOPort is the fixed UDP port miIO devices listen on.
+const miIOPort = 54321
+
+// MiIO is a fake Xiaomi miIO device. It answers the hello handshake and
+// encrypted commands: set_power and get_prop "power" drive Power,
+// set_properties and get_properties drive Outlets (power-strip sockets by
+// siid) and Properties (any siid/piid), and any method listed in Results
+// returns that raw result.
+type MiIO struct {
+	conn  *net.UDPConn
+	token []byte
+
+	mu sync.Mutex
+	// Power is the plug state, "on" or "off".
+	Power string
+	// Outlets holds the state of each power-strip outlet, keyed by siid.
+	// Only outlets present in the map exist.
+	Outlets map[int]bool
+	// Properties holds other MIoT property values (bool or float64), e.g.
+	// a fan's speed level. Only properties present in the map exist.
+	Properties map[MIoTProperty]interface{}
+	// Results maps extra method names to the raw JSON "result" to return.
+	Results map[string]json.RawMessage
+	// Silent, when true, drops every packet to simulate an offline device.
+	Silent bool
+	// Methods records the method of every command received, and Params
+	// the matching params.
+	Methods []string
+	Params  [][]interface{}
+}
+
+// MIoTProperty addresses a MIoT property by service and property ID.
+type MIoTProperty struct {
+	SIID, PIID int
+}
+
+// NewMiIO starts a fake plug with the given 32-hex-digit token, listening on
+// ip:54321. Because miIO uses a fixed port, each fake needs its own loopback
+// address, e.g. "127.0.0.2". Close it when done.
+func NewMiIO(ip, token string) (*MiIO, error) {
+	return NewMiIOPort(ip, miIOPort, token)
+}
+
+// NewMiIOPort starts a fake plug like NewMiIO but on a non-standard port,
+// as for a relay or port-forwarded device. Port 0 picks a free port; read
+// it back with Port.
+func NewMiIOPort(ip string, port int, token string) (*MiIO, error) {
+	tokenBytes, err := hex.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("decoding token: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(ip), Port: port})
+	if err != nil {
+		return nil, err
+	}
+	m := &MiIO{conn: conn, token: tokenBytes, Power: "off", Outlets: map[int]bool{}, Properties: map[MIoTProperty]interface{}{}, Results: map[string]json.RawMessage{}}
+	go m.serve()
+	return m, nil
+}
+
+// Port returns the UDP port the fake listens on.
+func (m *MiIO) Port() int { return m.conn.LocalAddr().(*net.UDPAddr).Port }
+
+// Close stops the responder.
+func (m *MiIO) Close() error { return m.conn.Close() }
+
+// Lock and Unlock guard the exported fields while the responder is running.
+func (m *MiIO) Lock()   { m.mu.Lock() }
+func (m *MiIO) Unlock() { m.mu.Unlock() }
+
+var (
+	miDeviceID = []byte{0x01, 0x02, 0x03, 0x04}
+	miStamp    = []byte{0x00, 0x00, 0x10, 0x00}
+)
+
+func (m *MiIO) serve() {
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			return // closed
+		}
+		m.mu.Lock()
+		silent := m.Silent
+		m.mu.Unlock()
+		if silent || n < 32 {
+			continue
+		}
+		if n == 32 {
+			m.conn.WriteToUDP(m.packet(nil), addr)
+			continue
+		}
+		reply, err := m.handle(buf[32:n])
+		if err != nil {
+			continue
+		}
+		m.conn.WriteToUDP(reply, addr)
+	}
+}
+
+func (m *MiIO) handle(encrypted []byte) ([]byte, error) {
+	plain, err := m.crypt(encrypted, false)
+	if err != nil {
+		return nil, err
+	}
+	var cmd struct {
+		ID     int           `json:"id"`
+		Method string        `json:"method"`
+		Params []interface{} `json:"params"`
+	}
+	if err := json.Unmarshal(plain, &cmd); err != nil {
+		return nil, err
+	}
+	resp := map[string]interface{}{"id": cmd.ID}
+	m.mu.Lock()
+	m.Methods = append(m.Methods, cmd.Method)
+	m.Params = append(m.Params, cmd.Params)
+	switch {
+	case cmd.Method == "set_power" && len(cmd.Params) == 1 && (cmd.Params[0] == "on" || cmd.Params[0] == "off"):
+		m.Power = cmd.Params[0].(string)
+		resp["result"] = []string{"ok"}
+	case cmd.Method == "get_prop":
+		resp["result"] = []string{m.Power}
+	case cmd.Method == "set_properties" || cmd.Method == "get_properties":
+		resp["result"] = m.properties(cmd.Method == "set_properties", cmd.Params)
+	case m.Results[cmd.Method] != nil:
+		resp["result"] = m.Results[cmd.Method]
+	default:
+		resp["error"] = map[string]interface{}{"code": -32601, "message": "Method not found."}
+	}
+	m.mu.Unlock()
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := m.crypt(data, true)
+	if err != nil {
+		return nil, err
+	}
+	return m.packet(sealed), nil
+}
+
+// properties answers a MIoT get/set_properties call against Properties,
+// then Outlets (power, piid 1, by siid). Unknown properties report code
+// -4004.
+func (m *MiIO) properties(set bool, params []interface{}) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, p := range params {
+		prop, _ := p.(map[string]interface{})
+		siid, _ := prop["siid"].(float64)
+		piid, _ := prop["piid"].(float64)
+		r := map[string]interface{}{"did": prop["did"], "siid": siid, "piid": piid, "code": 0}
+		key := MIoTProperty{SIID: int(siid), PIID: int(piid)}
+		if v, ok := m.Properties[key]; ok {
+			if set {
+				m.Properties[key] = prop["value"]
+			} else {
+				r["value"] = v
+			}
+			out = append(out, r)
+			continue
+		}
+		on, ok := m.Outlets[int(siid)]
+		if piid != 1 {
+			ok = false
+		}
+		switch {
+		case !ok:
+			r["code"] = -4004
+		case set:
+			v, _ := prop["value"].(bool)
+			m.Outlets[int(siid)] = v
+		default:
+			r["value"] = on
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// packet frames payload the way a device does; a nil payload is a hello reply.
+func (m *MiIO) packet(payload []byte) []byte {
+	pkt := make([]byte, 32+len(payload))
+	pkt[0], pkt[1] = 0x21, 0x31
+	pkt[2], pkt[3] = byte(len(pkt)>>8), byte(len(pkt))
+	copy(pkt[8:12], miDeviceID)
+	copy(pkt[12:16], miStamp)
+	copy(pkt[32:], payload)
+	if payload == nil {
+		copy(pkt[16:32], m.token)
+		return pkt
+	}
+	sum := md5.Sum(append(append(append([]byte{}, pkt[:16]...), m.token...), payload...))
+	copy(pkt[16:32], sum[:])
+	return pkt
+}
+
+// crypt AES-CBC encrypts (with PKCS7 padding) or decrypts data using the
+// MD5-derived key and IV of the miIO protocol.
+func (m *MiIO) crypt(data []byte, encrypt bool) ([]byte, error) {
+	key := md5.Sum(m.token)
+	iv := md5.Sum(append(key[:], m.token...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	if encrypt {
+		pad := aes.BlockSize - len(data)%aes.BlockSize
+		padded := append(append([]byte{}, data...), make([]byte, pad)...)
+		for i := len(data); i < len(padded); i++ {
+			padded[i] = byte(pad)
+		}
+		out := make([]byte, len(padded))
+		cipher.NewCBCEncrypter(block, iv[:]).CryptBlocks(out, padded)
+		return out, nil
+	}
+	if len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("ciphertext is not a multiple of the block size")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv[:]).CryptBlocks(out, data)
+	if n := len(out); n > 0 {
+		if pad := int(out[n-1]); pad > 0 && pad <= aes.BlockSize && pad <= n {
+			out = out[:n-pad]
+		}
+	}
+	return out, nil
+}
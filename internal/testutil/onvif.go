@@ -0,0 +1,107 @@
+package testutil
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ONVIF is a fake ONVIF camera serving the device, media and imaging
+// services the onvif backend uses: GetCapabilities, GetVideoSources,
+// GetImagingSettings and SetImagingSettings. Every service shares one
+// endpoint, which the device service advertises as both XAddrs.
+type ONVIF struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// IrCutFilter is the IR cut filter mode: "ON", "OFF" or "AUTO".
+	IrCutFilter string
+	// VideoSource is the token of the camera's only video source.
+	VideoSource string
+	// NoImaging leaves the imaging service out of GetCapabilities.
+	NoImaging bool
+	// Fault, if set, is answered as a SOAP fault to every request.
+	Fault string
+	// Requests records the SOAP operation of every request received, e.g.
+	// "SetImagingSettings".
+	Requests []string
+	// Authenticated records, per request, whether it carried a WS-Security
+	// UsernameToken.
+	Authenticated []bool
+	// SetSources records the VideoSourceToken of each SetImagingSettings.
+	SetSources []string
+}
+
+// NewONVIF starts a fake camera in day mode (IR cut filter on). Close it
+// when done.
+func NewONVIF() *ONVIF {
+	o := &ONVIF{IrCutFilter: "ON", VideoSource: "VideoSource_1"}
+	o.Server = httptest.NewServer(http.HandlerFunc(o.handle))
+	return o
+}
+
+// Host returns the camera address in CameraConfig.Host form ("127.0.0.1:port").
+func (o *ONVIF) Host() string {
+	return strings.TrimPrefix(o.URL, "http://")
+}
+
+// Lock and Unlock guard the exported fields while the server is running.
+func (o *ONVIF) Lock()   { o.mu.Lock() }
+func (o *ONVIF) Unlock() { o.mu.Unlock() }
+
+var (
+	soapOperation = regexp.MustCompile(`<s:Body>\s*<(\w+)`)
+	soapSource    = regexp.MustCompile(`<VideoSourceToken>([^<]*)</VideoSourceToken>`)
+	soapIrCut     = regexp.MustCompile(`<tt:IrCutFilter>([^<]*)</tt:IrCutFilter>`)
+)
+
+func (o *ONVIF) handle(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+	body := string(data)
+	op := ""
+	if m := soapOperation.FindStringSubmatch(body); m != nil {
+		op = m[1]
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.Requests = append(o.Requests, op)
+	o.Authenticated = append(o.Authenticated, strings.Contains(body, "<UsernameToken>"))
+	if o.Fault != "" {
+		w.WriteHeader(http.StatusInternalServerError)
+		writeSOAP(w, `<Fault><Reason><Text>`+o.Fault+`</Text></Reason></Fault>`)
+		return
+	}
+
+	switch op {
+	case "GetCapabilities":
+		imaging := ""
+		if !o.NoImaging {
+			imaging = `<Imaging><XAddr>` + o.URL + `/onvif/imaging</XAddr></Imaging>`
+		}
+		writeSOAP(w, `<GetCapabilitiesResponse><Capabilities><Media><XAddr>`+o.URL+`/onvif/media</XAddr></Media>`+imaging+`</Capabilities></GetCapabilitiesResponse>`)
+	case "GetVideoSources":
+		writeSOAP(w, fmt.Sprintf(`<GetVideoSourcesResponse><VideoSources token=%q/></GetVideoSourcesResponse>`, o.VideoSource))
+	case "GetImagingSettings":
+		writeSOAP(w, `<GetImagingSettingsResponse><ImagingSettings><IrCutFilter>`+o.IrCutFilter+`</IrCutFilter></ImagingSettings></GetImagingSettingsResponse>`)
+	case "SetImagingSettings":
+		if m := soapSource.FindStringSubmatch(body); m != nil {
+			o.SetSources = append(o.SetSources, m[1])
+		}
+		if m := soapIrCut.FindStringSubmatch(body); m != nil {
+			o.IrCutFilter = m[1]
+		}
+		writeSOAP(w, `<SetImagingSettingsResponse/>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		writeSOAP(w, `<Fault><Reason><Text>unsupported operation `+op+`</Text></Reason></Fault>`)
+	}
+}
+
+func writeSOAP(w http.ResponseWriter, body string) {
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>%s</s:Body></s:Envelope>`, body)
+}
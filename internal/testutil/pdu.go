@@ -0,0 +1,293 @@
+package testutil
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// APC PowerNet MIB objects the fake PDU serves, followed by the outlet
+// number.
+const (
+	apcOutletState   = ".1.3.6.1.4.1.318.1.1.12.3.5.1.1.4."
+	apcOutletCommand = ".1.3.6.1.4.1.318.1.1.12.3.3.1.1.4."
+)
+
+// PDU is a fake APC Switched Rack PDU SNMP agent. It answers SNMP v1 and
+// v2c Get and Set requests for the rPDU outlet objects: a Get of
+// rPDUOutletStatusOutletState reads Outlets (1 = on, 2 = off) and a Set of
+// rPDUOutletControlOutletCommand drives them (1 = on, 2 = off, 3 = reboot,
+// which leaves the outlet on). Like a real agent it ignores requests with
+// the wrong community.
+type PDU struct {
+	conn *net.UDPConn
+
+	mu sync.Mutex
+	// Community is the community the agent accepts (default "private").
+	Community string
+	// Outlets holds the state of each outlet, keyed by outlet number. Only
+	// outlets present in the map exist.
+	Outlets map[int]bool
+	// Silent, when true, drops every packet to simulate an offline PDU.
+	Silent bool
+	// IgnoreSets acknowledges that many further outlet commands without
+	// switching the outlet, like a PDU that misses a command.
+	IgnoreSets int
+	// Requests records every request the agent answered, e.g.
+	// "get .1.3.6.1.4.1.318.1.1.12.3.5.1.1.4.1" or
+	// "set .1.3.6.1.4.1.318.1.1.12.3.3.1.1.4.1 = 2".
+	Requests []string
+}
+
+// NewPDU starts a fake PDU on a free UDP port of 127.0.0.1. Close it when
+// done.
+func NewPDU() (*PDU, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	p := &PDU{conn: conn, Community: "private", Outlets: map[int]bool{}}
+	go p.serve()
+	return p, nil
+}
+
+// Host returns the agent's address as host:port, for a PDU switch config.
+func (p *PDU) Host() string { return p.conn.LocalAddr().String() }
+
+// Close stops the agent.
+func (p *PDU) Close() error { return p.conn.Close() }
+
+// Lock and Unlock guard the exported fields while the agent is running.
+func (p *PDU) Lock()   { p.mu.Lock() }
+func (p *PDU) Unlock() { p.mu.Unlock() }
+
+func (p *PDU) serve() {
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if reply := p.handle(buf[:n]); reply != nil {
+			p.conn.WriteToUDP(reply, from)
+		}
+	}
+}
+
+// handle answers one request, or returns nil to drop it.
+func (p *PDU) handle(msg []byte) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Silent {
+		return nil
+	}
+	top, _, ok := berSplit(msg)
+	if !ok || top.tag != 0x30 {
+		return nil
+	}
+	fields := berElements(top.content)
+	if len(fields) != 3 || string(fields[1].content) != p.Community {
+		return nil
+	}
+	version := berInt(fields[0].content)
+	pduTag := fields[2].tag
+	pdu := berElements(fields[2].content)
+	if len(pdu) != 4 {
+		return nil
+	}
+	binds := berElements(pdu[3].content)
+	if len(binds) != 1 {
+		return nil
+	}
+	bind := berElements(binds[0].content)
+	if len(bind) != 2 {
+		return nil
+	}
+	oid := berOID(bind[0].content)
+
+	var status int64
+	value := berTLV(0x81, nil) // noSuchInstance
+	switch pduTag {
+	case 0xa0: // GetRequest
+		p.Requests = append(p.Requests, "get "+oid)
+		if on, exists := p.outlet(oid, apcOutletState); exists {
+			state := int64(2)
+			if on {
+				state = 1
+			}
+			value = berTLV(0x02, berEncodeInt(state))
+		}
+	case 0xa3: // SetRequest
+		cmd := berInt(bind[1].content)
+		p.Requests = append(p.Requests, fmt.Sprintf("set %s = %d", oid, cmd))
+		value = bind[1].encoded
+		n, err := strconv.Atoi(strings.TrimPrefix(oid, apcOutletCommand))
+		switch {
+		case !strings.HasPrefix(oid, apcOutletCommand) || err != nil:
+			status = 17 // notWritable
+		case bind[1].tag != 0x02:
+			status = 7 // wrongType
+		case cmd < 1 || cmd > 3:
+			status = 10 // wrongValue
+		default:
+			if _, exists := p.Outlets[n]; !exists {
+				status = 11 // noCreation
+				break
+			}
+			if p.IgnoreSets > 0 {
+				p.IgnoreSets--
+				break
+			}
+			p.Outlets[n] = cmd != 2
+		}
+	default:
+		return nil
+	}
+	if version == 0 && value[0] == 0x81 {
+		status = 2 // SNMPv1 has no exception values: noSuchName
+	}
+	if status != 0 {
+		value = binds[0].content[len(bind[0].encoded):]
+	}
+	reply := berTLV(0xa2, berConcat(
+		pdu[0].encoded,
+		berTLV(0x02, berEncodeInt(status)),
+		berTLV(0x02, berEncodeInt(0)),
+		berTLV(0x30, berTLV(0x30, berConcat(bind[0].encoded, value))),
+	))
+	return berTLV(0x30, berConcat(fields[0].encoded, fields[1].encoded, reply))
+}
+
+// outlet returns the state of the outlet whose object is prefix followed
+// by the outlet number.
+func (p *PDU) outlet(oid, prefix string) (on, exists bool) {
+	if !strings.HasPrefix(oid, prefix) {
+		return false, false
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(oid, prefix))
+	if err != nil {
+		return false, false
+	}
+	on, exists = p.Outlets[n]
+	return on, exists
+}
+
+// berElement is one BER element: its tag, content and full encoding.
+type berElement struct {
+	tag     byte
+	content []byte
+	encoded []byte
+}
+
+// berSplit splits the first element off buf.
+func berSplit(buf []byte) (berElement, []byte, bool) {
+	if len(buf) < 2 {
+		return berElement{}, nil, false
+	}
+	length, pos := int(buf[1]), 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 3 || len(buf) < 2+n {
+			return berElement{}, nil, false
+		}
+		length = 0
+		for _, b := range buf[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		pos += n
+	}
+	if len(buf) < pos+length {
+		return berElement{}, nil, false
+	}
+	end := pos + length
+	return berElement{tag: buf[0], content: buf[pos:end], encoded: buf[:end]}, buf[end:], true
+}
+
+// berElements splits buf into its elements, or returns nil if it is
+// malformed.
+func berElements(buf []byte) []berElement {
+	var out []berElement
+	for len(buf) > 0 {
+		e, rest, ok := berSplit(buf)
+		if !ok {
+			return nil
+		}
+		out = append(out, e)
+		buf = rest
+	}
+	return out
+}
+
+func berTLV(tag byte, content []byte) []byte {
+	n := len(content)
+	var out []byte
+	switch {
+	case n < 0x80:
+		out = []byte{tag, byte(n)}
+	case n < 0x100:
+		out = []byte{tag, 0x81, byte(n)}
+	default:
+		out = []byte{tag, 0x82, byte(n >> 8), byte(n)}
+	}
+	return append(out, content...)
+}
+
+func berConcat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func berInt(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+func berEncodeInt(v int64) []byte {
+	var out []byte
+	for {
+		out = append([]byte{byte(v)}, out...)
+		next := v >> 8
+		if (next == 0 && v&0x80 == 0) || (next == -1 && v&0x80 != 0) {
+			return out
+		}
+		v = next
+	}
+}
+
+// berOID decodes an OID to dotted form with a leading dot.
+func berOID(b []byte) string {
+	var arcs []uint64
+	var a uint64
+	for _, c := range b {
+		a = a<<7 | uint64(c&0x7f)
+		if c&0x80 == 0 {
+			arcs = append(arcs, a)
+			a = 0
+		}
+	}
+	if len(arcs) == 0 {
+		return ""
+	}
+	first := arcs[0]
+	x := first / 40
+	if x > 2 {
+		x = 2
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, ".%d.%d", x, first-40*x)
+	for _, a := range arcs[1:] {
+		fmt.Fprintf(&sb, ".%d", a)
+	}
+	return sb.String()
+}
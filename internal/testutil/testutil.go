@@ -0,0 +1,10 @@
+// Package testutil provides fake devices for exercising backends without
+// real hardware: an httptest server emulating the Hikvision ISAPI endpoints
+// the hikvision backend uses, an ONVIF imaging service for the onvif
+// backend, a UDP responder speaking the Xiaomi miIO protocol, and an SNMP
+// agent emulating the outlets of an APC rack PDU.
+//
+// Fakes record the requests they receive and expose their state as exported
+// fields guarded by Lock/Unlock, so a caller can preset responses or inject
+// failures and then assert on what the backend sent.
+package testutil
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"alpaca-switch/backend"
+	"alpaca-switch/backend/hikvision"
+	"alpaca-switch/backend/httpjson"
+	"alpaca-switch/backend/mi"
+	"alpaca-switch/backend/onvif"
+	"alpaca-switch/backend/pdu"
+	"alpaca-switch/backend/uhubctl"
+)
+
+// Exit codes of the lint subcommand.
+const (
+	lintOK       = 0
+	lintErrors   = 1
+	lintWarnings = 2
+)
+
+// lintReport collects the findings of a config check.
+type lintReport struct {
+	errors   []string
+	warnings []string
+}
+
+func (r *lintReport) errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *lintReport) warnf(format string, args ...interface{}) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+// runLint implements "alpaca-switch lint": it loads the config, runs the
+// same validation as startup plus heuristic checks, optionally probes every
+// device, prints the findings and returns the process exit code.
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	path := fs.String("config", "config/settings.json", "Config file, directory or comma-separated list to check")
+	strict := fs.Bool("strict-config", false, "Reject unknown keys")
+	network := fs.Bool("network", false, "Also check that every device answers")
+	fs.Parse(args)
+
+	// Backends log the problems found while building them; the report
+	// covers those, so keep the output to the findings.
+	log.SetOutput(io.Discard)
+
+	rep := &lintReport{}
+	cfg, err := loadConfig(*path, *strict)
+	if err != nil {
+		rep.errorf("%v", err)
+	} else {
+		lintConfig(cfg, rep)
+		if *network {
+			lintNetwork(cfg, rep)
+		}
+	}
+
+	for _, e := range rep.errors {
+		fmt.Printf("error: %s\n", e)
+	}
+	for _, w := range rep.warnings {
+		fmt.Printf("warning: %s\n", w)
+	}
+	fmt.Printf("%s: %d error(s), %d warning(s)\n", *path, len(rep.errors), len(rep.warnings))
+	switch {
+	case len(rep.errors) > 0:
+		return lintErrors
+	case len(rep.warnings) > 0:
+		return lintWarnings
+	}
+	return lintOK
+}
+
+// lintConfig checks a loaded config without contacting any device.
+func lintConfig(cfg *Config, rep *lintReport) {
+	if cfg.DebugFaults != nil {
+		rep.warnf("debug_faults is set; it is for testing clients and should not be left in a production config")
+	}
+	for i, d := range cfg.MiDevices {
+		where := fmt.Sprintf("mi_devices.%d (%s)", i, d.Name)
+		if d.IP == "" {
+			rep.errorf("%s: ip is empty", where)
+		}
+		if !miToken.MatchString(d.Token) {
+			hint := ""
+			if looksLikePlaceholder(d.Token) {
+				hint = " (it looks like a placeholder)"
+			}
+			rep.errorf("%s: token must be 32 hex characters%s", where, hint)
+		} else if looksLikePlaceholder(d.Token) {
+			rep.warnf("%s: token looks like a placeholder", where)
+		}
+		if d.Max < d.Min {
+			rep.errorf("%s: max (%d) is below min (%d)", where, d.Max, d.Min)
+		}
+		lintGetSwitchMode(rep, where, d.GetSwitchMode)
+		for j, p := range d.Properties {
+			pwhere := fmt.Sprintf("mi_devices.%d.properties.%d (%s)", i, j, p.Name)
+			if p.SIID <= 0 || p.PIID <= 0 {
+				rep.errorf("%s: siid and piid must be positive", pwhere)
+			}
+			if p.Type != "" && p.Type != mi.PropertyBool && p.Type != mi.PropertyInt {
+				rep.errorf("%s: type must be %q or %q, got %q", pwhere, mi.PropertyBool, mi.PropertyInt, p.Type)
+			}
+			lintGetSwitchMode(rep, pwhere, p.GetSwitchMode)
+		}
+	}
+	for i, c := range cfg.HikvisionCameras {
+		where := fmt.Sprintf("hikvision_cameras.%d (%s)", i, c.Name)
+		if c.Host == "" {
+			rep.errorf("%s: host is empty", where)
+		}
+		if err := c.Validate(); err != nil {
+			rep.errorf("%s: %v", where, err)
+		}
+		lintCredentials(rep, where, c.Username, c.Password)
+	}
+	for i, c := range cfg.ONVIFCameras {
+		where := fmt.Sprintf("onvif_cameras.%d (%s)", i, c.Name)
+		if c.Host == "" && c.DeviceURL == "" {
+			rep.errorf("%s: host is empty", where)
+		}
+		lintCredentials(rep, where, c.Username, c.Password)
+	}
+	for i, s := range cfg.UhubctlSwitches {
+		if err := s.Validate(); err != nil {
+			rep.errorf("uhubctl_switches.%d (%s): %v", i, s.Name, err)
+		}
+	}
+	for i, s := range cfg.PDUSwitches {
+		if err := s.Validate(); err != nil {
+			rep.errorf("pdu_switches.%d (%s): %v", i, s.Name, err)
+		}
+	}
+	for i, s := range cfg.HTTPJSONSwitches {
+		where := fmt.Sprintf("httpjson_switches.%d (%s)", i, s.Name)
+		if r, err := s.Resolve(); err != nil {
+			rep.errorf("%s: %v", where, err)
+		} else {
+			s = r
+		}
+		if s.Max < s.Min {
+			rep.errorf("%s: max (%g) is below min (%g)", where, s.Max, s.Min)
+		}
+		if s.Step < 0 {
+			rep.errorf("%s: step must not be negative", where)
+		}
+		if !s.ReadOnly && s.Set == nil && s.On == nil && s.Off == nil {
+			rep.warnf("%s: writable but has no set, on or off request", where)
+		}
+		if s.Auth.Password != "" && looksLikePlaceholder(s.Auth.Password) {
+			rep.warnf("%s: auth password looks like a placeholder", where)
+		}
+	}
+	for i, e := range cfg.DiscoveryIfaces {
+		if !localInterface(e) {
+			rep.warnf("discovery_interfaces.%d: no local interface is named or has address %q", i, e)
+		}
+	}
+	if k := cfg.MiSettings.StateStore; k != "" {
+		if _, err := backend.OpenStore(backend.StoreConfig{Kind: k}); err != nil {
+			rep.errorf("mi_settings.state_store: %v", err)
+		}
+	}
+	if cfg.TLSCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+			rep.errorf("tls_cert_file/tls_key_file: %v", err)
+		}
+	}
+	if cfg.TLSClientCAFile != "" {
+		if pem, err := os.ReadFile(cfg.TLSClientCAFile); err != nil {
+			rep.errorf("tls_client_ca_file: %v", err)
+		} else if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			rep.errorf("tls_client_ca_file: no PEM certificates found in %s", cfg.TLSClientCAFile)
+		}
+	}
+	lintDuplicates(cfg, rep)
+
+	router := backend.NewRouter(lintBackends(cfg), backend.Options{Aggregates: cfg.AggregateSwitches})
+	for _, w := range emptyBackendWarnings(cfg, router.NumSwitches()) {
+		rep.warnf("%s", w)
+	}
+	if _, err := buildConnectPlan(router, cfg.ConnectOrder); err != nil {
+		rep.errorf("connect_order: %v", err)
+	}
+	names := make(map[string]string)
+	for _, b := range router.Backends() {
+		typ := "unknown"
+		if t, ok := b.(backend.Typed); ok {
+			typ = t.BackendType()
+		}
+		if h, ok := b.(backend.HealthReporter); ok {
+			if err := h.Health(); err != nil {
+				rep.warnf("%s: %v", typ, err)
+			}
+		}
+		for id := 0; id < b.NumSwitches(); id++ {
+			name := b.GetName(id)
+			key := strings.ToLower(name)
+			if prev, ok := names[key]; ok {
+				rep.warnf("switch name %q is used by both %s and %s switch %d", name, prev, typ, id)
+			} else {
+				names[key] = fmt.Sprintf("%s switch %d", typ, id)
+			}
+			if p, ok := b.(backend.OptionsProvider); ok && !b.GetCanWrite(id) {
+				opts := p.SwitchOptions(id)
+				if opts.OffOnShutdown {
+					rep.warnf("%s switch %d (%s) is read-only; off_on_shutdown has no effect", typ, id, name)
+				}
+				if opts.InitialState != nil {
+					rep.warnf("%s switch %d (%s) is read-only; initial_state has no effect", typ, id, name)
+				}
+			}
+		}
+	}
+	for i, a := range router.Aggregates() {
+		where := fmt.Sprintf("aggregate_switches.%d (%s)", i, a.Name)
+		switch cfg.AggregateSwitches[i].Mode {
+		case "", backend.AggregateAny, backend.AggregateAll, backend.AggregateCount, backend.AggregateSum:
+		default:
+			rep.errorf("%s: mode must be %q, %q, %q or %q", where, backend.AggregateAny, backend.AggregateAll, backend.AggregateCount, backend.AggregateSum)
+		}
+		if m := cfg.AggregateSwitches[i].Max; m < 0 || (m > 0 && cfg.AggregateSwitches[i].Mode != backend.AggregateSum) {
+			rep.warnf("%s: max must be positive and only applies to mode %q", where, backend.AggregateSum)
+		}
+		if len(a.Members) == 0 {
+			rep.errorf("%s: members is empty", where)
+		}
+		for _, m := range a.Members {
+			if _, ok := names[strings.ToLower(m)]; !ok {
+				rep.warnf("%s: member %q matches no switch", where, m)
+			}
+		}
+		key := strings.ToLower(a.Name)
+		if prev, ok := names[key]; ok {
+			rep.warnf("switch name %q is used by both %s and aggregate switch %d", a.Name, prev, i)
+		} else {
+			names[key] = fmt.Sprintf("aggregate switch %d", i)
+		}
+	}
+}
+
+// lintBackends creates the backends for cfg in router order.
+func lintBackends(cfg *Config) []backend.SwitchBackend {
+	return []backend.SwitchBackend{
+		mi.New(cfg.MiDevices, cfg.MiSettings),
+		hikvision.New(cfg.HikvisionCameras, cfg.HikvisionSettings),
+		httpjson.New(cfg.HTTPJSONSwitches, cfg.HTTPJSONSettings),
+		onvif.New(cfg.ONVIFCameras, cfg.ONVIFSettings),
+		uhubctl.New(cfg.UhubctlSwitches, cfg.UhubctlSettings),
+		pdu.New(cfg.PDUSwitches, cfg.PDUSettings),
+	}
+}
+
+// lintDuplicates flags devices configured twice and repeated UniqueIDs.
+func lintDuplicates(cfg *Config, rep *lintReport) {
+	seen := make(map[string]string)
+	check := func(key, where string) {
+		if prev, ok := seen[key]; ok {
+			rep.warnf("%s duplicates %s", where, prev)
+			return
+		}
+		seen[key] = where
+	}
+	for i, d := range cfg.MiDevices {
+		switch {
+		case d.RSSI:
+			check(fmt.Sprintf("mi:%s/rssi", d.Addr()), fmt.Sprintf("mi_devices.%d (%s)", i, d.Name))
+		case d.PIID > 0:
+			check(fmt.Sprintf("mi:%s/%d.%d", d.Addr(), d.SIID, d.PIID), fmt.Sprintf("mi_devices.%d (%s)", i, d.Name))
+		case len(d.Outlets) == 0 && len(d.Properties) == 0:
+			check(fmt.Sprintf("mi:%s/%d", d.Addr(), d.Outlet), fmt.Sprintf("mi_devices.%d (%s)", i, d.Name))
+		}
+		if d.RSSISwitch {
+			check(fmt.Sprintf("mi:%s/rssi", d.Addr()), fmt.Sprintf("mi_devices.%d rssi_switch", i))
+		}
+		for j, o := range d.Outlets {
+			check(fmt.Sprintf("mi:%s/%d", d.Addr(), o.Channel), fmt.Sprintf("mi_devices.%d.outlets.%d (%s)", i, j, o.Name))
+		}
+		for j, p := range d.Properties {
+			check(fmt.Sprintf("mi:%s/%d.%d", d.Addr(), p.SIID, p.PIID), fmt.Sprintf("mi_devices.%d.properties.%d (%s)", i, j, p.Name))
+		}
+	}
+	for i, c := range cfg.HikvisionCameras {
+		fn := c.Function
+		if fn == "" {
+			fn = hikvision.FunctionIR
+		}
+		check("hikvision:"+c.Host+"/"+fn, fmt.Sprintf("hikvision_cameras.%d (%s)", i, c.Name))
+	}
+	for i, c := range cfg.ONVIFCameras {
+		check("onvif:"+c.Host+c.DeviceURL, fmt.Sprintf("onvif_cameras.%d (%s)", i, c.Name))
+	}
+	for i, s := range cfg.UhubctlSwitches {
+		check(fmt.Sprintf("uhubctl:%s/%d", s.Location, s.Port), fmt.Sprintf("uhubctl_switches.%d (%s)", i, s.Name))
+	}
+	for i, s := range cfg.PDUSwitches {
+		check(fmt.Sprintf("pdu:%s/%d", s.Host, s.Outlet), fmt.Sprintf("pdu_switches.%d (%s)", i, s.Name))
+	}
+
+	uids := make(map[string]string)
+	checkUID := func(uid, where string) {
+		if uid == "" {
+			return
+		}
+		if prev, ok := uids[uid]; ok {
+			rep.warnf("%s reuses uniqueid %s of %s", where, uid, prev)
+			return
+		}
+		uids[uid] = where
+	}
+	for i, c := range cfg.HikvisionCameras {
+		checkUID(c.UniqueID, fmt.Sprintf("hikvision_cameras.%d (%s)", i, c.Name))
+	}
+	for i, c := range cfg.ONVIFCameras {
+		checkUID(c.UniqueID, fmt.Sprintf("onvif_cameras.%d (%s)", i, c.Name))
+	}
+}
+
+// lintCredentials warns about empty or placeholder camera credentials.
+func lintCredentials(rep *lintReport, where, username, password string) {
+	if username == "" {
+		rep.warnf("%s: username is empty", where)
+	}
+	if password == "" {
+		rep.warnf("%s: password is empty", where)
+	} else if looksLikePlaceholder(password) {
+		rep.warnf("%s: password looks like a placeholder", where)
+	}
+}
+
+// lintGetSwitchMode reports an unknown Mi getswitch_mode.
+func lintGetSwitchMode(rep *lintReport, where, mode string) {
+	switch mode {
+	case "", mi.GetSwitchStrict, mi.GetSwitchThreshold:
+	default:
+		rep.errorf("%s: getswitch_mode must be %q or %q, got %q", where, mi.GetSwitchStrict, mi.GetSwitchThreshold, mode)
+	}
+}
+
+var miToken = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+
+// placeholderWords appear in the example config and in typical templates.
+var placeholderWords = []string{"your", "changeme", "change_me", "placeholder", "example", "xxxx", "<", "..."}
+
+// looksLikePlaceholder reports whether a secret looks copied from a template
+// rather than set for a real device.
+func looksLikePlaceholder(secret string) bool {
+	s := strings.ToLower(secret)
+	for _, w := range placeholderWords {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return strings.Trim(s, "0") == "" || s == "password"
+}
+
+// localInterface reports whether this machine has an interface named name
+// or with address name.
+func localInterface(name string) bool {
+	if ip := net.ParseIP(name); ip != nil {
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return false
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	_, err := net.InterfaceByName(name)
+	return err == nil
+}
+
+// lintTimeout bounds each reachability probe.
+const lintTimeout = 3 * time.Second
+
+// lintNetwork checks that every configured device answers: a miIO status
+// read for Mi plugs, a TCP connect for cameras and HTTP/JSON endpoints, a
+// uhubctl status query for USB hub ports and an SNMP outlet state read for
+// PDU outlets.
+func lintNetwork(cfg *Config, rep *lintReport) {
+	for i, d := range cfg.MiDevices {
+		if !miToken.MatchString(d.Token) {
+			continue // already reported by lintConfig
+		}
+		var err error
+		if len(d.Properties) > 0 {
+			_, err = mi.GetProperty(d.Addr(), d.Token, d.Properties[0].SIID, d.Properties[0].PIID)
+		} else if d.PIID > 0 {
+			_, err = mi.GetProperty(d.Addr(), d.Token, d.SIID, d.PIID)
+		} else if len(d.Outlets) > 0 {
+			_, err = mi.GetOutlet(d.Addr(), d.Token, d.Outlets[0].Channel)
+		} else if d.Outlet > 0 {
+			_, err = mi.GetOutlet(d.Addr(), d.Token, d.Outlet)
+		} else {
+			_, err = mi.GetSwitch(d.Addr(), d.Token)
+		}
+		if err != nil {
+			rep.warnf("mi_devices.%d (%s): unreachable: %v", i, d.Name, err)
+		}
+	}
+	for i, c := range cfg.HikvisionCameras {
+		if err := dialCheck(c.Host, "80"); err != nil {
+			rep.warnf("hikvision_cameras.%d (%s): unreachable: %v", i, c.Name, err)
+		}
+	}
+	for i, c := range cfg.ONVIFCameras {
+		addr := c.Host
+		if c.DeviceURL != "" {
+			if u, err := url.Parse(c.DeviceURL); err == nil {
+				addr = u.Host
+			}
+		}
+		if err := dialCheck(addr, "80"); err != nil {
+			rep.warnf("onvif_cameras.%d (%s): unreachable: %v", i, c.Name, err)
+		}
+	}
+	for i, s := range cfg.HTTPJSONSwitches {
+		if r, err := s.Resolve(); err == nil {
+			s = r
+		}
+		raw := ""
+		for _, t := range []*httpjson.RequestTemplate{s.Set, s.On, s.Off} {
+			if t != nil {
+				raw = t.URL
+				break
+			}
+		}
+		if raw == "" && s.Get != nil {
+			raw = s.Get.URL
+		}
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			rep.errorf("httpjson_switches.%d (%s): %v", i, s.Name, err)
+			continue
+		}
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		if err := dialCheck(u.Host, port); err != nil {
+			rep.warnf("httpjson_switches.%d (%s): unreachable: %v", i, s.Name, err)
+		}
+	}
+	if len(cfg.UhubctlSwitches) > 0 {
+		hubs := uhubctl.New(cfg.UhubctlSwitches, cfg.UhubctlSettings)
+		for i, s := range cfg.UhubctlSwitches {
+			if s.Validate() != nil {
+				continue // already reported by lintConfig
+			}
+			if _, err := hubs.PollSwitchValue(i); err != nil {
+				rep.warnf("uhubctl_switches.%d (%s): unreachable: %v", i, s.Name, err)
+			}
+		}
+	}
+	if len(cfg.PDUSwitches) > 0 {
+		pdus := pdu.New(cfg.PDUSwitches, cfg.PDUSettings)
+		for i, s := range cfg.PDUSwitches {
+			if s.Validate() != nil {
+				continue // already reported by lintConfig
+			}
+			if _, err := pdus.PollSwitchValue(i); err != nil {
+				rep.warnf("pdu_switches.%d (%s): unreachable: %v", i, s.Name, err)
+			}
+		}
+	}
+}
+
+// dialCheck opens and closes a TCP connection to host, adding defaultPort
+// when host has none.
+func dialCheck(host, defaultPort string) error {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, defaultPort)
+	}
+	conn, err := net.DialTimeout("tcp", host, lintTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"alpaca-switch/backend"
+	"alpaca-switch/backend/hikvision"
+	"alpaca-switch/backend/mi"
+)
+
+// lint runs lintConfig over cfg and returns the report.
+func lint(cfg *Config) *lintReport {
+	rep := &lintReport{}
+	lintConfig(cfg, rep)
+	return rep
+}
+
+func goodConfig() *Config {
+	return &Config{
+		MiDevices:        []mi.Device{{IP: "10.0.0.5", Token: "8f3a9c1e5b7d2f4a6c8e0b1d3f5a7c9e", Name: "Mount", Max: 1, Step: 1, Canwrite: true}},
+		HikvisionCameras: []hikvision.CameraConfig{{Name: "Roof cam", Host: "10.0.0.9", Username: "admin", Password: "s3cr3t-Horse"}},
+	}
+}
+
+func TestLintGoodConfig(t *testing.T) {
+	if rep := lint(goodConfig()); len(rep.errors) != 0 || len(rep.warnings) != 0 {
+		t.Errorf("findings for a good config: errors %q, warnings %q", rep.errors, rep.warnings)
+	}
+}
+
+func TestLintFindings(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		edit    func(*Config)
+		errors  []string
+		warning []string
+	}{
+		{"empty ip", func(c *Config) { c.MiDevices[0].IP = "" }, []string{"mi_devices.0 (Mount): ip is empty"}, nil},
+		{"bad token", func(c *Config) { c.MiDevices[0].Token = "abc" }, []string{"token must be 32 hex characters"}, nil},
+		{"placeholder token", func(c *Config) { c.MiDevices[0].Token = "00000000000000000000000000000000" }, nil, []string{"token looks like a placeholder"}},
+		{"empty host", func(c *Config) { c.HikvisionCameras[0].Host = "" }, []string{"hikvision_cameras.0 (Roof cam): host is empty"}, nil},
+		{"duplicate name", func(c *Config) { c.HikvisionCameras[0].Name = "mount" }, nil, []string{`switch name "mount" is used by both mi switch 0 and hikvision switch 0`}},
+		{"debug faults", func(c *Config) { c.DebugFaults = &backend.FaultInjection{} }, nil, []string{"debug_faults is set"}},
+		{"aggregate without members", func(c *Config) {
+			c.AggregateSwitches = []backend.AggregateConfig{{Name: "Any on", Members: []string{"Dome"}}}
+		}, nil, []string{`member "Dome" matches no switch`}},
+	} {
+		cfg := goodConfig()
+		tc.edit(cfg)
+		rep := lint(cfg)
+		check := func(kind string, got, want []string) {
+			joined := strings.Join(got, "\n")
+			for _, w := range want {
+				if !strings.Contains(joined, w) {
+					t.Errorf("%s: %s %q, want one containing %q", tc.name, kind, got, w)
+				}
+			}
+			if len(want) == 0 && len(got) > 0 {
+				t.Errorf("%s: unexpected %s %q", tc.name, kind, got)
+			}
+		}
+		check("errors", rep.errors, tc.errors)
+		check("warnings", rep.warnings, tc.warning)
+	}
+}
+
+func TestLooksLikePlaceholder(t *testing.T) {
+	for secret, want := range map[string]bool{
+		"00000000000000000000000000000000": true,
+		"password":                         true,
+		"YOUR_TOKEN_HERE":                  true,
+		"8f3a9c1e5b7d2f4a6c8e0b1d3f5a7c9e": false,
+	} {
+		if got := looksLikePlaceholder(secret); got != want {
+			t.Errorf("looksLikePlaceholder(%q) = %v, want %v", secret, got, want)
+		}
+	}
+}
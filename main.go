@@ -1,57 +1,426 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"alpaca-switch/backend"
 	"alpaca-switch/backend/hikvision"
+	"alpaca-switch/backend/httpjson"
 	"alpaca-switch/backend/mi"
+	"alpaca-switch/backend/onvif"
+	"alpaca-switch/backend/pdu"
+	"alpaca-switch/backend/uhubctl"
 	"alpaca-switch/server"
 )
 
 // Config is the unified configuration file format.
 type Config struct {
-	AlpacaPort       int                    `json:"alpaca_port"`
-	MiDevices        []mi.Device            `json:"mi_devices"`
-	HikvisionCameras []hikvision.CameraConfig `json:"hikvision_cameras"`
+	AlpacaPort        int                       `json:"alpaca_port"`
+	BindAddress       string                    `json:"bind_address"`
+	DiscoveryIfaces   []string                  `json:"discovery_interfaces"`
+	DeviceNumber      int                       `json:"device_number"`
+	Maintenance       bool                      `json:"maintenance"`
+	MaintenanceFile   string                    `json:"maintenance_file"`
+	UniqueID          string                    `json:"unique_id"`
+	UniqueIDFile      string                    `json:"unique_id_file"`
+	BreakerFailures   int                       `json:"breaker_failures"`
+	BreakerCooldown   int                       `json:"breaker_cooldown_seconds"`
+	DisconnectGrace   int                       `json:"disconnect_grace_seconds"`
+	RequestTimeout    int                       `json:"request_timeout_seconds"`
+	MaxRequests       int                       `json:"max_concurrent_requests"`
+	TLSCertFile       string                    `json:"tls_cert_file"`
+	TLSKeyFile        string                    `json:"tls_key_file"`
+	TLSClientCAFile   string                    `json:"tls_client_ca_file"`
+	ShutdownTimeout   int                       `json:"shutdown_timeout_seconds"`
+	PowerOnStagger    int                       `json:"power_on_stagger_ms"`
+	HistorySize       int                       `json:"history_size"`
+	HistoryFile       string                    `json:"history_file"`
+	ConnectOrder      []ConnectDependency       `json:"connect_order"`
+	AutoConnect       bool                      `json:"auto_connect"`
+	ConnectOnStart    bool                      `json:"auto_connect_on_start"`
+	IgnoreEmpty       bool                      `json:"ignore_empty_backends"`
+	BooleanValueMode  string                    `json:"boolean_value_mode"`
+	UnknownParams     string                    `json:"unknown_parameters"`
+	APIVersions       []uint32                  `json:"api_versions"`
+	ExposeReadOnly    *bool                     `json:"expose_readonly"`
+	SwitchIDFile      string                    `json:"switch_id_file"`
+	SwitchOrder       []string                  `json:"switch_order"`
+	RetryPolicy       backend.RetryPolicy       `json:"retry_policy"`
+	DebugFaults       *backend.FaultInjection   `json:"debug_faults"`
+	DiscoveryFields   map[string]interface{}    `json:"discovery_fields"`
+	MiDevices         []mi.Device               `json:"mi_devices"`
+	MiSettings        mi.Settings               `json:"mi_settings"`
+	HikvisionCameras  []hikvision.CameraConfig  `json:"hikvision_cameras"`
+	HikvisionSettings hikvision.Settings        `json:"hikvision_settings"`
+	HTTPJSONSwitches  []httpjson.SwitchConfig   `json:"httpjson_switches"`
+	HTTPJSONSettings  httpjson.Settings         `json:"httpjson_settings"`
+	ONVIFCameras      []onvif.CameraConfig      `json:"onvif_cameras"`
+	ONVIFSettings     onvif.Settings            `json:"onvif_settings"`
+	UhubctlSwitches   []uhubctl.SwitchConfig    `json:"uhubctl_switches"`
+	UhubctlSettings   uhubctl.Settings          `json:"uhubctl_settings"`
+	PDUSwitches       []pdu.SwitchConfig        `json:"pdu_switches"`
+	PDUSettings       pdu.Settings              `json:"pdu_settings"`
+	AggregateSwitches []backend.AggregateConfig `json:"aggregate_switches"`
 }
 
-func loadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+// loadConfig reads the config from path: a file, a directory of *.json
+// files, or a comma-separated list of either, merged in order.
+func loadConfig(path string, strict bool) (*Config, error) {
+	files, err := configFiles(path)
 	if err != nil {
-		return nil, fmt.Errorf("reading %s: %w", path, err)
+		return nil, err
+	}
+	var data []byte
+	if len(files) == 1 {
+		data, err = os.ReadFile(files[0])
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", files[0], err)
+		}
+	} else if data, err = mergeConfigFiles(files, strict); err != nil {
+		return nil, err
 	}
 	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
+	if err := decodeConfig(data, &cfg, strict); err != nil {
 		return nil, fmt.Errorf("parsing %s: %w", path, err)
 	}
 	if cfg.AlpacaPort == 0 {
 		cfg.AlpacaPort = 11111
 	}
+	if cfg.BindAddress != "" {
+		if ip := net.ParseIP(cfg.BindAddress); ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("%s: bind_address must be an IPv4 address, got %q", path, cfg.BindAddress)
+		}
+	}
+	for i, e := range cfg.DiscoveryIfaces {
+		if e == "" {
+			return nil, fmt.Errorf("%s: discovery_interfaces.%d is empty", path, i)
+		}
+		if ip := net.ParseIP(e); ip != nil && ip.To4() == nil {
+			return nil, fmt.Errorf("%s: discovery_interfaces.%d must be an interface name or IPv4 address, got %q", path, i, e)
+		}
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("%s: tls_cert_file and tls_key_file must be set together", path)
+	}
+	if cfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		return nil, fmt.Errorf("%s: tls_client_ca_file needs tls_cert_file and tls_key_file", path)
+	}
+	if cfg.BreakerCooldown == 0 {
+		cfg.BreakerCooldown = 30
+	}
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = 15
+	}
+	// Unset or 0 means the default; a negative request_timeout_seconds
+	// turns the timeout off.
+	if cfg.RequestTimeout == 0 {
+		cfg.RequestTimeout = 30
+	}
+	if cfg.MaxRequests == 0 {
+		cfg.MaxRequests = 64
+	}
+	if cfg.DisconnectGrace == 0 {
+		cfg.DisconnectGrace = 60
+	}
+	if cfg.HistorySize == 0 {
+		cfg.HistorySize = 100
+	}
+	switch cfg.BooleanValueMode {
+	case "":
+		cfg.BooleanValueMode = backend.BooleanRound
+	case backend.BooleanRound, backend.BooleanReject:
+	default:
+		return nil, fmt.Errorf("%s: boolean_value_mode must be %q or %q", path, backend.BooleanRound, backend.BooleanReject)
+	}
+	switch cfg.UnknownParams {
+	case "":
+		cfg.UnknownParams = server.UnknownParamsIgnore
+	case server.UnknownParamsIgnore, server.UnknownParamsWarn:
+	default:
+		return nil, fmt.Errorf("%s: unknown_parameters must be %q or %q", path, server.UnknownParamsIgnore, server.UnknownParamsWarn)
+	}
+	for key, mode := range map[string]string{
+		"mi_settings":        cfg.MiSettings.WriteMode,
+		"hikvision_settings": cfg.HikvisionSettings.WriteMode,
+		"httpjson_settings":  cfg.HTTPJSONSettings.WriteMode,
+		"onvif_settings":     cfg.ONVIFSettings.WriteMode,
+		"uhubctl_settings":   cfg.UhubctlSettings.WriteMode,
+		"pdu_settings":       cfg.PDUSettings.WriteMode,
+	} {
+		switch mode {
+		case "", backend.WriteStrict, backend.WriteOptimize:
+		default:
+			return nil, fmt.Errorf("%s: %s.write_mode must be %q or %q", path, key, backend.WriteStrict, backend.WriteOptimize)
+		}
+	}
+	if cfg.DebugFaults != nil {
+		if err := cfg.DebugFaults.Check(); err != nil {
+			return nil, fmt.Errorf("%s: debug_faults: %w", path, err)
+		}
+	}
+	if err := checkRanges(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(cfg.APIVersions) == 0 {
+		cfg.APIVersions = []uint32{1}
+	}
+	hasV1 := false
+	for _, v := range cfg.APIVersions {
+		hasV1 = hasV1 || v == 1
+	}
+	if !hasV1 {
+		return nil, fmt.Errorf("%s: api_versions must include 1", path)
+	}
 	return &cfg, nil
 }
 
+// checkRanges rejects switches whose min/max/step cannot be stepped
+// through, naming the first offending device.
+func checkRanges(cfg *Config) error {
+	for i, d := range cfg.MiDevices {
+		if len(d.Outlets) > 0 {
+			continue // outlets are always 0-1 step 1
+		}
+		for j, p := range d.Properties {
+			if err := backend.CheckRange(float64(p.Min), float64(p.Max), float64(p.Step)); err != nil {
+				return fmt.Errorf("mi_devices.%d.properties.%d (%s): %w", i, j, p.Name, err)
+			}
+		}
+		if len(d.Properties) > 0 {
+			continue
+		}
+		if err := backend.CheckRange(float64(d.Min), float64(d.Max), float64(d.Step)); err != nil {
+			return fmt.Errorf("mi_devices.%d (%s): %w", i, d.Name, err)
+		}
+	}
+	for i, c := range cfg.HikvisionCameras {
+		if c.BrightnessStep > 0 {
+			if err := backend.CheckRange(0, 100, c.BrightnessStep); err != nil {
+				return fmt.Errorf("hikvision_cameras.%d (%s): brightness_step: %w", i, c.Name, err)
+			}
+		}
+		if c.Function == hikvision.FunctionTemperature && (c.TemperatureMin != 0 || c.TemperatureMax != 0) {
+			if err := backend.CheckRange(c.TemperatureMin, c.TemperatureMax, 0.1); err != nil {
+				return fmt.Errorf("hikvision_cameras.%d (%s): temperature range: %w", i, c.Name, err)
+			}
+		}
+	}
+	for i, s := range cfg.HTTPJSONSwitches {
+		if _, err := s.Resolve(); err != nil {
+			return fmt.Errorf("httpjson_switches.%d (%s): %w", i, s.Name, err)
+		}
+		min, max := s.Min, s.Max
+		if min == 0 && max == 0 {
+			max = 1 // the httpjson default
+		}
+		if err := backend.CheckRange(min, max, s.Step); err != nil {
+			return fmt.Errorf("httpjson_switches.%d (%s): %w", i, s.Name, err)
+		}
+	}
+	return nil
+}
+
+// warnEmptyBackends logs a warning for each backend whose device list is
+// present in the config but empty, and when no switches exist at all.
+func warnEmptyBackends(cfg *Config, router *backend.Router) {
+	for _, w := range emptyBackendWarnings(cfg, router.NumSwitches()) {
+		log.Printf("Warning: %s", w)
+	}
+}
+
+// emptyBackendWarnings describes each backend whose device list is present
+// in the config but empty, and the case of no switches at all. A device
+// list that is absent altogether means the backend is unused.
+func emptyBackendWarnings(cfg *Config, numSwitches int) []string {
+	sections := []struct {
+		key     string
+		present bool
+		count   int
+	}{
+		{"mi_devices", cfg.MiDevices != nil, len(cfg.MiDevices)},
+		{"hikvision_cameras", cfg.HikvisionCameras != nil, len(cfg.HikvisionCameras)},
+		{"httpjson_switches", cfg.HTTPJSONSwitches != nil, len(cfg.HTTPJSONSwitches)},
+		{"onvif_cameras", cfg.ONVIFCameras != nil, len(cfg.ONVIFCameras)},
+		{"uhubctl_switches", cfg.UhubctlSwitches != nil, len(cfg.UhubctlSwitches)},
+		{"pdu_switches", cfg.PDUSwitches != nil, len(cfg.PDUSwitches)},
+	}
+	var warnings []string
+	for _, sec := range sections {
+		if sec.present && sec.count == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s is configured but empty; that backend contributes no switches", sec.key))
+		}
+	}
+	if numSwitches == 0 {
+		warnings = append(warnings, "no switches configured; clients will see MaxSwitch = 0")
+	}
+	return warnings
+}
+
+// cameraCredentials re-reads the Hikvision cameras from the config file,
+// for the reauth action; set by main once the config path is known.
+var cameraCredentials hikvision.CredentialSource
+
+// debugFaults is set by --debug-faults; without it the debug_faults config
+// is ignored, so a test setting left in the config cannot slow down a
+// night's imaging.
+var debugFaults bool
+
+// buildRouter creates every backend from cfg and the Router over them.
+func buildRouter(cfg *Config) *backend.Router {
+	backend.SetRetryPolicy(cfg.RetryPolicy)
+	faults := cfg.DebugFaults
+	if faults != nil && !debugFaults {
+		log.Print("Warning: debug_faults is configured but ignored; start with --debug-faults to inject faults")
+		faults = nil
+	}
+	miBackend := mi.New(cfg.MiDevices, cfg.MiSettings)
+	hikBackend := hikvision.New(cfg.HikvisionCameras, cfg.HikvisionSettings)
+	if cameraCredentials != nil {
+		hikBackend.SetCredentialSource(cameraCredentials)
+	}
+	httpBackend := httpjson.New(cfg.HTTPJSONSwitches, cfg.HTTPJSONSettings)
+	onvifBackend := onvif.New(cfg.ONVIFCameras, cfg.ONVIFSettings)
+	uhubctlBackend := uhubctl.New(cfg.UhubctlSwitches, cfg.UhubctlSettings)
+	pduBackend := pdu.New(cfg.PDUSwitches, cfg.PDUSettings)
+
+	// Mi switches first, then Hikvision, then HTTP/JSON, then ONVIF, then uhubctl, then PDU
+	router := backend.NewRouter([]backend.SwitchBackend{miBackend, hikBackend, httpBackend, onvifBackend, uhubctlBackend, pduBackend}, backend.Options{
+		BreakerFailures:  cfg.BreakerFailures,
+		BreakerCooldown:  time.Duration(cfg.BreakerCooldown) * time.Second,
+		BooleanValueMode: cfg.BooleanValueMode,
+		HideReadOnly:     cfg.ExposeReadOnly != nil && !*cfg.ExposeReadOnly,
+		IDMapFile:        cfg.SwitchIDFile,
+		Aggregates:       cfg.AggregateSwitches,
+		AutoConnect:      cfg.AutoConnect,
+		Order:            cfg.SwitchOrder,
+		Faults:           faults,
+	})
+
+	log.Printf("%d total switches (%d Mi + %d Hikvision + %d HTTP/JSON + %d ONVIF + %d uhubctl + %d PDU + %d aggregate)",
+		router.NumSwitches(), miBackend.NumSwitches(), hikBackend.NumSwitches(), httpBackend.NumSwitches(), onvifBackend.NumSwitches(),
+		uhubctlBackend.NumSwitches(), pduBackend.NumSwitches(), len(cfg.AggregateSwitches))
+	return router
+}
+
+// reloadConfig re-reads the config file and swaps in a Router with the new
+// device set. Server settings (port, bind address, device number, unique
+// ID, timeouts, API versions) only take effect on restart. An invalid config is logged
+// and the running devices are kept.
+func reloadConfig(srv *server.Server, path string, strict bool) {
+	log.Printf("Received SIGHUP, reloading %s", path)
+	cfg, err := loadConfig(path, strict)
+	if err != nil {
+		log.Printf("Reload failed, keeping current devices: %v", err)
+		return
+	}
+	router := buildRouter(cfg)
+	connectPlan, err := buildConnectPlan(router, cfg.ConnectOrder)
+	if err != nil {
+		log.Printf("Reload failed, keeping current devices: invalid connect_order: %v", err)
+		return
+	}
+	warnEmptyBackends(cfg, router)
+	activeConfig.Store(cfg)
+	srv.Reload(router, connectPlan)
+}
+
 func main() {
-	cfg, err := loadConfig("config/settings.json")
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(runLint(os.Args[2:]))
+	}
+
+	version := flag.Bool("version", false, "Print the driver version and build info, then exit")
+	trace := flag.Bool("trace", false, "Log raw device request/response payloads (secrets redacted)")
+	configPath := flag.String("config", "config/settings.json", "Config file, directory of *.json files, or comma-separated list merged in order")
+	strict := flag.Bool("strict-config", false, "Reject unknown config keys")
+	flag.BoolVar(&debugFaults, "debug-faults", false, "Apply the debug_faults config: inject latency and errors into switch operations (testing only)")
+	flag.Parse()
+	if *version {
+		fmt.Println("alpaca-switch " + server.BuildInfo())
+		return
+	}
+	if *trace {
+		backend.SetTrace(true)
+		log.Print("Payload tracing enabled")
+	}
+	if debugFaults {
+		log.Print("Warning: fault injection enabled (--debug-faults); switch operations may be slowed or failed on purpose")
+	}
+
+	cfg, err := loadConfig(*configPath, *strict)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	cameraCredentials = func() ([]hikvision.CameraConfig, error) {
+		cfg, err := loadConfig(*configPath, *strict)
+		if err != nil {
+			return nil, err
+		}
+		return cfg.HikvisionCameras, nil
+	}
 
-	// Build backends
-	miBackend := mi.New(cfg.MiDevices, "")
-	hikBackend := hikvision.New(cfg.HikvisionCameras)
+	log.Printf("alpaca-switch %s starting", server.BuildInfo())
+	logStartupBanner(cfg, *configPath)
+	activeConfig.Store(cfg)
+	router := buildRouter(cfg)
+	warnEmptyBackends(cfg, router)
 
-	// Build router (Mi switches first, then Hikvision)
-	router := backend.NewRouter([]backend.SwitchBackend{miBackend, hikBackend})
+	connectPlan, err := buildConnectPlan(router, cfg.ConnectOrder)
+	if err != nil {
+		log.Fatalf("Invalid connect_order: %v", err)
+	}
 
-	log.Printf("alpaca-switch starting: %d total switches (%d Mi + %d Hikvision)",
-		router.NumSwitches(), miBackend.NumSwitches(), hikBackend.NumSwitches())
+	router.StartPolling()
 
 	// Start discovery and API
-	go server.StartDiscovery(32227, cfg.AlpacaPort)
-	srv := server.New(router)
-	srv.Start(fmt.Sprintf(":%d", cfg.AlpacaPort))
+	go server.StartDiscovery(discoveryPort, cfg.AlpacaPort, cfg.BindAddress, cfg.DiscoveryIfaces, cfg.DiscoveryFields)
+	srv := server.New(router, server.Options{
+		DeviceNumber:          cfg.DeviceNumber,
+		Maintenance:           cfg.Maintenance,
+		MaintenanceFile:       cfg.MaintenanceFile,
+		UniqueID:              resolveUniqueID(cfg),
+		ConnectPlan:           connectPlan,
+		IgnoreEmptyBackends:   cfg.IgnoreEmpty,
+		DisconnectGrace:       time.Duration(cfg.DisconnectGrace) * time.Second,
+		RequestTimeout:        time.Duration(cfg.RequestTimeout) * time.Second,
+		MaxConcurrentRequests: cfg.MaxRequests,
+		UnknownParams:         cfg.UnknownParams,
+		APIVersions:           cfg.APIVersions,
+		PowerOnStagger:        time.Duration(cfg.PowerOnStagger) * time.Millisecond,
+		HistorySize:           cfg.HistorySize,
+		HistoryFile:           cfg.HistoryFile,
+		Export:                exportConfig,
+		TLSCertFile:           cfg.TLSCertFile,
+		TLSKeyFile:            cfg.TLSKeyFile,
+		ClientCAFile:          cfg.TLSClientCAFile,
+	})
+	go srv.Start(net.JoinHostPort(cfg.BindAddress, strconv.Itoa(cfg.AlpacaPort)))
+	if cfg.ConnectOnStart {
+		log.Print("Connecting all backends (auto_connect_on_start)")
+		srv.Connect()
+	}
+
+	// Reload the device config on SIGHUP; shut down gracefully on Ctrl+C
+	// or a service stop.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	sig := <-stop
+	for sig == syscall.SIGHUP {
+		reloadConfig(srv, *configPath, *strict)
+		sig = <-stop
+	}
+	log.Printf("Received %v, shutting down", sig)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+	log.Print("Shutdown complete")
 }
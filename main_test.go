@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"alpaca-switch/backend/hikvision"
+	"alpaca-switch/backend/mi"
+)
+
+func TestEmptyBackendWarnings(t *testing.T) {
+	cfg := &Config{
+		MiDevices:        []mi.Device{},
+		HikvisionCameras: []hikvision.CameraConfig{{Name: "Cam"}},
+	}
+	warnings := emptyBackendWarnings(cfg, 1)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "mi_devices is configured but empty") {
+		t.Errorf("warnings = %q, want one for the empty mi_devices", warnings)
+	}
+
+	// Absent device lists are unused backends, not empty ones.
+	if warnings := emptyBackendWarnings(&Config{}, 0); len(warnings) != 1 || !strings.Contains(warnings[0], "no switches configured") {
+		t.Errorf("warnings for an empty config = %q, want only the no-switches warning", warnings)
+	}
+}
+
+// A switch whose range is not a whole number of steps is rejected, naming
+// the device.
+func TestCheckRangesNamesDevice(t *testing.T) {
+	cfg := &Config{MiDevices: []mi.Device{
+		{Name: "plug", Max: 1, Step: 1},
+		{Name: "heater", Max: 100, Step: 30},
+	}}
+	err := checkRanges(cfg)
+	if err == nil || !strings.Contains(err.Error(), "mi_devices.1 (heater)") {
+		t.Errorf("checkRanges = %v, want an error naming mi_devices.1 (heater)", err)
+	}
+	cfg.MiDevices[1].Step = 25
+	if err := checkRanges(cfg); err != nil {
+		t.Errorf("checkRanges with step 25 = %v, want nil", err)
+	}
+}
+
+// request_timeout_seconds falls back to the default when unset or 0 and
+// stays negative, which disables the timeout.
+func TestRequestTimeoutConfig(t *testing.T) {
+	for _, tc := range []struct {
+		json string
+		want int
+	}{
+		{`{}`, 30},
+		{`{"request_timeout_seconds": 0}`, 30},
+		{`{"request_timeout_seconds": 5}`, 5},
+		{`{"request_timeout_seconds": -1}`, -1},
+	} {
+		dir := writeConfigs(t, map[string]string{"settings.json": tc.json})
+		cfg, err := loadConfig(dir, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.RequestTimeout != tc.want {
+			t.Errorf("%s: request timeout %d, want %d", tc.json, cfg.RequestTimeout, tc.want)
+		}
+	}
+}
@@ -1,39 +1,234 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"alpaca-switch/backend"
 
 	"github.com/julienschmidt/httprouter"
 )
 
+// ASCOM Alpaca error numbers.
+const (
+	errNotImplemented   = 0x400
+	errInvalidValue     = 0x401
+	errNotConnected     = 0x407
+	errInvalidOperation = 0x40B
+	errActionNotImpl    = 0x40C
+)
+
+// Options holds server-wide settings.
+type Options struct {
+	// DeviceNumber is the ASCOM device number the Switch device is served
+	// under, so it can coexist with other Alpaca switch drivers.
+	DeviceNumber int
+
+	// Maintenance is the initial maintenance-mode state. While on, all
+	// switch writes are rejected.
+	Maintenance bool
+
+	// MaintenanceFile, if set, persists the maintenance flag across restarts.
+	// A saved flag takes precedence over Maintenance.
+	MaintenanceFile string
+
+	// UniqueID is the ASCOM UniqueID reported in configureddevices.
+	UniqueID string
+
+	// ConnectPlan orders backend connection. Nil connects all backends in parallel.
+	ConnectPlan ConnectPlan
+
+	// IgnoreEmptyBackends leaves backends with no switches out of the
+	// Connected aggregation so they cannot gate readiness.
+	IgnoreEmptyBackends bool
+
+	// DisconnectGrace is how long a backend must appear unreachable (every
+	// switch's circuit breaker tripped) before Connected reports false, so
+	// brief network blips do not look like a dropped device.
+	DisconnectGrace time.Duration
+
+	// APIVersions lists the Alpaca interface versions reported by
+	// apiversions. Versions other than 1 are served by the v1 handlers.
+	// Empty means [1].
+	APIVersions []uint32
+
+	// RequestTimeout bounds how long a read request may run before it is
+	// answered with an ASCOM timeout error. Writes always run to completion.
+	// Backends do not observe the deadline: a timed-out read keeps running
+	// in the background and its late result is dropped. Zero or negative
+	// disables the limit.
+	RequestTimeout time.Duration
+
+	// MaxConcurrentRequests caps how many requests are handled at once;
+	// further requests get a 503. Health probes are exempt. Zero or
+	// negative means no limit.
+	MaxConcurrentRequests int
+
+	// UnknownParams is UnknownParamsIgnore (default) or UnknownParamsWarn,
+	// which logs API request parameters the called method does not use.
+	UnknownParams string
+
+	// PowerOnStagger is the pause between successive initial_state writes
+	// on first connect, so many loads do not switch on at once.
+	PowerOnStagger time.Duration
+
+	// HistorySize is how many value changes are kept per switch for
+	// /api/v1/switch/N/history. Negative disables history.
+	HistorySize int
+
+	// HistoryFile, if set, persists the history across restarts.
+	HistoryFile string
+
+	// Export, if set, serves the live configuration at /config/export.
+	Export ExportFunc
+
+	// TLSCertFile and TLSKeyFile, if set, serve the API over HTTPS instead
+	// of plain HTTP.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// ClientCAFile, if set with TLSCertFile, requires requests other than
+	// management and health probes to present a client certificate signed
+	// by one of the CAs in this PEM file (mutual TLS).
+	ClientCAFile string
+}
+
 // Server is the ASCOM Alpaca HTTP API server.
 type Server struct {
-	router              *backend.Router
+	// current is swapped atomically when the config is reloaded; handlers
+	// take one snapshot with router() so they never mix two device sets.
+	current             atomic.Pointer[routerState]
+	httpServer          *http.Server
+	opts                Options
 	serverTransactionID uint32
+	maintenance         atomic.Bool
+	connecting          atomic.Bool
+	initialApplied      atomic.Bool
+	history             *history
+
+	// connectMu guards connectWant, the state last requested through
+	// connectAsync, and the start and end of its transitions.
+	connectMu   sync.Mutex
+	connectWant bool
 }
 
 // New creates a Server backed by the given backend Router.
-func New(r *backend.Router) *Server {
-	return &Server{router: r}
+func New(r *backend.Router, opts Options) *Server {
+	s := &Server{opts: opts}
+	s.current.Store(&routerState{router: r, plan: opts.ConnectPlan})
+	r.SetWriteGuard(s.checkWritable)
+	if opts.HistorySize > 0 {
+		s.history = newHistory(opts.HistorySize, opts.HistoryFile)
+		r.OnChange(s.history.record)
+	}
+	s.maintenance.Store(opts.Maintenance)
+	if opts.MaintenanceFile != "" {
+		if data, err := os.ReadFile(opts.MaintenanceFile); err == nil {
+			if on, err := strconv.ParseBool(strings.TrimSpace(string(data))); err == nil {
+				s.maintenance.Store(on)
+			}
+		}
+	}
+	if s.maintenance.Load() {
+		log.Print("[server] maintenance mode is ON: switch writes are frozen")
+	}
+	// The HTTP server is complete before Start runs, so Shutdown can stop
+	// it at any time, even before it is listening.
+	s.httpServer = &http.Server{Handler: s.handler()}
+	if opts.TLSCertFile != "" {
+		cfg, err := s.tlsConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.httpServer.TLSConfig = cfg
+	}
+	return s
 }
 
-// Start registers all routes and begins listening on addr (e.g. ":11111").
-func (s *Server) Start(addr string) {
+// routerState is the Router in service together with its connect plan.
+type routerState struct {
+	router *backend.Router
+	plan   ConnectPlan
+}
+
+// router returns the Router currently in service.
+func (s *Server) router() *backend.Router { return s.current.Load().router }
+
+// apiPath returns the device API route for method, e.g. "/api/v1/switch/0/getswitch".
+func (s *Server) apiPath(method string) string {
+	return fmt.Sprintf("/api/v1/switch/%d/%s", s.opts.DeviceNumber, method)
+}
+
+// handler registers all routes and wraps them in the request middleware.
+func (s *Server) handler() http.Handler {
 	r := httprouter.New()
 	s.configureManagementAPI(r)
 	s.configureCommonAPI(r)
 	s.configureSwitchAPI(r)
-	log.Printf("Alpaca API server listening on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, r))
+	s.configureDebugAPI(r)
+	s.configureStatusPage(r)
+	s.configureHealthAPI(r)
+	s.configureScanAPI(r)
+	s.configureMetricsAPI(r)
+	s.configureExportAPI(r)
+	r.NotFound = s.versionFallback(r)
+	return s.withClientCert(s.withTimeout(s.withConcurrencyLimit(s.withUnknownParams(withLowercasePath(r)))))
+}
+
+// Start begins listening on addr (e.g. ":11111") and serves the API until
+// Shutdown. If Shutdown has already been called it returns at once.
+func (s *Server) Start(addr string) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if s.opts.TLSCertFile != "" {
+		if s.opts.ClientCAFile != "" {
+			log.Printf("Alpaca API server listening on %s (HTTPS, client certificate required)", addr)
+		} else {
+			log.Printf("Alpaca API server listening on %s (HTTPS)", addr)
+		}
+		err = s.httpServer.ServeTLS(ln, s.opts.TLSCertFile, s.opts.TLSKeyFile)
+	} else {
+		log.Printf("Alpaca API server listening on %s", addr)
+		err = s.httpServer.Serve(ln)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// Shutdown stops accepting requests and waits for in-flight ones, stops
+// polling, turns off switches flagged off_on_shutdown and then disconnects
+// every backend in reverse connect order. ctx bounds the whole sequence.
+func (s *Server) Shutdown(ctx context.Context) {
+	rt := s.router()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		log.Printf("[server] shutdown: %v", err)
+	}
+	rt.StopPolling()
+	rt.SwitchOffForShutdown(ctx)
+	done := make(chan struct{})
+	go func() {
+		s.connectAll(false)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Print("[server] shutdown: timed out disconnecting backends")
+	}
 }
 
 func (s *Server) nextTxnID() uint32 {
@@ -45,10 +240,33 @@ func (s *Server) prepareResponse(r *http.Request, resp *alpacaResponse) {
 	resp.ServerTransactionID = s.nextTxnID()
 }
 
+// errorNumber maps an error to its ASCOM error number.
+func errorNumber(err error) int32 {
+	switch {
+	case errors.Is(err, backend.ErrInvalidValue):
+		return errInvalidValue
+	case errors.Is(err, backend.ErrInvalidOperation):
+		return errInvalidOperation
+	case errors.Is(err, backend.ErrNotConnected):
+		return errNotConnected
+	case errors.Is(err, backend.ErrActionNotImplemented):
+		return errActionNotImpl
+	}
+	return errNotImplemented
+}
+
+// sendJSON encodes v before writing any headers, so an unencodable value
+// (e.g. a NaN reading) produces a clean 500 instead of a truncated body.
 func (s *Server) sendJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("[server] encoding response: %v", err)
+		http.Error(w, "internal error encoding response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(v)
+	w.Write(append(data, '\n'))
 }
 
 // ---------- request helpers ----------
@@ -113,6 +331,13 @@ func getSwitchValue(r *http.Request) (float64, error) {
 	return strconv.ParseFloat(v, 64)
 }
 
+// getConfirm reports whether the request carries Confirm=true, which
+// require_confirm switches need before a dangerous write.
+func getConfirm(r *http.Request) bool {
+	confirmed, _ := strconv.ParseBool(getParamAnyCase(r, "Confirm"))
+	return confirmed
+}
+
 func getConnected(r *http.Request) (bool, error) {
 	v := getParamAnyCase(r, "Connected")
 	if v == "" {
@@ -122,6 +347,7 @@ func getConnected(r *http.Request) (bool, error) {
 }
 
 func getParamAnyCase(r *http.Request, name string) string {
+	noteParam(r, name)
 	if r.Method == http.MethodGet {
 		return getQueryAnyCase(r, name)
 	}
@@ -161,7 +387,7 @@ func (s *Server) handleNotSupported(w http.ResponseWriter, r *http.Request, _ ht
 	var resp stringResponse
 	s.prepareResponse(r, &resp.alpacaResponse)
 	resp.Value = "not supported"
-	resp.ErrorNumber = 0x400
+	resp.ErrorNumber = errNotImplemented
 	resp.ErrorMessage = "action not supported"
 	s.sendJSON(w, http.StatusBadRequest, resp)
 }
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// Shutdown may run before or while Start is listening; Start then returns
+// instead of serving.
+func TestShutdownBeforeStart(t *testing.T) {
+	s := New(backend.NewRouter([]backend.SwitchBackend{newFakeBackend(0)}, backend.Options{}), Options{})
+
+	done := make(chan struct{})
+	go func() {
+		s.Start("127.0.0.1:0")
+		close(done)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.Shutdown(ctx)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start still serving 5s after Shutdown")
+	}
+}
+
+// The server's handler is complete as soon as New returns.
+func TestHandlerServesAPI(t *testing.T) {
+	s := New(backend.NewRouter([]backend.SwitchBackend{newFakeBackend(0, 1)}, backend.Options{}), Options{})
+	ts := httptest.NewServer(s.httpServer.Handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/switch/0/maxswitch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out int32Response
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Value != 2 {
+		t.Errorf("MaxSwitch = %d, want 2", out.Value)
+	}
+}
+
+// Shutdown turns off the switches flagged off_on_shutdown, and only those,
+// before disconnecting.
+func TestShutdownSwitchesOff(t *testing.T) {
+	s, fake := newTestServer(Options{}, 1, 1, 1)
+	fake.opts = []backend.SwitchOptions{{OffOnShutdown: true}, {}, {OffOnShutdown: true}}
+	fake.Connect()
+
+	s.Shutdown(context.Background())
+	for id, want := range []float64{0, 1, 0} {
+		if v := fake.value(id); v != want {
+			t.Errorf("switch %d = %v after shutdown, want %v", id, v, want)
+		}
+	}
+	if fake.IsConnected() {
+		t.Error("backend still connected after shutdown")
+	}
+}
+
+// A switch that does not answer cannot hold up shutdown past its deadline.
+func TestShutdownSwitchOffTimeout(t *testing.T) {
+	s, fake := newTestServer(Options{}, 1)
+	fake.opts = []backend.SwitchOptions{{OffOnShutdown: true}}
+	fake.writeDelay = time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	s.Shutdown(ctx)
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Shutdown took %v with a 50ms deadline", d)
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"runtime/debug"
+	"strings"
+)
+
+// Build identification, overridable at link time:
+//
+//	go build -ldflags "-X alpaca-switch/server.Version=1.2.0 -X alpaca-switch/server.Commit=$(git rev-parse --short HEAD) -X alpaca-switch/server.BuildDate=$(date -u +%Y-%m-%d)"
+//
+// Without -ldflags, Commit and BuildDate fall back to the VCS information Go
+// embeds when building from a git checkout.
+var (
+	// Version is the driver version reported by driverversion.
+	Version = "1.0.0"
+	// Commit is the source revision the binary was built from.
+	Commit = ""
+	// BuildDate is when the binary was built.
+	BuildDate = ""
+)
+
+// BuildInfo describes the running build, e.g.
+// "1.2.0 (commit 1a2b3c4, built 2026-10-16)". Unknown parts are omitted.
+func BuildInfo() string {
+	commit, date := Commit, BuildDate
+	if info, ok := debug.ReadBuildInfo(); ok && (commit == "" || date == "") {
+		dirty := false
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && Commit == "":
+				commit = s.Value
+				if len(commit) > 7 {
+					commit = commit[:7]
+				}
+			case s.Key == "vcs.time" && date == "":
+				date = s.Value
+			case s.Key == "vcs.modified":
+				dirty = s.Value == "true"
+			}
+		}
+		if dirty && Commit == "" && commit != "" {
+			commit += "-dirty"
+		}
+	}
+	var parts []string
+	if commit != "" {
+		parts = append(parts, "commit "+commit)
+	}
+	if date != "" {
+		parts = append(parts, "built "+date)
+	}
+	if len(parts) == 0 {
+		return Version
+	}
+	return Version + " (" + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// driverversion and driverinfo report the version set at link time.
+func TestInjectedVersion(t *testing.T) {
+	defer func(v, c, d string) { Version, Commit, BuildDate = v, c, d }(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "9.8.7", "abc1234", "2026-10-16"
+
+	s, _ := newTestServer(Options{}, 1)
+	var version stringResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/driverversion", nil, &version)
+	if version.Value != "9.8.7" {
+		t.Errorf("driverversion = %q, want the injected 9.8.7", version.Value)
+	}
+	var info stringResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/driverinfo", nil, &info)
+	if !strings.Contains(info.Value, "9.8.7 (commit abc1234, built 2026-10-16)") {
+		t.Errorf("driverinfo = %q, want the version, commit and build date", info.Value)
+	}
+}
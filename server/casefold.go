@@ -0,0 +1,25 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// withLowercasePath lowercases the request path before routing: ASCOM
+// requires URLs to be matched case-insensitively, so /api/v1/Switch/0/GetSwitch
+// must reach the same handler as /api/v1/switch/0/getswitch. Every route is
+// registered in lower case. The query string, and with it every parameter
+// value, is left untouched.
+func withLowercasePath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lower := strings.ToLower(r.URL.Path); lower != r.URL.Path {
+			u := *r.URL
+			u.Path = lower
+			u.RawPath = ""
+			r2 := *r
+			r2.URL = &u
+			r = &r2
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMixedCasePaths(t *testing.T) {
+	s, fake := newTestServer(Options{}, 1)
+
+	var on booleanResponse
+	serve(t, s, http.MethodGet, "/API/v1/Switch/0/GetSwitch", form("ID=0"), &on)
+	if on.ErrorNumber != 0 || !on.Value {
+		t.Errorf("GetSwitch = %v (error %#x %q), want true", on.Value, on.ErrorNumber, on.ErrorMessage)
+	}
+
+	var versions uint32ListResponse
+	serve(t, s, http.MethodGet, "/Management/APIVersions", nil, &versions)
+	if len(versions.Value) != 1 {
+		t.Errorf("apiversions = %v, want [1]", versions.Value)
+	}
+
+	var put putResponse
+	serve(t, s, http.MethodPut, "/api/v1/switch/0/Connect", form("Connected=true"), &put)
+	serve(t, s, http.MethodPut, "/api/V1/SWITCH/0/SetSwitch", form("Id=0&State=false"), &put)
+	if put.ErrorNumber != 0 || fake.value(0) != 0 {
+		t.Errorf("SetSwitch = %#x %q, value %v; want the switch off", put.ErrorNumber, put.ErrorMessage, fake.value(0))
+	}
+
+	// Parameter values keep their case.
+	var bad alpacaResponse
+	serve(t, s, http.MethodGet, "/api/v1/Switch/0/GetSwitch", form("Id=AbC"), &bad)
+	if !strings.Contains(bad.ErrorMessage, "AbC") {
+		t.Errorf("error = %q, want it to quote the Id as sent", bad.ErrorMessage)
+	}
+}
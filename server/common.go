@@ -1,41 +1,65 @@
 package server
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"alpaca-switch/backend"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 func (s *Server) configureCommonAPI(r *httprouter.Router) {
+	// Custom actions
+	r.PUT(s.apiPath("action"), s.handleAction)
+	r.PUT(s.apiPath("commandstring"), s.handleCommandString)
+
 	// Unsupported ASCOM common actions
-	r.PUT("/api/v1/switch/0/action", s.handleNotSupported)
-	r.PUT("/api/v1/switch/0/commandblind", s.handleNotSupported)
-	r.PUT("/api/v1/switch/0/commandbool", s.handleNotSupported)
-	r.PUT("/api/v1/switch/0/commandstring", s.handleNotSupported)
+	r.PUT(s.apiPath("commandblind"), s.handleNotSupported)
+	r.PUT(s.apiPath("commandbool"), s.handleNotSupported)
 
 	// Connection
-	r.GET("/api/v1/switch/0/connected", s.handleGetConnected)
-	r.PUT("/api/v1/switch/0/connected", s.handleSetConnected)
+	r.GET(s.apiPath("connected"), s.handleGetConnected)
+	r.PUT(s.apiPath("connected"), s.handleSetConnected)
+	r.GET(s.apiPath("connecting"), s.handleConnecting)
+	r.PUT(s.apiPath("connect"), s.handleConnect)
+	r.PUT(s.apiPath("disconnect"), s.handleDisconnect)
 
 	// Device info
-	r.GET("/api/v1/switch/0/description", s.handleDeviceDescription)
-	r.GET("/api/v1/switch/0/driverinfo", s.handleDriverInfo)
-	r.GET("/api/v1/switch/0/driverversion", s.handleDriverVersion)
-	r.GET("/api/v1/switch/0/interfaceversion", s.handleInterfaceVersion)
-	r.GET("/api/v1/switch/0/name", s.handleName)
-	r.GET("/api/v1/switch/0/supportedactions", s.handleSupportedActions)
+	r.GET(s.apiPath("description"), s.handleDeviceDescription)
+	r.GET(s.apiPath("driverinfo"), s.handleDriverInfo)
+	r.GET(s.apiPath("driverversion"), s.handleDriverVersion)
+	r.GET(s.apiPath("interfaceversion"), s.handleInterfaceVersion)
+	r.GET(s.apiPath("name"), s.handleName)
+	r.GET(s.apiPath("supportedactions"), s.handleSupportedActions)
 }
 
-func (s *Server) handleGetConnected(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	// Report connected if ALL backends are connected
-	connected := true
-	for _, b := range s.router.Backends() {
+// allConnected reports connected if ALL backends are connected. A backend
+// that is connected but has been unreachable for longer than the
+// DisconnectGrace period counts as disconnected.
+func (s *Server) allConnected() bool {
+	rt := s.router()
+	backends := rt.Backends()
+	if s.opts.IgnoreEmptyBackends {
+		backends = rt.ActiveBackends()
+	}
+	for _, b := range backends {
 		if !b.IsConnected() {
-			connected = false
-			break
+			return false
+		}
+		if since := rt.UnreachableSince(b); !since.IsZero() && time.Since(since) >= s.opts.DisconnectGrace {
+			return false
 		}
 	}
-	resp := booleanResponse{Value: connected}
+	return true
+}
+
+func (s *Server) handleGetConnected(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	resp := booleanResponse{Value: s.allConnected()}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
@@ -45,18 +69,143 @@ func (s *Server) handleSetConnected(w http.ResponseWriter, r *http.Request, _ ht
 	if err != nil {
 		resp := stringResponse{Value: err.Error()}
 		s.prepareResponse(r, &resp.alpacaResponse)
-		resp.ErrorNumber = 0x400
+		resp.ErrorNumber = errNotImplemented
 		resp.ErrorMessage = err.Error()
 		s.sendJSON(w, http.StatusBadRequest, resp)
 		return
 	}
-	for _, b := range s.router.Backends() {
-		if connect {
-			_ = b.Connect()
-		} else {
-			b.Disconnect()
+	s.connectAll(connect)
+	var resp putResponse
+	s.prepareResponse(r, &resp.alpacaResponse)
+	s.sendJSON(w, http.StatusOK, resp)
+}
+
+// ConnectTarget is one backend in a connect stage.
+type ConnectTarget struct {
+	Backend backend.SwitchBackend
+	// Prerequisite, if set, is awaited before Backend connects (e.g. waiting
+	// for a PoE switch plug to be on). An error is logged and the backend
+	// connects anyway.
+	Prerequisite func() error
+}
+
+// ConnectPlan orders backend connection: stages connect one after another,
+// the backends within a stage in parallel. Disconnect runs in reverse.
+type ConnectPlan [][]ConnectTarget
+
+// connectPlan returns the configured plan, or a single parallel stage of
+// every backend.
+func (st *routerState) connectPlan() ConnectPlan {
+	if st.plan != nil {
+		return st.plan
+	}
+	var stage []ConnectTarget
+	for _, b := range st.router.Backends() {
+		stage = append(stage, ConnectTarget{Backend: b})
+	}
+	return ConnectPlan{stage}
+}
+
+// connectAll connects or disconnects every backend following the connect
+// plan and waits for all of them to finish. Switches with keepalive_seconds
+// that are already on get their keep-alive timers. After the first connect
+// outside maintenance mode, initial_state values are applied in the
+// background; a connect in maintenance mode leaves them for the next one.
+func (s *Server) connectAll(connect bool) {
+	st := s.current.Load()
+	st.connectAll(connect)
+	if !connect || s.initialApplied.Load() {
+		return
+	}
+	if err := s.checkWritable(); err != nil {
+		log.Printf("[server] not applying initial states yet: %v", err)
+		return
+	}
+	if s.initialApplied.CompareAndSwap(false, true) {
+		go st.router.ApplyInitialStates(s.opts.PowerOnStagger)
+	}
+}
+
+func (st *routerState) connectAll(connect bool) {
+	plan := st.connectPlan()
+	for i := range plan {
+		stage := plan[i]
+		if !connect {
+			stage = plan[len(plan)-1-i]
+		}
+		var wg sync.WaitGroup
+		for _, t := range stage {
+			wg.Add(1)
+			go func(t ConnectTarget) {
+				defer wg.Done()
+				if !connect {
+					t.Backend.Disconnect()
+					return
+				}
+				if t.Prerequisite != nil {
+					if err := t.Prerequisite(); err != nil {
+						log.Printf("[server] connect prerequisite: %v", err)
+					}
+				}
+				_ = t.Backend.Connect()
+			}(t)
 		}
+		wg.Wait()
+	}
+	if connect {
+		st.router.ArmKeepalives()
+	}
+}
+
+// Connect connects every backend in the background, as a client's Connect
+// would, e.g. at startup so switch state is live before any client arrives.
+// Connecting reports true until it completes.
+func (s *Server) Connect() { s.connectAsync(true) }
+
+// connectAsync runs connectAll in the background, reporting Connecting=true
+// until it completes (ASCOM Platform 7 Connect/Disconnect). A request made
+// while a transition is running is not dropped: the latest requested state
+// is applied once the current transition finishes, so a Disconnect issued
+// during a slow Connect still leaves the device disconnected.
+func (s *Server) connectAsync(connect bool) {
+	s.connectMu.Lock()
+	defer s.connectMu.Unlock()
+	s.connectWant = connect
+	if s.connecting.Load() {
+		return // the running transition applies connectWant when it finishes
 	}
+	s.connecting.Store(true)
+	go func() {
+		applied := connect
+		for {
+			s.connectAll(applied)
+			s.connectMu.Lock()
+			if s.connectWant == applied {
+				s.connecting.Store(false)
+				s.connectMu.Unlock()
+				return
+			}
+			applied = s.connectWant
+			s.connectMu.Unlock()
+		}
+	}()
+}
+
+func (s *Server) handleConnecting(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	resp := booleanResponse{Value: s.connecting.Load()}
+	s.prepareResponse(r, &resp.alpacaResponse)
+	s.sendJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	s.connectAsync(true)
+	var resp putResponse
+	s.prepareResponse(r, &resp.alpacaResponse)
+	s.sendJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleDisconnect(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	s.connectAsync(false)
 	var resp putResponse
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
@@ -69,13 +218,13 @@ func (s *Server) handleDeviceDescription(w http.ResponseWriter, r *http.Request,
 }
 
 func (s *Server) handleDriverInfo(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	resp := stringResponse{Value: serverName + " v" + driverVersion + " — " + manufacturer}
+	resp := stringResponse{Value: serverName + " v" + BuildInfo() + " — " + manufacturer}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
 
 func (s *Server) handleDriverVersion(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	resp := stringResponse{Value: driverVersion}
+	resp := stringResponse{Value: Version}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
@@ -93,7 +242,46 @@ func (s *Server) handleName(w http.ResponseWriter, r *http.Request, _ httprouter
 }
 
 func (s *Server) handleSupportedActions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	resp := stringListResponse{Value: []string{}}
+	resp := stringListResponse{Value: s.router().Actions()}
+	s.prepareResponse(r, &resp.alpacaResponse)
+	s.sendJSON(w, http.StatusOK, resp)
+}
+
+// handleAction runs a custom action. Parameters may start with a switch ID
+// to target one switch, e.g. Action=getdeviceinfo&Parameters=3.
+func (s *Server) handleAction(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	name := getParamAnyCase(r, "Action")
+	if name == "" {
+		s.badRequest(w, r, errors.New("Action parameter missing"))
+		return
+	}
+	s.runAction(w, r, name, getParamAnyCase(r, "Parameters"))
+}
+
+// handleCommandString runs a custom action given as "<action> [parameters]".
+func (s *Server) handleCommandString(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	command := strings.TrimSpace(getParamAnyCase(r, "Command"))
+	if command == "" {
+		s.badRequest(w, r, errors.New("Command parameter missing"))
+		return
+	}
+	name, params, _ := strings.Cut(command, " ")
+	s.runAction(w, r, name, params)
+}
+
+func (s *Server) runAction(w http.ResponseWriter, r *http.Request, name, params string) {
+	if s.router().ActionWrites(name, params) {
+		if err := s.checkWritable(); err != nil {
+			s.badRequest(w, r, err)
+			return
+		}
+	}
+	result, err := s.router().Action(name, params)
+	if err != nil {
+		s.badRequest(w, r, err)
+		return
+	}
+	resp := stringResponse{Value: result}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// waitConnecting waits for a background connect or disconnect to finish.
+func waitConnecting(t *testing.T, s *Server) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.connecting.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("Connecting still true after 5s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// A Disconnect issued while a slow Connect is running is applied once the
+// Connect finishes, instead of being dropped.
+func TestDisconnectDuringConnect(t *testing.T) {
+	fake := newFakeBackend(0)
+	fake.connectDelay = 100 * time.Millisecond
+	s := New(backend.NewRouter([]backend.SwitchBackend{fake}, backend.Options{}), Options{})
+
+	var resp putResponse
+	call(t, s.handleConnect, http.MethodPut, nil, &resp)
+	if !s.connecting.Load() {
+		t.Fatal("Connecting is false right after Connect")
+	}
+	call(t, s.handleDisconnect, http.MethodPut, nil, &resp)
+	if resp.ErrorNumber != 0 {
+		t.Fatalf("Disconnect: %s", resp.ErrorMessage)
+	}
+	waitConnecting(t, s)
+
+	if fake.IsConnected() {
+		t.Error("backend connected after Connect then Disconnect")
+	}
+	if _, _, connects := fake.counts(); connects != 1 {
+		t.Errorf("%d connects, want 1", connects)
+	}
+}
+
+// Requests that end in the state being applied cause no extra transition.
+func TestConnectTwiceDuringConnect(t *testing.T) {
+	fake := newFakeBackend(0)
+	fake.connectDelay = 50 * time.Millisecond
+	s := New(backend.NewRouter([]backend.SwitchBackend{fake}, backend.Options{}), Options{})
+
+	s.connectAsync(true)
+	s.connectAsync(false)
+	s.connectAsync(true)
+	waitConnecting(t, s)
+
+	if !fake.IsConnected() {
+		t.Error("backend not connected")
+	}
+	if _, _, connects := fake.counts(); connects != 1 {
+		t.Errorf("%d connects, want 1", connects)
+	}
+}
+
+// A first connect in maintenance mode holds initial_state back until a
+// connect after maintenance ends, instead of skipping it for good.
+func TestInitialStateAfterMaintenance(t *testing.T) {
+	on := 1.0
+	fake := newFakeBackend(0)
+	fake.opts = []backend.SwitchOptions{{InitialState: &on}}
+	s := New(backend.NewRouter([]backend.SwitchBackend{fake}, backend.Options{}), Options{Maintenance: true})
+
+	s.connectAll(true)
+	time.Sleep(50 * time.Millisecond)
+	if v := fake.value(0); v != 0 {
+		t.Fatalf("initial_state applied in maintenance mode: value %v", v)
+	}
+
+	s.setMaintenance(false)
+	s.connectAll(false)
+	s.connectAll(true)
+	deadline := time.Now().Add(2 * time.Second)
+	for fake.value(0) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("initial_state not applied on the first connect after maintenance")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Connect returns at once with Connecting true, and Connected follows once
+// the slow backend has connected.
+func TestConnectingTransition(t *testing.T) {
+	s, fake := newTestServer(Options{}, 0)
+	fake.connectDelay = 100 * time.Millisecond
+
+	var resp alpacaResponse
+	start := time.Now()
+	serve(t, s, http.MethodPut, "/api/v1/switch/0/connect", nil, &resp)
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("Connect took %v, want it to return before the backend connects", d)
+	}
+	var connecting, connected booleanResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/connecting", nil, &connecting)
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/connected", nil, &connected)
+	if !connecting.Value || connected.Value {
+		t.Errorf("right after Connect: Connecting %v, Connected %v; want true, false", connecting.Value, connected.Value)
+	}
+
+	waitConnecting(t, s)
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/connected", nil, &connected)
+	if !connected.Value {
+		t.Error("Connected false after Connecting ended")
+	}
+}
+
+// A backend with no switches blocks Connected unless IgnoreEmptyBackends
+// leaves it out.
+func TestIgnoreEmptyBackends(t *testing.T) {
+	for _, ignore := range []bool{false, true} {
+		full, empty := newFakeBackend(0), newFakeBackend()
+		s := New(backend.NewRouter([]backend.SwitchBackend{full, empty}, backend.Options{}), Options{IgnoreEmptyBackends: ignore})
+		full.Connect()
+
+		var connected booleanResponse
+		serve(t, s, http.MethodGet, "/api/v1/switch/0/connected", nil, &connected)
+		if connected.Value != ignore {
+			t.Errorf("IgnoreEmptyBackends %v: Connected = %v with the empty backend disconnected", ignore, connected.Value)
+		}
+	}
+}
+
+// A backend whose switches all fail is only reported disconnected once it
+// has been unreachable for the whole grace period.
+func TestDisconnectGrace(t *testing.T) {
+	fake := newFakeBackend(0)
+	rt := backend.NewRouter([]backend.SwitchBackend{fake}, backend.Options{BreakerFailures: 1, BreakerCooldown: time.Minute})
+	s := New(rt, Options{DisconnectGrace: 100 * time.Millisecond})
+	fake.Connect()
+
+	fake.mu.Lock()
+	fake.writeErr = errors.New("timeout")
+	fake.mu.Unlock()
+	if err := rt.SetSwitch(0, true); err == nil {
+		t.Fatal("SetSwitch succeeded on a failing device")
+	}
+
+	var connected booleanResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/connected", nil, &connected)
+	if !connected.Value {
+		t.Error("Connected = false within the grace period")
+	}
+	time.Sleep(120 * time.Millisecond)
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/connected", nil, &connected)
+	if connected.Value {
+		t.Error("Connected = true after the grace period")
+	}
+}
+
+// Connect, as auto_connect_on_start calls it at startup, connects every
+// backend without any client request.
+func TestConnectOnStart(t *testing.T) {
+	first, second := newFakeBackend(0), newFakeBackend(1)
+	second.connectDelay = 50 * time.Millisecond
+	s := New(backend.NewRouter([]backend.SwitchBackend{first, second}, backend.Options{}), Options{})
+
+	s.Connect()
+	waitConnecting(t, s)
+	if !first.IsConnected() || !second.IsConnected() {
+		t.Errorf("backends connected = %v, %v after Connect; want both", first.IsConnected(), second.IsConnected())
+	}
+	var connected booleanResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/connected", nil, &connected)
+	if !connected.Value {
+		t.Error("Connected false after the startup connect")
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"alpaca-switch/backend"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// switchDebugInfo is one entry of the /debug/switches listing.
+type switchDebugInfo struct {
+	ID       int                   `json:"id"`
+	Backend  string                `json:"backend"`
+	Name     string                `json:"name"`
+	CanWrite bool                  `json:"canwrite"`
+	Min      float64               `json:"min"`
+	Max      float64               `json:"max"`
+	Step     float64               `json:"step"`
+	Value    float64               `json:"value"`
+	Error    string                `json:"error,omitempty"`
+	Breaker  backend.BreakerStatus `json:"breaker"`
+	// State is the label of Value when state names are configured.
+	State      string   `json:"state,omitempty"`
+	StateNames []string `json:"state_names,omitempty"`
+	// LastUpdated is when the value was last confirmed by hardware; Stale
+	// means it is still the value restored from config.
+	LastUpdated *time.Time `json:"last_updated,omitempty"`
+	Stale       bool       `json:"stale"`
+	// LastContact is when the driver last completed a read or write on the
+	// device successfully; SecondsSinceContact is its age.
+	LastContact         *time.Time `json:"last_contact,omitempty"`
+	SecondsSinceContact *float64   `json:"seconds_since_contact,omitempty"`
+	// Hidden marks a read-only switch left out of the ASCOM switch list
+	// (expose_readonly false); its ID is -1.
+	Hidden bool `json:"hidden,omitempty"`
+	// Settling marks a switch that was written but is still inside its
+	// settle_ms window; Value is then the state it is leaving.
+	Settling bool `json:"settling,omitempty"`
+}
+
+func (s *Server) configureDebugAPI(r *httprouter.Router) {
+	r.GET("/debug/switches", s.handleDebugSwitches)
+}
+
+// handleDebugSwitches lists every switch with its cached value and
+// diagnostic state. It never touches hardware.
+func (s *Server) handleDebugSwitches(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rt := s.router()
+	out := make([]switchDebugInfo, rt.NumSwitches())
+	for id := range out {
+		info := switchDebugInfo{
+			ID:       id,
+			Backend:  rt.BackendType(id),
+			Name:     rt.GetName(id),
+			CanWrite: rt.GetCanWrite(id),
+			Min:      rt.GetMin(id),
+			Max:      rt.GetMax(id),
+			Step:     rt.GetStep(id),
+			Breaker:  rt.BreakerStatus(id),
+			Settling: rt.Settling(id),
+
+			StateNames: rt.GetStateNames(id),
+		}
+		if v, err := rt.GetSwitchValue(id); err != nil {
+			info.Error = err.Error()
+		} else {
+			info.Value = v
+			info.State = rt.StateName(id, v)
+		}
+		if t := rt.LastUpdated(id); t.IsZero() {
+			info.Stale = true
+		} else {
+			info.LastUpdated = &t
+		}
+		if t := rt.LastContact(id); !t.IsZero() {
+			age := time.Since(t).Seconds()
+			info.LastContact = &t
+			info.SecondsSinceContact = &age
+		}
+		out[id] = info
+	}
+	for _, h := range rt.HiddenSwitches() {
+		info := switchDebugInfo{
+			ID:      -1,
+			Backend: h.Backend,
+			Name:    h.Name,
+			Min:     h.Min,
+			Max:     h.Max,
+			Step:    h.Step,
+			Value:   h.Value,
+			Breaker: backend.BreakerStatus{State: "closed"},
+			Hidden:  true,
+		}
+		if h.Err != nil {
+			info.Error = h.Err.Error()
+		}
+		out = append(out, info)
+	}
+	s.sendJSON(w, http.StatusOK, out)
+}
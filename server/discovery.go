@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
@@ -10,15 +11,28 @@ import (
 )
 
 // StartDiscovery listens for ASCOM Alpaca UDP discovery broadcasts on listenPort
-// and responds with the given apiPort.
+// and responds with the given apiPort, plus any extra reply fields.
 //
 // NINA sends a discovery packet from every local network interface simultaneously,
 // which can cause duplicate listings. We reduce this by:
-//  1. Determining the machine's primary LAN IP (via outboundIP).
-//  2. Responding to loopback packets (for same-host clients) and packets on the
-//     same /24 subnet as the LAN IP.
+//  1. Determining the networks to answer on: the configured interfaces
+//     (names or addresses), else bindAddr when the API is bound to one
+//     address, else the primary LAN IP (via outboundIP).
+//  2. Responding to loopback packets (for same-host clients) and packets on
+//     those networks: each interface's own subnet, or the /24 around the
+//     primary LAN IP.
 //  3. Deduplicating responses per source IP within a 2-second window.
-func StartDiscovery(listenPort, apiPort int) {
+//
+// With interfaces or bindAddr set, each reply is sent from the address of
+// the network the request came from (loopback requests from the first), so
+// a client on a multi-homed machine connects to an interface the driver
+// actually serves.
+func StartDiscovery(listenPort, apiPort int, bindAddr string, interfaces []string, extra map[string]interface{}) {
+	reply, err := discoveryReply(apiPort, extra)
+	if err != nil {
+		log.Fatalf("Discovery reply: %v", err)
+	}
+
 	addr := fmt.Sprintf("0.0.0.0:%d", listenPort)
 	conn, err := net.ListenPacket("udp", addr)
 	if err != nil {
@@ -26,9 +40,25 @@ func StartDiscovery(listenPort, apiPort int) {
 	}
 	defer conn.Close()
 
-	lanIP := outboundIP()
-	log.Printf("Discovery listener binding to %s (LAN IP: %s)", addr, lanIP)
-	reply := fmt.Sprintf("{\n\"AlpacaPort\":%d\n}", apiPort)
+	// Broadcasts only reach a socket bound to the wildcard address, so the
+	// listener cannot be bound to an interface address; a second socket per
+	// address sends the replies instead.
+	nets := discoveryNets(bindAddr, interfaces)
+	replyConns := make([]net.PacketConn, len(nets))
+	var subnets []string
+	for i, n := range nets {
+		replyConns[i] = conn
+		if len(interfaces) > 0 || isSpecificIP(bindAddr) {
+			bound, err := net.ListenPacket("udp", net.JoinHostPort(n.ip.String(), "0"))
+			if err != nil {
+				log.Fatalf("Discovery reply socket failed to bind on %s: %v", n.ip, err)
+			}
+			defer bound.Close()
+			replyConns[i] = bound
+		}
+		subnets = append(subnets, n.subnet.String())
+		log.Printf("Discovery listener binding to %s (LAN IP: %s, subnet %s)", addr, n.ip, n.subnet)
+	}
 
 	// recentReplies deduplicates within a 2-second window as a safety net.
 	var mu sync.Mutex
@@ -50,10 +80,14 @@ func StartDiscovery(listenPort, apiPort int) {
 		srcIP := srcUDP.IP.String()
 
 		// Respond to local loopback packets for same-host clients (e.g. NINA),
-		// and to packets from the same /24 subnet as our LAN IP.
-		if !isLoopbackIP(srcUDP.IP) && !sameSubnet24(srcIP, lanIP) {
-			log.Printf("Discovery: ignoring packet from %s (not on LAN subnet %s/24)", srcIP, lanIP)
-			continue
+		// and to packets from one of our networks.
+		route := 0
+		if !isLoopbackIP(srcUDP.IP) {
+			var ok bool
+			if route, ok = discoveryRoute(nets, srcUDP.IP); !ok {
+				log.Printf("Discovery: ignoring packet from %s (not on LAN subnet %s)", srcIP, strings.Join(subnets, ", "))
+				continue
+			}
 		}
 
 		// Deduplicate: only reply once per source IP per 2 seconds.
@@ -67,20 +101,148 @@ func StartDiscovery(listenPort, apiPort int) {
 		mu.Unlock()
 
 		log.Printf("Received discovery packet from %s, sending response", src)
-		if _, err := conn.WriteTo([]byte(reply), src); err != nil {
+		if _, err := replyConns[route].WriteTo(reply, src); err != nil {
 			log.Printf("Discovery response error: %v", err)
 		}
 	}
 }
 
-// sameSubnet24 returns true if ip and ref share the same first three octets.
-func sameSubnet24(ip, ref string) bool {
-	a := net.ParseIP(ip).To4()
-	b := net.ParseIP(ref).To4()
-	if a == nil || b == nil {
-		return false
+// discoveryNet is one network discovery answers on: a local address and
+// the subnet it serves.
+type discoveryNet struct {
+	ip     net.IP
+	subnet *net.IPNet
+}
+
+// resolveDiscoveryInterfaces returns the networks of the configured
+// discovery interfaces. An entry is a local IPv4 address or an interface
+// name, which contributes each of its IPv4 addresses. Entries that do not
+// resolve are logged and skipped, as the interface may not be up yet.
+func resolveDiscoveryInterfaces(entries []string) []discoveryNet {
+	var nets []discoveryNet
+	for _, e := range entries {
+		if ip := net.ParseIP(e); ip != nil {
+			found := false
+			if addrs, err := net.InterfaceAddrs(); err == nil {
+				for _, a := range addrs {
+					if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+						nets = append(nets, discoveryNet{ip: ip, subnet: &net.IPNet{IP: n.IP.Mask(n.Mask), Mask: n.Mask}})
+						found = true
+						break
+					}
+				}
+			}
+			if !found {
+				log.Printf("Warning: discovery interface address %s is not a local address; skipping it", e)
+			}
+			continue
+		}
+		ifi, err := net.InterfaceByName(e)
+		if err != nil {
+			log.Printf("Warning: discovery interface %q: %v; skipping it", e, err)
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			log.Printf("Warning: discovery interface %q: %v; skipping it", e, err)
+			continue
+		}
+		found := false
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.To4() != nil {
+				nets = append(nets, discoveryNet{ip: n.IP, subnet: &net.IPNet{IP: n.IP.Mask(n.Mask), Mask: n.Mask}})
+				found = true
+			}
+		}
+		if !found {
+			log.Printf("Warning: discovery interface %q has no IPv4 address; skipping it", e)
+		}
 	}
-	return a[0] == b[0] && a[1] == b[1] && a[2] == b[2]
+	return nets
+}
+
+// discoveryNets returns the networks discovery answers on: the configured
+// interfaces, else bindAddr's network when the API is bound to one address,
+// else the /24 around the primary LAN IP.
+func discoveryNets(bindAddr string, interfaces []string) []discoveryNet {
+	var nets []discoveryNet
+	if len(interfaces) > 0 {
+		nets = resolveDiscoveryInterfaces(interfaces)
+		if len(nets) == 0 {
+			log.Printf("Warning: none of discovery_interfaces %v resolved to a local IPv4 address; auto-detecting", interfaces)
+		}
+		if isSpecificIP(bindAddr) {
+			for _, n := range nets {
+				if !n.ip.Equal(net.ParseIP(bindAddr)) {
+					log.Printf("Warning: discovery interface address %s is not bind_address %s; clients finding the driver there cannot reach the API", n.ip, bindAddr)
+				}
+			}
+		}
+	}
+	switch {
+	case len(nets) > 0:
+		return nets
+	case isSpecificIP(bindAddr):
+		return []discoveryNet{{ip: net.ParseIP(bindAddr), subnet: interfaceSubnet(bindAddr)}}
+	}
+	lanIP := outboundIP()
+	return []discoveryNet{{ip: net.ParseIP(lanIP), subnet: subnet24(lanIP)}}
+}
+
+// discoveryRoute returns the index of the first of nets whose subnet
+// contains src, and whether there is one.
+func discoveryRoute(nets []discoveryNet, src net.IP) (int, bool) {
+	for i, n := range nets {
+		if n.subnet.Contains(src) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// discoveryReply encodes the discovery response: AlpacaPort, which always
+// reports apiPort, together with the extra fields.
+func discoveryReply(apiPort int, extra map[string]interface{}) ([]byte, error) {
+	fields := make(map[string]interface{}, len(extra)+1)
+	for k, v := range extra {
+		fields[k] = v
+	}
+	fields["AlpacaPort"] = apiPort
+	return json.Marshal(fields)
+}
+
+// subnet24 returns the /24 network around ip, or an empty network if ip is
+// not IPv4.
+func subnet24(ip string) *net.IPNet {
+	v4 := net.ParseIP(ip).To4()
+	if v4 == nil {
+		return &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(32, 32)}
+	}
+	mask := net.CIDRMask(24, 32)
+	return &net.IPNet{IP: v4.Mask(mask), Mask: mask}
+}
+
+// interfaceSubnet returns the network of the local interface that owns ip,
+// falling back to the /24 around it.
+func interfaceSubnet(ip string) *net.IPNet {
+	want := net.ParseIP(ip)
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.Equal(want) {
+				return &net.IPNet{IP: n.IP.Mask(n.Mask), Mask: n.Mask}
+			}
+		}
+	}
+	log.Printf("Discovery: no local interface has address %s, assuming a /24 subnet", ip)
+	return subnet24(ip)
+}
+
+// isSpecificIP reports whether addr is an IP address other than the
+// wildcard, i.e. one the API can be bound to.
+func isSpecificIP(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && !ip.IsUnspecified()
 }
 
 func isLoopbackIP(ip net.IP) bool {
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+func TestDiscoveryReply(t *testing.T) {
+	reply, err := discoveryReply(11111, map[string]interface{}{
+		"AlpacaPort": 1, // cannot override the real port
+		"Note":       `quoted "name"`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(reply, &got); err != nil {
+		t.Fatalf("reply %s is not valid JSON: %v", reply, err)
+	}
+	if got["AlpacaPort"] != float64(11111) || got["Note"] != `quoted "name"` {
+		t.Errorf("reply = %s, want AlpacaPort 11111 and the extra field", reply)
+	}
+
+	if reply, _ := discoveryReply(4567, nil); string(reply) != `{"AlpacaPort":4567}` {
+		t.Errorf("reply without extra fields = %s", reply)
+	}
+}
+
+// With the API bound to one address, discovery answers only requests from
+// that address's network, and replies from the address itself.
+func TestDiscoveryFollowsBindAddress(t *testing.T) {
+	nets := discoveryNets("127.0.0.1", nil)
+	if len(nets) != 1 || !nets[0].ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Fatalf("networks for bind_address 127.0.0.1 = %v, want that address only", nets)
+	}
+	if _, ok := discoveryRoute(nets, net.ParseIP("127.0.0.9")); !ok {
+		t.Errorf("request from 127.0.0.9 rejected; want it accepted on %v", nets[0].subnet)
+	}
+	if _, ok := discoveryRoute(nets, net.ParseIP("192.0.2.7")); ok {
+		t.Errorf("request from 192.0.2.7 accepted on %v", nets[0].subnet)
+	}
+
+	// An unspecified bind address does not pin discovery to it.
+	for _, n := range discoveryNets("0.0.0.0", nil) {
+		if n.ip.IsUnspecified() {
+			t.Errorf("bind_address 0.0.0.0 used as the discovery address")
+		}
+	}
+}
+
+// Configured discovery interfaces, by name or address, decide which
+// networks discovery answers on; entries that don't resolve are skipped.
+func TestDiscoveryInterfaces(t *testing.T) {
+	var loopback string
+	ifaces, _ := net.Interfaces()
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagLoopback != 0 {
+			loopback = ifi.Name
+		}
+	}
+	if loopback == "" {
+		t.Skip("no loopback interface")
+	}
+	loop := net.ParseIP("127.0.0.1")
+	for _, entries := range [][]string{{loopback}, {"127.0.0.1"}, {"nosuch0", "192.0.2.1", "127.0.0.1"}} {
+		nets := discoveryNets("", entries)
+		if len(nets) != 1 || !nets[0].ip.Equal(loop) {
+			t.Errorf("networks for %q = %v, want 127.0.0.1's only", entries, nets)
+			continue
+		}
+		if _, ok := discoveryRoute(nets, net.ParseIP("127.0.0.9")); !ok {
+			t.Errorf("%q: request from 127.0.0.9 rejected", entries)
+		}
+	}
+
+	// With nothing resolving, discovery falls back to auto-detection.
+	for _, n := range discoveryNets("127.0.0.1", []string{"nosuch0"}) {
+		if !n.ip.Equal(loop) {
+			t.Errorf("fallback with bind_address 127.0.0.1 answers on %v", n.ip)
+		}
+	}
+}
+
+// A request is answered from the address of the network it came from.
+func TestDiscoveryRoute(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.1.0/24")
+	_, dome, _ := net.ParseCIDR("10.20.0.0/16")
+	nets := []discoveryNet{
+		{ip: net.ParseIP("192.168.1.10"), subnet: lan},
+		{ip: net.ParseIP("10.20.0.1"), subnet: dome},
+	}
+	for _, tc := range []struct {
+		src string
+		i   int
+		ok  bool
+	}{
+		{"192.168.1.77", 0, true},
+		{"10.20.5.5", 1, true},
+		{"172.16.0.1", 0, false},
+	} {
+		if i, ok := discoveryRoute(nets, net.ParseIP(tc.src)); i != tc.i || ok != tc.ok {
+			t.Errorf("discoveryRoute(%s) = %d, %v; want %d, %v", tc.src, i, ok, tc.i, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"alpaca-switch/backend"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// ExportFunc builds a complete config file from the live state of rt's
+// backends. With redact set, passwords and tokens are replaced.
+type ExportFunc func(rt *backend.Router, redact bool) interface{}
+
+func (s *Server) configureExportAPI(r *httprouter.Router) {
+	r.GET("/config/export", s.handleExportConfig)
+}
+
+// handleExportConfig serves the running configuration — current names,
+// cached values and server settings — as a reloadable settings.json.
+// ?redact=true masks secrets so the file can be shared.
+func (s *Server) handleExportConfig(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if s.opts.Export == nil {
+		http.Error(w, "config export is not available", http.StatusNotImplemented)
+		return
+	}
+	redact := r.URL.Query().Get("redact") == "true"
+	data, err := json.MarshalIndent(s.opts.Export(s.router(), redact), "", "    ")
+	if err != nil {
+		log.Printf("[server] encoding config export: %v", err)
+		http.Error(w, "internal error encoding config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="settings.json"`)
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"alpaca-switch/backend"
+)
+
+func TestExportConfig(t *testing.T) {
+	s, _ := newTestServer(Options{})
+	if rec := do(s, http.MethodGet, "/config/export", nil); rec.Code != http.StatusNotImplemented {
+		t.Errorf("export without an ExportFunc: status %d, want 501", rec.Code)
+	}
+
+	var redacted []bool
+	s, _ = newTestServer(Options{Export: func(rt *backend.Router, redact bool) interface{} {
+		redacted = append(redacted, redact)
+		return map[string]int{"switches": rt.NumSwitches()}
+	}}, 0, 1)
+	rec := do(s, http.MethodGet, "/config/export", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"switches": 2`) {
+		t.Errorf("export: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Header().Get("Content-Disposition"), "settings.json") {
+		t.Errorf("Content-Disposition = %q, want a settings.json attachment", rec.Header().Get("Content-Disposition"))
+	}
+	do(s, http.MethodGet, "/config/export", form("redact=true"))
+	if len(redacted) != 2 || redacted[0] || !redacted[1] {
+		t.Errorf("redact flags passed = %v, want [false true]", redacted)
+	}
+}
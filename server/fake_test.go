@@ -0,0 +1,187 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alpaca-switch/backend"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// fakeBackend is an in-memory SwitchBackend of on/off switches that counts
+// the calls the server makes, so tests can tell cached reads from hardware
+// round trips.
+type fakeBackend struct {
+	mu        sync.Mutex
+	values    []float64
+	errs      []error // returned by GetSwitchValue, per switch
+	writeErr  error   // returned by SetSwitchValue
+	connected bool
+
+	liveReads int // GetSwitch calls
+	writes    int // SetSwitch and SetSwitchValue calls
+	connects  int
+
+	// connectDelay, readDelay and writeDelay make Connect, live reads and
+	// writes slow.
+	connectDelay time.Duration
+	readDelay    time.Duration
+	writeDelay   time.Duration
+
+	// opts are the per-switch options, if any.
+	opts []backend.SwitchOptions
+}
+
+func newFakeBackend(values ...float64) *fakeBackend {
+	return &fakeBackend{values: values, errs: make([]error, len(values))}
+}
+
+func (f *fakeBackend) NumSwitches() int { return len(f.values) }
+
+func (f *fakeBackend) GetName(id int) string              { return fmt.Sprintf("fake %d", id) }
+func (f *fakeBackend) SetName(int, string) error          { return nil }
+func (f *fakeBackend) GetDescription(id int) string       { return "" }
+func (f *fakeBackend) GetCanWrite(int) bool               { return true }
+func (f *fakeBackend) GetMin(int) float64                 { return 0 }
+func (f *fakeBackend) GetMax(int) float64                 { return 1 }
+func (f *fakeBackend) GetStep(int) float64                { return 1 }
+func (f *fakeBackend) SetSwitch(id int, state bool) error { return f.SetSwitchValue(id, b2f(state)) }
+
+func (f *fakeBackend) GetSwitch(id int) (bool, error) {
+	time.Sleep(f.readDelay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.liveReads++
+	return f.values[id] > 0, f.errs[id]
+}
+
+func (f *fakeBackend) GetSwitchValue(id int) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.values[id], f.errs[id]
+}
+
+func (f *fakeBackend) SetSwitchValue(id int, value float64) error {
+	time.Sleep(f.writeDelay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes++
+	if f.writeErr != nil {
+		return f.writeErr
+	}
+	f.values[id] = value
+	return nil
+}
+
+func (f *fakeBackend) Connect() error {
+	time.Sleep(f.connectDelay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connects++
+	f.connected = true
+	return nil
+}
+
+func (f *fakeBackend) Disconnect() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connected = false
+}
+
+func (f *fakeBackend) IsConnected() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connected
+}
+
+func (f *fakeBackend) SwitchOptions(id int) backend.SwitchOptions {
+	if id < len(f.opts) {
+		return f.opts[id]
+	}
+	return backend.SwitchOptions{}
+}
+
+// newTestServer returns a server over a fake backend with the given values.
+func newTestServer(opts Options, values ...float64) (*Server, *fakeBackend) {
+	fake := newFakeBackend(values...)
+	return New(backend.NewRouter([]backend.SwitchBackend{fake}, backend.Options{}), opts), fake
+}
+
+// counts returns the live read, write and connect counters.
+func (f *fakeBackend) counts() (liveReads, writes, connects int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.liveReads, f.writes, f.connects
+}
+
+// value returns the current value of switch id.
+func (f *fakeBackend) value(id int) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.values[id]
+}
+
+func b2f(on bool) float64 {
+	if on {
+		return 1
+	}
+	return 0
+}
+
+// call invokes handler h with a request for method and form values and
+// decodes the JSON reply into out.
+func call(t *testing.T, h httprouter.Handle, method string, form url.Values, out interface{}) {
+	t.Helper()
+	var req *http.Request
+	if method == http.MethodGet {
+		req = httptest.NewRequest(method, "/?"+form.Encode(), nil)
+	} else {
+		req = httptest.NewRequest(method, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req, nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+}
+
+// form parses an encoded form such as "Id=0&State=true".
+func form(encoded string) url.Values {
+	v, err := url.ParseQuery(encoded)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// do sends a request through the server's full middleware chain.
+func do(s *Server, method, path string, form url.Values) *httptest.ResponseRecorder {
+	var req *http.Request
+	if method == http.MethodGet {
+		req = httptest.NewRequest(method, path+"?"+form.Encode(), nil)
+	} else {
+		req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// serve is do, decoding the JSON reply into out.
+func serve(t *testing.T, s *Server, method, path string, form url.Values, out interface{}) {
+	t.Helper()
+	rec := do(s, method, path, form)
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// readiness is the /readyz response body.
+type readiness struct {
+	Ready     bool     `json:"ready"`
+	Connected bool     `json:"connected"`
+	Warnings  []string `json:"warnings"`
+}
+
+func (s *Server) configureHealthAPI(r *httprouter.Router) {
+	r.GET("/healthz", s.handleHealthz)
+	r.GET("/readyz", s.handleReadyz)
+}
+
+// handleHealthz reports liveness: the process is up and serving HTTP.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports readiness: 200 once all backends are connected,
+// 503 otherwise. Degraded conditions that do not stop the driver working
+// (e.g. an unwritable state file) are listed as warnings without failing it.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	resp := readiness{
+		Connected: s.allConnected(),
+		Warnings:  s.router().Warnings(),
+	}
+	if resp.Warnings == nil {
+		resp.Warnings = []string{}
+	}
+	resp.Ready = resp.Connected
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	s.sendJSON(w, status, resp)
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// historyEntry is one recorded change of a switch's value.
+type historyEntry struct {
+	ID    int       `json:"id"`
+	Time  time.Time `json:"time"`
+	Old   double    `json:"old"`
+	Value double    `json:"value"`
+}
+
+// history keeps the most recent value changes of every switch in a ring
+// buffer per switch, optionally appending them to a file so they survive a
+// restart.
+type history struct {
+	mu    sync.Mutex
+	size  int
+	rings map[int]*historyRing
+	file  *os.File
+}
+
+// historyRing holds up to len(buf) entries; next is where the next one goes.
+type historyRing struct {
+	buf  []historyEntry
+	next int
+	full bool
+}
+
+func (r *historyRing) add(e historyEntry) {
+	r.buf[r.next] = e
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// entries returns the ring's contents, oldest first.
+func (r *historyRing) entries() []historyEntry {
+	if !r.full {
+		return append([]historyEntry(nil), r.buf[:r.next]...)
+	}
+	return append(append([]historyEntry(nil), r.buf[r.next:]...), r.buf[:r.next]...)
+}
+
+// newHistory creates a history keeping size changes per switch. With path
+// set, earlier changes are loaded from it, the file is compacted to what is
+// kept, and new changes are appended.
+func newHistory(size int, path string) *history {
+	h := &history{size: size, rings: make(map[int]*historyRing)}
+	if path == "" {
+		return h
+	}
+	if f, err := os.Open(path); err == nil {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			var e historyEntry
+			if json.Unmarshal(sc.Bytes(), &e) == nil {
+				h.ring(e.ID).add(e)
+			}
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		log.Printf("[server] reading history file: %v", err)
+	}
+	var kept []byte
+	for _, r := range h.rings {
+		for _, e := range r.entries() {
+			line, _ := json.Marshal(e)
+			kept = append(append(kept, line...), '\n')
+		}
+	}
+	if err := os.WriteFile(path, kept, 0644); err != nil {
+		log.Printf("[server] history file not writable, keeping history in memory only: %v", err)
+		return h
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("[server] history file not writable, keeping history in memory only: %v", err)
+		return h
+	}
+	h.file = f
+	return h
+}
+
+func (h *history) ring(id int) *historyRing {
+	r := h.rings[id]
+	if r == nil {
+		r = &historyRing{buf: make([]historyEntry, h.size)}
+		h.rings[id] = r
+	}
+	return r
+}
+
+// record is the Router change hook.
+func (h *history) record(id int, oldValue, newValue float64) {
+	e := historyEntry{ID: id, Time: time.Now().UTC(), Old: double(oldValue), Value: double(newValue)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ring(id).add(e)
+	if h.file != nil {
+		line, _ := json.Marshal(e)
+		if _, err := h.file.Write(append(line, '\n')); err != nil {
+			log.Printf("[server] writing history file: %v", err)
+		}
+	}
+}
+
+// since returns switch id's recorded changes after t, oldest first.
+func (h *history) since(id int, t time.Time) []historyEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := []historyEntry{}
+	if r := h.rings[id]; r != nil {
+		for _, e := range r.entries() {
+			if e.Time.After(t) {
+				out = append(out, e)
+			}
+		}
+	}
+	return out
+}
+
+type historyResponse struct {
+	alpacaResponse
+	Value []historyEntry `json:"Value"`
+}
+
+// handleHistory returns switch Id's recorded value changes, oldest first.
+// since (RFC 3339 or Unix seconds) limits them to changes after that time.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if s.history == nil {
+		s.badRequest(w, r, fmt.Errorf("history is disabled (history_size is negative)"))
+		return
+	}
+	id, err := getSwitchID(r)
+	if err != nil {
+		s.badRequest(w, r, err)
+		return
+	}
+	if id >= s.router().NumSwitches() {
+		s.badRequest(w, r, fmt.Errorf("switch ID %d is out of range", id))
+		return
+	}
+	var since time.Time
+	if v := getParamAnyCase(r, "since"); v != "" {
+		if since, err = parseSince(v); err != nil {
+			s.badRequest(w, r, err)
+			return
+		}
+	}
+	resp := historyResponse{Value: s.history.since(id, since)}
+	s.prepareResponse(r, &resp.alpacaResponse)
+	s.sendJSON(w, http.StatusOK, resp)
+}
+
+// parseSince accepts an RFC 3339 time or Unix seconds.
+func parseSince(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	secs, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("since parameter invalid: %s (want RFC 3339 or Unix seconds)", v)
+	}
+	return time.Unix(0, int64(secs*float64(time.Second))), nil
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHistoryRecordsChanges(t *testing.T) {
+	s, _ := newTestServer(Options{HistorySize: 10}, 0)
+	var put putResponse
+	serve(t, s, http.MethodPut, "/api/v1/switch/0/connect", form("Connected=true"), &put)
+	for _, state := range []string{"true", "false"} {
+		serve(t, s, http.MethodPut, "/api/v1/switch/0/setswitch", form("Id=0&State="+state), &put)
+		if put.ErrorNumber != 0 {
+			t.Fatalf("setswitch %s: %#x %q", state, put.ErrorNumber, put.ErrorMessage)
+		}
+	}
+
+	var resp historyResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/history", form("Id=0"), &resp)
+	if len(resp.Value) != 2 || resp.Value[0].Value != 1 || resp.Value[1].Old != 1 || resp.Value[1].Value != 0 {
+		t.Fatalf("history = %+v, want on then off", resp.Value)
+	}
+
+	since := url.Values{"Id": {"0"}, "since": {resp.Value[0].Time.Format(time.RFC3339Nano)}}
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/history", since, &resp)
+	if len(resp.Value) != 1 || resp.Value[0].Value != 0 {
+		t.Errorf("history since the first change = %+v, want only the second", resp.Value)
+	}
+}
+
+// Each switch keeps only the newest HistorySize changes.
+func TestHistoryCap(t *testing.T) {
+	h := newHistory(3, "")
+	for i := 1; i <= 5; i++ {
+		h.record(0, float64(i-1), float64(i))
+	}
+	h.record(1, 0, 1)
+
+	got := h.since(0, time.Time{})
+	if len(got) != 3 || got[0].Value != 3 || got[2].Value != 5 {
+		t.Errorf("switch 0 history = %+v, want the last three changes, oldest first", got)
+	}
+	if got := h.since(1, time.Time{}); len(got) != 1 {
+		t.Errorf("switch 1 history = %+v, want its own single change", got)
+	}
+}
+
+// With a history file, changes survive a restart.
+func TestHistoryFile(t *testing.T) {
+	path := t.TempDir() + "/history.jsonl"
+	h := newHistory(2, path)
+	h.record(0, 0, 1)
+	h.record(0, 1, 0)
+	h.record(0, 0, 1)
+	h.file.Close()
+
+	reloaded := newHistory(2, path)
+	defer reloaded.file.Close()
+	got := reloaded.since(0, time.Time{})
+	if len(got) != 2 || got[0].Value != 0 || got[1].Value != 1 {
+		t.Errorf("reloaded history = %+v, want the last two changes", got)
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// unlimitedPaths are served even while the request limit is reached, so
+// health probes keep answering under load.
+var unlimitedPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// withConcurrencyLimit caps the number of requests handled at once to
+// Options.MaxConcurrentRequests. Requests beyond the cap are rejected with
+// 503 straight away rather than queued, so a flood of requests cannot pile
+// up goroutines or overwhelm slow backends.
+func (s *Server) withConcurrencyLimit(h http.Handler) http.Handler {
+	max := s.opts.MaxConcurrentRequests
+	if max <= 0 {
+		return h
+	}
+	slots := make(chan struct{}, max)
+	var lastLogged atomic.Int64 // UnixNano of the last rejection logged
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unlimitedPaths[strings.ToLower(r.URL.Path)] {
+			h.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			h.ServeHTTP(w, r)
+		default:
+			msg := fmt.Sprintf("server busy: %d requests already in progress (max_concurrent_requests)", max)
+			// Log at most once a second: a flood would otherwise flood the log too.
+			now := time.Now().UnixNano()
+			if last := lastLogged.Load(); now-last >= int64(time.Second) && lastLogged.CompareAndSwap(last, now) {
+				log.Printf("[server] %s %s from %s: %s", r.Method, r.URL.Path, r.RemoteAddr, msg)
+			}
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, msg, http.StatusServiceUnavailable)
+		}
+	})
+}
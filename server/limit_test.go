@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Beyond max_concurrent_requests new requests get a 503 while the one in
+// flight completes; health probes are exempt.
+func TestConcurrencyLimit(t *testing.T) {
+	s, fake := newTestServer(Options{MaxConcurrentRequests: 1}, 0)
+	fake.writeDelay = 200 * time.Millisecond
+	var put putResponse
+	serve(t, s, http.MethodPut, "/api/v1/switch/0/connect", form("Connected=true"), &put)
+
+	done := make(chan int)
+	go func() {
+		done <- do(s, http.MethodPut, "/api/v1/switch/0/setswitch", form("Id=0&State=true")).Code
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	rec := do(s, http.MethodGet, "/api/v1/switch/0/getswitch", form("Id=0"))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("request beyond the limit: status %d, Retry-After %q; want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := do(s, http.MethodGet, "/healthz", nil); strings.Contains(rec.Body.String(), "server busy") {
+		t.Errorf("/healthz limited: %d %s", rec.Code, rec.Body)
+	}
+
+	if code := <-done; code != http.StatusOK || fake.value(0) != 1 {
+		t.Errorf("in-flight setswitch: status %d, value %v; want 200 and the switch on", code, fake.value(0))
+	}
+	if rec := do(s, http.MethodGet, "/api/v1/switch/0/getswitch", form("Id=0")); rec.Code != http.StatusOK {
+		t.Errorf("request after the in-flight one finished: status %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"alpaca-switch/backend"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// checkWritable returns an InvalidOperation error while maintenance mode is on.
+func (s *Server) checkWritable() error {
+	if s.maintenance.Load() {
+		return fmt.Errorf("%w: maintenance mode is on, switch writes are frozen", backend.ErrInvalidOperation)
+	}
+	return nil
+}
+
+// setMaintenance changes the maintenance flag and persists it if configured.
+func (s *Server) setMaintenance(on bool) {
+	s.maintenance.Store(on)
+	log.Printf("[server] maintenance mode set to %v", on)
+	if s.opts.MaintenanceFile == "" {
+		return
+	}
+	if err := os.WriteFile(s.opts.MaintenanceFile, []byte(strconv.FormatBool(on)+"\n"), 0644); err != nil {
+		log.Printf("[server] saving maintenance flag: %v", err)
+	}
+}
+
+func (s *Server) handleGetMaintenance(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	resp := booleanResponse{Value: s.maintenance.Load()}
+	s.prepareResponse(r, &resp.alpacaResponse)
+	s.sendJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleSetMaintenance(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	v := getParamAnyCase(r, "On")
+	if v == "" {
+		s.badRequest(w, r, errors.New("On parameter missing"))
+		return
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		s.badRequest(w, r, fmt.Errorf("On parameter invalid: %s", v))
+		return
+	}
+	s.setMaintenance(on)
+	var resp putResponse
+	s.prepareResponse(r, &resp.alpacaResponse)
+	s.sendJSON(w, http.StatusOK, resp)
+}
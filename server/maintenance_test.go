@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"alpaca-switch/backend"
+)
+
+// In maintenance mode writes are rejected with InvalidOperation and never
+// reach the backend, while reads keep working.
+func TestMaintenanceBlocksWrites(t *testing.T) {
+	s, fake := newTestServer(Options{Maintenance: true}, 0)
+
+	for _, tc := range []struct{ method, form string }{
+		{"setswitch", "Id=0&State=true"},
+		{"setswitchvalue", "Id=0&Value=1"},
+	} {
+		var resp alpacaResponse
+		serve(t, s, http.MethodPut, "/api/v1/switch/0/"+tc.method, form(tc.form), &resp)
+		if resp.ErrorNumber != errInvalidOperation {
+			t.Errorf("%s in maintenance mode = %#x %q, want InvalidOperation", tc.method, resp.ErrorNumber, resp.ErrorMessage)
+		}
+	}
+	if _, writes, _ := fake.counts(); writes != 0 {
+		t.Errorf("%d writes reached the backend in maintenance mode", writes)
+	}
+
+	var state booleanResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/getswitch", form("Id=0"), &state)
+	if state.ErrorNumber != 0 {
+		t.Errorf("getswitch in maintenance mode = %#x %q", state.ErrorNumber, state.ErrorMessage)
+	}
+
+	var resp alpacaResponse
+	serve(t, s, http.MethodPut, "/api/v1/switch/0/maintenance", form("On=false"), &resp)
+	serve(t, s, http.MethodPut, "/api/v1/switch/0/setswitch", form("Id=0&State=true"), &resp)
+	if resp.ErrorNumber != 0 || fake.value(0) != 1 {
+		t.Errorf("setswitch after maintenance ended = %#x %q, value %v", resp.ErrorNumber, resp.ErrorMessage, fake.value(0))
+	}
+}
+
+// The maintenance flag survives a restart through MaintenanceFile, and the
+// saved flag wins over the configured default.
+func TestMaintenanceFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance")
+	s, _ := newTestServer(Options{MaintenanceFile: path}, 0)
+	var resp alpacaResponse
+	serve(t, s, http.MethodPut, "/api/v1/switch/0/maintenance", form("On=true"), &resp)
+	if data, err := os.ReadFile(path); err != nil || strings.TrimSpace(string(data)) != "true" {
+		t.Fatalf("maintenance file = %q, %v", data, err)
+	}
+
+	restarted, _ := newTestServer(Options{MaintenanceFile: path, Maintenance: false}, 0)
+	var on booleanResponse
+	serve(t, restarted, http.MethodGet, "/api/v1/switch/0/maintenance", nil, &on)
+	if !on.Value {
+		t.Error("maintenance mode off after restart, want the saved on")
+	}
+}
+
+// actionBackend is a fakeBackend with a writing and a read-only custom
+// action, recording the actions it runs.
+type actionBackend struct {
+	*fakeBackend
+	ran []string
+}
+
+func (a *actionBackend) Actions() []string { return []string{"get_prop", "set_power"} }
+
+func (a *actionBackend) Action(name string, _ int, _ string) (string, error) {
+	a.ran = append(a.ran, name)
+	return "ok", nil
+}
+
+func (a *actionBackend) ActionWrites(name string, _ int) bool { return name == "set_power" }
+
+// Actions that change device state are refused in maintenance mode like
+// writes; read-only ones still run.
+func TestMaintenanceBlocksWritingActions(t *testing.T) {
+	fake := &actionBackend{fakeBackend: newFakeBackend(0)}
+	s := New(backend.NewRouter([]backend.SwitchBackend{fake}, backend.Options{}), Options{Maintenance: true})
+
+	for _, tc := range []struct {
+		path, form string
+		ok         bool
+	}{
+		{"action", "Action=set_power&Parameters=0", false},
+		{"commandstring", "Command=set_power", false},
+		{"action", "Action=testswitch&Parameters=0 0", false},
+		{"action", "Action=get_prop", true},
+	} {
+		var resp stringResponse
+		serve(t, s, http.MethodPut, "/api/v1/switch/0/"+tc.path, form(tc.form), &resp)
+		if ok := resp.ErrorNumber == 0; ok != tc.ok {
+			t.Errorf("%s %q in maintenance mode = %#x %q, want ok %v", tc.path, tc.form, resp.ErrorNumber, resp.ErrorMessage, tc.ok)
+		}
+	}
+	if !slices.Equal(fake.ran, []string{"get_prop"}) {
+		t.Errorf("actions run in maintenance mode = %v, want only get_prop", fake.ran)
+	}
+	if _, writes, _ := fake.counts(); writes != 0 {
+		t.Errorf("%d writes reached the backend in maintenance mode", writes)
+	}
+}
@@ -3,16 +3,18 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 const (
-	serverName     = "Alpaca Switch Controller"
-	manufacturer   = "https://github.com/exploded/"
-	driverVersion  = "1.0.0"
-	location       = "Earth"
-	deviceUniqueID = "a1b2c3d4-e5f6-7890-abcd-ef1234567890"
+	serverName   = "Alpaca Switch Controller"
+	manufacturer = "https://github.com/exploded/"
+	location     = "Earth"
+
+	// defaultUniqueID is reported when no UniqueID is configured.
+	defaultUniqueID = "a1b2c3d4-e5f6-7890-abcd-ef1234567890"
 )
 
 func (s *Server) configureManagementAPI(r *httprouter.Router) {
@@ -22,12 +24,40 @@ func (s *Server) configureManagementAPI(r *httprouter.Router) {
 	r.GET("/management/v1/configureddevices", s.handleConfiguredDevices)
 }
 
+// rootInfo is the machine-readable root document served to clients that
+// send Accept: application/json.
+type rootInfo struct {
+	ServerName    string   `json:"ServerName"`
+	DriverVersion string   `json:"DriverVersion"`
+	DeviceType    string   `json:"DeviceType"`
+	DeviceNumber  int      `json:"DeviceNumber"`
+	MaxSwitch     int      `json:"MaxSwitch"`
+	APIVersions   []uint32 `json:"APIVersions"`
+	ManagementAPI string   `json:"ManagementAPI"`
+	DeviceAPI     string   `json:"DeviceAPI"`
+}
+
+// handleRoot returns the server name as plain text for humans, or a JSON
+// summary when the client asks for application/json.
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	fmt.Fprintln(w, serverName)
+	if !strings.Contains(r.Header.Get("Accept"), "application/json") {
+		fmt.Fprintln(w, serverName)
+		return
+	}
+	s.sendJSON(w, http.StatusOK, rootInfo{
+		ServerName:    serverName,
+		DriverVersion: Version,
+		DeviceType:    "Switch",
+		DeviceNumber:  s.opts.DeviceNumber,
+		MaxSwitch:     s.router().NumSwitches(),
+		APIVersions:   s.apiVersions(),
+		ManagementAPI: "/management/v1/",
+		DeviceAPI:     s.apiPath(""),
+	})
 }
 
 func (s *Server) handleAPIVersions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	resp := uint32ListResponse{Value: []uint32{1}}
+	resp := uint32ListResponse{Value: s.apiVersions()}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
@@ -37,7 +67,7 @@ func (s *Server) handleDescription(w http.ResponseWriter, r *http.Request, _ htt
 		Value: ServerDescription{
 			ServerName:          serverName,
 			Manufacturer:        manufacturer,
-			ManufacturerVersion: driverVersion,
+			ManufacturerVersion: Version,
 			Location:            location,
 		},
 	}
@@ -46,13 +76,17 @@ func (s *Server) handleDescription(w http.ResponseWriter, r *http.Request, _ htt
 }
 
 func (s *Server) handleConfiguredDevices(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	uniqueID := s.opts.UniqueID
+	if uniqueID == "" {
+		uniqueID = defaultUniqueID
+	}
 	resp := managementDevicesListResponse{
 		Value: []DeviceConfiguration{
 			{
 				DeviceName:   serverName,
 				DeviceType:   "Switch",
-				DeviceNumber: 0,
-				UniqueID:     deviceUniqueID,
+				DeviceNumber: uint32(s.opts.DeviceNumber),
+				UniqueID:     uniqueID,
 			},
 		},
 	}
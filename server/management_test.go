@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// The configured device number is used in the device routes and reported by
+// configureddevices.
+func TestDeviceNumber(t *testing.T) {
+	s, _ := newTestServer(Options{DeviceNumber: 3}, 0, 1)
+
+	var max int32Response
+	serve(t, s, http.MethodGet, "/api/v1/switch/3/maxswitch", nil, &max)
+	if max.ErrorNumber != 0 || max.Value != 2 {
+		t.Errorf("maxswitch on device 3 = %d (error %#x %s), want 2", max.Value, max.ErrorNumber, max.ErrorMessage)
+	}
+	if rec := do(s, http.MethodGet, "/api/v1/switch/0/maxswitch", nil); rec.Code == http.StatusOK {
+		t.Errorf("device 0 still answered with device_number 3: %s", rec.Body)
+	}
+
+	var devices managementDevicesListResponse
+	serve(t, s, http.MethodGet, "/management/v1/configureddevices", nil, &devices)
+	if len(devices.Value) != 1 || devices.Value[0].DeviceNumber != 3 {
+		t.Errorf("configureddevices = %+v, want one device numbered 3", devices.Value)
+	}
+}
+
+// The root page is plain text for browsers and a JSON summary for clients
+// asking for JSON.
+func TestRootContentTypes(t *testing.T) {
+	s, _ := newTestServer(Options{DeviceNumber: 1}, 0, 0, 0)
+
+	rec := do(s, http.MethodGet, "/", nil)
+	if body := rec.Body.String(); !strings.HasPrefix(body, serverName) {
+		t.Errorf("plain root = %q, want the server name", body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want JSON", ct)
+	}
+	var info rootInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body, err)
+	}
+	if info.ServerName != serverName || info.DeviceType != "Switch" || info.DeviceNumber != 1 || info.MaxSwitch != 3 {
+		t.Errorf("root info = %+v", info)
+	}
+	if info.DeviceAPI != "/api/v1/switch/1/" {
+		t.Errorf("DeviceAPI = %q", info.DeviceAPI)
+	}
+}
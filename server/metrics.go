@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"alpaca-switch/backend"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func (s *Server) configureMetricsAPI(r *httprouter.Router) {
+	r.GET("/metrics", s.handleMetrics)
+}
+
+// handleMetrics serves per-switch gauges in the Prometheus text exposition
+// format. Switches that have never completed a hardware operation are left
+// out of the seconds-since-contact gauge and report 0 as their timestamp.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rt := s.router()
+	now := time.Now()
+	var b strings.Builder
+
+	b.WriteString("# HELP alpaca_switch_last_contact_timestamp_seconds Unix time of the last successful hardware read or write (0 = never).\n")
+	b.WriteString("# TYPE alpaca_switch_last_contact_timestamp_seconds gauge\n")
+	for id := 0; id < rt.NumSwitches(); id++ {
+		var ts float64
+		if t := rt.LastContact(id); !t.IsZero() {
+			ts = float64(t.UnixNano()) / 1e9
+		}
+		fmt.Fprintf(&b, "alpaca_switch_last_contact_timestamp_seconds{%s} %s\n", metricLabels(rt, id), formatMetric(ts))
+	}
+
+	b.WriteString("# HELP alpaca_switch_seconds_since_contact Seconds since the last successful hardware read or write.\n")
+	b.WriteString("# TYPE alpaca_switch_seconds_since_contact gauge\n")
+	for id := 0; id < rt.NumSwitches(); id++ {
+		t := rt.LastContact(id)
+		if t.IsZero() {
+			continue
+		}
+		fmt.Fprintf(&b, "alpaca_switch_seconds_since_contact{%s} %s\n", metricLabels(rt, id), formatMetric(now.Sub(t).Seconds()))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// metricLabels returns the label set identifying switch id.
+func metricLabels(rt *backend.Router, id int) string {
+	return fmt.Sprintf(`id="%d",backend="%s",name="%s"`, id,
+		escapeLabel(rt.BackendType(id)), escapeLabel(rt.GetName(id)))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string { return labelEscaper.Replace(v) }
+
+func formatMetric(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Only switches that have completed a hardware operation get a
+// seconds-since-contact gauge; the others report a zero timestamp.
+func TestMetricsLastContact(t *testing.T) {
+	s, _ := newTestServer(Options{}, 0, 0)
+	var put putResponse
+	serve(t, s, http.MethodPut, "/api/v1/switch/0/setswitch", form("Id=0&State=true"), &put)
+	if put.ErrorNumber != 0 {
+		t.Fatalf("setswitch failed: %s", put.ErrorMessage)
+	}
+
+	body := do(s, http.MethodGet, "/metrics", nil).Body.String()
+	if !strings.Contains(body, `alpaca_switch_seconds_since_contact{id="0",`) {
+		t.Errorf("no seconds-since-contact gauge for the written switch:\n%s", body)
+	}
+	if strings.Contains(body, `alpaca_switch_seconds_since_contact{id="1",`) {
+		t.Errorf("seconds-since-contact gauge for a switch never contacted:\n%s", body)
+	}
+	if !strings.Contains(body, `alpaca_switch_last_contact_timestamp_seconds{id="1",backend="`) || !strings.Contains(body, `name="fake 1"} 0`+"\n") {
+		t.Errorf("switch 1 should report a zero timestamp:\n%s", body)
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Values of Options.UnknownParams.
+const (
+	// UnknownParamsIgnore silently ignores parameters a method does not use
+	// (the default, as ASCOM asks of drivers).
+	UnknownParamsIgnore = "ignore"
+	// UnknownParamsWarn logs them, to help debug misbehaving clients.
+	UnknownParamsWarn = "warn"
+)
+
+// commonParams are accepted by every ASCOM method, whether or not the
+// handler reads them.
+var commonParams = map[string]bool{
+	"clientid":            true,
+	"clienttransactionid": true,
+}
+
+type paramsKey struct{}
+
+// paramsRead records the parameter names a handler looked up through
+// getParamAnyCase, lower-cased.
+type paramsRead struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+// noteParam records that the handler of r looked up parameter name.
+func noteParam(r *http.Request, name string) {
+	p, ok := r.Context().Value(paramsKey{}).(*paramsRead)
+	if !ok {
+		return
+	}
+	p.mu.Lock()
+	p.names[strings.ToLower(name)] = true
+	p.mu.Unlock()
+}
+
+// withUnknownParams, with Options.UnknownParams set to UnknownParamsWarn,
+// logs the parameters of /api/ requests that the handler never looked up,
+// e.g. a misspelt "Id" or a Value sent to a read method.
+func (s *Server) withUnknownParams(h http.Handler) http.Handler {
+	if s.opts.UnknownParams != UnknownParamsWarn {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(strings.ToLower(r.URL.Path), "/api/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		read := &paramsRead{names: make(map[string]bool)}
+		r = r.WithContext(context.WithValue(r.Context(), paramsKey{}, read))
+		h.ServeHTTP(w, r)
+
+		supplied := r.URL.Query()
+		if r.Method != http.MethodGet && r.ParseForm() == nil {
+			supplied = r.Form
+		}
+		read.mu.Lock()
+		var unknown []string
+		for name := range supplied {
+			key := strings.ToLower(name)
+			if !read.names[key] && !commonParams[key] {
+				unknown = append(unknown, name)
+			}
+		}
+		read.mu.Unlock()
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			log.Printf("[server] warning: %s %s from %s: ignoring unknown parameter(s) %s",
+				r.Method, r.URL.Path, r.RemoteAddr, strings.Join(unknown, ", "))
+		}
+	})
+}
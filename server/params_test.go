@@ -0,0 +1,34 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUnknownParams(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	const query = "Id=0&ClientID=1&ClientTransactionID=7&Idd=3&value=1"
+	for _, mode := range []string{UnknownParamsIgnore, UnknownParamsWarn} {
+		buf.Reset()
+		s, _ := newTestServer(Options{UnknownParams: mode}, 1)
+		var resp booleanResponse
+		serve(t, s, http.MethodGet, "/api/v1/switch/0/getswitch", form(query), &resp)
+		if resp.ErrorNumber != 0 || !resp.Value {
+			t.Errorf("%s: getswitch = %v (error %#x %q), want true", mode, resp.Value, resp.ErrorNumber, resp.ErrorMessage)
+		}
+		warned := strings.Contains(buf.String(), "ignoring unknown parameter(s) Idd, value")
+		if warned != (mode == UnknownParamsWarn) {
+			t.Errorf("%s: logged unknown parameters = %v:\n%s", mode, warned, buf.String())
+		}
+		if strings.Contains(buf.String(), "ClientID") {
+			t.Errorf("%s: common parameters reported as unknown:\n%s", mode, buf.String())
+		}
+	}
+}
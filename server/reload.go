@@ -0,0 +1,31 @@
+package server
+
+import (
+	"log"
+
+	"alpaca-switch/backend"
+)
+
+// Reload puts a new Router (built from a reloaded config) into service.
+// Handlers see either the old or the new device set, never a mix: the swap
+// is a single atomic store. The old Router stops polling and its backends
+// are disconnected and its keep-alive timers stopped; if the old backends
+// were connected, the new ones are connected before the swap (re-arming the
+// timers of switches that are on) so clients do not see a disconnect.
+func (s *Server) Reload(r *backend.Router, plan ConnectPlan) {
+	next := &routerState{router: r, plan: plan}
+	r.SetWriteGuard(s.checkWritable)
+	if s.history != nil {
+		r.OnChange(s.history.record)
+	}
+	wasConnected := s.allConnected()
+	if wasConnected {
+		next.connectAll(true)
+	}
+	r.StartPolling()
+	old := s.current.Swap(next)
+	old.router.StopPolling()
+	old.router.StopKeepalives()
+	old.connectAll(false)
+	log.Printf("[server] config reloaded: %d switches (was %d)", r.NumSwitches(), old.router.NumSwitches())
+}
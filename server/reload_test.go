@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"alpaca-switch/backend"
+)
+
+// A reload that adds a device is visible to clients straight away: the
+// switch count grows, the Switch device stays listed with the same unique
+// ID, and a connected server stays connected.
+func TestReloadAddsDevice(t *testing.T) {
+	s, old := newTestServer(Options{UniqueID: "hub-1"}, 1)
+	old.Connect()
+
+	var before managementDevicesListResponse
+	serve(t, s, http.MethodGet, "/management/v1/configureddevices", nil, &before)
+
+	plug, strip := newFakeBackend(1), newFakeBackend(0, 1)
+	s.Reload(backend.NewRouter([]backend.SwitchBackend{plug, strip}, backend.Options{}), nil)
+
+	var max int32Response
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/maxswitch", nil, &max)
+	if max.Value != 3 {
+		t.Errorf("maxswitch after reload = %d, want 3", max.Value)
+	}
+	var after managementDevicesListResponse
+	serve(t, s, http.MethodGet, "/management/v1/configureddevices", nil, &after)
+	if len(after.Value) != 1 || after.Value[0] != before.Value[0] || after.Value[0].UniqueID != "hub-1" {
+		t.Errorf("configureddevices after reload = %+v, want %+v", after.Value, before.Value)
+	}
+	var connected booleanResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/connected", nil, &connected)
+	if !connected.Value || !strip.IsConnected() || old.IsConnected() {
+		t.Errorf("after reload: Connected %v, new backend connected %v, old backend connected %v; want true, true, false",
+			connected.Value, strip.IsConnected(), old.IsConnected())
+	}
+	var value booleanResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/getswitch", form("Id=2"), &value)
+	if value.ErrorNumber != 0 || !value.Value {
+		t.Errorf("getswitch on the new switch 2 = %v (%s), want true", value.Value, value.ErrorMessage)
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// defaultScanTimeout is how long /discovery/devices listens for replies.
+const defaultScanTimeout = 3 * time.Second
+
+func (s *Server) configureScanAPI(r *httprouter.Router) {
+	r.GET("/discovery/devices", s.handleDiscoverDevices)
+}
+
+// handleDiscoverDevices probes the network with every backend's discovery
+// protocol and lists devices that are not in the config yet, for a setup UI
+// to offer as one-click additions. ?timeout=<seconds> overrides how long it
+// listens (default 3, max 30).
+func (s *Server) handleDiscoverDevices(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	timeout := defaultScanTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		secs, err := strconv.ParseFloat(v, 64)
+		if err != nil || secs <= 0 || secs > 30 {
+			http.Error(w, fmt.Sprintf("timeout must be between 0 and 30 seconds, got %q", v), http.StatusBadRequest)
+			return
+		}
+		timeout = time.Duration(secs * float64(time.Second))
+	}
+	s.sendJSON(w, http.StatusOK, s.router().Discover(timeout))
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// discoveringBackend is a fake backend that always finds one plug.
+type discoveringBackend struct {
+	*fakeBackend
+	timeout time.Duration
+}
+
+func (d *discoveringBackend) Discover(timeout time.Duration) ([]backend.DiscoveredDevice, error) {
+	d.timeout = timeout
+	return []backend.DiscoveredDevice{{Type: "mi", Address: "10.0.0.5", Needs: []string{"token"}}}, nil
+}
+
+func TestDiscoverDevices(t *testing.T) {
+	fake := &discoveringBackend{fakeBackend: newFakeBackend(0)}
+	s := New(backend.NewRouter([]backend.SwitchBackend{fake}, backend.Options{}), Options{})
+
+	rec := do(s, http.MethodGet, "/discovery/devices", form("timeout=0.5"))
+	var found []backend.DiscoveredDevice
+	if err := json.Unmarshal(rec.Body.Bytes(), &found); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+	if len(found) != 1 || found[0].Address != "10.0.0.5" {
+		t.Errorf("/discovery/devices = %+v, want the plug", found)
+	}
+	if fake.timeout != 500*time.Millisecond {
+		t.Errorf("discovery ran for %v, want the requested 500ms", fake.timeout)
+	}
+
+	if rec := do(s, http.MethodGet, "/discovery/devices", form("timeout=60")); rec.Code != http.StatusBadRequest {
+		t.Errorf("timeout=60 status = %d, want 400", rec.Code)
+	}
+}
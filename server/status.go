@@ -0,0 +1,113 @@
+package server
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// statusRow is one switch on the /status page.
+type statusRow struct {
+	ID       string
+	Name     string
+	Backend  string
+	State    string
+	LastSeen string
+}
+
+var statusPage = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="10">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.4em 1em; border-bottom: 1px solid #ccc; text-align: left; }
+.on { color: #080; font-weight: bold; }
+.off { color: #888; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Connected: {{if .Connected}}yes{{else}}no{{end}} &middot; {{len .Rows}} switches &middot; updated {{.Now}}</p>
+<table>
+<tr><th>ID</th><th>Name</th><th>Backend</th><th>State</th><th>Last seen</th></tr>
+{{range .Rows}}<tr><td>{{.ID}}</td><td>{{.Name}}</td><td>{{.Backend}}</td><td class="{{.State}}">{{.State}}</td><td>{{.LastSeen}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (s *Server) configureStatusPage(r *httprouter.Router) {
+	r.GET("/status", s.handleStatus)
+}
+
+// handleStatus renders a read-only, auto-refreshing HTML overview of every
+// switch from cached state. It never touches hardware.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rt := s.router()
+	rows := make([]statusRow, rt.NumSwitches())
+	for id := range rows {
+		row := statusRow{
+			ID:       strconv.Itoa(id),
+			Name:     rt.GetName(id),
+			Backend:  rt.BackendType(id),
+			LastSeen: "never (restored value)",
+		}
+		if v, err := rt.CachedSwitchValue(id); err != nil {
+			row.State = "error"
+		} else if name := rt.StateName(id, v); name != "" {
+			row.State = name
+		} else if rt.GetMax(id)-rt.GetMin(id) > 1 {
+			row.State = formatValue(v)
+		} else if v > rt.GetMin(id) {
+			row.State = "on"
+		} else {
+			row.State = "off"
+		}
+		if t := rt.LastUpdated(id); !t.IsZero() {
+			row.LastSeen = time.Since(t).Round(time.Second).String() + " ago"
+		}
+		rows[id] = row
+	}
+	for _, h := range rt.HiddenSwitches() {
+		row := statusRow{ID: "hidden", Name: h.Name, Backend: h.Backend, LastSeen: "-"}
+		switch {
+		case h.Err != nil:
+			row.State = "error"
+		case h.Max-h.Min > 1:
+			row.State = formatValue(h.Value)
+		case h.Value > h.Min:
+			row.State = "on"
+		default:
+			row.State = "off"
+		}
+		rows = append(rows, row)
+	}
+	data := struct {
+		Title     string
+		Connected bool
+		Now       string
+		Rows      []statusRow
+	}{
+		Title:     serverName,
+		Connected: s.allConnected(),
+		Now:       time.Now().Format("15:04:05"),
+		Rows:      rows,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusPage.Execute(w, data); err != nil {
+		log.Printf("[server] rendering status page: %v", err)
+	}
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"alpaca-switch/backend"
+)
+
+// The status page lists every switch by name with its state, from cache.
+func TestStatusPage(t *testing.T) {
+	fake := newFakeBackend(1, 0, 0)
+	fake.errs[2] = errors.New("unreachable")
+	s := New(backend.NewRouter([]backend.SwitchBackend{fake}, backend.Options{AutoConnect: true}), Options{})
+
+	rec := do(s, http.MethodGet, "/status", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status page: %d %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`<td>fake 0</td><td>backend</td><td class="on">on</td>`,
+		`<td>fake 1</td><td>backend</td><td class="off">off</td>`,
+		`<td>fake 2</td><td>backend</td><td class="error">error</td>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("status page lacks %s:\n%s", want, body)
+		}
+	}
+	if live, _, connects := fake.counts(); live != 0 || connects != 0 {
+		t.Errorf("status page made %d live reads and %d connects, want none", live, connects)
+	}
+}
@@ -4,24 +4,35 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 func (s *Server) configureSwitchAPI(r *httprouter.Router) {
-	r.GET("/setup/v1/switch/0/setup", s.handleSetup)
-	r.GET("/api/v1/switch/0/maxswitch", s.handleMaxSwitch)
-	r.GET("/api/v1/switch/0/canwrite", s.handleCanWrite)
-	r.GET("/api/v1/switch/0/getswitch", s.handleGetSwitch)
-	r.GET("/api/v1/switch/0/getswitchdescription", s.handleGetSwitchDescription)
-	r.GET("/api/v1/switch/0/getswitchname", s.handleGetSwitchName)
-	r.GET("/api/v1/switch/0/getswitchvalue", s.handleGetSwitchValue)
-	r.GET("/api/v1/switch/0/minswitchvalue", s.handleMinSwitchValue)
-	r.GET("/api/v1/switch/0/maxswitchvalue", s.handleMaxSwitchValue)
-	r.GET("/api/v1/switch/0/switchstep", s.handleSwitchStep)
-	r.PUT("/api/v1/switch/0/setswitch", s.handleSetSwitch)
-	r.PUT("/api/v1/switch/0/setswitchname", s.handleSetSwitchName)
-	r.PUT("/api/v1/switch/0/setswitchvalue", s.handleSetSwitchValue)
+	r.GET(fmt.Sprintf("/setup/v1/switch/%d/setup", s.opts.DeviceNumber), s.handleSetup)
+	r.GET(s.apiPath("maxswitch"), s.handleMaxSwitch)
+	r.GET(s.apiPath("canwrite"), s.handleCanWrite)
+	r.GET(s.apiPath("getswitch"), s.handleGetSwitch)
+	r.GET(s.apiPath("getswitchdescription"), s.handleGetSwitchDescription)
+	r.GET(s.apiPath("getswitchname"), s.handleGetSwitchName)
+	r.GET(s.apiPath("getswitchvalue"), s.handleGetSwitchValue)
+	r.GET(s.apiPath("minswitchvalue"), s.handleMinSwitchValue)
+	r.GET(s.apiPath("maxswitchvalue"), s.handleMaxSwitchValue)
+	r.GET(s.apiPath("switchstep"), s.handleSwitchStep)
+	r.PUT(s.apiPath("setswitch"), s.handleSetSwitch)
+	r.PUT(s.apiPath("setswitchname"), s.handleSetSwitchName)
+	r.PUT(s.apiPath("setswitchvalue"), s.handleSetSwitchValue)
+
+	// Custom (non-ASCOM) endpoints
+	r.GET(s.apiPath("getswitchvalues"), s.handleGetSwitchValues)
+	r.GET(s.apiPath("switchlastupdated"), s.handleSwitchLastUpdated)
+	r.GET(s.apiPath("switchstatenames"), s.handleSwitchStateNames)
+	r.GET(s.apiPath("history"), s.handleHistory)
+	r.GET(s.apiPath("maintenance"), s.handleGetMaintenance)
+	r.PUT(s.apiPath("maintenance"), s.handleSetMaintenance)
+	r.PUT(s.apiPath("invalidate"), s.handleInvalidate)
+	r.PUT(s.apiPath("keepalive"), s.handleKeepAlive)
 }
 
 func (s *Server) handleSetup(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
@@ -29,7 +40,7 @@ func (s *Server) handleSetup(w http.ResponseWriter, r *http.Request, _ httproute
 }
 
 func (s *Server) handleMaxSwitch(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	resp := int32Response{Value: int32(s.router.NumSwitches())}
+	resp := int32Response{Value: int32(s.router().NumSwitches())}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
@@ -40,7 +51,7 @@ func (s *Server) handleCanWrite(w http.ResponseWriter, r *http.Request, _ httpro
 		s.badRequest(w, r, err)
 		return
 	}
-	resp := booleanResponse{Value: s.router.GetCanWrite(id)}
+	resp := booleanResponse{Value: s.router().GetCanWrite(id)}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
@@ -51,7 +62,7 @@ func (s *Server) handleGetSwitch(w http.ResponseWriter, r *http.Request, _ httpr
 		s.badRequest(w, r, err)
 		return
 	}
-	state, err := s.router.GetSwitch(id)
+	state, err := s.router().GetSwitch(id)
 	if err != nil {
 		s.badRequest(w, r, err)
 		return
@@ -67,7 +78,7 @@ func (s *Server) handleGetSwitchDescription(w http.ResponseWriter, r *http.Reque
 		s.badRequest(w, r, err)
 		return
 	}
-	resp := stringResponse{Value: s.router.GetDescription(id)}
+	resp := stringResponse{Value: s.router().GetDescription(id)}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
@@ -78,7 +89,7 @@ func (s *Server) handleGetSwitchName(w http.ResponseWriter, r *http.Request, _ h
 		s.badRequest(w, r, err)
 		return
 	}
-	resp := stringResponse{Value: s.router.GetName(id)}
+	resp := stringResponse{Value: s.router().GetName(id)}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
@@ -89,12 +100,114 @@ func (s *Server) handleGetSwitchValue(w http.ResponseWriter, r *http.Request, _
 		s.badRequest(w, r, err)
 		return
 	}
-	val, err := s.router.GetSwitchValue(id)
+	val, err := s.router().GetSwitchValue(id)
 	if err != nil {
 		s.badRequest(w, r, err)
 		return
 	}
-	resp := doubleResponse{Value: val}
+	resp := doubleResponse{Value: double(val)}
+	s.prepareResponse(r, &resp.alpacaResponse)
+	s.sendJSON(w, http.StatusOK, resp)
+}
+
+// handleGetSwitchValues returns the cached value of every switch, indexed
+// by switch ID, so pollers can fetch all states in one request. It never
+// touches hardware. A switch whose value cannot be read is reported as null
+// with its error in SwitchErrors, keyed by ID, instead of failing the batch.
+func (s *Server) handleGetSwitchValues(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rt := s.router()
+	resp := switchValuesResponse{Value: make([]*double, rt.NumSwitches())}
+	for id := range resp.Value {
+		val, err := rt.CachedSwitchValue(id)
+		if err != nil {
+			if resp.SwitchErrors == nil {
+				resp.SwitchErrors = make(map[int]string)
+			}
+			resp.SwitchErrors[id] = err.Error()
+			continue
+		}
+		v := double(val)
+		resp.Value[id] = &v
+	}
+	s.prepareResponse(r, &resp.alpacaResponse)
+	s.sendJSON(w, http.StatusOK, resp)
+}
+
+// handleSwitchLastUpdated returns when switch Id's value was last confirmed
+// by hardware (RFC 3339), or "" if it is still the persisted value.
+func (s *Server) handleSwitchLastUpdated(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rt := s.router()
+	id, err := getSwitchID(r)
+	if err != nil {
+		s.badRequest(w, r, err)
+		return
+	}
+	if id >= rt.NumSwitches() {
+		s.badRequest(w, r, fmt.Errorf("switch ID %d is out of range", id))
+		return
+	}
+	var resp stringResponse
+	if t := rt.LastUpdated(id); !t.IsZero() {
+		resp.Value = t.UTC().Format(time.RFC3339)
+	}
+	s.prepareResponse(r, &resp.alpacaResponse)
+	s.sendJSON(w, http.StatusOK, resp)
+}
+
+// handleInvalidate marks switch Id's cached value as unknown, or every
+// switch's if Id is omitted, so the next read queries hardware live.
+func (s *Server) handleInvalidate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	id := -1
+	if getParamAnyCase(r, "Id") != "" {
+		var err error
+		if id, err = getSwitchID(r); err != nil {
+			s.badRequest(w, r, err)
+			return
+		}
+	}
+	if err := s.router().Invalidate(id); err != nil {
+		s.badRequest(w, r, err)
+		return
+	}
+	var resp putResponse
+	s.prepareResponse(r, &resp.alpacaResponse)
+	s.sendJSON(w, http.StatusOK, resp)
+}
+
+// handleKeepAlive restarts the dead-man timer of keepalive_seconds switch
+// Id, keeping it on.
+func (s *Server) handleKeepAlive(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	id, err := getSwitchID(r)
+	if err != nil {
+		s.badRequest(w, r, err)
+		return
+	}
+	if err := s.router().KeepAlive(id); err != nil {
+		s.badRequest(w, r, err)
+		return
+	}
+	var resp putResponse
+	s.prepareResponse(r, &resp.alpacaResponse)
+	s.sendJSON(w, http.StatusOK, resp)
+}
+
+// handleSwitchStateNames returns the configured labels for switch Id's
+// values (empty if none are configured).
+func (s *Server) handleSwitchStateNames(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rt := s.router()
+	id, err := getSwitchID(r)
+	if err != nil {
+		s.badRequest(w, r, err)
+		return
+	}
+	if id >= rt.NumSwitches() {
+		s.badRequest(w, r, fmt.Errorf("switch ID %d is out of range", id))
+		return
+	}
+	resp := stringListResponse{Value: rt.GetStateNames(id)}
+	if resp.Value == nil {
+		resp.Value = []string{}
+	}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
@@ -105,7 +218,7 @@ func (s *Server) handleMinSwitchValue(w http.ResponseWriter, r *http.Request, _
 		s.badRequest(w, r, err)
 		return
 	}
-	resp := doubleResponse{Value: s.router.GetMin(id)}
+	resp := doubleResponse{Value: double(s.router().GetMin(id))}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
@@ -116,7 +229,7 @@ func (s *Server) handleMaxSwitchValue(w http.ResponseWriter, r *http.Request, _
 		s.badRequest(w, r, err)
 		return
 	}
-	resp := doubleResponse{Value: s.router.GetMax(id)}
+	resp := doubleResponse{Value: double(s.router().GetMax(id))}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
@@ -127,7 +240,7 @@ func (s *Server) handleSwitchStep(w http.ResponseWriter, r *http.Request, _ http
 		s.badRequest(w, r, err)
 		return
 	}
-	resp := doubleResponse{Value: s.router.GetStep(id)}
+	resp := doubleResponse{Value: double(s.router().GetStep(id))}
 	s.prepareResponse(r, &resp.alpacaResponse)
 	s.sendJSON(w, http.StatusOK, resp)
 }
@@ -145,7 +258,20 @@ func (s *Server) handleSetSwitch(w http.ResponseWriter, r *http.Request, _ httpr
 		return
 	}
 	log.Printf("[server] SetSwitch id=%d state=%v", id, state)
-	if err := s.router.SetSwitch(id, state); err != nil {
+	if err := s.checkWritable(); err != nil {
+		s.badRequest(w, r, err)
+		return
+	}
+	rt := s.router()
+	value := rt.GetMin(id)
+	if state {
+		value = rt.GetMax(id)
+	}
+	if err := rt.CheckConfirm(id, value, getConfirm(r)); err != nil {
+		s.badRequest(w, r, err)
+		return
+	}
+	if err := rt.SetSwitch(id, state); err != nil {
 		s.badRequest(w, r, err)
 		return
 	}
@@ -165,7 +291,7 @@ func (s *Server) handleSetSwitchName(w http.ResponseWriter, r *http.Request, _ h
 		s.badRequest(w, r, err)
 		return
 	}
-	if err := s.router.SetName(id, name); err != nil {
+	if err := s.router().SetName(id, name); err != nil {
 		s.badRequest(w, r, err)
 		return
 	}
@@ -185,7 +311,16 @@ func (s *Server) handleSetSwitchValue(w http.ResponseWriter, r *http.Request, _
 		s.badRequest(w, r, err)
 		return
 	}
-	if err := s.router.SetSwitchValue(id, val); err != nil {
+	if err := s.checkWritable(); err != nil {
+		s.badRequest(w, r, err)
+		return
+	}
+	rt := s.router()
+	if err := rt.CheckConfirm(id, val, getConfirm(r)); err != nil {
+		s.badRequest(w, r, err)
+		return
+	}
+	if err := rt.SetSwitchValue(id, val); err != nil {
 		s.badRequest(w, r, err)
 		return
 	}
@@ -194,11 +329,12 @@ func (s *Server) handleSetSwitchValue(w http.ResponseWriter, r *http.Request, _
 	s.sendJSON(w, http.StatusOK, resp)
 }
 
-// badRequest sends a 400 response with the error message.
+// badRequest logs err and sends a 400 response with the error message.
 func (s *Server) badRequest(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("[server] %s %s: %v", r.Method, r.URL.Path, err)
 	resp := stringResponse{Value: err.Error()}
 	s.prepareResponse(r, &resp.alpacaResponse)
-	resp.ErrorNumber = 0x400
+	resp.ErrorNumber = errorNumber(err)
 	resp.ErrorMessage = err.Error()
 	s.sendJSON(w, http.StatusBadRequest, resp)
 }
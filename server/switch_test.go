@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"alpaca-switch/backend"
+)
+
+// getswitchvalues answers from the cache: it does not auto-connect, read
+// live or inject faults, and one unreadable switch does not fail the rest.
+func TestGetSwitchValuesCached(t *testing.T) {
+	fake := newFakeBackend(1, 0, 1)
+	fake.errs[1] = errors.New("unreachable")
+	rt := backend.NewRouter([]backend.SwitchBackend{fake}, backend.Options{
+		AutoConnect: true,
+		Faults:      &backend.FaultInjection{ErrorRate: 1},
+	})
+	s := New(rt, Options{})
+
+	var resp switchValuesResponse
+	call(t, s.handleGetSwitchValues, http.MethodGet, nil, &resp)
+
+	if resp.ErrorNumber != 0 {
+		t.Fatalf("ErrorNumber = %d (%s), want 0", resp.ErrorNumber, resp.ErrorMessage)
+	}
+	if len(resp.Value) != 3 {
+		t.Fatalf("got %d values, want 3", len(resp.Value))
+	}
+	for id, want := range map[int]float64{0: 1, 2: 1} {
+		if resp.Value[id] == nil || float64(*resp.Value[id]) != want {
+			t.Errorf("Value[%d] = %v, want %v", id, resp.Value[id], want)
+		}
+	}
+	if resp.Value[1] != nil {
+		t.Errorf("Value[1] = %v, want null", *resp.Value[1])
+	}
+	if len(resp.SwitchErrors) != 1 || resp.SwitchErrors[1] == "" {
+		t.Errorf("SwitchErrors = %v, want an error for switch 1 only", resp.SwitchErrors)
+	}
+	if live, _, connects := fake.counts(); live != 0 || connects != 0 {
+		t.Errorf("bulk read made %d live reads and %d connects, want none", live, connects)
+	}
+}
+
+// Injected faults reach clients as ASCOM errors, and only when configured.
+func TestFaultsInResponses(t *testing.T) {
+	id := url.Values{"Id": {"0"}}
+	faulty := New(backend.NewRouter([]backend.SwitchBackend{newFakeBackend(1)}, backend.Options{
+		Faults: &backend.FaultInjection{ErrorRate: 1, Operations: []string{backend.FaultRead}},
+	}), Options{})
+	var failed alpacaResponse
+	call(t, faulty.handleGetSwitch, http.MethodGet, id, &failed)
+	if failed.ErrorNumber == 0 || !strings.Contains(failed.ErrorMessage, "injected fault") {
+		t.Errorf("GetSwitch with faults = %#x %q, want the injected fault", failed.ErrorNumber, failed.ErrorMessage)
+	}
+
+	clean := New(backend.NewRouter([]backend.SwitchBackend{newFakeBackend(1)}, backend.Options{}), Options{})
+	var resp booleanResponse
+	call(t, clean.handleGetSwitch, http.MethodGet, id, &resp)
+	if resp.ErrorNumber != 0 || !resp.Value {
+		t.Errorf("GetSwitch without faults = %v, %#x %q; want true", resp.Value, resp.ErrorNumber, resp.ErrorMessage)
+	}
+}
+
+// Backend errors reach the client prefixed with the switch and backend.
+func TestErrorResponseNamesTheSwitch(t *testing.T) {
+	s, fake := newTestServer(Options{}, 0, 0)
+	fake.errs[1] = errors.New("no route to host")
+
+	var resp alpacaResponse
+	call(t, s.handleGetSwitch, http.MethodGet, url.Values{"Id": {"1"}}, &resp)
+	if want := "switch 1 [backend 'fake 1']: no route to host"; resp.ErrorNumber == 0 || resp.ErrorMessage != want {
+		t.Errorf("GetSwitch error = %#x %q, want %q", resp.ErrorNumber, resp.ErrorMessage, want)
+	}
+}
+
+// The batch matches what getswitchvalue reports switch by switch.
+func TestGetSwitchValuesMatchesSingleReads(t *testing.T) {
+	s, _ := newTestServer(Options{}, 1, 0, 0.5)
+
+	var batch switchValuesResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/getswitchvalues", nil, &batch)
+	if len(batch.Value) != 3 {
+		t.Fatalf("got %d values, want 3", len(batch.Value))
+	}
+	for id := range batch.Value {
+		var single doubleResponse
+		serve(t, s, http.MethodGet, "/api/v1/switch/0/getswitchvalue", url.Values{"Id": {strconv.Itoa(id)}}, &single)
+		if batch.Value[id] == nil || *batch.Value[id] != single.Value {
+			t.Errorf("switch %d: batch %v, getswitchvalue %v", id, batch.Value[id], single.Value)
+		}
+	}
+}
+
+func TestSwitchStateNames(t *testing.T) {
+	s, fake := newTestServer(Options{}, 0, 0)
+	fake.opts = []backend.SwitchOptions{{StateNames: []string{"off", "on"}}}
+
+	var names stringListResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/switchstatenames", form("Id=0"), &names)
+	if !reflect.DeepEqual(names.Value, []string{"off", "on"}) {
+		t.Errorf("switchstatenames for switch 0 = %v, want [off on]", names.Value)
+	}
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/switchstatenames", form("Id=1"), &names)
+	if names.Value == nil || len(names.Value) != 0 {
+		t.Errorf("switchstatenames for switch 1 = %#v, want an empty list", names.Value)
+	}
+
+	var debug []switchDebugInfo
+	if err := json.Unmarshal(do(s, http.MethodGet, "/debug/switches", nil).Body.Bytes(), &debug); err != nil {
+		t.Fatal(err)
+	}
+	if len(debug) != 2 || !reflect.DeepEqual(debug[0].StateNames, []string{"off", "on"}) {
+		t.Errorf("/debug/switches = %+v, want switch 0 with its state names", debug)
+	}
+}
+
+// A require_confirm switch refuses an unconfirmed power-off and accepts
+// it with Confirm=true.
+func TestSetSwitchRequiresConfirm(t *testing.T) {
+	s, fake := newTestServer(Options{}, 1)
+	fake.opts = []backend.SwitchOptions{{RequireConfirm: true}}
+	var resp putResponse
+	serve(t, s, http.MethodPut, "/api/v1/switch/0/connect", form("Connected=true"), &resp)
+
+	serve(t, s, http.MethodPut, "/api/v1/switch/0/setswitch", form("Id=0&State=false"), &resp)
+	if resp.ErrorNumber != errInvalidOperation || !strings.Contains(resp.ErrorMessage, "Confirm=true") {
+		t.Errorf("unconfirmed off = %#x %q, want InvalidOperation asking for Confirm=true", resp.ErrorNumber, resp.ErrorMessage)
+	}
+	if fake.value(0) != 1 {
+		t.Fatal("unconfirmed write reached the switch")
+	}
+
+	serve(t, s, http.MethodPut, "/api/v1/switch/0/setswitchvalue", form("Id=0&Value=0&Confirm=true"), &resp)
+	if resp.ErrorNumber != 0 || fake.value(0) != 0 {
+		t.Errorf("confirmed off = %#x %q, value %v; want the switch off", resp.ErrorNumber, resp.ErrorMessage, fake.value(0))
+	}
+}
+
+func TestInvalidateEndpoint(t *testing.T) {
+	s, _ := newTestServer(Options{}, 1, 0)
+	for _, tc := range []struct {
+		form   string
+		status int
+	}{
+		{"Id=1", http.StatusOK},
+		{"", http.StatusOK}, // every switch
+		{"Id=7", http.StatusBadRequest},
+	} {
+		if rec := do(s, http.MethodPut, "/api/v1/switch/0/invalidate", form(tc.form)); rec.Code != tc.status {
+			t.Errorf("invalidate %q: status %d, want %d: %s", tc.form, rec.Code, tc.status, rec.Body)
+		}
+	}
+}
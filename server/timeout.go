@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// errTimeout is reported when a request exceeds Options.RequestTimeout. ASCOM
+// defines no timeout error, so it uses the first driver-specific number.
+const errTimeout = 0x500
+
+// bufferedWriter collects a handler's response so it can be discarded if the
+// request times out before the handler finishes.
+type bufferedWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (b *bufferedWriter) Header() http.Header { return b.header }
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedWriter) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// withTimeout bounds every read request to Options.RequestTimeout. The
+// request context carries the deadline; backend calls that do not observe it
+// finish in the background and their late response is dropped. Timed-out API
+// requests get an ASCOM error response, anything else a plain 503.
+//
+// Writes (any method but GET and HEAD) are not timed out: backends do not
+// observe the deadline, so a write reported as timed out could still reach
+// the hardware afterwards and leave the client believing it failed.
+func (s *Server) withTimeout(h http.Handler) http.Handler {
+	if s.opts.RequestTimeout <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+		// Parse the form up front so the handler goroutine and a timeout
+		// response never race on it.
+		clientTxn := getClientTransactionID(r)
+
+		ctx, cancel := context.WithTimeout(r.Context(), s.opts.RequestTimeout)
+		defer cancel()
+		buf := &bufferedWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			h.ServeHTTP(buf, r.WithContext(ctx))
+		}()
+
+		select {
+		case <-done:
+			for k, v := range buf.header {
+				w.Header()[k] = v
+			}
+			if buf.status == 0 {
+				buf.status = http.StatusOK
+			}
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+		case <-ctx.Done():
+			s.timedOut(w, r, clientTxn)
+		}
+	})
+}
+
+func (s *Server) timedOut(w http.ResponseWriter, r *http.Request, clientTxn int) {
+	msg := fmt.Sprintf("request timed out after %v", s.opts.RequestTimeout)
+	log.Printf("[server] %s %s: %s", r.Method, r.URL.Path, msg)
+	if !strings.HasPrefix(r.URL.Path, "/api/") && !strings.HasPrefix(r.URL.Path, "/management/") {
+		http.Error(w, msg, http.StatusServiceUnavailable)
+		return
+	}
+	resp := stringResponse{Value: msg}
+	resp.ClientTransactionID = uint32(clientTxn)
+	resp.ServerTransactionID = s.nextTxnID()
+	resp.ErrorNumber = errTimeout
+	resp.ErrorMessage = msg
+	s.sendJSON(w, http.StatusBadRequest, resp)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"alpaca-switch/backend"
+)
+
+// A write slower than the request timeout still runs to completion and is
+// reported as done, rather than timing out and reaching the device later.
+func TestSlowWriteIsNotTimedOut(t *testing.T) {
+	fake := newFakeBackend(0)
+	fake.writeDelay = 150 * time.Millisecond
+	s := New(backend.NewRouter([]backend.SwitchBackend{fake}, backend.Options{}), Options{RequestTimeout: 30 * time.Millisecond})
+
+	var resp putResponse
+	serve(t, s, http.MethodPut, "/api/v1/switch/0/setswitch", url.Values{"Id": {"0"}, "State": {"true"}}, &resp)
+	if resp.ErrorNumber != 0 {
+		t.Fatalf("SetSwitch = %#x %s, want success", resp.ErrorNumber, resp.ErrorMessage)
+	}
+	if v := fake.value(0); v != 1 {
+		t.Errorf("switch value = %v after the write returned, want 1", v)
+	}
+}
+
+// A read slower than the request timeout is answered with the timeout error.
+func TestSlowReadTimesOut(t *testing.T) {
+	fake := newFakeBackend(0)
+	fake.readDelay = 150 * time.Millisecond
+	s := New(backend.NewRouter([]backend.SwitchBackend{fake}, backend.Options{}), Options{RequestTimeout: 30 * time.Millisecond})
+
+	var resp alpacaResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/getswitch", url.Values{"Id": {"0"}}, &resp)
+	if resp.ErrorNumber != errTimeout {
+		t.Errorf("GetSwitch error = %#x %s, want %#x", resp.ErrorNumber, resp.ErrorMessage, errTimeout)
+	}
+}
+
+// A negative request timeout disables the limit: a slow read is answered
+// normally.
+func TestNegativeTimeoutDisables(t *testing.T) {
+	fake := newFakeBackend(1)
+	fake.readDelay = 50 * time.Millisecond
+	s := New(backend.NewRouter([]backend.SwitchBackend{fake}, backend.Options{}), Options{RequestTimeout: -time.Second})
+
+	var resp booleanResponse
+	serve(t, s, http.MethodGet, "/api/v1/switch/0/getswitch", url.Values{"Id": {"0"}}, &resp)
+	if resp.ErrorNumber != 0 || !resp.Value {
+		t.Errorf("GetSwitch = %v, %#x %s; want true without a timeout", resp.Value, resp.ErrorNumber, resp.ErrorMessage)
+	}
+}
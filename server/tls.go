@@ -0,0 +1,60 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// tlsConfig returns the TLS settings for the API listener. With
+// Options.ClientCAFile set, client certificates are requested and verified
+// against that CA; whether one is required is decided per path by
+// withClientCert.
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.opts.ClientCAFile == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(s.opts.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client CA %s: no PEM certificates found", s.opts.ClientCAFile)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return cfg, nil
+}
+
+// certFreePath reports whether path is served without a client certificate:
+// the management API, which clients query to find the device before they
+// control it, and the health probes.
+func certFreePath(path string) bool {
+	path = strings.ToLower(path)
+	return strings.HasPrefix(path, "/management/") || unlimitedPaths[path]
+}
+
+// withClientCert rejects requests that did not present a client certificate
+// signed by Options.ClientCAFile, except on certFreePath paths. Besides
+// /api/ this covers the status page, metrics and the config export, which
+// would otherwise leak state and secrets. The TLS handshake has already
+// verified any certificate given, so only its presence is checked here.
+func (s *Server) withClientCert(h http.Handler) http.Handler {
+	if s.opts.ClientCAFile == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !certFreePath(r.URL.Path) && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			log.Printf("[server] %s %s from %s: rejected, no valid client certificate", r.Method, r.URL.Path, r.RemoteAddr)
+			http.Error(w, "a valid client certificate is required", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issue creates a certificate for template signed by parent (self-signed
+// when parent is nil).
+func issue(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// With a client CA configured, the API needs a certificate signed by it;
+// the management API and health probes stay open.
+func TestClientCertificates(t *testing.T) {
+	ca := issue(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "Observatory CA"}, IsCA: true, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}, nil)
+	serverCert := issue(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "driver"}, IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	clientCert := issue(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "observatory-pc"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+	stranger := issue(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "stranger"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, nil)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newTestServer(Options{ClientCAFile: caFile}, 1)
+	cfg, err := s.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Certificates = []tls.Certificate{serverCert}
+	ts := httptest.NewUnstartedServer(s.httpServer.Handler)
+	ts.TLS = cfg
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	get := func(path string, certs ...tls.Certificate) int {
+		t.Helper()
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			return 0 // handshake refused
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	const getswitch = "/api/v1/switch/0/getswitch?Id=0"
+	if code := get(getswitch); code != http.StatusForbidden {
+		t.Errorf("API without a client certificate: %d, want 403", code)
+	}
+	if code := get(getswitch, stranger); code == http.StatusOK {
+		t.Error("API accepted a certificate from another CA")
+	}
+	if code := get(getswitch, clientCert); code != http.StatusOK {
+		t.Errorf("API with a valid client certificate: %d, want 200", code)
+	}
+	if code := get("/management/apiversions"); code != http.StatusOK {
+		t.Errorf("management API without a client certificate: %d, want 200", code)
+	}
+	if code := get("/status"); code != http.StatusForbidden {
+		t.Errorf("status page without a client certificate: %d, want 403", code)
+	}
+}
@@ -1,5 +1,11 @@
 package server
 
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
 // ASCOM Alpaca response types
 
 type alpacaResponse struct {
@@ -26,7 +32,29 @@ type int32Response struct {
 
 type doubleResponse struct {
 	alpacaResponse
-	Value float64 `json:"Value"`
+	Value double `json:"Value"`
+}
+
+// double is a float64 that always serialises in plain decimal notation:
+// whole numbers as integers ("0", "1", "100") and fractions without an
+// exponent ("0.5", "0.0001"). NaN and infinities cannot be represented in
+// JSON and fail to marshal.
+type double float64
+
+func (d double) MarshalJSON() ([]byte, error) {
+	f := float64(d)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("cannot encode %v as a JSON number", f)
+	}
+	return []byte(strconv.FormatFloat(f, 'f', -1, 64)), nil
+}
+
+// switchValuesResponse is the getswitchvalues reply: null marks a switch
+// whose value could not be read, with the reason in SwitchErrors.
+type switchValuesResponse struct {
+	alpacaResponse
+	Value        []*double      `json:"Value"`
+	SwitchErrors map[int]string `json:"SwitchErrors,omitempty"`
 }
 
 type stringListResponse struct {
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// Switch values serialise in plain decimal notation, whole numbers without
+// a fraction, so clients parsing either integers or floats accept them.
+func TestDoubleJSON(t *testing.T) {
+	for v, want := range map[float64]string{
+		0:      "0",
+		1:      "1",
+		0.5:    "0.5",
+		100:    "100",
+		-40:    "-40",
+		0.0001: "0.0001",
+		1e21:   "1000000000000000000000",
+	} {
+		got, err := json.Marshal(double(v))
+		if err != nil || string(got) != want {
+			t.Errorf("double(%v) = %s, %v; want %s", v, got, err, want)
+		}
+	}
+	if _, err := json.Marshal(double(math.NaN())); err == nil {
+		t.Error("NaN marshalled without an error")
+	}
+	got, _ := json.Marshal(doubleResponse{Value: 1})
+	if want := `{"ClientTransactionID":0,"ServerTransactionID":0,"ErrorNumber":0,"ErrorMessage":"","Value":1}`; string(got) != want {
+		t.Errorf("doubleResponse = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// versionedPath matches the interface version in Alpaca API and management
+// paths, e.g. "/api/v2/switch/0/getswitch" or "/management/v3/description".
+var versionedPath = regexp.MustCompile(`^/(api|management)/v(\d+)/`)
+
+// apiVersions returns the advertised Alpaca interface versions.
+func (s *Server) apiVersions() []uint32 {
+	if len(s.opts.APIVersions) == 0 {
+		return []uint32{1}
+	}
+	return s.opts.APIVersions
+}
+
+func (s *Server) supportsAPIVersion(v uint32) bool {
+	for _, sv := range s.apiVersions() {
+		if sv == v {
+			return true
+		}
+	}
+	return false
+}
+
+// versionFallback handles requests that matched no route. Requests for an
+// additional supported version are served by the v1 handlers; requests for
+// an unsupported version get an Alpaca error naming the supported versions
+// instead of a bare 404.
+func (s *Server) versionFallback(mux *httprouter.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := versionedPath.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			http.NotFound(w, r)
+			return
+		}
+		v, err := strconv.ParseUint(m[2], 10, 32)
+		if err != nil || !s.supportsAPIVersion(uint32(v)) {
+			s.unsupportedVersion(w, r, m[2])
+			return
+		}
+		if v == 1 {
+			http.NotFound(w, r)
+			return
+		}
+		r.URL.Path = "/" + m[1] + "/v1/" + strings.TrimPrefix(r.URL.Path, m[0])
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) unsupportedVersion(w http.ResponseWriter, r *http.Request, version string) {
+	versions := make([]string, len(s.apiVersions()))
+	for i, v := range s.apiVersions() {
+		versions[i] = strconv.FormatUint(uint64(v), 10)
+	}
+	msg := fmt.Sprintf("Alpaca interface version %s is not supported (supported: %s)", version, strings.Join(versions, ", "))
+	log.Printf("[server] %s %s: %s", r.Method, r.URL.Path, msg)
+	resp := stringResponse{Value: msg}
+	s.prepareResponse(r, &resp.alpacaResponse)
+	resp.ErrorNumber = errNotImplemented
+	resp.ErrorMessage = msg
+	s.sendJSON(w, http.StatusBadRequest, resp)
+}
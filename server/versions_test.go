@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUnsupportedAPIVersion(t *testing.T) {
+	s, _ := newTestServer(Options{}, 1)
+
+	rec := do(s, http.MethodGet, "/api/v2/switch/0/getswitch", form("Id=0"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	var resp alpacaResponse
+	serve(t, s, http.MethodGet, "/api/v2/switch/0/getswitch", form("Id=0"), &resp)
+	if resp.ErrorNumber != errNotImplemented || !strings.Contains(resp.ErrorMessage, "supported: 1") {
+		t.Errorf("error = %#x %q, want not implemented naming the supported versions", resp.ErrorNumber, resp.ErrorMessage)
+	}
+
+	// Paths outside the Alpaca API are still a plain 404.
+	if rec := do(s, http.MethodGet, "/nosuchpage", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown page status = %d, want 404", rec.Code)
+	}
+}
+
+// A configured additional version is served by the v1 handlers.
+func TestAdditionalAPIVersion(t *testing.T) {
+	s, _ := newTestServer(Options{APIVersions: []uint32{1, 2}}, 1)
+
+	var resp booleanResponse
+	serve(t, s, http.MethodGet, "/api/v2/switch/0/getswitch", form("Id=0"), &resp)
+	if resp.ErrorNumber != 0 || !resp.Value {
+		t.Errorf("v2 getswitch = %v (error %#x %q), want true", resp.Value, resp.ErrorNumber, resp.ErrorMessage)
+	}
+	var versions uint32ListResponse
+	serve(t, s, http.MethodGet, "/management/apiversions", nil, &versions)
+	if len(versions.Value) != 2 || versions.Value[1] != 2 {
+		t.Errorf("apiversions = %v, want [1 2]", versions.Value)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// defaultUniqueIDFile caches the generated ASCOM UniqueID so it stays stable
+// even if devices are later added or removed.
+const defaultUniqueIDFile = "config/unique_id"
+
+// resolveUniqueID returns the ASCOM UniqueID for this installation: the
+// explicit unique_id from config if set, otherwise the cached ID, otherwise
+// a newly generated one (which is then cached).
+func resolveUniqueID(cfg *Config) string {
+	if cfg.UniqueID != "" {
+		return cfg.UniqueID
+	}
+	path := cfg.UniqueIDFile
+	if path == "" {
+		path = defaultUniqueIDFile
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id
+		}
+	}
+	hostname, _ := os.Hostname()
+	id := generateUniqueID(hostname, deviceIdentities(cfg))
+	if err := os.WriteFile(path, []byte(id+"\n"), 0644); err != nil {
+		log.Printf("Could not cache unique ID to %s: %v", path, err)
+	}
+	log.Printf("Generated unique ID %s", id)
+	return id
+}
+
+// deviceIdentities lists a stable identity string for every configured
+// device. Mi tokens are hashed so they never leave the config file.
+func deviceIdentities(cfg *Config) []string {
+	var ids []string
+	for _, d := range cfg.MiDevices {
+		sum := sha256.Sum256([]byte(d.Token))
+		ids = append(ids, "mi:"+hex.EncodeToString(sum[:8]))
+	}
+	for _, c := range cfg.HikvisionCameras {
+		ids = append(ids, "hikvision:"+c.Host)
+	}
+	for _, c := range cfg.ONVIFCameras {
+		ids = append(ids, "onvif:"+c.Host)
+	}
+	for _, s := range cfg.UhubctlSwitches {
+		ids = append(ids, fmt.Sprintf("uhubctl:%s/%d", s.Location, s.Port))
+	}
+	for _, s := range cfg.PDUSwitches {
+		ids = append(ids, fmt.Sprintf("pdu:%s/%d", s.Host, s.Outlet))
+	}
+	for _, s := range cfg.HTTPJSONSwitches {
+		if r, err := s.Resolve(); err == nil {
+			s = r
+		}
+		switch {
+		case s.Set != nil:
+			ids = append(ids, "httpjson:"+s.Set.URL)
+		case s.Get != nil:
+			ids = append(ids, "httpjson:"+s.Get.URL)
+		default:
+			ids = append(ids, "httpjson:"+s.Name)
+		}
+	}
+	return ids
+}
+
+// generateUniqueID derives a UUID-formatted ID from the hostname and the
+// sorted device identities. The same inputs always yield the same ID.
+func generateUniqueID(hostname string, identities []string) string {
+	sorted := append([]string(nil), identities...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(hostname + "\n" + strings.Join(sorted, "\n")))
+	b := sum[:16]
+	b[6] = (b[6] & 0x0f) | 0x50 // version 5 (name-based)
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
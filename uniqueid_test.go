@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"alpaca-switch/backend/hikvision"
+	"alpaca-switch/backend/mi"
+)
+
+func uniqueIDConfig(t *testing.T, cameraHost string) *Config {
+	return &Config{
+		UniqueIDFile:     filepath.Join(t.TempDir(), "unique_id"),
+		MiDevices:        []mi.Device{{IP: "10.0.0.2", Token: "00112233445566778899aabbccddeeff", Name: "Plug"}},
+		HikvisionCameras: []hikvision.CameraConfig{{Host: cameraHost, Name: "Cam"}},
+	}
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestGenerateUniqueIDStable(t *testing.T) {
+	a := generateUniqueID("host", deviceIdentities(uniqueIDConfig(t, "10.0.0.3")))
+	b := generateUniqueID("host", deviceIdentities(uniqueIDConfig(t, "10.0.0.3")))
+	if a != b {
+		t.Errorf("same config gave %s and %s", a, b)
+	}
+	if !uuidPattern.MatchString(a) {
+		t.Errorf("%s is not a version 5 UUID", a)
+	}
+	if c := generateUniqueID("host", deviceIdentities(uniqueIDConfig(t, "10.0.0.4"))); c == a {
+		t.Errorf("different cameras gave the same ID %s", a)
+	}
+	if d := generateUniqueID("other", deviceIdentities(uniqueIDConfig(t, "10.0.0.3"))); d == a {
+		t.Errorf("different hostnames gave the same ID %s", a)
+	}
+	reversed := generateUniqueID("host", []string{"b", "a"})
+	if reversed != generateUniqueID("host", []string{"a", "b"}) {
+		t.Error("device order changed the ID")
+	}
+}
+
+// Mi tokens are hashed, never used as identities as they are.
+func TestDeviceIdentitiesHideTokens(t *testing.T) {
+	cfg := uniqueIDConfig(t, "10.0.0.3")
+	for _, id := range deviceIdentities(cfg) {
+		if strings.Contains(id, cfg.MiDevices[0].Token) {
+			t.Errorf("identity %q contains the Mi token", id)
+		}
+	}
+}
+
+// The generated ID is cached, so later device changes keep it, and an
+// explicit unique_id always wins.
+func TestResolveUniqueIDCached(t *testing.T) {
+	cfg := uniqueIDConfig(t, "10.0.0.3")
+	first := resolveUniqueID(cfg)
+	if data, err := os.ReadFile(cfg.UniqueIDFile); err != nil || strings.TrimSpace(string(data)) != first {
+		t.Fatalf("cache file = %q, %v; want %s", data, err, first)
+	}
+	cfg.HikvisionCameras[0].Host = "10.0.0.9"
+	if again := resolveUniqueID(cfg); again != first {
+		t.Errorf("ID changed from %s to %s after a device change", first, again)
+	}
+	cfg.UniqueID = "explicit"
+	if got := resolveUniqueID(cfg); got != "explicit" {
+		t.Errorf("resolveUniqueID = %s, want the configured unique_id", got)
+	}
+}